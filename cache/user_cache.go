@@ -9,7 +9,8 @@ import (
 )
 
 type userCache struct {
-	cache cache.LoadingCache
+	cache       cache.LoadingCache
+	preferences cache.LoadingCache
 }
 
 var UserCache = newUserCache()
@@ -27,6 +28,19 @@ func newUserCache() *userCache {
 			cache.WithMaximumSize(1000),
 			cache.WithExpireAfterAccess(30*time.Minute),
 		),
+		preferences: cache.NewLoadingCache(
+			func(key cache.Key) (value cache.Value, e error) {
+				userId := key2Int64(key)
+				p := mysql_repo.UserPreferenceRepository.GetByUserId(sqls.DB(), userId)
+				if p == nil {
+					// 没有保存过偏好设置的用户同样缓存，避免每次都查询数据库
+					p = &models.UserPreference{UserId: userId}
+				}
+				return p, nil
+			},
+			cache.WithMaximumSize(1000),
+			cache.WithExpireAfterAccess(30*time.Minute),
+		),
 	}
 }
 
@@ -41,6 +55,20 @@ func (c *userCache) Get(userId int64) *models.User {
 	return val.(*models.User)
 }
 
+// GetPreference 获取用户的偏好设置，没有保存过时返回所有字段为零值的设置
+func (c *userCache) GetPreference(userId int64) *models.UserPreference {
+	if userId <= 0 {
+		return nil
+	}
+	val, err := c.preferences.Get(userId)
+	if err != nil {
+		return nil
+	}
+	return val.(*models.UserPreference)
+}
+
+// Invalidate 用户信息或偏好设置修改后同时清除两者的缓存
 func (c *userCache) Invalidate(userId int64) {
 	c.cache.Invalidate(userId)
+	c.preferences.Invalidate(userId)
 }
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"bluebell/logic"
+	"bluebell/models"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RequestAccountDeletion 申请注销账号
+// @Summary 申请注销账号
+// @Description 再次输入密码后申请注销账号，冷静期结束后账号被匿名化，发布的内容作者显示为deleted user，冷静期内可以撤销
+// @Tags 账号相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object body models.ParamDeleteAccount true "password"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseAccountDeletion
+// @Router /api/v1/user/deletion [post]
+func RequestAccountDeletion(c *gin.Context) {
+	param := new(models.ParamDeleteAccount)
+	if err := c.ShouldBindJSON(param); err != nil {
+		zap.L().Error("bind delete account param failed", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	res, err := logic.RequestAccountDeletion(c.GetInt64(ContextUserIdKey), param.Password)
+	if err != nil {
+		zap.L().Error("request account deletion error", zap.Error(err))
+		responseAccountError(c, err)
+		return
+	}
+	ResponseSuccess(c, res)
+}
+
+// CancelAccountDeletion 撤销注销账号的申请
+// @Summary 撤销注销账号的申请
+// @Description 冷静期内撤销注销账号的申请
+// @Tags 账号相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Security ApiKeyAuth
+// @Success 200 {object} _GeneralResponse
+// @Router /api/v1/user/deletion [delete]
+func CancelAccountDeletion(c *gin.Context) {
+	if err := logic.CancelAccountDeletion(c.GetInt64(ContextUserIdKey)); err != nil {
+		zap.L().Error("cancel account deletion error", zap.Error(err))
+		responseAccountError(c, err)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// GetAccountDeletion 获取注销账号的状态
+// @Summary 获取注销账号的状态
+// @Description 获取是否申请了注销账号，以及冷静期结束的时间
+// @Tags 账号相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseAccountDeletion
+// @Router /api/v1/user/deletion [get]
+func GetAccountDeletion(c *gin.Context) {
+	res, err := logic.GetAccountDeletion(c.GetInt64(ContextUserIdKey))
+	if err != nil {
+		zap.L().Error("get account deletion error", zap.Error(err))
+		responseAccountError(c, err)
+		return
+	}
+	ResponseSuccess(c, res)
+}
+
+// RequestDataExport 申请导出个人数据
+// @Summary 申请导出个人数据
+// @Description 在后台生成包含个人资料、帖子、评论、投票、收藏、关注、私信和偏好设置的zip文件，生成完成后可以下载
+// @Tags 账号相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseDataExport
+// @Router /api/v1/user/export [post]
+func RequestDataExport(c *gin.Context) {
+	res, err := logic.RequestDataExport(c.GetInt64(ContextUserIdKey))
+	if err != nil {
+		zap.L().Error("request data export error", zap.Error(err))
+		ResponseError(c, CODE_INTERNAL_ERROR)
+		return
+	}
+	ResponseSuccess(c, res)
+}
+
+// GetDataExport 获取个人数据导出的状态
+// @Summary 获取个人数据导出的状态
+// @Description 获取个人数据导出的状态，状态为ready时可以下载
+// @Tags 账号相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseDataExport
+// @Router /api/v1/user/export [get]
+func GetDataExport(c *gin.Context) {
+	res, err := logic.GetDataExport(c.GetInt64(ContextUserIdKey))
+	if err != nil {
+		ResponseError(c, CODE_INTERNAL_ERROR)
+		return
+	}
+	ResponseSuccess(c, res)
+}
+
+// DownloadDataExport 下载个人数据
+// @Summary 下载个人数据
+// @Description 下载已经生成好的个人数据zip文件
+// @Tags 账号相关接口
+// @Produce application/zip
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Security ApiKeyAuth
+// @Success 200 {file} file
+// @Router /api/v1/user/export/download [get]
+func DownloadDataExport(c *gin.Context) {
+	file, err := logic.GetDataExportFile(c.GetInt64(ContextUserIdKey))
+	if err != nil {
+		zap.L().Warn("download data export error", zap.Error(err))
+		responseAccountError(c, err)
+		return
+	}
+	c.FileAttachment(file, "bluebell-data-export.zip")
+}
+
+func responseAccountError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, logic.ERROR_WRONG_PASSWORD):
+		ResponseError(c, CODE_PASSWORD_ERROR)
+	case errors.Is(err, logic.ERROR_WRONG_USER):
+		ResponseError(c, CODE_USER_NOT_EXSITS)
+	case errors.Is(err, logic.ERROR_DELETION_NOT_REQUESTED), errors.Is(err, logic.ERROR_EXPORT_NOT_READY):
+		ResponseError(c, CODE_NO_ROW_IN_DB)
+	default:
+		ResponseError(c, CODE_INTERNAL_ERROR)
+	}
+}
@@ -1,9 +1,9 @@
 package controllers
 
 import (
+	"bluebell/logic"
 	"bluebell/models"
 	"bluebell/pkg/strs"
-	"bluebell/settings"
 	"fmt"
 	"github.com/dchest/captcha"
 	"github.com/gin-gonic/gin"
@@ -19,9 +19,7 @@ import (
 // @Router /api/v1/captcha/request [get]
 func GetCaptchaInfo(c *gin.Context) {
 	captchaId := captcha.NewLen(4)
-	host := settings.GlobalSettings.AppCfg.Host
-	port := settings.GlobalSettings.AppCfg.Port
-	captchaUrl := fmt.Sprintf("%s:%d/api/v1/captcha/show?captcha-id=%s&r=%s", host, port, captchaId, strs.UUID())
+	captchaUrl := logic.AbsoluteURL(fmt.Sprintf("/api/v1/captcha/show?captcha-id=%s&r=%s", captchaId, strs.UUID()))
 	ResponseSuccess(c, gin.H{
 		"captchaId":  captchaId,
 		"captchaUrl": captchaUrl,
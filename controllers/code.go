@@ -20,6 +20,7 @@ const (
 
 const ContextUserIdKey = "user_id"
 const ContextUserNameKey = "username"
+const ContextSessionIdKey = "session_id"
 const (
 	CODE_SUCCESS = 100 * iota
 	CODE_USER_EXISTS
@@ -37,6 +38,20 @@ const (
 	CODE_VERFICATION_CODE_ERROR
 	CODE_NOT_ALLOW_PUBLISH_POST
 	CODE_NOT_ALLOW_PUBLISH_COMMENT
+	CODE_NOT_ALLOW_OPERATION
+	CODE_TRASH_EXPIRED
+	CODE_COMMENT_EDIT_EXPIRED
+	CODE_COMMENT_LOCKED
+	CODE_SESSION_REVOKED
+	CODE_TOO_MANY_SESSIONS
+	CODE_MFA_REQUIRED
+	CODE_INVALID_MFA_CODE
+	CODE_OIDC_LOGIN_FAILED
+	CODE_OIDC_EMAIL_CONFLICT
+	CODE_IDENTITY_LINKED
+	CODE_LAST_LOGIN_METHOD
+	CODE_LOGIN_LOCKED
+	CODE_LINK_NOT_ALLOWED
 )
 
 var code_to_msg = map[ResponseCode]string{
@@ -56,6 +71,20 @@ var code_to_msg = map[ResponseCode]string{
 	CODE_VERFICATION_CODE_ERROR:    "verification code error",
 	CODE_NOT_ALLOW_PUBLISH_POST:    "not allow publish post",
 	CODE_NOT_ALLOW_PUBLISH_COMMENT: "not allow publish comment",
+	CODE_NOT_ALLOW_OPERATION:       "operation not allowed",
+	CODE_TRASH_EXPIRED:             "trash has expired",
+	CODE_COMMENT_EDIT_EXPIRED:      "comment can no longer be edited",
+	CODE_COMMENT_LOCKED:            "comments on this post are locked",
+	CODE_SESSION_REVOKED:           "session has been revoked or expired, please login again",
+	CODE_TOO_MANY_SESSIONS:         "too many devices logged in",
+	CODE_MFA_REQUIRED:              "two-factor authentication is required for your role",
+	CODE_INVALID_MFA_CODE:          "invalid two-factor authentication code",
+	CODE_OIDC_LOGIN_FAILED:         "third-party login failed",
+	CODE_OIDC_EMAIL_CONFLICT:       "an account with this email already exists, please sign in with password and link it",
+	CODE_IDENTITY_LINKED:           "this third-party account is already linked",
+	CODE_LAST_LOGIN_METHOD:         "can not unlink the only way to sign in, please set a password first",
+	CODE_LOGIN_LOCKED:              "too many failed login attempts, please try again later",
+	CODE_LINK_NOT_ALLOWED:          "not enough reputation to post links",
 }
 
 func getMsg(code ResponseCode) string {
@@ -8,6 +8,7 @@ import (
 	"bluebell/pkg/snowflake"
 	"bluebell/pkg/sqls"
 	"bluebell/pkg/validation"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"strconv"
@@ -55,6 +56,10 @@ func CreateComment(c *gin.Context) {
 	u := mysql_repo.UserRepository.Get(sqls.DB(), CommentEntry.UserId)
 	if err = validation.CheckComment(u, CommentEntry); err != nil {
 		zap.L().Error("This user hit some strategy, fail to publish post", zap.Error(err))
+		if errors.Is(err, validation.ERROR_LINK_NOT_ALLOWED) {
+			ResponseError(c, CODE_LINK_NOT_ALLOWED)
+			return
+		}
 		ResponseError(c, CODE_NOT_ALLOW_PUBLISH_COMMENT)
 		return
 	}
@@ -63,7 +68,14 @@ func CreateComment(c *gin.Context) {
 	err = logic.CreateComment(CommentEntry)
 	if err != nil {
 		zap.L().Error("fail to save comment to the database...", zap.Error(err))
-		ResponseError(c, CODE_INTERNAL_ERROR)
+		switch {
+		case errors.Is(err, logic.ERROR_COMMENT_LOCKED):
+			ResponseError(c, CODE_COMMENT_LOCKED)
+		case errors.Is(err, logic.ERROR_POST_NOT_EXISTS), errors.Is(err, logic.ERROR_WRONG_COMMENT):
+			ResponseError(c, CODE_NO_ROW_IN_DB)
+		default:
+			ResponseError(c, CODE_INTERNAL_ERROR)
+		}
 		return
 	}
 	ResponseSuccess(c, nil)
@@ -101,6 +113,79 @@ func VoteForComment(c *gin.Context) {
 	ResponseSuccess(c, nil)
 }
 
+// EditComment 编辑评论
+// @Summary 编辑评论
+// @Description 作者可以在发布后的一段时间内编辑评论，编辑前的内容会保存为历史版本
+// @Tags 评论相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object body models.ParamEditComment true "comment id, content"
+// @Security ApiKeyAuth
+// @Success 200 {object} _GeneralResponse
+// @Router /api/v1/comment [put]
+func EditComment(c *gin.Context) {
+	param := new(models.ParamEditComment)
+	if err := c.ShouldBindJSON(param); err != nil {
+		zap.L().Error("bind edit comment param failed", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	userId := c.GetInt64(ContextUserIdKey)
+	if err := logic.EditComment(userId, param); err != nil {
+		zap.L().Error("edit comment error", zap.Error(err))
+		switch {
+		case errors.Is(err, logic.ERROR_WRONG_COMMENT):
+			ResponseError(c, CODE_NO_ROW_IN_DB)
+		case errors.Is(err, logic.ERROR_ILLEGAL_COMMENT_EDIT):
+			ResponseError(c, CODE_NOT_ALLOW_OPERATION)
+		case errors.Is(err, logic.ERROR_COMMENT_EDIT_EXPIRED):
+			ResponseError(c, CODE_COMMENT_EDIT_EXPIRED)
+		case errors.Is(err, validation.ERROR_TOO_MANY_PUBLISH):
+			ResponseError(c, CODE_NOT_ALLOW_PUBLISH_COMMENT)
+		case errors.Is(err, validation.ERROR_LINK_NOT_ALLOWED):
+			ResponseError(c, CODE_LINK_NOT_ALLOWED)
+		default:
+			ResponseError(c, CODE_INTERNAL_ERROR)
+		}
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// GetCommentHistory 获取评论的编辑历史
+// @Summary 获取评论的编辑历史
+// @Description 获取评论被编辑之前的所有版本，只有版主可以查看
+// @Tags 评论相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param comment-id query string true "comment id"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseCommentHistory
+// @Router /api/v1/comment/history [get]
+func GetCommentHistory(c *gin.Context) {
+	commentId, err := strconv.ParseInt(c.Query("comment-id"), 10, 64)
+	if err != nil {
+		zap.L().Error("Parse comment id error", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	list, err := logic.GetCommentHistory(c.GetInt64(ContextUserIdKey), commentId)
+	if err != nil {
+		zap.L().Error("get comment history error", zap.Error(err))
+		switch {
+		case errors.Is(err, logic.ERROR_WRONG_COMMENT):
+			ResponseError(c, CODE_NO_ROW_IN_DB)
+		case errors.Is(err, logic.ERROR_NOT_MODERATOR):
+			ResponseError(c, CODE_NOT_ALLOW_OPERATION)
+		default:
+			ResponseError(c, CODE_INTERNAL_ERROR)
+		}
+		return
+	}
+	ResponseSuccess(c, list)
+}
+
 // DeleteComment 删除评论
 // @Summary 删除评论
 // @Description 删除评论
@@ -130,11 +215,11 @@ func DeleteComment(c *gin.Context) {
 
 // GetCommentByPostId 根据post id分页获取其下的所有评论
 // @Summary 根据post id分页获取其下的所有评论
-// @Description 根据post id分页获取其下的所有评论
+// @Description 根据post id分页获取其下的所有评论，根评论可以按照热度(hot)、最新(new)、最早(old)排序
 // @Tags 评论相关接口
 // @Produce application/json
 // @Param Authorization header string false "Bearer 用户令牌"
-// @Param object query models.ParamGetCommentByPostId true "page size post id"
+// @Param object query models.ParamGetCommentByPostId true "page size post id sort"
 // @Security ApiKeyAuth
 // @Success 200 {object} _ResponseComments
 // @Router /api/v1/comment/by-post-id [get]
@@ -149,7 +234,7 @@ func GetCommentByPostId(c *gin.Context) {
 	// 从bluebell:post:[post-id]中找到所有的根评论
 	// 在根据这些根评论，去bluebell:comment:child_comment_record:[comment-id]中找出所有的子评论
 	// 采用BFS的策略
-	commentss, err := logic.GetCommentListByPostId(query)
+	commentss, pinned, err := logic.GetCommentListByPostId(query)
 	if err != nil {
 		zap.L().Error("get comments and sub comments error", zap.Error(err))
 		ResponseError(c, CODE_INTERNAL_ERROR)
@@ -175,7 +260,10 @@ func GetCommentByPostId(c *gin.Context) {
 		ResponseArr[i].Username = username
 		ResponseArr[i].Content = comments[0].Content
 		ResponseArr[i].UpdateAt = comments[0].UpdateAt
+		ResponseArr[i].Edited, ResponseArr[i].EditedAt = comments[0].EditedAt != nil, comments[0].EditedAt
 		ResponseArr[i].VoteNum = voteNum
+		ResponseArr[i].Pinned = comments[0].CommentId == pinned
+		ResponseArr[i].Mentions = logic.GetMentionSpans(logic.CommentType, comments[0].CommentId)
 		ResponseArr[i].SubComment = make([]models.ResponseComment, len(comments)-1)
 		for j := 1; j < len(comments); j++ {
 			username, err = logic.GetUsernameById(comments[j].UserId)
@@ -186,6 +274,8 @@ func GetCommentByPostId(c *gin.Context) {
 			}
 			ResponseArr[i].SubComment[j-1].Username = username
 			ResponseArr[i].SubComment[j-1].Content = comments[j].Content
+			ResponseArr[i].SubComment[j-1].Edited = comments[j].EditedAt != nil
+			ResponseArr[i].SubComment[j-1].Mentions = logic.GetMentionSpans(logic.CommentType, comments[j].CommentId)
 		}
 	}
 	ResponseSuccess(c, ResponseArr)
@@ -214,7 +304,7 @@ func GetTotalCommentsCount(c *gin.Context) {
 
 // GetSubCommentsCount 根据comment id，获取该comment下所有的评论总数
 // @Summary 根据comment id，获取该comment下所有的评论总数
-// @Description 根据comment，获取该comment下所有的评论总数
+// @Description 根据comment id，获取该comment下所有的评论总数，根评论统计其下所有的追评，追评只统计直接回复
 // @Tags 评论相关接口
 // @Produce application/json
 // @Param Authorization header string false "Bearer 用户令牌"
@@ -223,14 +313,13 @@ func GetTotalCommentsCount(c *gin.Context) {
 // @Success 200 {object} _ResponseCount
 // @Router /api/v1/comment/sub-comments-count [get]
 func GetSubCommentsCount(c *gin.Context) {
-	commentId := c.Query("comment-id")
-	cnt, err := redis_repo.GetSubCommentsCountOfAComment(commentId)
+	commentId, err := strconv.ParseInt(c.Query("comment-id"), 10, 64)
 	if err != nil {
-		zap.L().Error("get total comment count of a post error", zap.Error(err))
-		ResponseError(c, CODE_INTERNAL_ERROR)
+		zap.L().Error("Parse comment id error", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
 		return
 	}
-	ResponseSuccess(c, cnt)
+	ResponseSuccess(c, logic.GetReplyCount(commentId))
 }
 
 // GetCommentsDetail 根据comment id，获取该comment的详细信息
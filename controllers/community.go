@@ -2,7 +2,10 @@ package controllers
 
 import (
 	"bluebell/logic"
+	"bluebell/models"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 	"strconv"
 )
 
@@ -52,3 +55,60 @@ func GetCommunityById(c *gin.Context) {
 	ResponseSuccess(c, community)
 
 }
+
+// GetCommunityReputation 获取社区的声望门槛
+// @Summary 获取社区的声望门槛
+// @Description 返回社区生效的声望门槛，达到publish后放宽发帖/评论频率限制，达到vote_weight后对帖子投票的权重提高，达到link后可以发布链接
+// @Tags 社区相关接口
+// @Produce application/json
+// @Param id path string true "community id"
+// @Success 200 {object} _ResponseReputationThresholds
+// @Router /api/v1/community/{id}/reputation [get]
+func GetCommunityReputation(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	res, err := logic.GetCommunityReputation(id)
+	if err != nil {
+		ResponseError(c, CODE_NO_ROW_IN_DB)
+		return
+	}
+	ResponseSuccess(c, res)
+}
+
+// SetCommunityReputation 设置社区的声望门槛
+// @Summary 设置社区的声望门槛
+// @Description 版主设置社区的声望门槛，不传的项恢复为全局配置
+// @Tags 社区相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object body models.ParamCommunityReputation true "community id, 各项门槛"
+// @Security ApiKeyAuth
+// @Success 200 {object} _GeneralResponse
+// @Router /api/v1/community/reputation [put]
+func SetCommunityReputation(c *gin.Context) {
+	param := new(models.ParamCommunityReputation)
+	if err := c.ShouldBindJSON(param); err != nil {
+		zap.L().Error("bind community reputation param failed", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	if err := logic.SetCommunityReputation(c.GetInt64(ContextUserIdKey), param); err != nil {
+		zap.L().Error("set community reputation error", zap.Error(err))
+		switch {
+		case errors.Is(err, logic.ERROR_INVALID_THRESHOLD):
+			ResponseError(c, CODE_PARAM_ERROR)
+		case errors.Is(err, logic.ERROR_COMMUNITY_NOT_EXISTS):
+			ResponseError(c, CODE_NO_ROW_IN_DB)
+		case errors.Is(err, logic.ERROR_NOT_MODERATOR):
+			ResponseError(c, CODE_NOT_ALLOW_OPERATION)
+		default:
+			ResponseError(c, CODE_INTERNAL_ERROR)
+		}
+		return
+	}
+	ResponseSuccess(c, nil)
+}
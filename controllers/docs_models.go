@@ -1,6 +1,11 @@
 package controllers
 
-import "bluebell/models"
+import (
+	"bluebell/logic"
+	"bluebell/models"
+	"bluebell/pkg/jwtkeys"
+	"bluebell/pkg/reputation"
+)
 
 type _GeneralResponse struct {
 	Code ResponseCode `json:"code" example:"200"`   // 业务状态响应码
@@ -8,9 +13,9 @@ type _GeneralResponse struct {
 }
 
 type _ResponseUserSignIn struct {
-	Code  ResponseCode      `json:"code" example:"200"`                                 // 业务状态响应码
-	Msg   string            `json:"message" example:"ok"`                               // 提示信息
-	Token map[string]string `json:"token" example:"refresh_token:xxx,access_token:xxx"` // refresh-token and access-token
+	Code  ResponseCode      `json:"code" example:"200"`                                                // 业务状态响应码
+	Msg   string            `json:"message" example:"ok"`                                              // 提示信息
+	Token map[string]string `json:"token" example:"refresh_token:xxx,access_token:xxx,session_id:xxx"` // refresh-token, access-token and session id
 }
 
 type _ResponsePostDetail struct {
@@ -53,3 +58,127 @@ type _ResponseCount struct {
 	Msg  string       `json:"message" example:"ok"` // 提示信息
 	Data int64        `json:"data"`                 // 计数
 }
+
+type _ResponseTrashList struct {
+	Code ResponseCode             `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string                   `json:"message" example:"ok"` // 提示信息
+	Data models.ResponseTrashList `json:"data"`                 // 回收站列表以及总数
+}
+
+type _ResponseCommentHistory struct {
+	Code ResponseCode            `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string                  `json:"message" example:"ok"` // 提示信息
+	Data []models.CommentHistory `json:"data"`                 // 评论的历史版本
+}
+
+type _ResponseUserAutocomplete struct {
+	Code ResponseCode               `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string                     `json:"message" example:"ok"` // 提示信息
+	Data []models.ResponseUserBrief `json:"data"`                 // 匹配的用户
+}
+
+type _ResponseNotificationList struct {
+	Code ResponseCode          `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string                `json:"message" example:"ok"` // 提示信息
+	Data []models.Notification `json:"data"`                 // 通知列表
+}
+
+type _ResponseReactions struct {
+	Code ResponseCode             `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string                   `json:"message" example:"ok"` // 提示信息
+	Data models.ResponseReactions `json:"data"`                 // 回应统计
+}
+
+type _ResponseAccountDeletion struct {
+	Code ResponseCode                   `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string                         `json:"message" example:"ok"` // 提示信息
+	Data models.ResponseAccountDeletion `json:"data"`                 // 注销状态
+}
+
+type _ResponseDataExport struct {
+	Code ResponseCode              `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string                    `json:"message" example:"ok"` // 提示信息
+	Data models.ResponseDataExport `json:"data"`                 // 导出状态
+}
+
+type _ResponseUserProfile struct {
+	Code ResponseCode               `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string                     `json:"message" example:"ok"` // 提示信息
+	Data models.ResponseUserProfile `json:"data"`                 // 用户主页
+}
+
+type _ResponseFollowList struct {
+	Code ResponseCode              `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string                    `json:"message" example:"ok"` // 提示信息
+	Data models.ResponseFollowList `json:"data"`                 // 用户列表
+}
+
+type _ResponseSessions struct {
+	Code ResponseCode     `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string           `json:"message" example:"ok"` // 提示信息
+	Data []models.Session `json:"data"`                 // 登录会话列表
+}
+
+type _ResponseJWKS struct {
+	Keys []jwtkeys.JWK `json:"keys"` // 公钥列表
+}
+
+type _ResponseMfaStatus struct {
+	Code ResponseCode             `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string                   `json:"message" example:"ok"` // 提示信息
+	Data models.ResponseMfaStatus `json:"data"`                 // 两步验证状态
+}
+
+type _ResponseMfaSetup struct {
+	Code ResponseCode            `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string                  `json:"message" example:"ok"` // 提示信息
+	Data models.ResponseMfaSetup `json:"data"`                 // 身份验证器密钥
+}
+
+type _ResponseRecoveryCodes struct {
+	Code ResponseCode `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string       `json:"message" example:"ok"` // 提示信息
+	Data []string     `json:"data"`                 // 恢复码，只会返回一次
+}
+
+type _ResponseMfaPolicy struct {
+	Code ResponseCode `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string       `json:"message" example:"ok"` // 提示信息
+	Data []int8       `json:"data"`                 // 必须开启两步验证的角色
+}
+
+type _ResponseOidcAuthorize struct {
+	Code ResponseCode                 `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string                       `json:"message" example:"ok"` // 提示信息
+	Data models.ResponseOidcAuthorize `json:"data"`                 // 身份提供方的登录地址
+}
+
+type _ResponseOidcProviders struct {
+	Code ResponseCode `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string       `json:"message" example:"ok"` // 提示信息
+	Data []string     `json:"data"`                 // 身份提供方名称
+}
+
+type _ResponseUserIdentities struct {
+	Code ResponseCode          `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string                `json:"message" example:"ok"` // 提示信息
+	Data []models.UserIdentity `json:"data"`                 // 已绑定的第三方账号
+}
+
+type _ResponseReputationThresholds struct {
+	Code ResponseCode          `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string                `json:"message" example:"ok"` // 提示信息
+	Data reputation.Thresholds `json:"data"`                 // 声望门槛
+}
+
+type _ResponseBadgeRules struct {
+	Code ResponseCode      `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string            `json:"message" example:"ok"` // 提示信息
+	Data []logic.BadgeRule `json:"data"`                 // 徽章规则
+}
+
+type _ResponseUserPreference struct {
+	Code ResponseCode          `json:"code" example:"200"`   // 业务状态响应码
+	Msg  string                `json:"message" example:"ok"` // 提示信息
+	Data models.UserPreference `json:"data"`                 // 偏好设置
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"bluebell/logic"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+// GetPostOEmbed 帖子的oEmbed信息
+// @Summary 帖子的oEmbed信息
+// @Description 按照oEmbed规范返回帖子的预览信息，只支持json格式。为了兼容oEmbed客户端，直接返回oEmbed对象，错误时返回对应的HTTP状态码
+// @Tags 帖子相关接口
+// @Produce application/json
+// @Param url query string true "帖子链接或者分享链接"
+// @Param format query string false "json"
+// @Param maxwidth query int false "最大宽度"
+// @Param maxheight query int false "最大高度"
+// @Success 200 {object} logic.OEmbedResponse
+// @Router /api/v1/oembed [get]
+func GetPostOEmbed(c *gin.Context) {
+	if format := c.DefaultQuery("format", "json"); format != "json" {
+		c.Status(http.StatusNotImplemented)
+		return
+	}
+	maxWidth, _ := strconv.Atoi(c.Query("maxwidth"))
+	maxHeight, _ := strconv.Atoi(c.Query("maxheight"))
+	resp, err := logic.GetPostOEmbed(c.Query("url"), maxWidth, maxHeight)
+	if err != nil {
+		zap.L().Error("get post oembed error", zap.String("url", c.Query("url")), zap.Error(err))
+		switch {
+		case errors.Is(err, logic.ERROR_INVALID_EMBED_URL), errors.Is(err, logic.ERROR_POST_NOT_EXISTS):
+			c.Status(http.StatusNotFound)
+		default:
+			c.Status(http.StatusInternalServerError)
+		}
+		return
+	}
+	c.Header("Cache-Control", "public, max-age="+strconv.Itoa(resp.CacheAge))
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetPostCard 帖子的预览页面
+// @Summary 帖子的预览页面
+// @Description 返回带有Open Graph/Twitter Card元信息的帖子预览页面，供聊天软件等抓取链接预览，没有配置分享落地页时分享链接也跳转到这里
+// @Tags 帖子相关接口
+// @Produce text/html
+// @Param id path string true "post id"
+// @Success 200 {string} string
+// @Router /embed/post/{id} [get]
+func GetPostCard(c *gin.Context) {
+	postId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		zap.L().Error("Parse post id error", zap.Error(err))
+		c.Status(http.StatusNotFound)
+		return
+	}
+	html, err := logic.GetPostCardHTML(postId)
+	if err != nil {
+		zap.L().Error("get post card error", zap.Int64("post_id", postId), zap.Error(err))
+		if errors.Is(err, logic.ERROR_POST_NOT_EXISTS) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", html)
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"bluebell/logic"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	contentTypeAtom = "application/atom+xml; charset=utf-8"
+	contentTypeRss  = "application/rss+xml; charset=utf-8"
+)
+
+// GetCommunityFeed 社区Atom订阅源
+// @Summary 社区Atom订阅源
+// @Description 获取社区最新帖子的Atom订阅源，支持ETag/Last-Modified条件请求
+// @Tags 订阅源相关接口
+// @Produce application/atom+xml
+// @Param id path string true "community id，以.atom结尾"
+// @Success 200 {string} string
+// @Router /feeds/community/{id}.atom [get]
+func GetCommunityFeed(c *gin.Context) {
+	communityId, ok := parseFeedId(c.Param("id"), ".atom")
+	if !ok {
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	feed, err := logic.GetCommunityFeed(communityId)
+	if err != nil {
+		zap.L().Error("get community feed error", zap.Int64("community_id", communityId), zap.Error(err))
+		if errors.Is(err, logic.ERROR_COMMUNITY_NOT_EXISTS) {
+			ResponseError(c, CODE_NO_ROW_IN_DB)
+			return
+		}
+		ResponseError(c, CODE_INTERNAL_ERROR)
+		return
+	}
+	ResponseFeed(c, feed, contentTypeAtom)
+}
+
+// GetUserFeed 用户Atom订阅源
+// @Summary 用户Atom订阅源
+// @Description 获取用户最新发布帖子的Atom订阅源，支持ETag/Last-Modified条件请求
+// @Tags 订阅源相关接口
+// @Produce application/atom+xml
+// @Param id path string true "user id，以.atom结尾"
+// @Success 200 {string} string
+// @Router /feeds/user/{id}.atom [get]
+func GetUserFeed(c *gin.Context) {
+	userId, ok := parseFeedId(c.Param("id"), ".atom")
+	if !ok {
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	feed, err := logic.GetUserFeed(userId)
+	if err != nil {
+		zap.L().Error("get user feed error", zap.Int64("user_id", userId), zap.Error(err))
+		if errors.Is(err, logic.ERROR_WRONG_USER) {
+			ResponseError(c, CODE_USER_NOT_EXSITS)
+			return
+		}
+		ResponseError(c, CODE_INTERNAL_ERROR)
+		return
+	}
+	ResponseFeed(c, feed, contentTypeAtom)
+}
+
+// GetHotFeed 热门帖子RSS订阅源
+// @Summary 热门帖子RSS订阅源
+// @Description 获取热门帖子的RSS订阅源，支持ETag/Last-Modified条件请求
+// @Tags 订阅源相关接口
+// @Produce application/rss+xml
+// @Success 200 {string} string
+// @Router /feeds/hot.rss [get]
+func GetHotFeed(c *gin.Context) {
+	feed, err := logic.GetHotFeed()
+	if err != nil {
+		zap.L().Error("get hot feed error", zap.Error(err))
+		ResponseError(c, CODE_INTERNAL_ERROR)
+		return
+	}
+	ResponseFeed(c, feed, contentTypeRss)
+}
+
+// parseFeedId 解析形如 123.atom 的路径参数
+func parseFeedId(param, ext string) (int64, bool) {
+	if !strings.HasSuffix(param, ext) {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(strings.TrimSuffix(param, ext), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// ResponseFeed 返回订阅源，客户端缓存的内容没有变化时返回304
+func ResponseFeed(c *gin.Context, feed *logic.FeedResult, contentType string) {
+	c.Header("ETag", feed.ETag)
+	c.Header("Last-Modified", feed.LastModified.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "public, max-age=300")
+	if notModified(c, feed) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, contentType, feed.Body)
+}
+
+func notModified(c *gin.Context, feed *logic.FeedResult) bool {
+	// If-None-Match的优先级高于If-Modified-Since
+	if inm := c.GetHeader("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == feed.ETag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := c.GetHeader("If-Modified-Since"); ims != "" {
+		t, err := time.Parse(http.TimeFormat, ims)
+		if err == nil && !feed.LastModified.Truncate(time.Second).After(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"bluebell/logic"
+	"bluebell/models"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"strconv"
+)
+
+func responseFollowListError(c *gin.Context, err error) {
+	if errors.Is(err, logic.ERROR_WRONG_USER) {
+		ResponseError(c, CODE_USER_NOT_EXSITS)
+	} else {
+		ResponseError(c, CODE_INTERNAL_ERROR)
+	}
+}
+
+// GetFollowers 获取用户的粉丝列表
+// @Summary 获取用户的粉丝列表
+// @Description 分页获取用户的粉丝，登录时返回每个用户与当前用户的关注关系(已关注、关注了你、互相关注)
+// @Tags 用户相关接口
+// @Produce application/json
+// @Param Authorization header string false "Bearer 用户令牌"
+// @Param id path string true "user id"
+// @Param object query models.ParamFollowList false "分页参数"
+// @Success 200 {object} _ResponseFollowList
+// @Router /api/v1/user/{id}/followers [get]
+func GetFollowers(c *gin.Context) {
+	userId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	param := new(models.ParamFollowList)
+	if err == nil {
+		err = c.ShouldBindQuery(param)
+	}
+	if err != nil {
+		zap.L().Error("bind follower list params failed", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	list, err := logic.GetFollowers(c.GetInt64(ContextUserIdKey), userId, param)
+	if err != nil {
+		responseFollowListError(c, err)
+		return
+	}
+	ResponseSuccess(c, list)
+}
+
+// GetFollowing 获取用户的关注列表
+// @Summary 获取用户的关注列表
+// @Description 分页获取用户关注的人，登录时返回每个用户与当前用户的关注关系(已关注、关注了你、互相关注)
+// @Tags 用户相关接口
+// @Produce application/json
+// @Param Authorization header string false "Bearer 用户令牌"
+// @Param id path string true "user id"
+// @Param object query models.ParamFollowList false "分页参数"
+// @Success 200 {object} _ResponseFollowList
+// @Router /api/v1/user/{id}/following [get]
+func GetFollowing(c *gin.Context) {
+	userId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	param := new(models.ParamFollowList)
+	if err == nil {
+		err = c.ShouldBindQuery(param)
+	}
+	if err != nil {
+		zap.L().Error("bind following list params failed", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	list, err := logic.GetFollowing(c.GetInt64(ContextUserIdKey), userId, param)
+	if err != nil {
+		responseFollowListError(c, err)
+		return
+	}
+	ResponseSuccess(c, list)
+}
+
+// GetCommonFollows 获取两个用户共同关注的人
+// @Summary 获取两个用户共同关注的人
+// @Description 分页获取路径中的用户与other_user_id共同关注的人，other_user_id为空时与当前登录的用户比较
+// @Tags 用户相关接口
+// @Produce application/json
+// @Param Authorization header string false "Bearer 用户令牌"
+// @Param id path string true "user id"
+// @Param object query models.ParamCommonFollows false "查询参数"
+// @Success 200 {object} _ResponseFollowList
+// @Router /api/v1/user/{id}/common-follows [get]
+func GetCommonFollows(c *gin.Context) {
+	userId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	param := new(models.ParamCommonFollows)
+	if err == nil {
+		err = c.ShouldBindQuery(param)
+	}
+	if err != nil {
+		zap.L().Error("bind common follows params failed", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	viewerId := c.GetInt64(ContextUserIdKey)
+	otherUserId := param.OtherUserId
+	if otherUserId == 0 {
+		otherUserId = viewerId
+	}
+	if otherUserId == 0 {
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	list, err := logic.GetCommonFollows(viewerId, userId, otherUserId, param)
+	if err != nil {
+		responseFollowListError(c, err)
+		return
+	}
+	ResponseSuccess(c, list)
+}
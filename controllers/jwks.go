@@ -0,0 +1,19 @@
+package controllers
+
+import (
+	"bluebell/logic"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetJWKS 获取校验token的公钥
+// @Summary 获取校验token的公钥
+// @Description 以JWK Set格式返回RS256/EdDSA签名密钥的公钥，其他服务根据token header中的kid选择公钥校验token，HS256密钥不会公开
+// @Tags 用户相关接口
+// @Produce application/json
+// @Success 200 {object} _ResponseJWKS
+// @Router /.well-known/jwks.json [get]
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, logic.GetJWKS())
+}
@@ -0,0 +1,228 @@
+package controllers
+
+import (
+	"bluebell/logic"
+	"bluebell/models"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func responseMfaError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, logic.ERROR_INVALID_MFA_CODE):
+		ResponseError(c, CODE_INVALID_MFA_CODE)
+	case errors.Is(err, logic.ERROR_INVALID_MFA_TOKEN):
+		ResponseError(c, CODE_INVALID_TOKEN)
+	case errors.Is(err, logic.ERROR_MFA_REQUIRED):
+		ResponseError(c, CODE_MFA_REQUIRED)
+	case errors.Is(err, logic.ERROR_WRONG_PASSWORD):
+		ResponseError(c, CODE_PASSWORD_ERROR)
+	case errors.Is(err, logic.ERROR_WRONG_USER):
+		ResponseError(c, CODE_USER_NOT_EXSITS)
+	case errors.Is(err, logic.ERROR_MFA_ALREADY_ENABLED), errors.Is(err, logic.ERROR_MFA_NOT_ENABLED), errors.Is(err, logic.ERROR_NOT_ADMIN):
+		ResponseError(c, CODE_NOT_ALLOW_OPERATION)
+	case errors.Is(err, logic.ERROR_TOO_MANY_SESSIONS):
+		ResponseError(c, CODE_TOO_MANY_SESSIONS)
+	default:
+		zap.L().Error("two-factor authentication error", zap.Error(err))
+		ResponseError(c, CODE_INTERNAL_ERROR)
+	}
+}
+
+// SignInWithMfa 登录第二步，校验两步验证码
+// @Summary 登录第二步，校验两步验证码
+// @Description 登录接口返回mfa_required时，使用返回的mfa-token和身份验证器中的验证码（或一个恢复码）完成登录，返回refresh-token 和 access-token；登录过程中绑定身份验证器时同时返回recovery_codes
+// @Tags 用户相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param object body models.ParamMfaLogin true "mfa-token和验证码"
+// @Success 200 {object} _ResponseUserSignIn
+// @Router /api/v1/login/mfa [post]
+func SignInWithMfa(c *gin.Context) {
+	p := new(models.ParamMfaLogin)
+	if err := c.ShouldBindJSON(p); err != nil {
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	res, err := logic.CompleteMfaLogin(p)
+	if err != nil {
+		responseMfaError(c, err)
+		return
+	}
+	ResponseSuccess(c, res)
+}
+
+// StartMfaEnrollment 登录过程中绑定身份验证器
+// @Summary 登录过程中绑定身份验证器
+// @Description 角色要求开启两步验证但还没有绑定时（登录接口返回enrollment_required），使用mfa-token获取身份验证器密钥，再调用/login/mfa完成绑定和登录
+// @Tags 用户相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param object body models.ParamMfaEnroll true "mfa-token"
+// @Success 200 {object} _ResponseMfaSetup
+// @Router /api/v1/login/mfa/enroll [post]
+func StartMfaEnrollment(c *gin.Context) {
+	p := new(models.ParamMfaEnroll)
+	if err := c.ShouldBindJSON(p); err != nil {
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	res, err := logic.StartMfaEnrollment(p.MfaToken)
+	if err != nil {
+		responseMfaError(c, err)
+		return
+	}
+	ResponseSuccess(c, res)
+}
+
+// GetMfaStatus 获取两步验证状态
+// @Summary 获取两步验证状态
+// @Description 返回是否已开启两步验证、当前角色是否被要求开启以及剩余的恢复码数量
+// @Tags 用户相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseMfaStatus
+// @Router /api/v1/user/mfa [get]
+func GetMfaStatus(c *gin.Context) {
+	res, err := logic.GetMfaStatus(c.GetInt64(ContextUserIdKey))
+	if err != nil {
+		responseMfaError(c, err)
+		return
+	}
+	ResponseSuccess(c, res)
+}
+
+// SetupMfa 开始绑定身份验证器
+// @Summary 开始绑定身份验证器
+// @Description 生成新的身份验证器密钥和otpauth地址，客户端据此生成二维码，调用/user/mfa/confirm确认后才会生效
+// @Tags 用户相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseMfaSetup
+// @Router /api/v1/user/mfa/setup [post]
+func SetupMfa(c *gin.Context) {
+	res, err := logic.SetupMfa(c.GetInt64(ContextUserIdKey))
+	if err != nil {
+		responseMfaError(c, err)
+		return
+	}
+	ResponseSuccess(c, res)
+}
+
+// ConfirmMfa 确认绑定身份验证器
+// @Summary 确认绑定身份验证器
+// @Description 使用身份验证器中的验证码确认绑定，成功后开启两步验证并返回一次性的恢复码，恢复码只会返回这一次
+// @Tags 用户相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object body models.ParamMfaCode true "验证码"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseRecoveryCodes
+// @Router /api/v1/user/mfa/confirm [post]
+func ConfirmMfa(c *gin.Context) {
+	p := new(models.ParamMfaCode)
+	if err := c.ShouldBindJSON(p); err != nil {
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	codes, err := logic.ConfirmMfa(c.GetInt64(ContextUserIdKey), p.Code)
+	if err != nil {
+		responseMfaError(c, err)
+		return
+	}
+	ResponseSuccess(c, codes)
+}
+
+// DisableMfa 关闭两步验证
+// @Summary 关闭两步验证
+// @Description 需要同时提供密码和验证码（或恢复码），角色被要求开启两步验证时不能关闭
+// @Tags 用户相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object body models.ParamDisableMfa true "密码和验证码"
+// @Security ApiKeyAuth
+// @Success 200 {object} _GeneralResponse
+// @Router /api/v1/user/mfa [delete]
+func DisableMfa(c *gin.Context) {
+	p := new(models.ParamDisableMfa)
+	if err := c.ShouldBindJSON(p); err != nil {
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	if err := logic.DisableMfa(c.GetInt64(ContextUserIdKey), p); err != nil {
+		responseMfaError(c, err)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码
+// @Summary 重新生成恢复码
+// @Description 校验验证码后重新生成一组恢复码，之前的恢复码全部作废
+// @Tags 用户相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object body models.ParamMfaCode true "验证码"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseRecoveryCodes
+// @Router /api/v1/user/mfa/recovery-codes [post]
+func RegenerateRecoveryCodes(c *gin.Context) {
+	p := new(models.ParamMfaCode)
+	if err := c.ShouldBindJSON(p); err != nil {
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	codes, err := logic.RegenerateRecoveryCodes(c.GetInt64(ContextUserIdKey), p.Code)
+	if err != nil {
+		responseMfaError(c, err)
+		return
+	}
+	ResponseSuccess(c, codes)
+}
+
+// GetMfaPolicy 获取两步验证策略
+// @Summary 获取两步验证策略
+// @Description 返回必须开启两步验证的角色，只有管理员可以访问
+// @Tags 用户相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseMfaPolicy
+// @Router /api/v1/admin/mfa-policy [get]
+func GetMfaPolicy(c *gin.Context) {
+	if !logic.IsAdmin(c.GetInt64(ContextUserIdKey)) {
+		ResponseError(c, CODE_NOT_ALLOW_OPERATION)
+		return
+	}
+	ResponseSuccess(c, logic.GetMfaPolicy())
+}
+
+// SetMfaPolicy 设置两步验证策略
+// @Summary 设置两步验证策略
+// @Description 设置必须开启两步验证的角色，对应角色的用户下次登录时必须完成两步验证，还没有绑定身份验证器的需要在登录时绑定
+// @Tags 用户相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object body models.ParamMfaPolicy true "必须开启两步验证的角色"
+// @Security ApiKeyAuth
+// @Success 200 {object} _GeneralResponse
+// @Router /api/v1/admin/mfa-policy [put]
+func SetMfaPolicy(c *gin.Context) {
+	p := new(models.ParamMfaPolicy)
+	if err := c.ShouldBindJSON(p); err != nil {
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	if err := logic.SetMfaPolicy(c.GetInt64(ContextUserIdKey), p.RequiredRoles); err != nil {
+		responseMfaError(c, err)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"bluebell/logic"
+	"bluebell/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// GetNotificationList 获取通知列表
+// @Summary 获取通知列表
+// @Description 分页获取当前用户的站内通知，例如被@，最新的通知在前
+// @Tags 通知相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object query models.ParamNotificationList false "查询参数"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseNotificationList
+// @Router /api/v1/notification [get]
+func GetNotificationList(c *gin.Context) {
+	param := &models.ParamNotificationList{Page: 1, Size: 10}
+	if err := c.ShouldBindQuery(param); err != nil {
+		zap.L().Error("bind notification list query failed", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	list, err := logic.GetNotificationList(c.GetInt64(ContextUserIdKey), param)
+	if err != nil {
+		zap.L().Error("get notification list failed", zap.Error(err))
+		ResponseError(c, CODE_INTERNAL_ERROR)
+		return
+	}
+	ResponseSuccess(c, list)
+}
+
+// GetUnreadNotificationCount 获取未读通知的数量
+// @Summary 获取未读通知的数量
+// @Description 获取当前用户未读通知的数量
+// @Tags 通知相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseCount
+// @Router /api/v1/notification/unread-count [get]
+func GetUnreadNotificationCount(c *gin.Context) {
+	ResponseSuccess(c, logic.GetUnreadNotificationCount(c.GetInt64(ContextUserIdKey)))
+}
+
+// ReadNotifications 将通知标记为已读
+// @Summary 将通知标记为已读
+// @Description 将指定的通知标记为已读，不指定时将所有通知标记为已读
+// @Tags 通知相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object body models.ParamReadNotification false "notification ids"
+// @Security ApiKeyAuth
+// @Success 200 {object} _GeneralResponse
+// @Router /api/v1/notification/read [post]
+func ReadNotifications(c *gin.Context) {
+	param := new(models.ParamReadNotification)
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(param); err != nil {
+			zap.L().Error("bind read notification param failed", zap.Error(err))
+			ResponseError(c, CODE_PARAM_ERROR)
+			return
+		}
+	}
+	if err := logic.ReadNotifications(c.GetInt64(ContextUserIdKey), param); err != nil {
+		ResponseError(c, CODE_INTERNAL_ERROR)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
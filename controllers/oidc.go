@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"bluebell/logic"
+	"bluebell/models"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func responseOidcError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, logic.ERROR_UNKNOWN_OIDC_PROVIDER), errors.Is(err, logic.ERROR_IDENTITY_NOT_FOUND):
+		ResponseError(c, CODE_NO_ROW_IN_DB)
+	case errors.Is(err, logic.ERROR_INVALID_OIDC_STATE):
+		ResponseError(c, CODE_INVALID_TOKEN)
+	case errors.Is(err, logic.ERROR_OIDC_LOGIN_FAILED):
+		ResponseError(c, CODE_OIDC_LOGIN_FAILED)
+	case errors.Is(err, logic.ERROR_OIDC_EMAIL_CONFLICT):
+		ResponseError(c, CODE_OIDC_EMAIL_CONFLICT)
+	case errors.Is(err, logic.ERROR_IDENTITY_LINKED), errors.Is(err, logic.ERROR_PROVIDER_ALREADY_LINKED):
+		ResponseError(c, CODE_IDENTITY_LINKED)
+	case errors.Is(err, logic.ERROR_LAST_LOGIN_METHOD):
+		ResponseError(c, CODE_LAST_LOGIN_METHOD)
+	case errors.Is(err, logic.ERROR_WRONG_USER):
+		ResponseError(c, CODE_USER_NOT_EXSITS)
+	case errors.Is(err, logic.ERROR_TOO_MANY_SESSIONS):
+		ResponseError(c, CODE_TOO_MANY_SESSIONS)
+	default:
+		zap.L().Error("oidc login error", zap.Error(err))
+		ResponseError(c, CODE_INTERNAL_ERROR)
+	}
+}
+
+// GetOidcProviders 获取支持的第三方登录
+// @Summary 获取支持的第三方登录
+// @Description 返回配置的OpenID Connect身份提供方名称，用于登录页面展示第三方登录按钮
+// @Tags 用户相关接口
+// @Produce application/json
+// @Success 200 {object} _ResponseOidcProviders
+// @Router /api/v1/oauth/providers [get]
+func GetOidcProviders(c *gin.Context) {
+	ResponseSuccess(c, logic.GetOidcProviders())
+}
+
+// OidcAuthorize 发起第三方登录
+// @Summary 发起第三方登录
+// @Description 返回身份提供方的登录地址，前端跳转到该地址，登录完成后身份提供方带着code和state跳转回配置的前端页面
+// @Tags 用户相关接口
+// @Produce application/json
+// @Param provider path string true "身份提供方名称"
+// @Param object query models.ParamOidcAuthorize false "设备名称"
+// @Success 200 {object} _ResponseOidcAuthorize
+// @Router /api/v1/oauth/{provider}/authorize [get]
+func OidcAuthorize(c *gin.Context) {
+	p := new(models.ParamOidcAuthorize)
+	if err := c.ShouldBindQuery(p); err != nil {
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	res, err := logic.StartOidcAuthorization(c.Param("provider"), 0, sessionDevice(c, p.DeviceName))
+	if err != nil {
+		responseOidcError(c, err)
+		return
+	}
+	ResponseSuccess(c, res)
+}
+
+// OidcCallback 完成第三方登录
+// @Summary 完成第三方登录
+// @Description 提交身份提供方返回的code和state完成登录，已绑定的账号直接登录，邮箱已验证时关联同一邮箱的账号，否则自动注册；开启了两步验证时返回mfa_required
+// @Tags 用户相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param provider path string true "身份提供方名称"
+// @Param object body models.ParamOidcCallback true "code和state"
+// @Success 200 {object} _ResponseUserSignIn
+// @Router /api/v1/oauth/{provider}/callback [post]
+func OidcCallback(c *gin.Context) {
+	p := new(models.ParamOidcCallback)
+	if err := c.ShouldBindJSON(p); err != nil {
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	res, err := logic.OidcSignIn(c.Param("provider"), p)
+	if err != nil {
+		responseOidcError(c, err)
+		return
+	}
+	ResponseSuccess(c, res)
+}
+
+// GetUserIdentities 获取已绑定的第三方账号
+// @Summary 获取已绑定的第三方账号
+// @Tags 用户相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseUserIdentities
+// @Router /api/v1/user/identities [get]
+func GetUserIdentities(c *gin.Context) {
+	ResponseSuccess(c, logic.GetUserIdentities(c.GetInt64(ContextUserIdKey)))
+}
+
+// LinkIdentity 发起绑定第三方账号
+// @Summary 发起绑定第三方账号
+// @Description 返回身份提供方的登录地址，登录完成后把code和state提交到/user/identities/{provider}/callback完成绑定
+// @Tags 用户相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param provider path string true "身份提供方名称"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseOidcAuthorize
+// @Router /api/v1/user/identities/{provider} [post]
+func LinkIdentity(c *gin.Context) {
+	res, err := logic.StartOidcAuthorization(c.Param("provider"), c.GetInt64(ContextUserIdKey), nil)
+	if err != nil {
+		responseOidcError(c, err)
+		return
+	}
+	ResponseSuccess(c, res)
+}
+
+// LinkIdentityCallback 完成绑定第三方账号
+// @Summary 完成绑定第三方账号
+// @Tags 用户相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param provider path string true "身份提供方名称"
+// @Param object body models.ParamOidcCallback true "code和state"
+// @Security ApiKeyAuth
+// @Success 200 {object} _GeneralResponse
+// @Router /api/v1/user/identities/{provider}/callback [post]
+func LinkIdentityCallback(c *gin.Context) {
+	p := new(models.ParamOidcCallback)
+	if err := c.ShouldBindJSON(p); err != nil {
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	if err := logic.LinkOidcIdentity(c.GetInt64(ContextUserIdKey), c.Param("provider"), p); err != nil {
+		responseOidcError(c, err)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// UnlinkIdentity 解绑第三方账号
+// @Summary 解绑第三方账号
+// @Description 没有设置密码时不能解绑最后一个第三方账号
+// @Tags 用户相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param provider path string true "身份提供方名称"
+// @Security ApiKeyAuth
+// @Success 200 {object} _GeneralResponse
+// @Router /api/v1/user/identities/{provider} [delete]
+func UnlinkIdentity(c *gin.Context) {
+	if err := logic.UnlinkOidcIdentity(c.GetInt64(ContextUserIdKey), c.Param("provider")); err != nil {
+		responseOidcError(c, err)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
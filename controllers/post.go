@@ -7,10 +7,10 @@ import (
 	"bluebell/pkg/snowflake"
 	"bluebell/pkg/sqls"
 	"bluebell/pkg/validation"
-	"bluebell/settings"
-	"fmt"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"net/http"
 	"strconv"
 	"strings"
 )
@@ -51,8 +51,12 @@ func CreatePost(c *gin.Context) {
 		ResponseError(c, CODE_NOT_ALLOW_PUBLISH_POST)
 		return
 	}
-	if err = validation.CheckPost(u, nil); err != nil {
+	if err = validation.CheckPost(u, PostEntry); err != nil {
 		zap.L().Error("This user hit some strategy, fail to publish post", zap.Error(err))
+		if errors.Is(err, validation.ERROR_LINK_NOT_ALLOWED) {
+			ResponseError(c, CODE_LINK_NOT_ALLOWED)
+			return
+		}
 		ResponseError(c, CODE_NOT_ALLOW_PUBLISH_POST)
 		return
 	}
@@ -79,7 +83,6 @@ func CreatePost(c *gin.Context) {
 // @Success 200 {object} _ResponsePostDetail
 // @Router /api/v1/post/{id} [get]
 func GetPostById(c *gin.Context) {
-	postDetail := new(models.PostDetail)
 	// 获取post id
 	postId := c.Param("id")
 	// 获取当前用户ID
@@ -90,39 +93,87 @@ func GetPostById(c *gin.Context) {
 	if err != nil {
 		zap.L().Error("parse postId failed", zap.Error(err))
 		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	postDetail, err := getPostDetail(currentUserId, id)
+	if err != nil {
+		ResponseError(c, CODE_INTERNAL_ERROR)
+		return
 	}
+	ResponseSuccess(c, postDetail)
+
+}
+
+// GetPostPreview 不需要登录的帖子预览
+// @Summary 帖子预览
+// @Description 不需要登录即可查看的帖子详情
+// @Tags 帖子相关接口
+// @Produce application/json
+// @Param id path string true "post id"
+// @Success 200 {object} _ResponsePostDetail
+// @Router /api/v1/post/preview/{id} [get]
+func GetPostPreview(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		zap.L().Error("parse postId failed", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	postDetail, err := getPostDetail(0, id)
+	if err != nil {
+		if errors.Is(err, logic.ERROR_POST_NOT_EXISTS) {
+			ResponseError(c, CODE_NO_ROW_IN_DB)
+			return
+		}
+		ResponseError(c, CODE_INTERNAL_ERROR)
+		return
+	}
+	ResponseSuccess(c, postDetail)
+}
+
+// getPostDetail 组装帖子详情，并且浏览量+1
+func getPostDetail(currentUserId, id int64) (*models.PostDetail, error) {
+	postDetail := new(models.PostDetail)
 	// 获取post详细信息
 	post, err := logic.GetPostById(id)
 	if err != nil {
 		zap.L().Error("get post by id failed", zap.Error(err))
-		ResponseError(c, CODE_INTERNAL_ERROR)
-		return
+		return nil, err
 	}
 
 	// 获取username
 	username, err := logic.GetUsernameById(post.AuthorID)
 	if err != nil {
 		zap.L().Error("get username by id failed", zap.Error(err))
-		ResponseError(c, CODE_INTERNAL_ERROR)
-		return
+		return nil, err
 	}
 	// 获取社区详细信息
 	community, err := logic.GetCommunityById(post.CommunityID)
 	if err != nil {
 		zap.L().Error("get community by id failed", zap.Error(err))
-		ResponseError(c, CODE_INTERNAL_ERROR)
-		return
+		return nil, err
 	}
 
 	postDetail.Title = post.Title
 	postDetail.AuthorName = username
 	postDetail.Content = post.Content
+	postDetail.Mentions = logic.GetMentionSpans(logic.PostType, post.PostId)
 
 	postDetail.YesVotes, postDetail.CommentNum, postDetail.ClickNums = logic.GetPostDetailedInfo1(post.PostId)
 	//postDetail.YesVotes, postDetail.CommentNum, postDetail.ClickNums = post.VoteUpNums, post.CommentNums, post.ClickNums
+	postDetail.ShareNums = logic.GetPostShareNumById(post.PostId)
 
 	postDetail.UpdateAt = post.UpdateAt
 	postDetail.CommunityName = community.CommunityName
+	postDetail.PinnedCommentId, postDetail.CommentLocked = post.PinnedCommentId, post.CommentLocked
+	// emoji回应统计，获取失败不影响帖子详情
+	if postDetail.Reactions, err = logic.GetReactions(currentUserId, logic.PostType, post.PostId); err != nil {
+		zap.L().Error("get post reactions error", zap.Error(err))
+	}
+	// 热评预览，获取失败不影响帖子详情
+	if postDetail.TopComments, err = logic.GetTopComments(post.PostId, logic.N_TOP_COMMENTS); err != nil {
+		zap.L().Error("get top comments error", zap.Error(err))
+	}
 	// 浏览量+1,需要同时操作MySQL数据库和Redis
 	err = logic.AddPostClickNum(currentUserId, post.PostId)
 	if err != nil {
@@ -130,9 +181,7 @@ func GetPostById(c *gin.Context) {
 	} else {
 		zap.L().Info("add post click num success")
 	}
-
-	ResponseSuccess(c, postDetail)
-
+	return postDetail, nil
 }
 
 // GetPostList 分页获取所有post
@@ -241,7 +290,7 @@ func VoteForPost(c *gin.Context) {
 
 // GetPostList1 分页获取post简略信息
 // @Summary 分页获取post简略信息
-// @Description 可按用户指定分页要求（若有）返回特定community（若有）的post简略信息列表
+// @Description 可按用户指定分页要求（若有）返回特定community（若有）的post简略信息列表，没有指定排序方式时使用登录用户偏好设置中的排序方式
 // @Tags 帖子相关接口
 // @Produce application/json
 // @Param Authorization header string false "Bearer 用户令牌"
@@ -258,6 +307,9 @@ func GetPostList1(c *gin.Context) {
 		ResponseError(c, CODE_PARAM_ERROR)
 		return
 	}
+	if param_list_query.Order == "" {
+		param_list_query.Order = logic.PreferredPostSort(c.GetInt64(ContextUserIdKey))
+	}
 
 	// 2.业务逻辑处理
 	// 从redis中获取id列表，再根据这个id列表去redis中获取点赞/反对的数量
@@ -430,12 +482,13 @@ func DeletePost(c *gin.Context) {
 
 // GetPostLink 获取帖子分享链接
 // @Summary 获取帖子分享链接
-// @Description 获取帖子分享链接
+// @Description 获取带签名的帖子分享短链接，登录用户生成的链接会记录分享者
 // @Tags 帖子相关接口
 // @Produce application/json
 // @Param Authorization header string false "Bearer 用户令牌"
 // @Param post-id query string true "post id"
 // @Security ApiKeyAuth
+// @Success 200 {object} _GeneralResponse
 // @Router /api/v1/post/link [get]
 func GetPostLink(c *gin.Context) {
 	postId, err := strconv.ParseInt(c.Query("post-id"), 10, 64)
@@ -444,7 +497,102 @@ func GetPostLink(c *gin.Context) {
 		ResponseError(c, CODE_PARAM_ERROR)
 		return
 	}
-	url := fmt.Sprintf("%s:%d/api/v1/post/%d",
-		settings.GlobalSettings.AppCfg.Host, settings.GlobalSettings.AppCfg.Port, postId)
-	ResponseSuccess(c, url)
+	link, err := logic.GetShareLink(postId, c.GetInt64(ContextUserIdKey))
+	if err != nil {
+		zap.L().Error("get share link error", zap.Error(err))
+		if errors.Is(err, logic.ERROR_POST_NOT_EXISTS) {
+			ResponseError(c, CODE_NO_ROW_IN_DB)
+			return
+		}
+		ResponseError(c, CODE_INTERNAL_ERROR)
+		return
+	}
+	ResponseSuccess(c, link)
+}
+
+// ResolveShareLink 访问分享短链接
+// @Summary 访问分享短链接
+// @Description 校验分享链接的签名，记录分享访问次数，然后跳转到帖子页面
+// @Tags 帖子相关接口
+// @Param code path string true "share code"
+// @Success 302
+// @Router /s/{code} [get]
+func ResolveShareLink(c *gin.Context) {
+	target, err := logic.ResolveShareLink(c.Param("code"), c.ClientIP())
+	if err != nil {
+		zap.L().Error("resolve share link error", zap.String("code", c.Param("code")), zap.Error(err))
+		switch {
+		case errors.Is(err, logic.ERROR_INVALID_SHARE_CODE):
+			ResponseError(c, CODE_PARAM_ERROR)
+		case errors.Is(err, logic.ERROR_POST_NOT_EXISTS):
+			ResponseError(c, CODE_NO_ROW_IN_DB)
+		default:
+			ResponseError(c, CODE_INTERNAL_ERROR)
+		}
+		return
+	}
+	c.Redirect(http.StatusFound, target)
+}
+
+// PinComment 置顶评论
+// @Summary 置顶评论
+// @Description 帖子作者或版主置顶帖子下的一条根评论，置顶的评论在评论列表中总是显示在最前面，comment-id为0时取消置顶
+// @Tags 帖子相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object body models.ParamPinComment true "post id, comment id"
+// @Security ApiKeyAuth
+// @Success 200 {object} _GeneralResponse
+// @Router /api/v1/post/pin-comment [post]
+func PinComment(c *gin.Context) {
+	param := new(models.ParamPinComment)
+	if err := c.ShouldBindJSON(param); err != nil {
+		zap.L().Error("bind pin comment param failed", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	if err := logic.PinComment(c.GetInt64(ContextUserIdKey), param); err != nil {
+		zap.L().Error("pin comment error", zap.Error(err))
+		responsePostModerationError(c, err)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// LockComments 锁定/解锁帖子的评论
+// @Summary 锁定/解锁帖子的评论
+// @Description 帖子作者或版主禁止/允许在帖子下发表新的评论，版主锁定的帖子只有版主可以解锁
+// @Tags 帖子相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object body models.ParamLockComment true "post id, lock"
+// @Security ApiKeyAuth
+// @Success 200 {object} _GeneralResponse
+// @Router /api/v1/post/lock-comments [post]
+func LockComments(c *gin.Context) {
+	param := new(models.ParamLockComment)
+	if err := c.ShouldBindJSON(param); err != nil {
+		zap.L().Error("bind lock comments param failed", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	if err := logic.LockComments(c.GetInt64(ContextUserIdKey), param); err != nil {
+		zap.L().Error("lock comments error", zap.Error(err))
+		responsePostModerationError(c, err)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+func responsePostModerationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, logic.ERROR_POST_NOT_EXISTS), errors.Is(err, logic.ERROR_WRONG_COMMENT):
+		ResponseError(c, CODE_NO_ROW_IN_DB)
+	case errors.Is(err, logic.ERROR_ILLEGAL_POST_OPERATION):
+		ResponseError(c, CODE_NOT_ALLOW_OPERATION)
+	default:
+		ResponseError(c, CODE_INTERNAL_ERROR)
+	}
 }
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"bluebell/logic"
+	"bluebell/models"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// React 添加/取消emoji回应
+// @Summary 添加/取消emoji回应
+// @Description 对帖子/评论添加或取消emoji回应，同一用户可以添加多种不同的回应，只能使用社区允许的emoji
+// @Tags 回应相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object body models.ParamReaction true "target type, target id, emoji, action"
+// @Security ApiKeyAuth
+// @Success 200 {object} _GeneralResponse
+// @Router /api/v1/reaction [post]
+func React(c *gin.Context) {
+	param := new(models.ParamReaction)
+	if err := c.ShouldBindJSON(param); err != nil {
+		zap.L().Error("bind reaction param failed", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	if err := logic.React(c.GetInt64(ContextUserIdKey), param); err != nil {
+		zap.L().Error("react error", zap.Error(err))
+		responseReactionError(c, err)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// GetReactions 获取emoji回应统计
+// @Summary 获取emoji回应统计
+// @Description 获取帖子/评论每种emoji回应的数量，登录时同时返回当前用户添加的回应
+// @Tags 回应相关接口
+// @Produce application/json
+// @Param Authorization header string false "Bearer 用户令牌"
+// @Param object query models.ParamGetReactions true "查询参数"
+// @Success 200 {object} _ResponseReactions
+// @Router /api/v1/reaction [get]
+func GetReactions(c *gin.Context) {
+	param := new(models.ParamGetReactions)
+	if err := c.ShouldBindQuery(param); err != nil {
+		zap.L().Error("bind get reactions query failed", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	res, err := logic.GetReactions(c.GetInt64(ContextUserIdKey), param.TargetType, param.TargetId)
+	if err != nil {
+		zap.L().Error("get reactions error", zap.Error(err))
+		responseReactionError(c, err)
+		return
+	}
+	ResponseSuccess(c, res)
+}
+
+// SetCommunityReactions 设置社区可用的emoji回应
+// @Summary 设置社区可用的emoji回应
+// @Description 版主设置社区内可以使用的emoji回应，传入空列表时恢复为默认的回应
+// @Tags 回应相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object body models.ParamCommunityReactions true "community id, reactions"
+// @Security ApiKeyAuth
+// @Success 200 {object} _GeneralResponse
+// @Router /api/v1/community/reactions [put]
+func SetCommunityReactions(c *gin.Context) {
+	param := new(models.ParamCommunityReactions)
+	if err := c.ShouldBindJSON(param); err != nil {
+		zap.L().Error("bind community reactions param failed", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	if err := logic.SetCommunityReactions(c.GetInt64(ContextUserIdKey), param); err != nil {
+		zap.L().Error("set community reactions error", zap.Error(err))
+		responseReactionError(c, err)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+func responseReactionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, logic.ERROR_INVALID_REACTION):
+		ResponseError(c, CODE_PARAM_ERROR)
+	case errors.Is(err, logic.ERROR_POST_NOT_EXISTS), errors.Is(err, logic.ERROR_WRONG_COMMENT),
+		errors.Is(err, logic.ERROR_COMMUNITY_NOT_EXISTS):
+		ResponseError(c, CODE_NO_ROW_IN_DB)
+	case errors.Is(err, logic.ERROR_NOT_MODERATOR):
+		ResponseError(c, CODE_NOT_ALLOW_OPERATION)
+	default:
+		ResponseError(c, CODE_INTERNAL_ERROR)
+	}
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"bluebell/logic"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// GetSessions 获取已登录的设备列表
+// @Summary 获取已登录的设备列表
+// @Description 返回当前用户所有有效的登录会话，包括设备名称、User-Agent、ip、登录时间以及最后活动时间，current表示当前设备
+// @Tags 用户相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseSessions
+// @Router /api/v1/user/sessions [get]
+func GetSessions(c *gin.Context) {
+	sessions, err := logic.GetSessions(c.GetInt64(ContextUserIdKey), c.GetString(ContextSessionIdKey))
+	if err != nil {
+		ResponseError(c, CODE_INTERNAL_ERROR)
+		return
+	}
+	ResponseSuccess(c, sessions)
+}
+
+// RevokeSession 退出某个设备上的登录
+// @Summary 退出某个设备上的登录
+// @Description 吊销指定的登录会话，该设备上的token立即失效，也可以用来退出当前设备
+// @Tags 用户相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param id path string true "session id"
+// @Security ApiKeyAuth
+// @Success 200 {object} _GeneralResponse
+// @Router /api/v1/user/sessions/{id} [delete]
+func RevokeSession(c *gin.Context) {
+	if err := logic.RevokeSession(c.GetInt64(ContextUserIdKey), c.Param("id")); err != nil {
+		if errors.Is(err, logic.ERROR_SESSION_NOT_FOUND) {
+			ResponseError(c, CODE_NO_ROW_IN_DB)
+		} else {
+			zap.L().Error("revoke session error in logic.RevokeSession()", zap.Error(err))
+			ResponseError(c, CODE_INTERNAL_ERROR)
+		}
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// RevokeOtherSessions 退出其他所有设备上的登录
+// @Summary 退出其他所有设备上的登录
+// @Description 吊销除当前设备以外所有的登录会话
+// @Tags 用户相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Security ApiKeyAuth
+// @Success 200 {object} _GeneralResponse
+// @Router /api/v1/user/sessions [delete]
+func RevokeOtherSessions(c *gin.Context) {
+	if err := logic.RevokeOtherSessions(c.GetInt64(ContextUserIdKey), c.GetString(ContextSessionIdKey)); err != nil {
+		zap.L().Error("revoke other sessions error in logic.RevokeOtherSessions()", zap.Error(err))
+		ResponseError(c, CODE_INTERNAL_ERROR)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"bluebell/logic"
+	"bluebell/models"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"strconv"
+)
+
+// GetTrashList 获取回收站列表
+// @Summary 获取回收站列表
+// @Description 获取回收站中被删除的帖子/评论，版主可以查看所有用户的回收站
+// @Tags 回收站相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object query models.ParamTrashList false "查询参数"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseTrashList
+// @Router /api/v1/trash [get]
+func GetTrashList(c *gin.Context) {
+	param := &models.ParamTrashList{Page: 1, Size: 10}
+	if err := c.ShouldBindQuery(param); err != nil {
+		zap.L().Error("bind trash list query failed", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	userId := c.GetInt64(ContextUserIdKey)
+	list, err := logic.GetTrashList(userId, param)
+	if err != nil {
+		zap.L().Error("get trash list failed", zap.Error(err))
+		ResponseError(c, CODE_INTERNAL_ERROR)
+		return
+	}
+	ResponseSuccess(c, list)
+}
+
+// RestoreTrash 从回收站恢复内容
+// @Summary 从回收站恢复内容
+// @Description 从回收站恢复被删除的帖子/评论，被版主删除的内容只能由版主恢复
+// @Tags 回收站相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param trash-id query string true "trash id"
+// @Security ApiKeyAuth
+// @Success 200 {object} _GeneralResponse
+// @Router /api/v1/trash/restore [post]
+func RestoreTrash(c *gin.Context) {
+	trashId, err := strconv.ParseInt(c.Query("trash-id"), 10, 64)
+	if err != nil {
+		zap.L().Error("Parse trash id error", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	userId := c.GetInt64(ContextUserIdKey)
+	if err = logic.RestoreTrash(userId, trashId); err != nil {
+		zap.L().Error("restore trash error", zap.Error(err))
+		switch {
+		case errors.Is(err, logic.ERROR_TRASH_NOT_EXISTS):
+			ResponseError(c, CODE_NO_ROW_IN_DB)
+		case errors.Is(err, logic.ERROR_ILLEGAL_TRASH_OPERATION):
+			ResponseError(c, CODE_NOT_ALLOW_OPERATION)
+		case errors.Is(err, logic.ERROR_TRASH_EXPIRED):
+			ResponseError(c, CODE_TRASH_EXPIRED)
+		default:
+			ResponseError(c, CODE_INTERNAL_ERROR)
+		}
+		return
+	}
+	ResponseSuccess(c, nil)
+}
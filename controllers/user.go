@@ -6,8 +6,9 @@ import (
 	"errors"
 	"github.com/dchest/captcha"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 	"go.uber.org/zap"
+	"math"
+	"strconv"
 	"strings"
 )
 
@@ -37,7 +38,7 @@ func SignUp(context *gin.Context) {
 	}
 	// 调用业务逻辑层
 	if err := logic.SignUp(user); err != nil {
-		if errors.Is(err, logic.ERROR_DUPLICATED_USERNAME) {
+		if errors.Is(err, logic.ERROR_DUPLICATED_USERNAME) || errors.Is(err, logic.ERROR_RESERVED_USERNAME) {
 			ResponseError(context, CODE_USER_EXISTS)
 		} else if errors.Is(err, logic.ERROR_DUPLICATED_EMAIL) {
 			ResponseError(context, CODE_EMAIL_EXSITS)
@@ -53,7 +54,7 @@ func SignUp(context *gin.Context) {
 
 // SignIn 处理账户登录
 // @Summary 实现用户登录功能
-// @Description 接受用户输入的用户名，密码，返回refresh-token 和 access-token
+// @Description 接受用户输入的用户名，密码，返回refresh-token 和 access-token；连续失败过多时需要等待一段时间，响应头Retry-After为剩余秒数；开启了两步验证时返回mfa_required和mfa_token，需要调用/login/mfa完成登录
 // @Tags 用户相关接口
 // @Accept application/json
 // @Produce application/json
@@ -79,9 +80,16 @@ func SignIn(context *gin.Context) {
 	u := new(models.User)
 	u.Username = user.Username
 	u.Password = user.Password
-	if err := logic.SignInWithPassword(u); err != nil {
-		ResponseError(context, CODE_PASSWORD_ERROR)
-		zap.L().Error("user sign in parameter in controller.SignInWithPassword()...", zap.Error(err))
+	if err := logic.SignInWithPasswordFrom(u, context.ClientIP()); err != nil {
+		// 账号不存在和密码错误返回相同的结果
+		var locked *logic.LoginLockedError
+		if errors.As(err, &locked) {
+			context.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+			ResponseError(context, CODE_LOGIN_LOCKED)
+		} else {
+			ResponseError(context, CODE_PASSWORD_ERROR)
+		}
+		zap.L().Warn("user sign in parameter in controller.SignInWithPassword()...", zap.Error(err))
 		return
 	}
 
@@ -93,15 +101,27 @@ func SignIn(context *gin.Context) {
 	//}
 
 	// 继续后续步骤
-	res, err := logic.SignInPostProcess(u)
+	res, err := logic.SignInPostProcess(u, sessionDevice(context, user.DeviceName))
 	if err != nil {
-		ResponseError(context, CODE_INTERNAL_ERROR)
+		responseSignInError(context, err)
 		zap.L().Error("user sign in postprocess error in controller.SignInWithPassword()...", zap.Error(err))
 		return
 	}
 	ResponseSuccess(context, res)
 }
 
+func sessionDevice(c *gin.Context, name string) *models.SessionDevice {
+	return &models.SessionDevice{Name: name, UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+}
+
+func responseSignInError(c *gin.Context, err error) {
+	if errors.Is(err, logic.ERROR_TOO_MANY_SESSIONS) {
+		ResponseError(c, CODE_TOO_MANY_SESSIONS)
+	} else {
+		ResponseError(c, CODE_INTERNAL_ERROR)
+	}
+}
+
 // SignInViaEmail 处理账户登录
 // @Summary 实现用户通过邮箱验证码登录功能
 // @Description 接受用户输入的email，验证码，返回refresh-token 和 access-token
@@ -130,9 +150,9 @@ func SignInViaEmail(context *gin.Context) {
 	}
 	// 3.继续后续步骤
 
-	res, err := logic.SignInPostProcess(u)
+	res, err := logic.SignInPostProcess(u, sessionDevice(context, user.DeviceName))
 	if err != nil {
-		ResponseError(context, CODE_INTERNAL_ERROR)
+		responseSignInError(context, err)
 		zap.L().Error("user sign in postprocess error in controller.SignInWithPassword()...", zap.Error(err))
 		return
 	}
@@ -168,6 +188,99 @@ func GetVerificationCode(context *gin.Context) {
 	ResponseSuccess(context, nil)
 }
 
+// GetUserProfile 获取用户的公开主页
+// @Summary 获取用户的公开主页
+// @Description 返回用户名、性别、注册时间、发帖数、评论数、获赞总数、声望、获得的徽章、粉丝数、关注数，登录时返回是否已关注该用户
+// @Tags 用户相关接口
+// @Produce application/json
+// @Param Authorization header string false "Bearer 用户令牌"
+// @Param id path string true "user id"
+// @Success 200 {object} _ResponseUserProfile
+// @Router /api/v1/user/{id} [get]
+func GetUserProfile(context *gin.Context) {
+	userId, err := strconv.ParseInt(context.Param("id"), 10, 64)
+	if err != nil {
+		zap.L().Error("parse user id failed", zap.Error(err))
+		ResponseError(context, CODE_PARAM_ERROR)
+		return
+	}
+	profile, err := logic.GetUserProfile(context.GetInt64(ContextUserIdKey), userId)
+	if err != nil {
+		if errors.Is(err, logic.ERROR_WRONG_USER) {
+			ResponseError(context, CODE_USER_NOT_EXSITS)
+		} else {
+			ResponseError(context, CODE_INTERNAL_ERROR)
+		}
+		return
+	}
+	ResponseSuccess(context, profile)
+}
+
+// GetBadgeRules 获取所有可以获得的徽章
+// @Summary 获取所有可以获得的徽章
+// @Description 返回徽章的名称、标题、说明以及获得的条件
+// @Tags 用户相关接口
+// @Produce application/json
+// @Success 200 {object} _ResponseBadgeRules
+// @Router /api/v1/badges [get]
+func GetBadgeRules(context *gin.Context) {
+	ResponseSuccess(context, logic.GetBadgeRules())
+}
+
+// ForgotPassword 申请重置密码
+// @Summary 申请重置密码
+// @Description 向邮箱发送一次性的重置密码链接，无论邮箱是否注册都返回成功
+// @Tags 用户相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param object body models.ParamForgotPassword true "email"
+// @Success 200 {object} _GeneralResponse
+// @Router /api/v1/forgot-password [post]
+func ForgotPassword(context *gin.Context) {
+	param := new(models.ParamForgotPassword)
+	if err := context.ShouldBindJSON(param); err != nil {
+		ResponseError(context, CODE_PARAM_ERROR)
+		zap.L().Error("forgot password parameter bind error...", zap.Error(err))
+		return
+	}
+	if err := logic.ForgotPassword(param.Email); err != nil {
+		ResponseError(context, CODE_INTERNAL_ERROR)
+		zap.L().Error("forgot password error in logic.ForgotPassword()...", zap.Error(err))
+		return
+	}
+	ResponseSuccess(context, nil)
+}
+
+// ResetPassword 重置密码
+// @Summary 重置密码
+// @Description 使用邮件中的token设置新密码，token只能使用一次，重置成功后所有设备上的登录状态失效
+// @Tags 用户相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param object body models.ParamResetPassword true "token, 新密码"
+// @Success 200 {object} _GeneralResponse
+// @Router /api/v1/reset-password [post]
+func ResetPassword(context *gin.Context) {
+	param := new(models.ParamResetPassword)
+	if err := context.ShouldBindJSON(param); err != nil {
+		ResponseError(context, CODE_PARAM_ERROR)
+		zap.L().Error("reset password parameter bind error...", zap.Error(err))
+		return
+	}
+	if err := logic.ResetPassword(param); err != nil {
+		zap.L().Error("reset password error in logic.ResetPassword()...", zap.Error(err))
+		if errors.Is(err, logic.ERROR_INVALID_RESET_TOKEN) {
+			ResponseError(context, CODE_INVALID_TOKEN)
+		} else if errors.Is(err, logic.ERROR_WEAK_PASSWORD) {
+			ResponseError(context, CODE_PARAM_ERROR)
+		} else {
+			ResponseError(context, CODE_INTERNAL_ERROR)
+		}
+		return
+	}
+	ResponseSuccess(context, nil)
+}
+
 // EditUserInfo 更新用户信息
 // @Summary 更新用户信息
 // @Description 用户可更新用户名/性别/email
@@ -196,44 +309,99 @@ func EditUserInfo(c *gin.Context) {
 	ResponseSuccess(c, nil)
 }
 
+// GetUserPreference 获取用户的偏好设置
+// @Summary 获取用户的偏好设置
+// @Description 返回默认的帖子排序、语言、各类通知的邮件开关、通知邮件的发送频率以及谁可以私信/@自己，没有设置过的项返回默认值
+// @Tags 用户相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseUserPreference
+// @Router /api/v1/user/preference [get]
+func GetUserPreference(c *gin.Context) {
+	p, err := logic.GetUserPreference(c.GetInt64(ContextUserIdKey))
+	if err != nil {
+		zap.L().Error("get user preference error", zap.Error(err))
+		ResponseError(c, CODE_USER_NOT_EXSITS)
+		return
+	}
+	ResponseSuccess(c, p)
+}
+
+// UpdateUserPreference 修改用户的偏好设置
+// @Summary 修改用户的偏好设置
+// @Description 只修改传了的项，返回修改后的全部设置
+// @Tags 用户相关接口
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object body models.ParamUserPreference true "需要修改的设置"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseUserPreference
+// @Router /api/v1/user/preference [patch]
+func UpdateUserPreference(c *gin.Context) {
+	param := new(models.ParamUserPreference)
+	if err := c.ShouldBindJSON(param); err != nil {
+		zap.L().Error("bind user preference param failed", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	p, err := logic.UpdateUserPreference(c.GetInt64(ContextUserIdKey), param)
+	if err != nil {
+		zap.L().Error("update user preference error", zap.Error(err))
+		switch {
+		case errors.Is(err, logic.ERROR_INVALID_PREFERENCE):
+			ResponseError(c, CODE_PARAM_ERROR)
+		case errors.Is(err, logic.ERROR_WRONG_USER):
+			ResponseError(c, CODE_USER_NOT_EXSITS)
+		default:
+			ResponseError(c, CODE_INTERNAL_ERROR)
+		}
+		return
+	}
+	ResponseSuccess(c, p)
+}
+
 // RefreshAccessToken 刷新AccessToken的接口
 // @Summary 实现刷新token功能
-// @Description 判断当前refresh-token是否过期，没有的话返回新的access-token（access token过期的话）
+// @Description 使用refresh-token换取新的access-token和refresh-token，旧的refresh-token立即失效，重复使用会导致该设备退出登录
 // @Tags 用户相关接口
 // @Accept application/json
 // @Produce application/json
-// @Param Authorization header string false "用户的refresh-token和access-token"
+// @Param Authorization header string false "用户的refresh-token，兼容旧的 access-token|refresh-token 格式"
 // @Security ApiKeyAuth
 // @Success 200 {object} _ResponseUserSignIn
 // @Router /api/v1/refresh-access-token [get]
 func RefreshAccessToken(c *gin.Context) {
-	// 1.检验参数，判断是否携带access token 和 refresh token
-	// 假设token是存放在Head的Authorization字段中，access token和refresh token用｜隔开
+	// 1.检验参数，判断是否携带refresh token
+	// refresh token存放在Head的Authorization字段中，旧的客户端会用｜隔开access token和refresh token
 	authHeader := c.Request.Header.Get("Authorization")
 	if authHeader == "" {
 		zap.L().Error("no auth header")
 		ResponseError(c, CODE_NOT_LOGIN)
 		return
 	}
-	// 分割token
 	tokens := strings.Split(authHeader, "|")
-	if len(tokens) != 2 {
+	if len(tokens) > 2 {
 		zap.L().Error("invalid auth header")
 		ResponseError(c, CODE_INVALID_TOKEN)
 		return
 	}
-	accessToken, err := logic.RefreshToken(tokens[0], tokens[1])
+	res, err := logic.RefreshToken(tokens[len(tokens)-1])
 	if err != nil {
-		if errors.Is(err, err.(jwt.ValidationError)) {
+		switch {
+		case errors.Is(err, logic.INVALID_TOKEN):
 			zap.L().Error("invalid refresh token", zap.Error(err))
 			ResponseError(c, CODE_INVALID_TOKEN)
-		} else {
+		case errors.Is(err, logic.ERROR_REFRESH_TOKEN_REUSED):
+			ResponseError(c, CODE_SESSION_REVOKED)
+		default:
 			zap.L().Error("refresh token error", zap.Error(err))
 			ResponseError(c, CODE_INTERNAL_ERROR)
 		}
 		return
 	}
-	ResponseSuccess(c, accessToken)
+	ResponseSuccess(c, res)
 }
 
 // SendEmail 实现获取邮箱验证码的接口
@@ -326,3 +494,53 @@ func FollowUser(c *gin.Context) {
 	}
 	ResponseSuccess(c, nil)
 }
+
+// AutocompleteUsername 根据用户名前缀补全用户
+// @Summary 根据用户名前缀补全用户
+// @Description 输入@用户名时，根据已输入的前缀返回匹配的用户
+// @Tags 用户相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param object query models.ParamUserAutocomplete true "prefix, size"
+// @Security ApiKeyAuth
+// @Success 200 {object} _ResponseUserAutocomplete
+// @Router /api/v1/user/autocomplete [get]
+func AutocompleteUsername(c *gin.Context) {
+	query := new(models.ParamUserAutocomplete)
+	if err := c.ShouldBindQuery(query); err != nil {
+		zap.L().Error("bind autocomplete query failed", zap.Error(err))
+		ResponseError(c, CODE_PARAM_ERROR)
+		return
+	}
+	ResponseSuccess(c, logic.AutocompleteUsername(query))
+}
+
+// UnlockUser 解除账号的登录锁定
+// @Summary 解除账号的登录锁定
+// @Description 清除账号连续登录失败的次数和锁定，只有管理员可以操作
+// @Tags 用户相关接口
+// @Produce application/json
+// @Param Authorization header string true "Bearer 用户令牌"
+// @Param id path string true "用户id"
+// @Security ApiKeyAuth
+// @Success 200 {object} _GeneralResponse
+// @Router /api/v1/admin/users/{id}/unlock [post]
+func UnlockUser(context *gin.Context) {
+	userId, err := strconv.ParseInt(context.Param("id"), 10, 64)
+	if err != nil {
+		ResponseError(context, CODE_PARAM_ERROR)
+		return
+	}
+	if err = logic.UnlockUser(context.GetInt64(ContextUserIdKey), userId); err != nil {
+		switch {
+		case errors.Is(err, logic.ERROR_NOT_ADMIN):
+			ResponseError(context, CODE_NOT_ALLOW_OPERATION)
+		case errors.Is(err, logic.ERROR_WRONG_USER):
+			ResponseError(context, CODE_USER_NOT_EXSITS)
+		default:
+			ResponseError(context, CODE_INTERNAL_ERROR)
+		}
+		return
+	}
+	ResponseSuccess(context, nil)
+}
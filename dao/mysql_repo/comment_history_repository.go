@@ -0,0 +1,23 @@
+package mysql_repo
+
+import (
+	"bluebell/models"
+	"bluebell/pkg/sqls"
+	"gorm.io/gorm"
+)
+
+var CommentHistoryRepository = newCommentHistoryRepository()
+
+func newCommentHistoryRepository() *commentHistoryRepository { return &commentHistoryRepository{} }
+
+type commentHistoryRepository struct{}
+
+func (r *commentHistoryRepository) Create(db *gorm.DB, t *models.CommentHistory) (err error) {
+	err = db.Create(t).Error
+	return
+}
+
+func (r *commentHistoryRepository) Find(db *gorm.DB, cnd *sqls.Cnd) (list []models.CommentHistory) {
+	cnd.Find(db, &list)
+	return
+}
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"strconv"
+	"time"
 )
 
 var CommentRepository = newCommentRepository()
@@ -57,49 +59,187 @@ func (r *commentRepository) FindPageByCnd(db *gorm.DB, cnd *sqls.Cnd) (list []mo
 
 }
 
+// GetRootCommentId 获取父评论所在的根评论id，父评论不存在(或已被删除)时返回错误
 func (r *commentRepository) GetRootCommentId(db *gorm.DB, parentCommentId int64) (commentId int64, err error) {
-	// 根据parentCommentId,postId一路找到根comment的id
-	var comment *models.Comment
-	parentId := parentCommentId
-	for {
-		comment = r.Get(db, parentId)
-		if comment.ParentCommentId == 0 {
-			break
-		}
-		parentId = comment.ParentCommentId
+	parent := r.Get(db, parentCommentId)
+	if parent == nil {
+		return 0, errors.New("not found parent comment")
+	}
+	return parent.RootCommentId, nil
+}
+
+// 评论树保存在MySQL中：根评论的root_comment_id为自身的id，追评的root_comment_id为所在根评论的id
+// 因此根评论及其所有追评可以通过root_comment_id上的索引一次查询得到，不再需要在Redis中维护评论树
+
+// FindSubtree 获取根评论下的所有追评(不包括根评论本身)，按照发布顺序排列
+func (r *commentRepository) FindSubtree(db *gorm.DB, rootCommentIds []int64) (list []models.Comment) {
+	if len(rootCommentIds) == 0 {
+		return nil
 	}
-	if comment == nil {
-		err = errors.New("not found root comment")
-		return 0, err
+	if err := db.Where("root_comment_id IN (?) AND comment_id <> root_comment_id", rootCommentIds).Order("id").Find(&list).Error; err != nil {
+		zap.L().Error("find sub comments error in FindSubtree()", zap.Error(err))
 	}
-	return comment.CommentId, nil
+	return
 }
 
-// 目前的评论结构是一个多叉树，但是只有孩子指向父节点的指针，没有父节点指向孩子的指针
-// 需要设计缓存之类的东西，让父节点能够指向孩子
-// bluebell:comment:child_comment_record:commentId 下面存放该评论的所有子评论
-// bluebell:comment:child_comment_record:commentId 在构建子评论的时候创建
+// CountReplies 批量统计根评论下的追评总数
+func (r *commentRepository) CountReplies(db *gorm.DB, rootCommentIds []int64) map[int64]int64 {
+	var rows []struct {
+		RootCommentId int64
+		Cnt           int64
+	}
+	res := make(map[int64]int64, len(rootCommentIds))
+	if len(rootCommentIds) == 0 {
+		return res
+	}
+	if err := db.Model(&models.Comment{}).Select("root_comment_id, COUNT(*) AS cnt").
+		Where("root_comment_id IN (?) AND comment_id <> root_comment_id", rootCommentIds).
+		Group("root_comment_id").Scan(&rows).Error; err != nil {
+		zap.L().Error("count replies error in CountReplies()", zap.Error(err))
+	}
+	for _, row := range rows {
+		res[row.RootCommentId] = row.Cnt
+	}
+	return res
+}
 
-func (r *commentRepository) DeleteCommentInfo(db *gorm.DB, commentIds []string) (err error) {
-	// 传进来所有需要删除的comment_id
-	tx := db.Begin()
-	if err = tx.Error; err != nil {
-		zap.L().Error("create transaction failed in DeleteCommentInfo()", zap.Error(err))
-		return err
+// TopCommenter 统计一段时间内发布评论最多的用户，没有评论时返回0
+func (r *commentRepository) TopCommenter(db *gorm.DB, from, to time.Time) (userId, count int64) {
+	var row struct {
+		UserId int64
+		Cnt    int64
 	}
+	if err := db.Model(&models.Comment{}).Select("user_id, COUNT(*) AS cnt").
+		Where("create_at >= ? AND create_at < ?", from, to).
+		Group("user_id").Order("cnt DESC, user_id ASC").Limit(1).Scan(&row).Error; err != nil {
+		zap.L().Error("find top commenter error in TopCommenter()", zap.Error(err))
+	}
+	return row.UserId, row.Cnt
+}
+
+// CountDirectReplies 统计评论的直接回复数
+func (r *commentRepository) CountDirectReplies(db *gorm.DB, commentId int64) int64 {
+	return r.Count(db, sqls.NewCnd().Where("parent_comment_id = ?", commentId))
+}
 
-	for _, id := range commentIds {
-		if err = tx.Delete(&models.Comment{}, "comment_id = ?", id).Error; err != nil {
-			zap.L().Error("delete comment error in DeleteCommentInfo()", zap.Error(err))
-			tx.Rollback()
+// DeleteCommentInfo 软删除评论，删除根评论时同时删除其下所有的追评，删除追评时只删除该评论本身
+// 返回所有被删除的评论id
+func (r *commentRepository) DeleteCommentInfo(db *gorm.DB, comment *models.Comment, deleteAt time.Time) (commentIds []string, err error) {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		where := "comment_id = ?"
+		if comment.ParentCommentId == 0 {
+			where = "root_comment_id = ?"
+		}
+		var ids []int64
+		if err := tx.Model(&models.Comment{}).Where(where, comment.CommentId).Pluck("comment_id", &ids).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Comment{}).Where(where, comment.CommentId).Update("delete_at", deleteAt).Error; err != nil {
 			return err
 		}
+		commentIds = make([]string, len(ids))
+		for i, id := range ids {
+			commentIds[i] = strconv.FormatInt(id, 10)
+		}
+		return nil
+	})
+	if err != nil {
+		zap.L().Error("delete comment error in DeleteCommentInfo()", zap.Error(err))
+		return nil, err
+	}
+	return commentIds, nil
+}
+
+// BackfillRootCommentId 为旧数据补全root_comment_id，根评论指向自身，追评逐层继承父评论的root_comment_id
+// 父评论已经不存在的追评无法找到根评论，作为自身的根评论，补全以后不再有root_comment_id为0的记录
+// 新评论创建时就会设置root_comment_id，没有root_comment_id为0的记录时说明已经补全过，直接跳过
+func (r *commentRepository) BackfillRootCommentId(db *gorm.DB) (err error) {
+	db = db.Unscoped().Session(&gorm.Session{SkipHooks: true})
+	var ids []int64
+	if err = db.Model(&models.Comment{}).Where("root_comment_id = 0").Limit(1).Pluck("id", &ids).Error; err != nil || len(ids) == 0 {
+		return err
+	}
+	if err = db.Model(&models.Comment{}).Where("(parent_comment_id = 0 OR parent_comment_id IS NULL) AND root_comment_id <> comment_id").
+		UpdateColumns(map[string]interface{}{"root_comment_id": gorm.Expr("comment_id"), "update_at": gorm.Expr("update_at")}).Error; err != nil {
+		return err
 	}
-	if err = tx.Commit().Error; err != nil {
-		zap.L().Error("commit transaction failed in DeleteCommentInfo()", zap.Error(err))
-		tx.Rollback()
+	stmt := &gorm.Statement{DB: db}
+	if err = stmt.Parse(&models.Comment{}); err != nil {
 		return err
 	}
-	zap.L().Info("commit transaction successfully in DeleteCommentInfo()")
-	return nil
+	table := stmt.Schema.Table
+	// 每一轮补全一层追评，直到没有可以补全的记录
+	for {
+		res := db.Exec("UPDATE " + table + " c JOIN " + table + " p ON c.parent_comment_id = p.comment_id " +
+			"SET c.root_comment_id = p.root_comment_id, c.update_at = c.update_at " +
+			"WHERE c.parent_comment_id <> 0 AND c.root_comment_id = 0 AND p.root_comment_id <> 0")
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			break
+		}
+	}
+	res := db.Model(&models.Comment{}).Where("root_comment_id = 0").
+		UpdateColumns(map[string]interface{}{"root_comment_id": gorm.Expr("comment_id"), "update_at": gorm.Expr("update_at")})
+	if res.RowsAffected > 0 {
+		zap.L().Warn("comments whose parent no longer exists are used as root comments", zap.Int64("count", res.RowsAffected))
+	}
+	return res.Error
+}
+
+// EditComment 保存评论编辑前的版本，并更新评论内容
+func (r *commentRepository) EditComment(db *gorm.DB, history *models.CommentHistory, content string, editedAt time.Time) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(history).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Comment{}).Where("comment_id = ?", history.CommentId).
+			Updates(map[string]interface{}{"content": content, "edited_at": editedAt}).Error
+	})
+}
+
+// UpdateScore 更新评论的热度，显式保留update_at，避免被MySQL的ON UPDATE自动修改
+func (r *commentRepository) UpdateScore(db *gorm.DB, commentId, score int64) (err error) {
+	return db.Model(&models.Comment{}).Where("comment_id = ?", commentId).
+		UpdateColumns(map[string]interface{}{"score": score, "update_at": gorm.Expr("update_at")}).Error
+}
+
+// FindDeleted 获取指定的已被软删除的评论
+func (r *commentRepository) FindDeleted(db *gorm.DB, commentIds []string) (list []models.Comment) {
+	if err := db.Unscoped().Where("comment_id IN (?) AND delete_at IS NOT NULL", commentIds).Find(&list).Error; err != nil {
+		zap.L().Error("find deleted comments error in FindDeleted()", zap.Error(err))
+	}
+	return
+}
+
+// FindIdsByPostIdUnscoped 获取帖子下所有评论的id，包括已被软删除的评论
+func (r *commentRepository) FindIdsByPostIdUnscoped(db *gorm.DB, postId int64) (ids []int64) {
+	if err := db.Unscoped().Model(&models.Comment{}).Where("post_id = ?", postId).Pluck("comment_id", &ids).Error; err != nil {
+		zap.L().Error("find comment ids error in FindIdsByPostIdUnscoped()", zap.Error(err))
+	}
+	return
+}
+
+// RestoreCommentInfo 恢复在同一时间被删除的评论
+func (r *commentRepository) RestoreCommentInfo(db *gorm.DB, commentIds []string, deleteAt time.Time) (err error) {
+	err = db.Unscoped().Model(&models.Comment{}).Where("comment_id IN (?) AND delete_at = ?", commentIds, deleteAt).
+		Update("delete_at", nil).Error
+	return
+}
+
+// PurgeCommentInfo 彻底删除评论以及对评论的点赞记录、编辑历史、@记录
+func (r *commentRepository) PurgeCommentInfo(db *gorm.DB, commentIds []string) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("type = ? AND target_id IN (?)", 2, commentIds).Delete(&models.Vote{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("comment_id IN (?)", commentIds).Delete(&models.CommentHistory{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("source_type = ? AND source_id IN (?)", 2, commentIds).Delete(&models.Mention{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("comment_id IN (?)", commentIds).Delete(&models.Comment{}).Error
+	})
 }
@@ -26,3 +26,13 @@ func (r *communityRepository) Find(db *gorm.DB, cnd *sqls.Cnd) (list []models.Co
 	cnd.Find(db, &list)
 	return
 }
+
+func (r *communityRepository) UpdateColumn(db *gorm.DB, id int64, name string, value interface{}) (err error) {
+	err = db.Model(&models.Community{}).Where("community_id = ?", id).UpdateColumn(name, value).Error
+	return
+}
+
+func (r *communityRepository) Updates(db *gorm.DB, id int64, columns map[string]interface{}) (err error) {
+	err = db.Model(&models.Community{}).Where("community_id = ?", id).Updates(columns).Error
+	return
+}
@@ -0,0 +1,36 @@
+package mysql_repo
+
+import (
+	"bluebell/models"
+	"bluebell/pkg/sqls"
+	"gorm.io/gorm"
+)
+
+var MentionRepository = newMentionRepository()
+
+func newMentionRepository() *mentionRepository { return &mentionRepository{} }
+
+type mentionRepository struct{}
+
+func (r *mentionRepository) Find(db *gorm.DB, cnd *sqls.Cnd) (list []models.Mention) {
+	cnd.Find(db, &list)
+	return
+}
+
+// FindBySource 获取帖子/评论中的所有@记录，按照出现的位置排序
+func (r *mentionRepository) FindBySource(db *gorm.DB, sourceType int8, sourceId int64) (list []models.Mention) {
+	return r.Find(db, sqls.NewCnd().Where("source_type = ? AND source_id = ?", sourceType, sourceId).Asc("start"))
+}
+
+// Replace 用新的@记录替换帖子/评论原有的记录，mentions为空时只删除原有记录
+func (r *mentionRepository) Replace(db *gorm.DB, sourceType int8, sourceId int64, mentions []models.Mention) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("source_type = ? AND source_id = ?", sourceType, sourceId).Delete(&models.Mention{}).Error; err != nil {
+			return err
+		}
+		if len(mentions) == 0 {
+			return nil
+		}
+		return tx.Create(&mentions).Error
+	})
+}
@@ -0,0 +1,37 @@
+package mysql_repo
+
+import (
+	"bluebell/models"
+	"bluebell/pkg/sqls"
+	"gorm.io/gorm"
+)
+
+var MessageRepository = newMessageRepository()
+
+func newMessageRepository() *messageRepository { return &messageRepository{} }
+
+type messageRepository struct{}
+
+func (r *messageRepository) FindConversations(db *gorm.DB, cnd *sqls.Cnd) (list []models.Conversation) {
+	cnd.Find(db, &list)
+	return
+}
+
+func (r *messageRepository) Find(db *gorm.DB, cnd *sqls.Cnd) (list []models.Message) {
+	cnd.Find(db, &list)
+	return
+}
+
+// FindByUser 获取用户参与的所有会话以及会话中的消息
+func (r *messageRepository) FindByUser(db *gorm.DB, userId int64) (conversations []models.Conversation, messages []models.Message) {
+	conversations = r.FindConversations(db, sqls.NewCnd().Where("user_1_id = ? OR user_2_id = ?", userId, userId).Asc("id"))
+	if len(conversations) == 0 {
+		return
+	}
+	ids := make([]int64, len(conversations))
+	for i, c := range conversations {
+		ids[i] = c.ConversationId
+	}
+	messages = r.Find(db, sqls.NewCnd().In("conversation_id", ids).Asc("id"))
+	return
+}
@@ -26,6 +26,11 @@ func InitDB(cfg *settings.MysqlConfig) (err error) {
 	}
 	if err = sqls.Open(cfg, gormConf, models.Models...); err != nil {
 		zap.L().Error("InitDB error...", zap.Error(err))
+		return err
+	}
+	// 评论树改为保存在MySQL中，需要为旧的评论补全root_comment_id
+	if err = CommentRepository.BackfillRootCommentId(sqls.DB()); err != nil {
+		zap.L().Error("backfill root comment id error...", zap.Error(err))
 	}
 	return err
 }
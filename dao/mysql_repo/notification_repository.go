@@ -0,0 +1,38 @@
+package mysql_repo
+
+import (
+	"bluebell/models"
+	"bluebell/pkg/sqls"
+	"gorm.io/gorm"
+	"time"
+)
+
+var NotificationRepository = newNotificationRepository()
+
+func newNotificationRepository() *notificationRepository { return &notificationRepository{} }
+
+type notificationRepository struct{}
+
+func (r *notificationRepository) Create(db *gorm.DB, t *models.Notification) (err error) {
+	err = db.Create(t).Error
+	return
+}
+
+func (r *notificationRepository) Find(db *gorm.DB, cnd *sqls.Cnd) (list []models.Notification) {
+	cnd.Find(db, &list)
+	return
+}
+
+func (r *notificationRepository) Count(db *gorm.DB, cnd *sqls.Cnd) int64 {
+	return cnd.Count(db, &models.Notification{})
+}
+
+// MarkRead 将用户的通知标记为已读，ids为空时标记该用户所有的未读通知
+func (r *notificationRepository) MarkRead(db *gorm.DB, userId int64, ids []string, readAt time.Time) (err error) {
+	tx := db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userId)
+	if len(ids) > 0 {
+		tx = tx.Where("notification_id IN (?)", ids)
+	}
+	err = tx.Update("read_at", readAt).Error
+	return
+}
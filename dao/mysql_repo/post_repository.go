@@ -6,6 +6,7 @@ import (
 	"bluebell/pkg/sqls"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"time"
 )
 
 var PostRepository = newPostRepository()
@@ -44,6 +45,20 @@ func (r *postRepository) UpdateColumn(db *gorm.DB, id int64, name string, value
 	return
 }
 
+// UpdateCommentSetting 修改帖子的评论设置（置顶/锁定），显式保留update_at，这些操作不算作编辑帖子
+func (r *postRepository) UpdateCommentSetting(db *gorm.DB, id int64, columns map[string]interface{}) (err error) {
+	columns["update_at"] = gorm.Expr("update_at")
+	err = db.Model(&models.Post{}).Where("post_id = ?", id).UpdateColumns(columns).Error
+	return
+}
+
+// UnpinComment 帖子置顶的是commentId时取消置顶，返回是否修改了帖子
+func (r *postRepository) UnpinComment(db *gorm.DB, id, commentId int64) (bool, error) {
+	res := db.Model(&models.Post{}).Where("post_id = ? AND pinned_comment_id = ?", id, commentId).
+		UpdateColumns(map[string]interface{}{"pinned_comment_id": 0, "update_at": gorm.Expr("update_at")})
+	return res.RowsAffected > 0, res.Error
+}
+
 func (r *postRepository) Count(db *gorm.DB, cnd *sqls.Cnd) int64 {
 	return cnd.Count(db, &models.Post{})
 }
@@ -61,23 +76,24 @@ func (r *postRepository) FindPageByCnd(db *gorm.DB, cnd *sqls.Cnd) (list []model
 
 }
 
-func (r *postRepository) DeletePostInfo(db *gorm.DB, postId int64) (err error) {
+// DeletePostInfo 软删除帖子以及帖子下的收藏/评论，所有记录使用同一个删除时间，方便从回收站恢复
+func (r *postRepository) DeletePostInfo(db *gorm.DB, postId int64, deleteAt time.Time) (err error) {
 	tx := db.Begin()
 	if err = tx.Error; err != nil {
 		zap.L().Error("create transaction failed in DeletePostInfo()", zap.Error(err))
 		return err
 	}
-	if err = tx.Delete(&models.Post{}, "post_id = ?", postId).Error; err != nil {
+	if err = tx.Model(&models.Post{}).Where("post_id = ?", postId).Update("delete_at", deleteAt).Error; err != nil {
 		zap.L().Error("delete post failed in DeletePostInfo()", zap.Error(err))
 		tx.Rollback()
 		return err
 	}
-	if err = tx.Delete(&models.Like{}, "post_id = ?", postId).Error; err != nil {
+	if err = tx.Model(&models.Like{}).Where("post_id = ?", postId).Update("delete_at", deleteAt).Error; err != nil {
 		zap.L().Error("delete post in like  failed in DeletePostInfo()", zap.Error(err))
 		tx.Rollback()
 		return err
 	}
-	if err = tx.Delete(&models.Comment{}, "post_id = ?", postId).Error; err != nil {
+	if err = tx.Model(&models.Comment{}).Where("post_id = ?", postId).Update("delete_at", deleteAt).Error; err != nil {
 		zap.L().Error("delete posts' comment failed in DeletePostInfo()", zap.Error(err))
 		tx.Rollback()
 		return err
@@ -91,6 +107,61 @@ func (r *postRepository) DeletePostInfo(db *gorm.DB, postId int64) (err error) {
 	return nil
 }
 
+// GetDeleted 获取已被软删除的帖子
+func (r *postRepository) GetDeleted(db *gorm.DB, id int64) *models.Post {
+	ret := &models.Post{}
+	if err := db.Unscoped().Where("delete_at IS NOT NULL").First(ret, "post_id = ?", id).Error; err != nil {
+		return nil
+	}
+	return ret
+}
+
+// RestorePostInfo 恢复和帖子在同一时间被删除的帖子/收藏/评论
+func (r *postRepository) RestorePostInfo(db *gorm.DB, postId int64, deleteAt time.Time) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Post{}).Where("post_id = ? AND delete_at = ?", postId, deleteAt).
+			Update("delete_at", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Like{}).Where("post_id = ? AND delete_at = ?", postId, deleteAt).
+			Update("delete_at", nil).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&models.Comment{}).Where("post_id = ? AND delete_at = ?", postId, deleteAt).
+			Update("delete_at", nil).Error
+	})
+}
+
+// PurgePostInfo 彻底删除帖子，以及帖子下的评论/收藏/点赞记录
+func (r *postRepository) PurgePostInfo(db *gorm.DB, postId int64) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		commentIds := tx.Unscoped().Model(&models.Comment{}).Select("comment_id").Where("post_id = ?", postId)
+		if err := tx.Unscoped().Where("type = ? AND target_id IN (?)", 2, commentIds).Delete(&models.Vote{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("comment_id IN (?)", commentIds).Delete(&models.CommentHistory{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("type = ? AND target_id = ?", 1, postId).Delete(&models.Vote{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("post_id = ?", postId).Delete(&models.Mention{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("post_id = ?", postId).Delete(&models.Comment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("post_id = ?", postId).Delete(&models.Like{}).Error; err != nil {
+			return err
+		}
+		// 帖子下单独删除的评论的回收站记录，帖子删除以后这些评论已经无法恢复
+		if err := tx.Unscoped().Where("type = ? AND post_id = ?", 2, postId).Delete(&models.Trash{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("post_id = ?", postId).Delete(&models.Post{}).Error
+	})
+}
+
 func (r *postRepository) IncreaseClickNum(db *gorm.DB, postId int64) (err error) {
 	// 开始事务
 	tx := db.Begin()
@@ -118,6 +189,18 @@ func (r *postRepository) IncreaseClickNum(db *gorm.DB, postId int64) (err error)
 	return tx.Commit().Error
 }
 
+// IncreaseShareNum 帖子分享链接被访问一次，分享数+1
+func (r *postRepository) IncreaseShareNum(db *gorm.DB, postId int64) (err error) {
+	return db.Model(&models.Post{}).Where("post_id = ?", postId).
+		UpdateColumn("share_nums", gorm.Expr("share_nums + ?", 1)).Error
+}
+
+// IncrScore 增量修改帖子的投票得分
+func (r *postRepository) IncrScore(db *gorm.DB, postId int64, delta int64) (err error) {
+	return db.Model(&models.Post{}).Where("post_id = ?", postId).
+		UpdateColumn("score", gorm.Expr("score + ?", delta)).Error
+}
+
 func (r *postRepository) AddPostCollection(db *gorm.DB, postId, userId int64) (err error) {
 	// 开始事务
 	tx := db.Begin()
@@ -0,0 +1,47 @@
+package mysql_repo
+
+import (
+	"bluebell/models"
+	"bluebell/pkg/sqls"
+	"gorm.io/gorm"
+)
+
+var ReactionRepository = newReactionRepository()
+
+func newReactionRepository() *reactionRepository { return &reactionRepository{} }
+
+type reactionRepository struct{}
+
+func (r *reactionRepository) Take(db *gorm.DB, where ...interface{}) *models.Reaction {
+	ret := &models.Reaction{}
+	if err := db.Take(ret, where...).Error; err != nil {
+		return nil
+	}
+	return ret
+}
+
+func (r *reactionRepository) Find(db *gorm.DB, cnd *sqls.Cnd) (list []models.Reaction) {
+	cnd.Find(db, &list)
+	return
+}
+
+// Add 添加回应，已经存在时不做处理
+func (r *reactionRepository) Add(db *gorm.DB, t *models.Reaction) (err error) {
+	if r.Take(db, "user_id = ? AND target_type = ? AND target_id = ? AND emoji = ?", t.UserId, t.TargetType, t.TargetId, t.Emoji) != nil {
+		return nil
+	}
+	err = db.Create(t).Error
+	return
+}
+
+// Remove 取消回应，回应记录直接物理删除，避免和唯一索引冲突
+func (r *reactionRepository) Remove(db *gorm.DB, t *models.Reaction) (err error) {
+	err = db.Unscoped().Where("user_id = ? AND target_type = ? AND target_id = ? AND emoji = ?", t.UserId, t.TargetType, t.TargetId, t.Emoji).
+		Delete(&models.Reaction{}).Error
+	return
+}
+
+// FindByTarget 获取帖子/评论的所有回应
+func (r *reactionRepository) FindByTarget(db *gorm.DB, targetType int8, targetId int64) (list []models.Reaction) {
+	return r.Find(db, sqls.NewCnd().Where("target_type = ? AND target_id = ?", targetType, targetId))
+}
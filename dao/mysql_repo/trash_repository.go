@@ -0,0 +1,49 @@
+package mysql_repo
+
+import (
+	"bluebell/models"
+	"bluebell/pkg/sqls"
+	"gorm.io/gorm"
+)
+
+var TrashRepository = newTrashRepository()
+
+func newTrashRepository() *trashRepository { return &trashRepository{} }
+
+type trashRepository struct{}
+
+func (r *trashRepository) Create(db *gorm.DB, t *models.Trash) (err error) {
+	err = db.Create(t).Error
+	return
+}
+
+func (r *trashRepository) Get(db *gorm.DB, id int64) *models.Trash {
+	ret := &models.Trash{}
+	if err := db.First(ret, "trash_id = ?", id).Error; err != nil {
+		return nil
+	}
+	return ret
+}
+
+func (r *trashRepository) Find(db *gorm.DB, cnd *sqls.Cnd) (list []models.Trash) {
+	cnd.Find(db, &list)
+	return
+}
+
+func (r *trashRepository) FindPageByCnd(db *gorm.DB, cnd *sqls.Cnd) (list []models.Trash, paging *sqls.Paging) {
+	cnd.Find(db, &list)
+	count := cnd.Count(db, &models.Trash{})
+
+	paging = &sqls.Paging{
+		Page:  cnd.Paging.Page,
+		Limit: cnd.Paging.Limit,
+		Total: count,
+	}
+	return
+}
+
+// Delete 回收站记录在恢复或清理以后不再需要，直接物理删除
+func (r *trashRepository) Delete(db *gorm.DB, id int64) (err error) {
+	err = db.Unscoped().Delete(&models.Trash{}, "trash_id = ?", id).Error
+	return
+}
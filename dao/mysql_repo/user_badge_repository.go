@@ -0,0 +1,25 @@
+package mysql_repo
+
+import (
+	"bluebell/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var UserBadgeRepository = newUserBadgeRepository()
+
+func newUserBadgeRepository() *userBadgeRepository { return &userBadgeRepository{} }
+
+type userBadgeRepository struct{}
+
+// Create 颁发徽章，已经颁发过时不做处理，返回是否是新颁发的
+func (r *userBadgeRepository) Create(db *gorm.DB, t *models.UserBadge) (created bool, err error) {
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(t)
+	return res.RowsAffected > 0, res.Error
+}
+
+// FindByUserId 获取用户获得的徽章，最新获得的在前
+func (r *userBadgeRepository) FindByUserId(db *gorm.DB, userId int64) (list []models.UserBadge) {
+	db.Where("user_id = ?", userId).Order("id desc").Find(&list)
+	return
+}
@@ -55,3 +55,15 @@ func (r *userFollowRepository) Creates(db *gorm.DB, ts []*models.Follow) error {
 	err := db.Create(&ts).Error
 	return err
 }
+
+// FindFollowingIds 查询用户关注的所有用户id
+func (r *userFollowRepository) FindFollowingIds(db *gorm.DB, userId int64) (ids []int64) {
+	db.Model(&models.Follow{}).Where("follower_id = ? AND val = 1", userId).Pluck("following_id", &ids)
+	return
+}
+
+// FindFollowerIds 查询用户所有粉丝的id
+func (r *userFollowRepository) FindFollowerIds(db *gorm.DB, userId int64) (ids []int64) {
+	db.Model(&models.Follow{}).Where("following_id = ? AND val = 1", userId).Pluck("follower_id", &ids)
+	return
+}
@@ -0,0 +1,48 @@
+package mysql_repo
+
+import (
+	"bluebell/models"
+	"gorm.io/gorm"
+)
+
+var UserIdentityRepository = newUserIdentityRepository()
+
+func newUserIdentityRepository() *userIdentityRepository { return &userIdentityRepository{} }
+
+type userIdentityRepository struct{}
+
+// GetBySubject 根据身份提供方和用户在身份提供方的标识查找绑定关系
+func (r *userIdentityRepository) GetBySubject(db *gorm.DB, provider, subject string) *models.UserIdentity {
+	ret := &models.UserIdentity{}
+	if err := db.Take(ret, "provider = ? AND subject = ?", provider, subject).Error; err != nil {
+		return nil
+	}
+	return ret
+}
+
+func (r *userIdentityRepository) FindByUserId(db *gorm.DB, userId int64) (list []models.UserIdentity) {
+	db.Where("user_id = ?", userId).Order("id asc").Find(&list)
+	return
+}
+
+func (r *userIdentityRepository) Create(db *gorm.DB, t *models.UserIdentity) (err error) {
+	err = db.Create(t).Error
+	return
+}
+
+// CreateWithUser 第三方登录自动注册时，在同一个事务中创建用户和绑定关系
+func (r *userIdentityRepository) CreateWithUser(db *gorm.DB, u *models.User, t *models.UserIdentity) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(u).Error; err != nil {
+			return err
+		}
+		t.UserId = u.UserId
+		return tx.Create(t).Error
+	})
+}
+
+// Delete 解绑时物理删除记录，之后可以重新绑定同一个第三方账号
+func (r *userIdentityRepository) Delete(db *gorm.DB, userId int64, provider string) (err error) {
+	err = db.Unscoped().Where("user_id = ? AND provider = ?", userId, provider).Delete(&models.UserIdentity{}).Error
+	return
+}
@@ -0,0 +1,49 @@
+package mysql_repo
+
+import (
+	"bluebell/models"
+	"gorm.io/gorm"
+)
+
+var UserMfaRepository = newUserMfaRepository()
+
+func newUserMfaRepository() *userMfaRepository { return &userMfaRepository{} }
+
+type userMfaRepository struct{}
+
+// GetByUserId 获取用户的两步验证设置，没有设置过时返回nil
+func (r *userMfaRepository) GetByUserId(db *gorm.DB, userId int64) *models.UserMfa {
+	ret := &models.UserMfa{}
+	if err := db.Take(ret, "user_id = ?", userId).Error; err != nil {
+		return nil
+	}
+	return ret
+}
+
+func (r *userMfaRepository) Create(db *gorm.DB, t *models.UserMfa) (err error) {
+	err = db.Create(t).Error
+	return
+}
+
+func (r *userMfaRepository) Updates(db *gorm.DB, userId int64, columns map[string]interface{}) (err error) {
+	err = db.Model(&models.UserMfa{}).Where("user_id = ?", userId).Updates(columns).Error
+	return
+}
+
+// Delete 关闭两步验证时物理删除记录，重新绑定时生成新的密钥
+func (r *userMfaRepository) Delete(db *gorm.DB, userId int64) (err error) {
+	err = db.Unscoped().Where("user_id = ?", userId).Delete(&models.UserMfa{}).Error
+	return
+}
+
+// UseStep 记录验证成功的时间步，只有比上次更新的时间步才能写入，返回false说明验证码已经被使用过
+func (r *userMfaRepository) UseStep(db *gorm.DB, userId, step int64) (bool, error) {
+	res := db.Model(&models.UserMfa{}).Where("user_id = ? AND last_step < ?", userId, step).Update("last_step", step)
+	return res.RowsAffected > 0, res.Error
+}
+
+// ReplaceRecoveryCodes 在恢复码没有被并发修改时替换恢复码，用于消耗恢复码
+func (r *userMfaRepository) ReplaceRecoveryCodes(db *gorm.DB, userId int64, old, codes string) (bool, error) {
+	res := db.Model(&models.UserMfa{}).Where("user_id = ? AND recovery_codes = ?", userId, old).Update("recovery_codes", codes)
+	return res.RowsAffected > 0, res.Error
+}
@@ -0,0 +1,46 @@
+package mysql_repo
+
+import (
+	"bluebell/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var UserPreferenceRepository = newUserPreferenceRepository()
+
+func newUserPreferenceRepository() *userPreferenceRepository { return &userPreferenceRepository{} }
+
+type userPreferenceRepository struct{}
+
+// GetByUserId 获取用户的偏好设置，没有保存过时返回nil
+func (r *userPreferenceRepository) GetByUserId(db *gorm.DB, userId int64) *models.UserPreference {
+	ret := &models.UserPreference{}
+	if err := db.Take(ret, "user_id = ?", userId).Error; err != nil {
+		return nil
+	}
+	return ret
+}
+
+// Save 保存用户的偏好设置，已经存在时覆盖可以修改的字段
+func (r *userPreferenceRepository) Save(db *gorm.DB, t *models.UserPreference) (err error) {
+	err = db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"post_sort", "language", "email_mention", "email_badge",
+			"digest_frequency", "message_permission", "mention_permission"}),
+	}).Create(t).Error
+	return
+}
+
+// FindDigestDue 按id顺序分批获取需要发送通知摘要的设置，sentBefore之后发送过摘要的不需要再发送
+func (r *userPreferenceRepository) FindDigestDue(db *gorm.DB, frequency string, sentBefore time.Time, afterId int64, limit int) (list []models.UserPreference) {
+	db.Where("digest_frequency = ? AND (email_mention = ? OR email_badge = ?)", frequency, true, true).
+		Where("digest_sent_at IS NULL OR digest_sent_at <= ?", sentBefore).
+		Where("id > ?", afterId).Order("id").Limit(limit).Find(&list)
+	return
+}
+
+func (r *userPreferenceRepository) UpdateDigestSentAt(db *gorm.DB, userId int64, sentAt time.Time) (err error) {
+	err = db.Model(&models.UserPreference{}).Where("user_id = ?", userId).Update("digest_sent_at", sentAt).Error
+	return
+}
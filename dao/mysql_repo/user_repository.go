@@ -3,7 +3,10 @@ package mysql_repo
 import (
 	"bluebell/models"
 	"bluebell/pkg/sqls"
+	"fmt"
 	"gorm.io/gorm"
+	"strings"
+	"time"
 )
 
 var UserRepository = newUserRepository()
@@ -57,6 +60,12 @@ func (r *userRepository) UpdateColumn(db *gorm.DB, id int64, name string, value
 	return
 }
 
+// IncrReputation 增量修改用户的声望
+func (r *userRepository) IncrReputation(db *gorm.DB, id int64, delta int64) (err error) {
+	return db.Model(&models.User{}).Where("user_id = ?", id).
+		UpdateColumn("reputation", gorm.Expr("reputation + ?", delta)).Error
+}
+
 func (r *userRepository) GetByUsername(db *gorm.DB, username string) *models.User {
 	return r.Take(db, "username = ?", username)
 }
@@ -64,3 +73,64 @@ func (r *userRepository) GetByUsername(db *gorm.DB, username string) *models.Use
 func (r *userRepository) GetByEmail(db *gorm.DB, email string) *models.User {
 	return r.Take(db, "email = ?", email)
 }
+
+// FindByUsernamePrefix 按照用户名前缀查找用户，用于@用户时的自动补全
+func (r *userRepository) FindByUsernamePrefix(db *gorm.DB, prefix string, limit int) (list []models.User) {
+	prefix = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix)
+	return r.Find(db, sqls.NewCnd().Cols("user_id", "username").Where("username LIKE ?", prefix+"%").
+		Where("status <> ?", models.UserStatusDeleted).Asc("username").Limit(limit))
+}
+
+// FindDeletionDue 查找在before之前申请注销、冷静期已经结束的账号
+func (r *userRepository) FindDeletionDue(db *gorm.DB, before time.Time, limit int) (list []models.User) {
+	return r.Find(db, sqls.NewCnd().Where("delete_request_at IS NOT NULL AND delete_request_at <= ?", before).
+		Where("status <> ?", models.UserStatusDeleted).Asc("delete_request_at").Limit(limit))
+}
+
+// Anonymize 注销账号：清除用户名、邮箱、密码，删除关注关系、收藏、通知和偏好设置，@记录中的用户名替换为已注销
+// 用户发布的帖子、评论以及投票保留，展示时作者显示为已注销
+func (r *userRepository) Anonymize(db *gorm.DB, userId int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// 保留前缀之前注册的账号可能已经占用了这个用户名，此时加上时间戳避免唯一索引冲突
+		username := fmt.Sprintf("%s%d", models.DeletedUsernamePrefix, userId)
+		var count int64
+		if err := tx.Model(&models.User{}).Where("username = ? AND user_id <> ?", username, userId).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			username = fmt.Sprintf("%s_%d", username, time.Now().UnixNano())
+		}
+		if err := tx.Model(&models.User{}).Where("user_id = ?", userId).Updates(map[string]interface{}{
+			"username": username,
+			"email":    "",
+			"password": "",
+			"gender":   0,
+			"verified": false,
+			"status":   models.UserStatusDeleted,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("follower_id = ? OR following_id = ?", userId, userId).Delete(&models.Follow{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userId).Delete(&models.Like{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userId).Delete(&models.Notification{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userId).Delete(&models.UserMfa{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userId).Delete(&models.UserIdentity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userId).Delete(&models.UserBadge{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userId).Delete(&models.UserPreference{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Mention{}).Where("user_id = ?", userId).Update("username", models.DeletedUsername).Error
+	})
+}
@@ -53,6 +53,10 @@ func (r *voteRepository) UpdateColumn(db *gorm.DB, id int64, name string, value
 	err = db.Model(&models.Vote{}).Where("vote_id = ?", id).UpdateColumn(name, value).Error
 	return
 }
+func (r *voteRepository) UpdateColumns(db *gorm.DB, id int64, columns map[string]interface{}) (err error) {
+	err = db.Model(&models.Vote{}).Where("vote_id = ?", id).UpdateColumns(columns).Error
+	return
+}
 func (r *voteRepository) Count(db *gorm.DB, cnd *sqls.Cnd) int64 {
 	return cnd.Count(db, &models.Vote{})
 }
@@ -70,6 +74,14 @@ func (r *voteRepository) FindPageByCnd(db *gorm.DB, cnd *sqls.Cnd) (list []model
 
 }
 
+// CountLikesReceived 统计用户发布的帖子和评论一共收到的点赞数
+func (r *voteRepository) CountLikesReceived(db *gorm.DB, userId int64) (count int64) {
+	posts := db.Model(&models.Post{}).Select("post_id").Where("author_id = ?", userId)
+	comments := db.Model(&models.Comment{}).Select("comment_id").Where("user_id = ?", userId)
+	db.Model(&models.Vote{}).Where("val = 1 AND ((type = 1 AND target_id IN (?)) OR (type = 2 AND target_id IN (?)))", posts, comments).Count(&count)
+	return
+}
+
 func (r *voteRepository) Delete(db *gorm.DB, id int64) {
 	db.Delete(&models.Like{}, "vote_id = ?", id)
 }
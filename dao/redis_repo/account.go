@@ -0,0 +1,61 @@
+package redis_repo
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+func followListKey(userId string) string { return getKey(KeyUserFollowListSet + ":" + userId) }
+
+func fansListKey(userId string) string { return getKey(KeyUserFansListSet) + ":" + userId }
+
+// ClearUserData 注销账号时清除用户在Redis中的关注/粉丝关系、计数、黑名单和收藏记录
+// 同时从被关注用户的粉丝列表、粉丝的关注列表中移除该用户，并修正对方的计数
+func ClearUserData(ctx context.Context, userId int64) error {
+	id := strconv.FormatInt(userId, 10)
+	follows, err := rdb.SMembers(ctx, followListKey(id)).Result()
+	if err != nil {
+		return err
+	}
+	fans, err := rdb.SMembers(ctx, fansListKey(id)).Result()
+	if err != nil {
+		return err
+	}
+	pipe := rdb.TxPipeline()
+	for _, f := range follows {
+		pipe.SRem(ctx, fansListKey(f), id)
+		pipe.ZIncrBy(ctx, getKey(KeyUserFansCountZset), -1, f)
+	}
+	for _, f := range fans {
+		pipe.SRem(ctx, followListKey(f), id)
+		pipe.ZIncrBy(ctx, getKey(KeyUserFollowsCountZset), -1, f)
+	}
+	pipe.Del(ctx, followListKey(id), fansListKey(id),
+		getKey(KeyUserBlackListSet+":"+id), getKey(KeyPostUserCollection+id), getKey(KeyUserExportPrefix+id), getKey(KeyUserStatsPrefix+id),
+		getKey(KeyBadgeStreakPrefix+id))
+	pipe.ZRem(ctx, getKey(KeyUserFansCountZset), id)
+	pipe.ZRem(ctx, getKey(KeyUserFollowsCountZset), id)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// SetDataExport 记录个人数据导出的状态，过期后导出记录自动删除
+func SetDataExport(ctx context.Context, userId int64, status, file string, createAt time.Time, expiration time.Duration) error {
+	key := getKey(KeyUserExportPrefix + strconv.FormatInt(userId, 10))
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, key, "status", status, "file", file, "create_at", createAt.Unix())
+	pipe.Expire(ctx, key, expiration)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetDataExport 获取个人数据导出的状态，没有导出记录时status为空
+func GetDataExport(ctx context.Context, userId int64) (status, file string, createAt time.Time, err error) {
+	res, err := rdb.HGetAll(ctx, getKey(KeyUserExportPrefix+strconv.FormatInt(userId, 10))).Result()
+	if err != nil || len(res) == 0 {
+		return "", "", time.Time{}, err
+	}
+	ts, _ := strconv.ParseInt(res["create_at"], 10, 64)
+	return res["status"], res["file"], time.Unix(ts, 0), nil
+}
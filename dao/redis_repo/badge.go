@@ -0,0 +1,33 @@
+package redis_repo
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// 同一天内的活动不改变连续天数，比最后活跃日期更早的活动（消息乱序）直接忽略
+var streakScript = redis.NewScript(`
+local day = tonumber(ARGV[1])
+local last = tonumber(redis.call("HGET", KEYS[1], "day") or "0")
+local n = tonumber(redis.call("HGET", KEYS[1], "len") or "0")
+if day <= last then
+	return n
+end
+if day == last + 1 then
+	n = n + 1
+else
+	n = 1
+end
+redis.call("HSET", KEYS[1], "day", day, "len", n)
+redis.call("EXPIRE", KEYS[1], ARGV[2])
+return n
+`)
+
+// UpdateStreak 记录用户在day（从1970-01-01开始的天数）活跃，返回连续活跃的天数
+// 超过expiration没有活动时记录过期，连续天数重新计算
+func UpdateStreak(ctx context.Context, userId, day int64, expiration time.Duration) (int64, error) {
+	key := getKey(KeyBadgeStreakPrefix + strconv.FormatInt(userId, 10))
+	return streakScript.Run(ctx, rdb, []string{key}, day, int64(expiration/time.Second)).Int64()
+}
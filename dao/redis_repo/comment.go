@@ -3,29 +3,22 @@ package redis_repo
 import (
 	"bluebell/models"
 	"errors"
-	"fmt"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"strconv"
 	"time"
 )
 
-func CreateComment(comment *models.Comment, rootCommentId int64) (err error) {
+func CreateComment(comment *models.Comment) (err error) {
 	pipe := rdb.TxPipeline()
 	// 创建评论的time和score记录，以及该评论归属于哪一post
 	pipe.ZAdd(ctx, getKey(KeyCommentTimeZset), redis.Z{Score: float64(time.Now().Unix()), Member: comment.CommentId})
-	pipe.ZAdd(ctx, getKey(KeyCommentScoreZset), redis.Z{Score: 0, Member: comment.CommentId})
+	pipe.ZAdd(ctx, getKey(KeyCommentScoreZset), redis.Z{Score: float64(comment.Score) / models.CommentScoreScale, Member: comment.CommentId})
 	// 添加帖子的评论数量 post:comment_numbers,zset， key 为帖子id
 	pipe.ZIncrBy(ctx, getKey(KeyPostCommentZset), 1, strconv.FormatInt(comment.PostId, 10))
 	if comment.ParentCommentId == 0 {
-		// 只有post的根评论才加到Redis数据库 bluebell:post:[commentId] set
+		// 只有post的根评论才加到Redis数据库 bluebell:post:[commentId] set，追评通过MySQL中的root_comment_id查询
 		pipe.SAdd(ctx, getKey(KeyPostPrefix+strconv.FormatInt(comment.PostId, 10)), comment.CommentId)
-
-	} else {
-		// 评论的评论，需要记录到Redis中，方便从根评论找到所有子评论,记录到bluebell:comment:child_comment_record:[parent_comment_id],set
-		pipe.SAdd(ctx, getKey(KeyCommentSubCommentSet+":"+strconv.FormatInt(comment.ParentCommentId, 10)), comment.CommentId)
-		// 记录根评论下的评论总数,bluebell:comment:comment_numbers,zset key 为rootCommentId
-		pipe.ZIncrBy(ctx, getKey(KeyCommentSubCommentCntZset), 1, strconv.FormatInt(rootCommentId, 10))
 	}
 
 	_, err = pipe.Exec(ctx)
@@ -76,136 +69,86 @@ func SetUser2CommentVotedAndPostVoteNum(curDirection, oDirection float64, postId
 	return
 }
 
-// GetToDeleteComment 从Redis中获取所有需要删除的commentId，从KeyCommentSubCommentSet:commentId逐个记录
-func GetToDeleteComment(commentId, rootCommentId int64) (res []string, err error) {
-	var que []string
-	que = append(que, strconv.FormatInt(commentId, 10))
-	for len(que) > 0 {
-		cur := que[0]
-		que = que[1:]
-		res = append(res, cur)
-		tmp, err := rdb.SMembers(ctx, getKey(KeyCommentSubCommentSet+":"+cur)).Result()
-		if err != nil {
-			zap.L().Error("find child comments error in redis_repo.GetToDeleteComment()", zap.Error(err))
-			return nil, err
-		}
-		que = append(que, tmp...)
+// CommentVotesLoaded 判断Redis中是否有评论的投票数据，投票过或者从MySQL重建过的评论才会有点赞数记录
+func CommentVotesLoaded(commentId string) (bool, error) {
+	_, err := rdb.ZScore(ctx, getKey(KeyCommentVoteZset), commentId).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
 	}
-	return res, nil
+	return err == nil, err
 }
 
-func DeleteCommentInfo(commentId, rootCommentId, postId int64, relatedCommentIds []string) (err error) {
-	pipe := rdb.TxPipeline()
-
-	for _, id := range relatedCommentIds {
-		_, err = rdb.ZScore(ctx, getKey(KeyCommentVoteZset), id).Result()
-		if errors.Is(err, redis.Nil) {
-			zap.L().Info(fmt.Sprintf("%s:%d not exists in redis.", getKey(KeyCommentVoteZset), id))
-		} else if err == nil {
-			pipe.ZRem(ctx, getKey(KeyCommentVoteZset), id)
-		} else {
-			zap.L().Error("execute rdb.ZScore(ctx,getKey(KeyCommentVoteZset),id).Result() error!", zap.Error(err))
-			return err
-		}
-
-		_, err = rdb.ZScore(ctx, getKey(KeyCommentDevoteZset), id).Result()
-		if errors.Is(err, redis.Nil) {
-			zap.L().Info(fmt.Sprintf("%s:%d not exists in redis.", getKey(KeyCommentDevoteZset), id))
-		} else if err == nil {
-			pipe.ZRem(ctx, getKey(KeyCommentDevoteZset), id)
-		} else {
-			zap.L().Error("execute rdb.ZScore(ctx,getKey(KeyCommentDevoteZset),id).Result() error!", zap.Error(err))
-			return err
-		}
-
-		flag, err := rdb.Exists(ctx, getKey(KeyCommentVotedZset+":"+id)).Result()
-		if err != nil {
-			zap.L().Error("execute rdb.Exists(ctx,getKey(KeyCommentSubCommentCntZset),commentId).Result() error!", zap.Error(err))
-			return err
-		}
-		if flag > 0 {
-			pipe.Del(ctx, getKey(KeyCommentVotedZset+":"+id))
-		}
-
-		key := getKey(KeyCommentSubCommentSet + ":" + id)
-		flag, err = rdb.Exists(ctx, key).Result()
-		if err != nil {
-			zap.L().Error("execute rdb.Exists(ctx,getKey(KeyCommentSubCommentCntZset),commentId).Result() error!", zap.Error(err))
-			return err
-		}
-		if flag > 0 {
-			pipe.Del(ctx, key)
-		}
-
-		// score需要在for中删除
-		_, err = rdb.ZScore(ctx, getKey(KeyCommentScoreZset), id).Result()
-		if errors.Is(err, redis.Nil) {
-			zap.L().Info(fmt.Sprintf("%s:%s not exists in redis.", getKey(KeyCommentScoreZset), id))
-
-		} else if err == nil {
-			pipe.ZRem(ctx, getKey(KeyCommentScoreZset), id)
-		} else {
-			zap.L().Error("execute rdb.ZScore(ctx,getKey(KeyCommentScoreZset),id).Result() error!", zap.Error(err))
-			return err
-		}
-		// time需要在for中删除
-		_, err = rdb.ZScore(ctx, getKey(KeyCommentTimeZset), id).Result()
-		if errors.Is(err, redis.Nil) {
-			zap.L().Info(fmt.Sprintf("%s:%s not exists in redis.", getKey(KeyCommentTimeZset), id))
-		} else if err == nil {
-			pipe.ZRem(ctx, getKey(KeyCommentTimeZset), id)
-		} else {
-			zap.L().Error("execute rdb.ZScore(ctx,getKey(KeyPostCommentZset),commentId).Result() error!", zap.Error(err))
-			return err
-		}
-
-		// 对帖子下的评论总数执行-1操作
-		_, err = rdb.ZScore(ctx, getKey(KeyPostCommentZset), strconv.FormatInt(postId, 10)).Result()
-		if errors.Is(err, redis.Nil) {
-			zap.L().Info(fmt.Sprintf("%s:%d not exists in redis.", getKey(KeyPostCommentZset), postId))
-
-		} else if err == nil {
-			pipe.ZIncrBy(ctx, getKey(KeyPostCommentZset), -1, strconv.FormatInt(postId, 10))
-		} else {
-			zap.L().Error("execute rdb.ZScore(ctx,getKey(KeyPostCommentZset),commentId).Result() error!", zap.Error(err))
-			return err
-		}
-
-		// 对根评论下的追评总数执行-1操作
-		if id != strconv.FormatInt(rootCommentId, 10) {
-			_, err = rdb.ZScore(ctx, getKey(KeyCommentSubCommentCntZset), strconv.FormatInt(rootCommentId, 10)).Result()
-			if errors.Is(err, redis.Nil) {
-				zap.L().Info(fmt.Sprintf("%s:%d not exists in redis.", getKey(KeyCommentSubCommentCntZset), rootCommentId))
-			} else if err == nil {
-				pipe.ZIncrBy(ctx, getKey(KeyCommentSubCommentCntZset), -1, strconv.FormatInt(rootCommentId, 10))
-			} else {
-				zap.L().Error("execute rdb.ZScore(ctx,getKey(KeyCommentSubCommentCntZset),commentId).Result() error!", zap.Error(err))
-				return err
-			}
+// RebuildCommentVotes 用MySQL中的投票记录重建评论在Redis中的投票数据，votes为用户id以及投票类型
+func RebuildCommentVotes(commentId string, votes map[string]float64) (err error) {
+	var ups, downs float64
+	members := make([]redis.Z, 0, len(votes))
+	for userId, val := range votes {
+		members = append(members, redis.Z{Score: val, Member: userId})
+		if val == 1 {
+			ups++
+		} else if val == -1 {
+			downs++
 		}
+	}
+	pipe := rdb.TxPipeline()
+	pipe.Del(ctx, getKey(KeyCommentVotedZset+":"+commentId))
+	if len(members) > 0 {
+		pipe.ZAdd(ctx, getKey(KeyCommentVotedZset+":"+commentId), members...)
+	}
+	pipe.ZAdd(ctx, getKey(KeyCommentVoteZset), redis.Z{Score: ups, Member: commentId})
+	pipe.ZAdd(ctx, getKey(KeyCommentDevoteZset), redis.Z{Score: downs, Member: commentId})
+	_, err = pipe.Exec(ctx)
+	return
+}
 
+// DeleteCommentInfo 删除评论的time/score记录，并减少帖子的评论数，删除的是根评论时还需要从帖子的根评论中移除
+func DeleteCommentInfo(comment *models.Comment, deletedCommentIds []string) (err error) {
+	// 点赞/点踩记录保留到回收站过期，由PurgeCommentInfo清理，方便恢复评论
+	pipe := rdb.TxPipeline()
+	for _, id := range deletedCommentIds {
+		pipe.ZRem(ctx, getKey(KeyCommentScoreZset), id)
+		pipe.ZRem(ctx, getKey(KeyCommentTimeZset), id)
 	}
-	// 如果删除根评论，还需要删除bluebell:post:[postid] 下的根comment id，以及bluebell:comment:comment_numbers 下的根comment id
-	if commentId == rootCommentId {
-		pipe.SRem(ctx, getKey(KeyPostPrefix+strconv.FormatInt(postId, 10)), commentId)
-		pipe.ZRem(ctx, getKey(KeyCommentSubCommentCntZset), commentId)
+	postId := strconv.FormatInt(comment.PostId, 10)
+	_, err = rdb.ZScore(ctx, getKey(KeyPostCommentZset), postId).Result()
+	if err == nil {
+		pipe.ZIncrBy(ctx, getKey(KeyPostCommentZset), -float64(len(deletedCommentIds)), postId)
+	} else if !errors.Is(err, redis.Nil) {
+		zap.L().Error("execute rdb.ZScore(ctx,getKey(KeyPostCommentZset),postId).Result() error!", zap.Error(err))
+		return err
+	}
+	if comment.ParentCommentId == 0 {
+		pipe.SRem(ctx, getKey(KeyPostPrefix+postId), comment.CommentId)
 	}
+	_, err = pipe.Exec(ctx)
+	return
+}
 
-	//pipe.ZRem(ctx, getKey(KeyCommentVoteZset), commentId)
-	//pipe.ZRem(ctx, getKey(KeyCommentDevoteZset), commentId)
-	//pipe.ZRem(ctx, getKey(KeyCommentScoreZset), commentId)
-	//pipe.ZRem(ctx, getKey(KeyCommentTimeZset), commentId)
-	//pipe.ZRem(ctx, getKey(KeyPostCommentZset), rootCommentId)
-	//pipe.Del(ctx,getKey(KeyCommentVotedZset + ":" + commentId))
-	// 删除子评论计数缓存
-	//pipe.ZRem(ctx, getKey(KeyCommentSubCommentCntZset), rootCommentId)
-	// 删除所有相关的bluebell:child_comment_record:[commentId]
-	//for _, id := range relatedCommentIds {
-	//	key := getKey(KeyCommentSubCommentSet + ":" + id)
-	//	pipe.SRem(ctx, key)
-	//}
+// RestoreComments 从回收站恢复评论以后，重建评论的time/score记录以及帖子的根评论
+// commentNum 为帖子下的评论总数
+func RestoreComments(postId int64, comments []models.Comment, commentNum int64) (err error) {
+	pipe := rdb.TxPipeline()
+	for _, comment := range comments {
+		pipe.ZAdd(ctx, getKey(KeyCommentTimeZset), redis.Z{Score: float64(comment.CreateAt.Unix()), Member: comment.CommentId})
+		pipe.ZAdd(ctx, getKey(KeyCommentScoreZset), redis.Z{Score: float64(comment.Score) / models.CommentScoreScale, Member: comment.CommentId})
+		if comment.ParentCommentId == 0 {
+			pipe.SAdd(ctx, getKey(KeyPostPrefix+strconv.FormatInt(postId, 10)), comment.CommentId)
+		}
+	}
+	pipe.ZAdd(ctx, getKey(KeyPostCommentZset), redis.Z{Score: float64(commentNum), Member: strconv.FormatInt(postId, 10)})
 	_, err = pipe.Exec(ctx)
+	return
+}
 
+// PurgeCommentInfo 彻底删除评论时，清理评论的点赞/点踩记录
+func PurgeCommentInfo(commentIds []string) (err error) {
+	pipe := rdb.TxPipeline()
+	for _, id := range commentIds {
+		pipe.ZRem(ctx, getKey(KeyCommentVoteZset), id)
+		pipe.ZRem(ctx, getKey(KeyCommentDevoteZset), id)
+		pipe.Del(ctx, getKey(KeyCommentVotedZset+":"+id))
+	}
+	_, err = pipe.Exec(ctx)
 	return
 }
 
@@ -218,23 +161,6 @@ func GetAllRootComment(postId string) (res []string, err error) {
 	return res, nil
 }
 
-func GetSubCommentIdsByRootComment(rootCommentId string) (res []string, err error) {
-	var queue []string
-	queue = append(queue, rootCommentId)
-	for len(queue) > 0 {
-		cur := queue[0]
-		queue = queue[1:]
-		res = append(res, cur)
-		tmp, err := rdb.SMembers(ctx, getKey(KeyCommentSubCommentSet)+":"+cur).Result()
-		if err != nil {
-			zap.L().Error("redis_repo.GetSubCommentsByRootComment() error ", zap.Error(err))
-			return nil, err
-		}
-		queue = append(queue, tmp...)
-	}
-	return res, nil
-}
-
 func GetCommentVoteNumById(commentId string) (res int, err error) {
 	r, err := rdb.ZScore(ctx, getKey(KeyCommentVoteZset), commentId).Result()
 	if errors.Is(err, redis.Nil) {
@@ -259,14 +185,41 @@ func GetTotalCommentCountOfAPost(postId string) (res int, err error) {
 	}
 }
 
-func GetSubCommentsCountOfAComment(commentId string) (res int, err error) {
-	r, err := rdb.ZScore(ctx, getKey(KeyCommentSubCommentCntZset), commentId).Result()
-	if errors.Is(err, redis.Nil) {
-		return 0, nil
-	} else if err == nil {
-		return int(r), nil
-	} else {
-		zap.L().Error("redis_repo.GetSubCommentsCountOfAComment error", zap.Error(err))
-		return -1, err
+// GetCommentVoteStat 获取评论的点赞数、点踩数，用于计算评论热度
+func GetCommentVoteStat(commentId string) (ups, downs int64, err error) {
+	pipe := rdb.Pipeline()
+	upCmd := pipe.ZScore(ctx, getKey(KeyCommentVoteZset), commentId)
+	downCmd := pipe.ZScore(ctx, getKey(KeyCommentDevoteZset), commentId)
+	if _, err = pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		zap.L().Error("redis_repo.GetCommentVoteStat error", zap.Error(err))
+		return 0, 0, err
+	}
+	return int64(upCmd.Val()), int64(downCmd.Val()), nil
+}
+
+// SetCommentScore 更新评论的热度
+func SetCommentScore(commentId int64, score float64) error {
+	return rdb.ZAdd(ctx, getKey(KeyCommentScoreZset), redis.Z{Score: score, Member: commentId}).Err()
+}
+
+// GetCommentsOrderValue 批量获取评论的热度(byTime为false)或者发布时间(byTime为true)，不存在的评论返回0
+func GetCommentsOrderValue(commentIds []string, byTime bool) ([]float64, error) {
+	key := getKey(KeyCommentScoreZset)
+	if byTime {
+		key = getKey(KeyCommentTimeZset)
+	}
+	pipe := rdb.Pipeline()
+	cmds := make([]*redis.FloatCmd, len(commentIds))
+	for i, id := range commentIds {
+		cmds[i] = pipe.ZScore(ctx, key, id)
 	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		zap.L().Error("redis_repo.GetCommentsOrderValue error", zap.Error(err))
+		return nil, err
+	}
+	res := make([]float64, len(commentIds))
+	for i, cmd := range cmds {
+		res[i] = cmd.Val()
+	}
+	return res, nil
 }
@@ -0,0 +1,34 @@
+package redis_repo
+
+import (
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// GetPostEmbed 获取缓存的帖子预览信息，缓存不存在时返回空字符串
+func GetPostEmbed(postId int64) (string, error) {
+	return getString(getKey(KeyPostEmbedPrefix + strconv.FormatInt(postId, 10)))
+}
+
+func SetPostEmbed(postId int64, data string, expiration time.Duration) error {
+	return rdb.Set(ctx, getKey(KeyPostEmbedPrefix+strconv.FormatInt(postId, 10)), data, expiration).Err()
+}
+
+// GetPostCard 获取缓存的帖子预览页面，缓存不存在时返回空字符串
+func GetPostCard(postId int64) (string, error) {
+	return getString(getKey(KeyPostCardPrefix + strconv.FormatInt(postId, 10)))
+}
+
+func SetPostCard(postId int64, html string, expiration time.Duration) error {
+	return rdb.Set(ctx, getKey(KeyPostCardPrefix+strconv.FormatInt(postId, 10)), html, expiration).Err()
+}
+
+func getString(key string) (string, error) {
+	val, err := rdb.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return val, err
+}
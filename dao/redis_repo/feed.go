@@ -0,0 +1,29 @@
+package redis_repo
+
+import (
+	"strconv"
+	"time"
+)
+
+// GetFeed 获取缓存的订阅源，返回内容，etag以及最后修改时间，缓存不存在时body为空
+func GetFeed(name string) (body, etag string, modified time.Time, err error) {
+	val, err := rdb.HGetAll(ctx, getKey(KeyFeedPrefix+name)).Result()
+	if err != nil || len(val) == 0 {
+		return "", "", time.Time{}, err
+	}
+	unix, err := strconv.ParseInt(val["modified"], 10, 64)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	return val["body"], val["etag"], time.Unix(unix, 0), nil
+}
+
+// SetFeed 缓存生成好的订阅源，expiration到期后重新生成
+func SetFeed(name, body, etag string, modified time.Time, expiration time.Duration) (err error) {
+	key := getKey(KeyFeedPrefix + name)
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, key, "body", body, "etag", etag, "modified", modified.Unix())
+	pipe.Expire(ctx, key, expiration)
+	_, err = pipe.Exec(ctx)
+	return
+}
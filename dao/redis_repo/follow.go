@@ -0,0 +1,78 @@
+package redis_repo
+
+import (
+	"context"
+	"strconv"
+)
+
+func followSetKey(userId int64, fans bool) string {
+	if fans {
+		return fansListKey(strconv.FormatInt(userId, 10))
+	}
+	return followListKey(strconv.FormatInt(userId, 10))
+}
+
+func parseIds(members []string) []int64 {
+	ids := make([]int64, 0, len(members))
+	for _, m := range members {
+		if id, err := strconv.ParseInt(m, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// followSetLoadedKey 标记用户的关注/粉丝列表已经从MySQL加载过
+// 消费者会直接向不存在的列表中添加关注关系，产生不完整的列表，所以不能用列表是否存在来判断
+func followSetLoadedKey(userId int64, fans bool) string {
+	return followSetKey(userId, fans) + ":loaded"
+}
+
+// FollowSetLoaded 判断用户的关注列表(fans为true时为粉丝列表)是否已经加载到Redis中
+func FollowSetLoaded(ctx context.Context, userId int64, fans bool) (bool, error) {
+	n, err := rdb.Exists(ctx, followSetLoadedKey(userId, fans)).Result()
+	return n > 0, err
+}
+
+// RebuildFollowSet 使用MySQL中的关注关系重建用户的关注/粉丝列表，并标记为已加载，没有关注关系时同样标记
+// 只做添加，不覆盖重建之前以及重建期间消费者写入的数据
+func RebuildFollowSet(ctx context.Context, userId int64, fans bool, ids []int64) error {
+	pipe := rdb.TxPipeline()
+	if len(ids) > 0 {
+		members := make([]interface{}, len(ids))
+		for i, id := range ids {
+			members[i] = id
+		}
+		pipe.SAdd(ctx, followSetKey(userId, fans), members...)
+	}
+	pipe.Set(ctx, followSetLoadedKey(userId, fans), 1, 0)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetFollowSet 获取用户关注/粉丝列表中的所有用户id
+func GetFollowSet(ctx context.Context, userId int64, fans bool) ([]int64, error) {
+	members, err := rdb.SMembers(ctx, followSetKey(userId, fans)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseIds(members), nil
+}
+
+// GetCommonFollows 获取两个用户共同关注的用户id
+func GetCommonFollows(ctx context.Context, userId, otherUserId int64) ([]int64, error) {
+	members, err := rdb.SInter(ctx, followSetKey(userId, false), followSetKey(otherUserId, false)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseIds(members), nil
+}
+
+// CheckFollowSetMembers 批量判断ids是否在用户的关注/粉丝列表中
+func CheckFollowSetMembers(ctx context.Context, userId int64, fans bool, ids []int64) ([]bool, error) {
+	members := make([]interface{}, len(ids))
+	for i, id := range ids {
+		members[i] = id
+	}
+	return rdb.SMIsMember(ctx, followSetKey(userId, fans), members...).Result()
+}
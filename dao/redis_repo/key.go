@@ -1,34 +1,53 @@
 package redis_repo
 
 const (
-	KeyPrefix                   = "bluebell:"
-	KeyPostTimeZset             = "post:create_time"      // zset 帖子以及发帖时间
-	KeyPostScoreZset            = "post:score"            // zset 帖子以及投票分数
-	KeyUserTokenHash            = "userid2access_token"   // hash 记录用户id和accesstoken的映射关系
-	KeyPostActionPrefix         = "post:user_action:"     // 记录用户的对帖子的投票类型,后面跟post id，整体是一个hset，key为user id，值为none, like, dislike
-	KeyPostUserCollection       = "post:user_collection:" // 记录用户收藏的所有帖子，后面跟user id,整体是一个Set
-	KeyCommunityPrefix          = "community:"
-	KeyMailVerification         = "mail_verification"
-	KeyUserLastLoginToken       = "user:last_login"
-	KeyMailLoginCode            = "mail_login_code"
-	KeyPostVoteUpZset           = "post:vote_up"                 // zset 帖子以及点赞数量
-	KeyPostVoteDownZset         = "post:vote_down"               // zset 帖子点踩数量
-	KeyPostCollectionZset       = "post:collection_numbers"      // zset 帖子收藏数量
-	KeyPostCommentZset          = "post:comment_numbers"         // zset 帖子评论数量，统计这一帖子下面一共有多少评论。
-	KeyPostClickZset            = "post:click_numbers"           // zset 帖子浏览数量
-	KeyUserBlackListSet         = "user:blacklist"               // set 用户黑名单
-	KeyUserFollowListSet        = "user:follow_list"             // set 用户关注列表
-	KeyUserFansListSet          = "user:fans_list"               // set 粉丝关注列表
-	KeyUserFansCountZset        = "user:fans_count"              // zset 记录每个用户的粉丝数量，key为id，val为粉丝数量
-	KeyUserFollowsCountZset     = "user:follows_count"           // zset 记录每个用户的关注数量，key为id，val为关注数量
-	KeyCommentTimeZset          = "comment:time"                 // zset 评论以及评论时间
-	KeyCommentScoreZset         = "comment:score"                // zset 评论以及分数（计算热评）
-	KeyPostPrefix               = "post:"                        // 后面可以拼接postId，表内存放根评论
-	KeyCommentVotedZset         = "comment:voted"                // zset 记录用户以及投票类型
-	KeyCommentVoteZset          = "comment:vote"                 // zset comment以及点赞数量
-	KeyCommentDevoteZset        = "comment:devote"               // zset comment以及点踩数量
-	KeyCommentSubCommentCntZset = "comment:comment_numbers"      // zset comment 的子评论总数,存放所有根评论的评论总数。统计每个根comment下共有多少追评
-	KeyCommentSubCommentSet     = "comment:child_comment_record" // set,存放当前评论的所有子评论
+	KeyPrefix               = "bluebell:"
+	KeyPostTimeZset         = "post:create_time"      // zset 帖子以及发帖时间
+	KeyPostScoreZset        = "post:score"            // zset 帖子以及投票分数
+	KeyPostActionPrefix     = "post:user_action:"     // 记录用户的对帖子的投票类型,后面跟post id，整体是一个hset，key为user id，值为none, like, dislike
+	KeyPostUserCollection   = "post:user_collection:" // 记录用户收藏的所有帖子，后面跟user id,整体是一个Set
+	KeyCommunityPrefix      = "community:"
+	KeyUserPostsPrefix      = "user:posts:" // set 后面跟user id，记录用户发布的帖子以及占位的0，发帖、删除、恢复时删除，下次查询时从MySQL重建
+	KeyMailVerification     = "mail_verification"
+	KeyUserLastLoginToken   = "user:last_login"
+	KeyMailLoginCode        = "mail_login_code"
+	KeyPostVoteUpZset       = "post:vote_up"            // zset 帖子以及点赞数量
+	KeyPostVoteDownZset     = "post:vote_down"          // zset 帖子点踩数量
+	KeyPostCollectionZset   = "post:collection_numbers" // zset 帖子收藏数量
+	KeyPostCommentZset      = "post:comment_numbers"    // zset 帖子评论数量，统计这一帖子下面一共有多少评论。
+	KeyPostClickZset        = "post:click_numbers"      // zset 帖子浏览数量
+	KeyUserBlackListSet     = "user:blacklist"          // set 用户黑名单
+	KeyUserFollowListSet    = "user:follow_list"        // set 用户关注列表
+	KeyUserFansListSet      = "user:fans_list"          // set 粉丝关注列表
+	KeyUserFansCountZset    = "user:fans_count"         // zset 记录每个用户的粉丝数量，key为id，val为粉丝数量
+	KeyUserFollowsCountZset = "user:follows_count"      // zset 记录每个用户的关注数量，key为id，val为关注数量
+	KeyCommentTimeZset      = "comment:time"            // zset 评论以及评论时间
+	KeyCommentScoreZset     = "comment:score"           // zset 评论以及分数（计算热评）
+	KeyPostPrefix           = "post:"                   // 后面可以拼接postId，表内存放根评论
+	KeyCommentVotedZset     = "comment:voted"           // zset 记录用户以及投票类型
+	KeyCommentVoteZset      = "comment:vote"            // zset comment以及点赞数量
+	KeyCommentDevoteZset    = "comment:devote"          // zset comment以及点踩数量
+	KeyPostShareZset        = "post:share_numbers"      // zset 帖子分享链接的访问次数
+	KeyPostSharerPrefix     = "post:sharer:"            // zset 后面跟post id，记录每个分享者带来的访问次数
+	KeyPostShareVisitPrefix = "post:share_visit:"       // string 后面跟post id:访问者，记录统计窗口内已经统计过的分享访问
+	KeyPostEmbedPrefix      = "post:embed:"             // string 后面跟post id，缓存帖子的预览信息（oEmbed/Open Graph）
+	KeyPostCardPrefix       = "post:card:"              // string 后面跟post id，缓存渲染好的帖子预览页面
+	KeyReactionCountPrefix  = "reaction:count:"         // hash 后面跟target type:target id，记录每种emoji回应的数量
+	KeyReactionUserPrefix   = "reaction:user:"          // set 后面跟target type:target id:user id，记录用户添加过的emoji回应
+	KeyFeedPrefix           = "feed:"                   // hash 后面跟订阅源名称，缓存生成好的订阅源内容以及etag、最后修改时间
+	KeyPasswordResetPrefix  = "password_reset:token:"   // string 后面跟重置密码链接的随机串，值为user id，使用后删除
+	KeyPasswordResetEmail   = "password_reset:email:"   // string 后面跟邮箱，限制向同一邮箱发送重置密码邮件的频率
+	KeyUserSessionPrefix    = "user:sessions:"          // hash 后面跟user id，key为会话id，值为会话的设备信息、创建以及最后活动时间
+	KeyRefreshTokenPrefix   = "token:refresh:"          // string 后面跟会话id，值为会话当前有效的refresh token的jti
+	KeyRevokedTokenPrefix   = "token:revoked:"          // string 后面跟jti，记录已经吊销或使用过的refresh token，保留到token过期
+	KeyMfaPendingPrefix     = "mfa:pending:"            // hash 后面跟mfa token，记录密码校验通过、等待两步验证的登录
+	KeyMfaRequiredRoles     = "mfa:required_roles"      // string 必须开启两步验证的角色，用逗号分隔
+	KeyOidcStatePrefix      = "oidc:state:"             // hash 后面跟state，记录第三方登录的身份提供方、PKCE code verifier、nonce以及发起的用户
+	KeyLoginFailPrefix      = "login:fail:"             // string 后面跟account:user id、name:登录名（账号不存在时）或ip:ip，记录统计窗口内连续登录失败的次数
+	KeyLoginLockPrefix      = "login:lock:"             // string 与login:fail:后面的部分相同，存在时禁止登录，过期时间为剩余的等待时间
+	KeyUserExportPrefix     = "user:export:"            // hash 后面跟user id，记录个人数据导出的状态、文件路径以及创建时间
+	KeyUserStatsPrefix      = "user:stats:"             // hash 后面跟user id，缓存用户的发帖数、评论数、获赞总数
+	KeyBadgeStreakPrefix    = "badge:streak:"           // hash 后面跟user id，记录用户最后活跃的日期以及连续活跃的天数
 )
 
 func getKey(key string) string {
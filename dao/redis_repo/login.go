@@ -0,0 +1,58 @@
+package redis_repo
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// RecordLoginFailure 记录一次登录失败，返回统计窗口内连续失败的次数，每次失败都会重新计算窗口
+func RecordLoginFailure(ctx context.Context, subject string, window time.Duration) (int64, error) {
+	key := getKey(KeyLoginFailPrefix + subject)
+	pipe := rdb.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// SetLoginLock 在d时间内禁止登录，已经存在更长的锁定时不会缩短
+func SetLoginLock(ctx context.Context, subject string, d time.Duration) error {
+	key := getKey(KeyLoginLockPrefix + subject)
+	pipe := rdb.TxPipeline()
+	pipe.SetNX(ctx, key, 1, d)
+	pipe.ExpireGT(ctx, key, d)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetLoginLock 返回多个对象中最长的剩余锁定时间，都没有被锁定时返回0
+func GetLoginLock(ctx context.Context, subjects ...string) (time.Duration, error) {
+	pipe := rdb.Pipeline()
+	cmds := make([]*redis.DurationCmd, len(subjects))
+	for i, s := range subjects {
+		cmds[i] = pipe.PTTL(ctx, getKey(KeyLoginLockPrefix+s))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	var max time.Duration
+	for _, cmd := range cmds {
+		// key不存在时PTTL返回负数
+		if d := cmd.Val(); d > max {
+			max = d
+		}
+	}
+	return max, nil
+}
+
+// ClearLoginFailures 登录成功或者管理员解锁时清除失败次数和锁定
+func ClearLoginFailures(ctx context.Context, subjects ...string) error {
+	keys := make([]string, 0, 2*len(subjects))
+	for _, s := range subjects {
+		keys = append(keys, getKey(KeyLoginFailPrefix+s), getKey(KeyLoginLockPrefix+s))
+	}
+	return rdb.Del(ctx, keys...).Err()
+}
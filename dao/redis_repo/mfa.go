@@ -0,0 +1,95 @@
+package redis_repo
+
+import (
+	"bluebell/models"
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MfaPending 密码校验通过、等待两步验证的登录
+type MfaPending struct {
+	UserId   int64
+	Device   models.SessionDevice
+	Attempts int64
+}
+
+// SetMfaPending 保存等待两步验证的登录，过期后需要重新登录
+func SetMfaPending(ctx context.Context, token string, p *MfaPending, expiration time.Duration) error {
+	key := getKey(KeyMfaPendingPrefix + token)
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, key, "user_id", p.UserId, "name", p.Device.Name, "user_agent", p.Device.UserAgent, "ip", p.Device.IP, "attempts", 0)
+	pipe.Expire(ctx, key, expiration)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// TakeMfaAttempt 获取等待两步验证的登录并增加一次尝试次数，不存在时返回nil
+func TakeMfaAttempt(ctx context.Context, token string) (*MfaPending, error) {
+	key := getKey(KeyMfaPendingPrefix + token)
+	pipe := rdb.TxPipeline()
+	attempts := pipe.HIncrBy(ctx, key, "attempts", 1)
+	fields := pipe.HGetAll(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	res := fields.Val()
+	userId, err := strconv.ParseInt(res["user_id"], 10, 64)
+	if err != nil {
+		// 登录已过期，HIncrBy创建的key直接删除
+		return nil, rdb.Del(ctx, key).Err()
+	}
+	return &MfaPending{
+		UserId:   userId,
+		Device:   models.SessionDevice{Name: res["name"], UserAgent: res["user_agent"], IP: res["ip"]},
+		Attempts: attempts.Val(),
+	}, nil
+}
+
+// DeleteMfaPending 两步验证完成或者尝试次数过多时删除等待中的登录
+func DeleteMfaPending(ctx context.Context, token string) error {
+	return rdb.Del(ctx, getKey(KeyMfaPendingPrefix+token)).Err()
+}
+
+// SetMfaPendingSecret 为等待两步验证、但还没有绑定身份验证器的登录保存新生成的密钥
+func SetMfaPendingSecret(ctx context.Context, token, secret string) error {
+	return rdb.HSet(ctx, getKey(KeyMfaPendingPrefix+token), "secret", secret).Err()
+}
+
+// GetMfaPendingSecret 获取登录时生成的身份验证器密钥
+func GetMfaPendingSecret(ctx context.Context, token string) (string, error) {
+	secret, err := rdb.HGet(ctx, getKey(KeyMfaPendingPrefix+token), "secret").Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return secret, err
+}
+
+// GetMfaRequiredRoles 获取管理员设置的必须开启两步验证的角色，没有设置过时ok为false
+func GetMfaRequiredRoles(ctx context.Context) (roles []int8, ok bool, err error) {
+	val, err := rdb.Get(ctx, getKey(KeyMfaRequiredRoles)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	for _, r := range strings.Split(val, ",") {
+		if role, err := strconv.ParseInt(r, 10, 8); err == nil {
+			roles = append(roles, int8(role))
+		}
+	}
+	return roles, true, nil
+}
+
+// SetMfaRequiredRoles 设置必须开启两步验证的角色
+func SetMfaRequiredRoles(ctx context.Context, roles []int8) error {
+	parts := make([]string, len(roles))
+	for i, r := range roles {
+		parts[i] = strconv.Itoa(int(r))
+	}
+	return rdb.Set(ctx, getKey(KeyMfaRequiredRoles), strings.Join(parts, ","), 0).Err()
+}
@@ -0,0 +1,51 @@
+package redis_repo
+
+import (
+	"bluebell/models"
+	"context"
+	"strconv"
+	"time"
+)
+
+// OidcState 发起第三方登录时保存的状态，身份提供方跳转回来时根据state取出
+type OidcState struct {
+	Provider string
+	Verifier string
+	Nonce    string
+	// 绑定第三方账号时为发起绑定的用户，登录时为0
+	UserId int64
+	Device models.SessionDevice
+}
+
+func SetOidcState(ctx context.Context, state string, s *OidcState, expiration time.Duration) error {
+	key := getKey(KeyOidcStatePrefix + state)
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, key, "provider", s.Provider, "verifier", s.Verifier, "nonce", s.Nonce, "user_id", s.UserId,
+		"name", s.Device.Name, "user_agent", s.Device.UserAgent, "ip", s.Device.IP)
+	pipe.Expire(ctx, key, expiration)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// TakeOidcState 取出并删除state，每个state只能使用一次，不存在或已过期时返回nil
+func TakeOidcState(ctx context.Context, state string) (*OidcState, error) {
+	key := getKey(KeyOidcStatePrefix + state)
+	pipe := rdb.TxPipeline()
+	fields := pipe.HGetAll(ctx, key)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	res := fields.Val()
+	if len(res) == 0 {
+		return nil, nil
+	}
+	userId, _ := strconv.ParseInt(res["user_id"], 10, 64)
+	return &OidcState{
+		Provider: res["provider"],
+		Verifier: res["verifier"],
+		Nonce:    res["nonce"],
+		UserId:   userId,
+		Device:   models.SessionDevice{Name: res["name"], UserAgent: res["user_agent"], IP: res["ip"]},
+	}, nil
+}
@@ -0,0 +1,32 @@
+package redis_repo
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// SetPasswordResetToken 保存重置密码链接中的随机串，过期后链接失效
+func SetPasswordResetToken(ctx context.Context, nonce string, userId int64, expiration time.Duration) error {
+	return rdb.Set(ctx, getKey(KeyPasswordResetPrefix+nonce), userId, expiration).Err()
+}
+
+// TakePasswordResetToken 取出并删除重置密码链接中的随机串，保证链接只能使用一次，不存在时返回0
+func TakePasswordResetToken(ctx context.Context, nonce string) (int64, error) {
+	userId, err := rdb.GetDel(ctx, getKey(KeyPasswordResetPrefix+nonce)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return userId, err
+}
+
+// AllowPasswordResetEmail 同一邮箱在interval内只允许发送一次重置密码邮件
+func AllowPasswordResetEmail(ctx context.Context, email string, interval time.Duration) (bool, error) {
+	return rdb.SetNX(ctx, getKey(KeyPasswordResetEmail+email), 1, interval).Result()
+}
+
+// RevokeUserTokens 删除用户所有的登录会话，之前签发的token全部失效
+func RevokeUserTokens(ctx context.Context, userId int64) error {
+	return rdb.Del(ctx, sessionKey(userId)).Err()
+}
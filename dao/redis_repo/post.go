@@ -110,6 +110,21 @@ func SetPostScore(postId string, score float64) (err error) {
 	err = rdb.ZIncrBy(ctx, getKey(KeyPostScoreZset), score, postId).Err()
 	return
 }
+
+// IncrPostScore 增量修改帖子的投票得分，全局以及社区内的排序缓存中存在该帖子时才修改，不存在时等待从MySQL重建
+func IncrPostScore(postId, communityId int64, delta float64) (err error) {
+	member := strconv.FormatInt(postId, 10)
+	pipe := rdb.TxPipeline()
+	pipe.ZAddArgsIncr(ctx, getKey(KeyPostScoreZset), redis.ZAddArgs{XX: true, Members: []redis.Z{{Score: delta, Member: member}}})
+	pipe.ZAddArgsIncr(ctx, fmt.Sprintf("%s:%d", getKey(KeyPostScoreZset), communityId), redis.ZAddArgs{XX: true, Members: []redis.Z{{Score: delta, Member: member}}})
+	_, err = pipe.Exec(ctx)
+	if errors.Is(err, redis.Nil) {
+		// 帖子不在缓存中时ZADD XX INCR返回nil
+		err = nil
+	}
+	return
+}
+
 func SetPostVote(postId string, vote float64) (err error) {
 	err = rdb.ZIncrBy(ctx, getKey(KeyPostVoteUpZset), vote, postId).Err()
 	return
@@ -126,6 +141,7 @@ func CreatePost(post *models.Post) (err error) {
 	pipe.ZAdd(ctx, getKey(KeyPostTimeZset), redis.Z{Score: float64(time.Now().Unix()), Member: post.PostId})
 	pipe.ZAdd(ctx, getKey(KeyPostScoreZset), redis.Z{Score: 0, Member: post.PostId})
 	pipe.SAdd(ctx, getKey(KeyCommunityPrefix+strconv.FormatInt(post.CommunityID, 10)), post.PostId)
+	invalidateUserPosts(pipe, post.AuthorID)
 	_, err = pipe.Exec(ctx)
 	return
 }
@@ -181,7 +197,15 @@ func GetPostIds(param *models.ParamPostList) (postIds []string, err error) {
 	// 如果没有指定community id，则从所有的帖子数据中按照指定顺序排序
 	var target_key = key + ":" + param.CommunityId
 	flag := false
-	if len(param.CommunityId) > 0 {
+	if len(param.AuthorId) > 0 {
+		// 按作者筛选时和社区一样计算交集，结果同样缓存下来
+		flag = true
+		target_key = userPostsOrderKey(key, param.AuthorId)
+		if err = intersectUserPosts(key, target_key, param.AuthorId); err != nil {
+			zap.L().Error("Error intersecting user posts", zap.String("user_id", param.AuthorId), zap.Error(err))
+			return nil, err
+		}
+	} else if len(param.CommunityId) > 0 {
 		// 先查看redis中是否有过这个键了，有过就不用再算了
 		flag = true
 		val := rdb.Exists(ctx, target_key).Val()
@@ -227,18 +251,96 @@ func GetPostIds(param *models.ParamPostList) (postIds []string, err error) {
 	return
 }
 
-func DeletePostInfo(postId, communityId int64) (err error) {
+// userPostsOrderKey 用户发布的帖子按照key排序的结果
+func userPostsOrderKey(key, userId string) string {
+	return key + ":user:" + userId
+}
+
+// intersectUserPosts 计算用户发布的帖子在key中的排序结果并保存到target
+// 发帖时间不会变化，按时间排序的结果已经存在时不再计算；投票会改变分数，按分数排序时每次重新计算，交集不超过用户的帖子数
+func intersectUserPosts(key, target, userId string) error {
+	if key != getKey(KeyPostScoreZset) {
+		exists, err := Exists(ctx, target)
+		if err != nil || exists {
+			return err
+		}
+	}
+	// 检查bluebell:user:posts:[user-id]是否存在，不存在时从MySQL中重建
+	setKey := getKey(KeyUserPostsPrefix + userId)
+	exists, err := Exists(ctx, setKey)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		posts := mysql_repo.PostRepository.Find(sqls.DB(), sqls.NewCnd().Where("author_id = ?", userId))
+		pipe := rdb.TxPipeline()
+		// 0不是帖子id，不会出现在交集中，用来保证没有发帖的用户也会缓存下来，不会每次都查询MySQL
+		pipe.SAdd(ctx, setKey, 0)
+		for _, post := range posts {
+			pipe.SAdd(ctx, setKey, post.PostId)
+		}
+		if _, err = pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return rdb.ZInterStore(ctx, target, &redis.ZStore{Keys: []string{setKey, key}, Aggregate: "max"}).Err()
+}
+
+// invalidateUserPosts 用户发布的帖子变化时删除用户的帖子记录以及排序结果，下次查询时重建
+func invalidateUserPosts(pipe redis.Pipeliner, authorId int64) {
+	userId := strconv.FormatInt(authorId, 10)
+	pipe.Del(ctx, getKey(KeyUserPostsPrefix+userId),
+		userPostsOrderKey(getKey(KeyPostTimeZset), userId),
+		userPostsOrderKey(getKey(KeyPostScoreZset), userId))
+}
+
+func DeletePostInfo(postId, communityId, authorId int64) (err error) {
 	pipe := rdb.TxPipeline()
-	pipe.ZRem(ctx, getKey(KeyPostVoteUpZset), postId)
-	pipe.ZRem(ctx, getKey(KeyPostVoteDownZset), postId)
+	invalidateUserPosts(pipe, authorId)
+	// 点赞/点踩数保留到彻底删除，点踩数在MySQL中没有备份，恢复时需要继续使用
 	pipe.ZRem(ctx, getKey(KeyPostScoreZset), postId)
+	pipe.ZRem(ctx, getKey(KeyPostTimeZset), postId)
 	pipe.ZRem(ctx, getKey(KeyPostCommentZset), postId)
+	pipe.SRem(ctx, getKey(KeyCommunityPrefix+strconv.FormatInt(communityId, 10)), postId)
 	pipe.ZRem(ctx, fmt.Sprintf("%s:%d", getKey(KeyPostScoreZset), communityId), postId)
+	pipe.ZRem(ctx, fmt.Sprintf("%s:%d", getKey(KeyPostTimeZset), communityId), postId)
+	// 帖子的根评论记录，恢复时会根据MySQL中的评论重建
+	pipe.Del(ctx, getKey(KeyPostPrefix+strconv.FormatInt(postId, 10)))
+	pipe.Del(ctx, getKey(KeyPostEmbedPrefix+strconv.FormatInt(postId, 10)))
+	pipe.Del(ctx, getKey(KeyPostCardPrefix+strconv.FormatInt(postId, 10)))
 	_, err = pipe.Exec(ctx)
 	return
 
 }
 
+// RestorePost 从回收站恢复帖子时，重建帖子的time/score/community记录
+func RestorePost(post *models.Post) (err error) {
+	pipe := rdb.TxPipeline()
+	pipe.ZAdd(ctx, getKey(KeyPostTimeZset), redis.Z{Score: float64(post.CreateAt.Unix()), Member: post.PostId})
+	pipe.ZAdd(ctx, getKey(KeyPostScoreZset), redis.Z{Score: float64(post.Score), Member: post.PostId})
+	pipe.SAdd(ctx, getKey(KeyCommunityPrefix+strconv.FormatInt(post.CommunityID, 10)), post.PostId)
+	// 社区内的排序结果是由交集计算缓存下来的，直接删除，下次查询时重新计算
+	pipe.Del(ctx, fmt.Sprintf("%s:%d", getKey(KeyPostScoreZset), post.CommunityID))
+	pipe.Del(ctx, fmt.Sprintf("%s:%d", getKey(KeyPostTimeZset), post.CommunityID))
+	invalidateUserPosts(pipe, post.AuthorID)
+	_, err = pipe.Exec(ctx)
+	return
+}
+
+// PurgePostInfo 彻底删除帖子时，清理帖子剩余的用户投票/点赞数/点踩数/浏览/收藏/分享记录
+func PurgePostInfo(postId int64) (err error) {
+	pipe := rdb.TxPipeline()
+	pipe.ZRem(ctx, getKey(KeyPostVoteUpZset), postId)
+	pipe.ZRem(ctx, getKey(KeyPostVoteDownZset), postId)
+	pipe.Del(ctx, getKey(KeyPostActionPrefix+strconv.FormatInt(postId, 10)))
+	pipe.ZRem(ctx, getKey(KeyPostClickZset), postId)
+	pipe.ZRem(ctx, getKey(KeyPostCollectionZset), postId)
+	pipe.ZRem(ctx, getKey(KeyPostShareZset), postId)
+	pipe.Del(ctx, getKey(KeyPostSharerPrefix+strconv.FormatInt(postId, 10)))
+	_, err = pipe.Exec(ctx)
+	return
+}
+
 // GetPostVoteNumById 获取特定帖子的点赞数
 func GetPostVoteNumById(postId int64) (result float64, err error) {
 	result, err = rdb.ZScore(ctx, getKey(KeyPostVoteUpZset), strconv.FormatInt(postId, 10)).Result()
@@ -300,6 +402,49 @@ func AddPostClickNum(postId int64) (err error) {
 	return
 }
 
+// GetPostShareNumById 获取特定帖子分享链接的访问次数
+func GetPostShareNumById(postId int64) (result float64, err error) {
+	result, err = rdb.ZScore(ctx, getKey(KeyPostShareZset), strconv.FormatInt(postId, 10)).Result()
+	if errors.Is(err, redis.Nil) {
+		// 说明需要去mysql中查询，缓存中无此项数据
+		post := mysql_repo.PostRepository.Get(sqls.DB(), postId)
+		if post == nil {
+			return 0, nil
+		}
+		result = float64(post.ShareNums)
+		err = nil
+		rdb.ZAdd(ctx, getKey(KeyPostShareZset), redis.Z{Score: float64(post.ShareNums), Member: post.PostId})
+	}
+	return
+}
+
+// AddPostShareNum 分享链接被访问一次，帖子分享数+1，同时记录分享者带来的访问次数
+// 同一访问者在window内重复访问只统计一次，counted表示这次访问是否被统计
+func AddPostShareNum(postId, sharerId int64, visitor string, window time.Duration) (counted bool, err error) {
+	visitKey := getKey(KeyPostShareVisitPrefix + strconv.FormatInt(postId, 10) + ":" + visitor)
+	if counted, err = rdb.SetNX(ctx, visitKey, 1, window).Result(); err != nil || !counted {
+		return counted, err
+	}
+	if _, err = GetPostShareNumById(postId); err != nil {
+		zap.L().Error("fail to check post share num in redis", zap.Error(err))
+		return false, err
+	}
+	pipe := rdb.TxPipeline()
+	pipe.ZIncrBy(ctx, getKey(KeyPostShareZset), 1, strconv.FormatInt(postId, 10))
+	if sharerId != 0 {
+		pipe.ZIncrBy(ctx, getKey(KeyPostSharerPrefix+strconv.FormatInt(postId, 10)), 1, strconv.FormatInt(sharerId, 10))
+	}
+	if _, err = pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetPostTopSharers 获取为帖子带来访问次数最多的分享者
+func GetPostTopSharers(postId int64, n int64) ([]redis.Z, error) {
+	return rdb.ZRevRangeWithScores(ctx, getKey(KeyPostSharerPrefix+strconv.FormatInt(postId, 10)), 0, n-1).Result()
+}
+
 func AddCollection(postId int64, userId int64) (exist bool, err error) {
 	key := getKey(KeyPostUserCollection + strconv.FormatInt(userId, 10))
 	flag, err := rdb.SIsMember(ctx, key, postId).Result()
@@ -0,0 +1,106 @@
+package redis_repo
+
+import (
+	"github.com/redis/go-redis/v9"
+	"strconv"
+)
+
+// reactionLoadedField 回应数量hash中标记已经从MySQL加载过的字段，回应不能包含逗号，不会和回应冲突
+// 最后一个回应被取消后hash中仍然保留这个字段，不会被当成缓存缺失而用MySQL中还没有同步的数据重建
+const reactionLoadedField = ",loaded"
+
+// 用户的回应集合和回应数量在同一个脚本中修改，KEYS[1]为用户的回应集合，KEYS[2]为回应数量，ARGV[1]为回应
+var addReactionScript = redis.NewScript(`
+if redis.call("SADD", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("HINCRBY", KEYS[2], ARGV[1], 1)
+return 1
+`)
+
+var removeReactionScript = redis.NewScript(`
+if redis.call("SREM", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+if redis.call("HINCRBY", KEYS[2], ARGV[1], -1) <= 0 then
+	redis.call("HDEL", KEYS[2], ARGV[1])
+end
+return 1
+`)
+
+func reactionTarget(targetType int8, targetId int64) string {
+	return strconv.Itoa(int(targetType)) + ":" + strconv.FormatInt(targetId, 10)
+}
+
+func reactionCountKey(targetType int8, targetId int64) string {
+	return getKey(KeyReactionCountPrefix + reactionTarget(targetType, targetId))
+}
+
+func reactionUserKey(targetType int8, targetId, userId int64) string {
+	return getKey(KeyReactionUserPrefix + reactionTarget(targetType, targetId) + ":" + strconv.FormatInt(userId, 10))
+}
+
+// AddReaction 记录用户添加的回应，并增加该回应的数量，用户已经添加过该回应时返回false
+func AddReaction(targetType int8, targetId, userId int64, emoji string) (added bool, err error) {
+	keys := []string{reactionUserKey(targetType, targetId, userId), reactionCountKey(targetType, targetId)}
+	n, err := addReactionScript.Run(ctx, rdb, keys, emoji).Int()
+	return n == 1, err
+}
+
+// RemoveReaction 取消用户添加的回应，并减少该回应的数量，用户没有添加过该回应时返回false
+func RemoveReaction(targetType int8, targetId, userId int64, emoji string) (removed bool, err error) {
+	keys := []string{reactionUserKey(targetType, targetId, userId), reactionCountKey(targetType, targetId)}
+	n, err := removeReactionScript.Run(ctx, rdb, keys, emoji).Int()
+	return n == 1, err
+}
+
+// ReactionsLoaded 帖子/评论的回应是否已经从MySQL加载到Redis中
+func ReactionsLoaded(targetType int8, targetId int64) (bool, error) {
+	return rdb.HExists(ctx, reactionCountKey(targetType, targetId), reactionLoadedField).Result()
+}
+
+// GetReactionCounts 获取每种回应的数量，Redis中没有记录时返回空map
+func GetReactionCounts(targetType int8, targetId int64) (map[string]int64, error) {
+	vals, err := rdb.HGetAll(ctx, reactionCountKey(targetType, targetId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]int64, len(vals))
+	for emoji, val := range vals {
+		if emoji == reactionLoadedField {
+			continue
+		}
+		if cnt, _ := strconv.ParseInt(val, 10, 64); cnt > 0 {
+			res[emoji] = cnt
+		}
+	}
+	return res, nil
+}
+
+// GetUserReactions 获取用户对帖子/评论添加过的回应
+func GetUserReactions(targetType int8, targetId, userId int64) ([]string, error) {
+	return rdb.SMembers(ctx, reactionUserKey(targetType, targetId, userId)).Result()
+}
+
+// RebuildReactions 用MySQL中的记录重建帖子/评论在Redis中的回应数据，users为用户id以及添加过的回应
+// 没有任何回应时也会写入加载标记
+func RebuildReactions(targetType int8, targetId int64, users map[int64][]string) (err error) {
+	counts := map[string]interface{}{reactionLoadedField: 1}
+	pipe := rdb.TxPipeline()
+	for userId, emojis := range users {
+		key := reactionUserKey(targetType, targetId, userId)
+		pipe.Del(ctx, key)
+		members := make([]interface{}, len(emojis))
+		for i, emoji := range emojis {
+			members[i] = emoji
+			cnt, _ := counts[emoji].(int64)
+			counts[emoji] = cnt + 1
+		}
+		pipe.SAdd(ctx, key, members...)
+	}
+	key := reactionCountKey(targetType, targetId)
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, counts)
+	_, err = pipe.Exec(ctx)
+	return
+}
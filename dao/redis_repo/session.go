@@ -0,0 +1,159 @@
+package redis_repo
+
+import (
+	"bluebell/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// 会话存在时才更新，避免刚被吊销的会话被更新最后活动时间时重新写回
+var updateSessionScript = redis.NewScript(`
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+	return redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+end
+return -1
+`)
+
+// RotateRefreshToken 的结果
+const (
+	RefreshTokenMissing = -1 // 会话没有有效的refresh token
+	RefreshTokenReused  = 0  // 不是会话当前的jti，说明refresh token被重复使用
+	RefreshTokenRotated = 1
+)
+
+// refresh token轮换：只有会话当前的jti才能换取新的token，旧的jti同时记录为已吊销
+var rotateRefreshTokenScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if not current then
+	return -1
+end
+if current ~= ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+redis.call("SET", KEYS[2], 1, "PX", ARGV[4])
+return 1
+`)
+
+func sessionKey(userId int64) string {
+	return getKey(KeyUserSessionPrefix + strconv.FormatInt(userId, 10))
+}
+
+// SaveSession 保存用户的登录会话，整个hash的过期时间会延长到最晚过期的会话
+func SaveSession(ctx context.Context, userId int64, s *models.Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	key := sessionKey(userId)
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, key, s.SessionId, data)
+	pipe.ExpireGT(ctx, key, time.Until(s.ExpireAt))
+	pipe.ExpireNX(ctx, key, time.Until(s.ExpireAt))
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// UpdateSession 更新已存在的会话，会话已被删除时返回false
+func UpdateSession(ctx context.Context, userId int64, s *models.Session) (bool, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return false, err
+	}
+	res, err := updateSessionScript.Run(ctx, rdb, []string{sessionKey(userId)}, s.SessionId, data).Int()
+	return res >= 0, err
+}
+
+// GetSession 获取用户的某个登录会话，不存在时返回nil
+func GetSession(ctx context.Context, userId int64, sessionId string) (*models.Session, error) {
+	data, err := rdb.HGet(ctx, sessionKey(userId), sessionId).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := new(models.Session)
+	if err = json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetSessions 获取用户所有的登录会话
+func GetSessions(ctx context.Context, userId int64) ([]models.Session, error) {
+	res, err := rdb.HGetAll(ctx, sessionKey(userId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]models.Session, 0, len(res))
+	for _, data := range res {
+		var s models.Session
+		if err = json.Unmarshal([]byte(data), &s); err != nil {
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+// DeleteSessions 删除用户的若干登录会话
+func DeleteSessions(ctx context.Context, userId int64, sessionIds ...string) error {
+	if len(sessionIds) == 0 {
+		return nil
+	}
+	return rdb.HDel(ctx, sessionKey(userId), sessionIds...).Err()
+}
+
+// SetRefreshToken 记录会话当前有效的refresh token的jti
+func SetRefreshToken(ctx context.Context, sessionId, jti string, expiration time.Duration) error {
+	return rdb.Set(ctx, getKey(KeyRefreshTokenPrefix+sessionId), jti, expiration).Err()
+}
+
+// RotateRefreshToken 把会话当前的jti从oldJti换成newJti，并在旧token过期之前保留旧jti的吊销记录
+func RotateRefreshToken(ctx context.Context, sessionId, oldJti, newJti string, expiration, oldRemaining time.Duration) (int, error) {
+	if oldRemaining < time.Millisecond {
+		oldRemaining = time.Millisecond
+	}
+	res, err := rotateRefreshTokenScript.Run(ctx, rdb,
+		[]string{getKey(KeyRefreshTokenPrefix + sessionId), getKey(KeyRevokedTokenPrefix + oldJti)},
+		oldJti, newJti, expiration.Milliseconds(), oldRemaining.Milliseconds()).Int()
+	if err != nil {
+		return RefreshTokenMissing, err
+	}
+	return res, nil
+}
+
+// RevokeRefreshTokens 吊销会话当前的refresh token，吊销记录保留expiration
+func RevokeRefreshTokens(ctx context.Context, expiration time.Duration, sessionIds ...string) error {
+	if len(sessionIds) == 0 {
+		return nil
+	}
+	keys := make([]string, len(sessionIds))
+	for i, id := range sessionIds {
+		keys[i] = getKey(KeyRefreshTokenPrefix + id)
+	}
+	jtis, err := rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return err
+	}
+	pipe := rdb.TxPipeline()
+	for _, jti := range jtis {
+		if jti, ok := jti.(string); ok {
+			pipe.Set(ctx, getKey(KeyRevokedTokenPrefix+jti), 1, expiration)
+		}
+	}
+	pipe.Del(ctx, keys...)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// IsTokenIdRevoked 判断jti是否已经被吊销
+func IsTokenIdRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := rdb.Exists(ctx, getKey(KeyRevokedTokenPrefix+jti)).Result()
+	return n > 0, err
+}
@@ -3,38 +3,12 @@ package redis_repo
 import (
 	"bluebell/models"
 	"context"
-	"fmt"
 	"go.uber.org/zap"
 	"strconv"
 	"strings"
 	"time"
 )
 
-// 将userId-access token存入数据库
-
-func SaveUserId2AccessToken(accessToken string, userId int64) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
-
-	err := rdb.HSet(ctx, fmt.Sprintf("%s%s", KeyPrefix, KeyUserTokenHash), strconv.FormatInt(userId, 10), accessToken).Err()
-	return err
-}
-
-func CheckUserId2AccessToken(userId int64, access_token string) (err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
-	accessToken, err := rdb.HGet(ctx, fmt.Sprintf("%s%s", KeyPrefix, KeyUserTokenHash), strconv.FormatInt(userId, 10)).Result()
-	if err != nil {
-		zap.L().Error("get access token from redis_repo userid2access_token failed", zap.Error(err))
-		return
-	}
-	if accessToken != access_token {
-		zap.L().Error("current access token is different from one in redis_repo...", zap.Error(ERROR_MORE_THAN_ONE_USER))
-		return
-	}
-	return nil
-}
-
 // SetEmailVerificationInfo 将邮箱验证码存入redis
 func SetEmailVerificationInfo(ctx context.Context, info string) error {
 	err := rdb.Set(ctx, getKey(KeyMailVerification+":"+info), true, EMAIL_VERFICATION_VALID_TIME).Err()
@@ -133,6 +107,7 @@ func ExecuteBatchFollowIncrOperation(keys [][]byte, values []interface{}) (err e
 	return err
 }
 
+// ExecuteBatchFollowOperation 批量修改关注/粉丝列表，列表没有从MySQL加载过时写入的只是部分数据，读取前会先合并MySQL中的数据
 func ExecuteBatchFollowOperation(ops []models.FollowOperation) (err error) {
 	pipe := rdb.TxPipeline()
 	for _, op := range ops {
@@ -0,0 +1,72 @@
+package redis_repo
+
+import (
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// 用户主页统计数据的字段
+const (
+	UserStatPosts         = "posts"
+	UserStatComments      = "comments"
+	UserStatLikesReceived = "likes_received"
+)
+
+// 统计数据缓存存在时才更新，不存在时等待下次访问主页时从MySQL重新统计
+var incrIfExistsScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("HINCRBY", KEYS[1], ARGV[1], ARGV[2])
+end
+return 0
+`)
+
+func userStatsKey(userId int64) string {
+	return getKey(KeyUserStatsPrefix + strconv.FormatInt(userId, 10))
+}
+
+// GetUserStats 获取缓存的用户统计数据，缓存不存在时返回nil
+func GetUserStats(userId int64) (map[string]int64, error) {
+	res, err := rdb.HGetAll(ctx, userStatsKey(userId)).Result()
+	if err != nil || len(res) == 0 {
+		return nil, err
+	}
+	stats := make(map[string]int64, len(res))
+	for field, val := range res {
+		stats[field], _ = strconv.ParseInt(val, 10, 64)
+	}
+	return stats, nil
+}
+
+// SetUserStats 缓存从MySQL统计出的用户数据
+func SetUserStats(userId int64, stats map[string]int64, expiration time.Duration) error {
+	key := userStatsKey(userId)
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, key, stats)
+	pipe.Expire(ctx, key, expiration)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// IncrUserStat 增量更新缓存的用户统计数据
+func IncrUserStat(userId int64, field string, delta int64) error {
+	return incrIfExistsScript.Run(ctx, rdb, []string{userStatsKey(userId)}, field, delta).Err()
+}
+
+// DeleteUserStats 删除缓存的用户统计数据，下次访问时重新统计
+func DeleteUserStats(userId int64) error {
+	return rdb.Del(ctx, userStatsKey(userId)).Err()
+}
+
+// GetUserFollowCounts 获取用户的粉丝数和关注数
+func GetUserFollowCounts(userId int64) (fans, follows int64, err error) {
+	id := strconv.FormatInt(userId, 10)
+	pipe := rdb.Pipeline()
+	fansCmd := pipe.ZScore(ctx, getKey(KeyUserFansCountZset), id)
+	followsCmd := pipe.ZScore(ctx, getKey(KeyUserFollowsCountZset), id)
+	if _, err = pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return 0, 0, err
+	}
+	return int64(fansCmd.Val()), int64(followsCmd.Val()), nil
+}
@@ -0,0 +1,312 @@
+package logic
+
+import (
+	"archive/zip"
+	"bluebell/cache"
+	"bluebell/dao/mysql_repo"
+	"bluebell/dao/redis_repo"
+	"bluebell/models"
+	"bluebell/pkg/sqls"
+	"bluebell/pkg/validation"
+	"bluebell/settings"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	DefaultDeletionGraceDays    = 14
+	DefaultAccountPurgeInterval = 60 // 分钟
+	DefaultExportDir            = "exports"
+	DefaultExportExpireTime     = 72               // 小时
+	ExportPendingExpireTime     = 30 * time.Minute // 生成中的记录的过期时间，服务在生成过程中重启时，过期后可以重新申请导出
+	accountPurgeBatchSize       = 100
+)
+
+// 个人数据导出的状态
+const (
+	ExportStatusNone    = "none"
+	ExportStatusPending = "pending"
+	ExportStatusReady   = "ready"
+	ExportStatusFailed  = "failed"
+)
+
+var (
+	ERROR_DELETION_NOT_REQUESTED = errors.New("account deletion has not been requested")
+	ERROR_EXPORT_NOT_READY       = errors.New("data export is not ready")
+)
+
+func deletionGracePeriod() time.Duration {
+	days := DefaultDeletionGraceDays
+	if cfg := settings.GlobalSettings.AccountCfg; cfg != nil && cfg.DeletionGraceDays > 0 {
+		days = cfg.DeletionGraceDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func exportDir() string {
+	if cfg := settings.GlobalSettings.AccountCfg; cfg != nil && cfg.ExportDir != "" {
+		return cfg.ExportDir
+	}
+	return DefaultExportDir
+}
+
+func exportExpireTime() time.Duration {
+	hours := DefaultExportExpireTime
+	if cfg := settings.GlobalSettings.AccountCfg; cfg != nil && cfg.ExportExpireTime > 0 {
+		hours = cfg.ExportExpireTime
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// RequestAccountDeletion 申请注销账号，需要再次输入密码，冷静期内可以撤销
+func RequestAccountDeletion(userId int64, password string) (res *models.ResponseAccountDeletion, err error) {
+	u := mysql_repo.UserRepository.Get(sqls.DB(), userId)
+	if u == nil {
+		return nil, ERROR_WRONG_USER
+	}
+	if !validation.CheckPassword(password, u.Password) {
+		return nil, ERROR_WRONG_PASSWORD
+	}
+	if u.DeleteRequestAt == nil {
+		if err = mysql_repo.UserRepository.UpdateColumn(sqls.DB(), userId, "delete_request_at", time.Now()); err != nil {
+			zap.L().Error("request account deletion error in logic.RequestAccountDeletion()", zap.Error(err))
+			return nil, err
+		}
+		cache.UserCache.Invalidate(userId)
+	}
+	return GetAccountDeletion(userId)
+}
+
+// CancelAccountDeletion 在冷静期内撤销注销申请
+func CancelAccountDeletion(userId int64) (err error) {
+	u := mysql_repo.UserRepository.Get(sqls.DB(), userId)
+	if u == nil {
+		return ERROR_WRONG_USER
+	}
+	if u.DeleteRequestAt == nil {
+		return ERROR_DELETION_NOT_REQUESTED
+	}
+	if err = mysql_repo.UserRepository.UpdateColumn(sqls.DB(), userId, "delete_request_at", nil); err != nil {
+		zap.L().Error("cancel account deletion error in logic.CancelAccountDeletion()", zap.Error(err))
+		return err
+	}
+	cache.UserCache.Invalidate(userId)
+	return nil
+}
+
+// GetAccountDeletion 获取账号注销的状态
+func GetAccountDeletion(userId int64) (*models.ResponseAccountDeletion, error) {
+	u := mysql_repo.UserRepository.Get(sqls.DB(), userId)
+	if u == nil {
+		return nil, ERROR_WRONG_USER
+	}
+	res := &models.ResponseAccountDeletion{Requested: u.DeleteRequestAt != nil}
+	if res.Requested {
+		purgeAt := u.DeleteRequestAt.Add(deletionGracePeriod())
+		res.RequestAt, res.PurgeAt = u.DeleteRequestAt, &purgeAt
+	}
+	return res, nil
+}
+
+// PurgeDeletedAccounts 匿名化冷静期已经结束的账号，并清理过期的导出文件
+func PurgeDeletedAccounts() {
+	before := time.Now().Add(-deletionGracePeriod())
+	for _, u := range mysql_repo.UserRepository.FindDeletionDue(sqls.DB(), before, accountPurgeBatchSize) {
+		if err := purgeAccount(u.UserId); err != nil {
+			zap.L().Error("purge deleted account failed", zap.Int64("user_id", u.UserId), zap.Error(err))
+		}
+	}
+	purgeExpiredExports()
+}
+
+// purgeAccount 先清理Redis，再匿名化MySQL中的数据，Redis清理失败时下一轮会重试
+func purgeAccount(userId int64) error {
+	if _, file, _, err := redis_repo.GetDataExport(ctx, userId); err == nil && file != "" {
+		os.Remove(file)
+	}
+	if err := redis_repo.ClearUserData(ctx, userId); err != nil {
+		return err
+	}
+	if err := mysql_repo.UserRepository.Anonymize(sqls.DB(), userId); err != nil {
+		return err
+	}
+	cache.UserCache.Invalidate(userId)
+	if err := RevokeUserTokens(userId); err != nil {
+		zap.L().Error("revoke tokens of deleted account failed", zap.Int64("user_id", userId), zap.Error(err))
+	}
+	zap.L().Info("account purged", zap.Int64("user_id", userId))
+	return nil
+}
+
+// StartAccountPurge 启动定时任务，定期处理冷静期结束的注销申请
+func StartAccountPurge() {
+	minutes := DefaultAccountPurgeInterval
+	if cfg := settings.GlobalSettings.AccountCfg; cfg != nil && cfg.PurgeInterval > 0 {
+		minutes = cfg.PurgeInterval
+	}
+	ticker := time.NewTicker(time.Duration(minutes) * time.Minute)
+	go func() {
+		for range ticker.C {
+			PurgeDeletedAccounts()
+		}
+	}()
+}
+
+// RequestDataExport 申请导出个人数据，导出文件在后台生成，正在生成时不会重复创建任务
+func RequestDataExport(userId int64) (*models.ResponseDataExport, error) {
+	res, err := GetDataExport(userId)
+	if err != nil || res.Status == ExportStatusPending {
+		return res, err
+	}
+	// 新的导出文件生成以后删除上一次的文件
+	_, previous, _, _ := redis_repo.GetDataExport(ctx, userId)
+	createAt := time.Now()
+	if err = redis_repo.SetDataExport(ctx, userId, ExportStatusPending, "", createAt, ExportPendingExpireTime); err != nil {
+		zap.L().Error("save data export status error in logic.RequestDataExport()", zap.Error(err))
+		return nil, err
+	}
+	go buildDataExport(userId, createAt, previous)
+	return &models.ResponseDataExport{Status: ExportStatusPending, CreateAt: createAt, ExpireAt: createAt.Add(exportExpireTime())}, nil
+}
+
+// GetDataExport 获取个人数据导出的状态
+func GetDataExport(userId int64) (*models.ResponseDataExport, error) {
+	status, _, createAt, err := redis_repo.GetDataExport(ctx, userId)
+	if err != nil {
+		zap.L().Error("get data export status error in logic.GetDataExport()", zap.Error(err))
+		return nil, err
+	}
+	if status == "" {
+		return &models.ResponseDataExport{Status: ExportStatusNone}, nil
+	}
+	return &models.ResponseDataExport{Status: status, CreateAt: createAt, ExpireAt: createAt.Add(exportExpireTime())}, nil
+}
+
+// GetDataExportFile 获取已经生成好的导出文件路径
+func GetDataExportFile(userId int64) (string, error) {
+	status, file, _, err := redis_repo.GetDataExport(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+	if status != ExportStatusReady || file == "" {
+		return "", ERROR_EXPORT_NOT_READY
+	}
+	if _, err = os.Stat(file); err != nil {
+		return "", ERROR_EXPORT_NOT_READY
+	}
+	return file, nil
+}
+
+type exportProfile struct {
+	UserId   int64     `json:"user_id,string"`
+	Username string    `json:"username"`
+	Email    string    `json:"email"`
+	Gender   int8      `json:"gender"`
+	Verified bool      `json:"verified"`
+	Role     int8      `json:"role"`
+	CreateAt time.Time `json:"create_at"`
+}
+
+type exportFollows struct {
+	Following []models.Follow `json:"following"`
+	Followers []models.Follow `json:"followers"`
+}
+
+type exportMessages struct {
+	Conversations []models.Conversation `json:"conversations"`
+	Messages      []models.Message      `json:"messages"`
+}
+
+// buildDataExport 生成包含个人数据的zip文件，每类数据对应一个json文件
+func buildDataExport(userId int64, createAt time.Time, previous string) {
+	file, err := writeDataExport(userId, createAt)
+	status := ExportStatusReady
+	if err != nil {
+		zap.L().Error("build data export failed", zap.Int64("user_id", userId), zap.Error(err))
+		status, file = ExportStatusFailed, ""
+	} else if previous != "" && previous != file {
+		os.Remove(previous)
+	}
+	if err = redis_repo.SetDataExport(ctx, userId, status, file, createAt, exportExpireTime()); err != nil {
+		zap.L().Error("save data export status failed", zap.Int64("user_id", userId), zap.Error(err))
+	}
+}
+
+func writeDataExport(userId int64, createAt time.Time) (path string, err error) {
+	u := mysql_repo.UserRepository.Get(sqls.DB(), userId)
+	if u == nil {
+		return "", ERROR_WRONG_USER
+	}
+	if err = os.MkdirAll(exportDir(), 0o700); err != nil {
+		return "", err
+	}
+	path = filepath.Join(exportDir(), fmt.Sprintf("%d-%d.zip", userId, createAt.UnixNano()))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+	defer f.Close()
+
+	db := sqls.DB()
+	conversations, messages := mysql_repo.MessageRepository.FindByUser(db, userId)
+	entries := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", exportProfile{u.UserId, u.Username, u.Email, u.Gender, u.Verified, u.Role, u.CreateAt}},
+		{"posts.json", mysql_repo.PostRepository.Find(db, sqls.NewCnd().Where("author_id = ?", userId).Asc("id"))},
+		{"comments.json", mysql_repo.CommentRepository.Find(db, sqls.NewCnd().Where("user_id = ?", userId).Asc("id"))},
+		{"votes.json", mysql_repo.VoteRepository.Find(db, sqls.NewCnd().Where("user_id = ? AND val <> 0", userId).Asc("id"))},
+		{"collections.json", mysql_repo.LikeRepository.Find(db, sqls.NewCnd().Where("user_id = ? AND val = 1", userId).Asc("id"))},
+		{"follows.json", exportFollows{
+			Following: mysql_repo.UserFollowRepository.Find(db, sqls.NewCnd().Where("follower_id = ? AND val = 1", userId).Asc("id")),
+			Followers: mysql_repo.UserFollowRepository.Find(db, sqls.NewCnd().Where("following_id = ? AND val = 1", userId).Asc("id")),
+		}},
+		{"messages.json", exportMessages{Conversations: conversations, Messages: messages}},
+		{"preferences.json", mysql_repo.UserPreferenceRepository.GetByUserId(db, userId)},
+	}
+	zw := zip.NewWriter(f)
+	for _, entry := range entries {
+		w, err := zw.Create(entry.name)
+		if err != nil {
+			return "", err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(entry.data); err != nil {
+			return "", err
+		}
+	}
+	if err = zw.Close(); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// purgeExpiredExports 删除超过保留时间的导出文件
+func purgeExpiredExports() {
+	entries, err := os.ReadDir(exportDir())
+	if err != nil {
+		return
+	}
+	expired := time.Now().Add(-exportExpireTime())
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || info.ModTime().After(expired) {
+			continue
+		}
+		if err = os.Remove(filepath.Join(exportDir(), entry.Name())); err != nil {
+			zap.L().Warn("remove expired data export failed", zap.String("file", entry.Name()), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package logic
+
+import (
+	"bluebell/cache"
+	"bluebell/dao/mysql_repo"
+	"bluebell/dao/redis_repo"
+	"bluebell/message_queue"
+	"bluebell/models"
+	"bluebell/pkg/sqls"
+	"bluebell/settings"
+	"fmt"
+	"go.uber.org/zap"
+	"time"
+)
+
+// 徽章由声明式的规则定义：用户的某个统计项达到阈值时颁发，规则可以在配置文件中替换
+// 消息队列的消费者在处理发布、点赞事件以后通过badgeEvaluator重新检查相关用户的统计项，排行榜类的徽章由定时任务在每周结束后颁发
+// 颁发记录的唯一索引保证同一徽章在同一周期内只颁发一次，重复处理事件不会重复颁发和通知
+
+// 徽章规则的统计项
+const (
+	BadgeMetricPosts              = redis_repo.UserStatPosts
+	BadgeMetricComments           = redis_repo.UserStatComments
+	BadgeMetricLikesReceived      = redis_repo.UserStatLikesReceived
+	BadgeMetricStreakDays         = "streak_days"          // 连续活跃（发帖、评论或点赞）的天数
+	BadgeMetricWeeklyTopCommenter = "weekly_top_commenter" // 上一周评论数最多的用户，阈值为最少的评论数
+)
+
+const (
+	DefaultBadgeRankInterval = 60 // 检查上一周排行榜徽章的间隔，单位为分钟
+	// 超过一天没有活动连续天数就会中断，多保留一天用来判断是否是连续的
+	streakExpireTime = 48 * time.Hour
+)
+
+type BadgeRule struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Metric      string `json:"metric"`
+	Threshold   int64  `json:"threshold"`
+}
+
+var DefaultBadgeRules = []BadgeRule{
+	{Name: "first_post", Title: "First Post", Description: "Published the first post", Metric: BadgeMetricPosts, Threshold: 1},
+	{Name: "first_comment", Title: "First Comment", Description: "Published the first comment", Metric: BadgeMetricComments, Threshold: 1},
+	{Name: "likes_100", Title: "Well Liked", Description: "Received 100 likes", Metric: BadgeMetricLikesReceived, Threshold: 100},
+	{Name: "streak_30", Title: "Regular", Description: "Active for 30 days in a row", Metric: BadgeMetricStreakDays, Threshold: 30},
+	{Name: "weekly_top_commenter", Title: "Top Commenter of the Week", Description: "Posted the most comments in a week", Metric: BadgeMetricWeeklyTopCommenter, Threshold: 10},
+}
+
+// GetBadgeRules 获取所有可以获得的徽章，配置了规则时使用配置的规则
+func GetBadgeRules() []BadgeRule {
+	cfg := settings.GlobalSettings.BadgeCfg
+	if cfg == nil || len(cfg.Rules) == 0 {
+		return DefaultBadgeRules
+	}
+	rules := make([]BadgeRule, 0, len(cfg.Rules))
+	for _, r := range cfg.Rules {
+		rules = append(rules, BadgeRule(r))
+	}
+	return rules
+}
+
+// awardBadge 颁发徽章并通知用户，已经颁发过时不做处理
+func awardBadge(userId int64, rule *BadgeRule, period string) error {
+	created, err := mysql_repo.UserBadgeRepository.Create(sqls.DB(), &models.UserBadge{UserId: userId, Badge: rule.Name, Period: period})
+	if err != nil || !created {
+		return err
+	}
+	zap.L().Info("badge awarded", zap.Int64("user_id", userId), zap.String("badge", rule.Name), zap.String("period", period))
+	CreateNotification(&models.Notification{
+		UserId:  userId,
+		Type:    models.NotificationBadge,
+		Content: rule.Title,
+	})
+	return nil
+}
+
+// evaluateBadges 根据用户当前的统计值颁发达到阈值的徽章，metrics中没有的统计项不检查
+func evaluateBadges(userId int64, metrics map[string]int64) error {
+	rules := GetBadgeRules()
+	for i := range rules {
+		v, ok := metrics[rules[i].Metric]
+		if !ok || v < rules[i].Threshold {
+			continue
+		}
+		if err := awardBadge(userId, &rules[i], ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evaluateStatBadges 检查发帖数、评论数、获赞总数相关的徽章
+func evaluateStatBadges(userId int64) error {
+	u := cache.UserCache.Get(userId)
+	if u == nil || u.Status == models.UserStatusDeleted {
+		return nil
+	}
+	stats, err := loadUserStats(userId)
+	if err != nil {
+		return err
+	}
+	return evaluateBadges(userId, stats)
+}
+
+// recordActivity 记录用户在t时活跃，更新连续活跃的天数并检查相关的徽章
+func recordActivity(userId int64, t time.Time) error {
+	y, m, d := t.In(time.Local).Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400
+	n, err := redis_repo.UpdateStreak(ctx, userId, day, streakExpireTime)
+	if err != nil {
+		return err
+	}
+	return evaluateBadges(userId, map[string]int64{BadgeMetricStreakDays: n})
+}
+
+// startOfWeek 返回t所在周的周一零点
+func startOfWeek(t time.Time) time.Time {
+	y, m, d := t.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// AwardWeeklyBadges 颁发上一周排行榜类的徽章，同一周重复执行不会重复颁发
+func AwardWeeklyBadges(now time.Time) {
+	end := startOfWeek(now)
+	start := end.AddDate(0, 0, -7)
+	year, week := start.ISOWeek()
+	period := fmt.Sprintf("%d-W%02d", year, week)
+	rules := GetBadgeRules()
+	for i := range rules {
+		if rules[i].Metric != BadgeMetricWeeklyTopCommenter {
+			continue
+		}
+		userId, count := mysql_repo.CommentRepository.TopCommenter(sqls.DB(), start, end)
+		if userId == 0 || count < rules[i].Threshold {
+			continue
+		}
+		if err := awardBadge(userId, &rules[i], period); err != nil {
+			zap.L().Error("award weekly badge failed", zap.String("badge", rules[i].Name), zap.String("period", period), zap.Error(err))
+		}
+	}
+}
+
+// badgeEvaluator 提供给消息队列的消费者检查徽章规则
+type badgeEvaluator struct{}
+
+func (badgeEvaluator) RecordActivity(userId int64, t time.Time) error {
+	return recordActivity(userId, t)
+}
+
+func (badgeEvaluator) EvaluateStats(userId int64) error {
+	return evaluateStatBadges(userId)
+}
+
+// StartBadgeEngine 注册消费者检查徽章规则的方法，并启动定期颁发上一周排行榜徽章的任务，需要在启动消息队列之前调用
+func StartBadgeEngine() {
+	message_queue.SetBadgeEvaluator(badgeEvaluator{})
+
+	minutes := DefaultBadgeRankInterval
+	if c := settings.GlobalSettings.BadgeCfg; c != nil && c.RankInterval > 0 {
+		minutes = c.RankInterval
+	}
+	ticker := time.NewTicker(time.Duration(minutes) * time.Minute)
+	go func() {
+		AwardWeeklyBadges(time.Now())
+		for range ticker.C {
+			AwardWeeklyBadges(time.Now())
+		}
+	}()
+}
+
+// GetUserBadges 获取用户获得的徽章，规则已经被删除的徽章不再显示
+func GetUserBadges(userId int64) []models.ResponseBadge {
+	rules := make(map[string]BadgeRule)
+	for _, r := range GetBadgeRules() {
+		rules[r.Name] = r
+	}
+	list := mysql_repo.UserBadgeRepository.FindByUserId(sqls.DB(), userId)
+	badges := make([]models.ResponseBadge, 0, len(list))
+	for _, b := range list {
+		r, ok := rules[b.Badge]
+		if !ok {
+			continue
+		}
+		badges = append(badges, models.ResponseBadge{
+			Name:        r.Name,
+			Title:       r.Title,
+			Description: r.Description,
+			Period:      b.Period,
+			AwardedAt:   b.CreateAt,
+		})
+	}
+	return badges
+}
@@ -4,19 +4,29 @@ import (
 	"bluebell/cache"
 	"bluebell/dao/mysql_repo"
 	"bluebell/dao/redis_repo"
+	"bluebell/message_queue"
 	"bluebell/models"
+	"bluebell/pkg/reputation"
 	"bluebell/pkg/sqls"
+	"bluebell/pkg/validation"
+	"bluebell/settings"
 	"errors"
 	"go.uber.org/zap"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const N_SUB_COMMENTS_TO_SHOW = 2
 const CommentType = 2
 
+const DefaultCommentEditWindow = 15 // 分钟
+
 var (
 	ERROR_ILLEGAL_COMMENT_DELETE = errors.New("can not delete other's comment")
 	ERROR_WRONG_COMMENT          = errors.New("no this comment")
+	ERROR_ILLEGAL_COMMENT_EDIT   = errors.New("can not edit other's comment")
+	ERROR_COMMENT_EDIT_EXPIRED   = errors.New("comment can no longer be edited")
 )
 
 func GetCommentById(commentId int64) (comment *models.Comment, err error) {
@@ -28,25 +38,53 @@ func GetCommentById(commentId int64) (comment *models.Comment, err error) {
 }
 
 func CreateComment(comment *models.Comment) (err error) {
+	if err = checkCommentLocked(comment.PostId, comment.UserId); err != nil {
+		return err
+	}
+	// 追评需要记录所在的根评论，根评论的root_comment_id为自身
+	comment.RootCommentId = comment.CommentId
+	if comment.ParentCommentId != 0 {
+		parent, err := GetCommentById(comment.ParentCommentId)
+		if err != nil || parent.PostId != comment.PostId {
+			zap.L().Error("parent comment not exists in logic.CreateComment()", zap.Int64("parent_comment_id", comment.ParentCommentId))
+			return ERROR_WRONG_COMMENT
+		}
+		comment.RootCommentId = parent.RootCommentId
+	}
+	// 新评论没有任何互动，热度为0，只用发布时间区分先后
+	comment.Score = int64(CommentHotScore(0, 0, 0, time.Now()) * models.CommentScoreScale)
 	err = mysql_repo.CommentRepository.Create(sqls.DB(), comment)
 	if err != nil {
 		zap.L().Error("mysql_repo.CreateComment(comment) failed", zap.Error(err))
 		return
 	}
-	var rootCommentId int64
-	if comment.ParentCommentId != 0 {
-		rootCommentId, err = mysql_repo.CommentRepository.GetRootCommentId(sqls.DB(), comment.ParentCommentId)
-		if err != nil {
-			zap.L().Error("mysql_repo.CommentRepository.GetRootCommentId failed", zap.Error(err))
-		}
-	}
-	// 获取根评论的id
 
-	err = redis_repo.CreateComment(comment, rootCommentId)
+	err = redis_repo.CreateComment(comment)
 	if err != nil {
 		zap.L().Error("create comment in redis_repo failed", zap.Error(err))
 		return err
 	}
+	if err = redis_repo.IncrUserStat(comment.UserId, redis_repo.UserStatComments, 1); err != nil {
+		zap.L().Error("update user comment count failed", zap.Int64("user_id", comment.UserId), zap.Error(err))
+	}
+	// 回复数会影响父评论的热度
+	if comment.ParentCommentId != 0 {
+		if err = UpdateCommentScore(comment.ParentCommentId); err != nil {
+			zap.L().Error("update parent comment score failed", zap.Error(err))
+		}
+	}
+	if _, err = SaveMentions(CommentType, comment.CommentId, comment.PostId, comment.UserId, comment.Content); err != nil {
+		zap.L().Error("save comment mentions failed", zap.Int64("comment_id", comment.CommentId), zap.Error(err))
+	}
+	if err = message_queue.SendContentEvent(ctx, message_queue.ContentEvent{
+		UserId:     comment.UserId,
+		TargetType: CommentType,
+		TargetId:   comment.CommentId,
+		PostId:     comment.PostId,
+		Timestamp:  time.Now().Format(time.RFC3339),
+	}); err != nil {
+		zap.L().Error("send comment content event failed", zap.Int64("comment_id", comment.CommentId), zap.Error(err))
+	}
 	return nil
 }
 
@@ -56,6 +94,11 @@ func CreateComment(comment *models.Comment) (err error) {
 // 3. direction为-1，原值为1，0。最终的值会在原值的基础上减1或者2
 
 func VoteComment(userId int64, comment *models.ParamVoteComment) (err error) {
+	// Redis中没有该评论的投票数据时（例如Redis数据丢失），先从MySQL重建，避免把用户原来的投票当作none
+	if err = loadCommentVotes(comment.CommentId); err != nil {
+		zap.L().Error("load comment votes error", zap.Int64("comment_id", comment.CommentId), zap.Error(err))
+		return
+	}
 	// 从Redis中获取当前用户对评论的点赞情况
 	oValue, err := redis_repo.GetUser2CommentVoted(strconv.FormatInt(userId, 10), strconv.FormatInt(comment.CommentId, 10))
 	if err != nil {
@@ -72,9 +115,39 @@ func VoteComment(userId int64, comment *models.ParamVoteComment) (err error) {
 		zap.L().Error("error occur during modify redis post vote or devote...", zap.Error(err))
 		return err
 	}
+	if err = UpdateCommentScore(comment.CommentId); err != nil {
+		zap.L().Error("update comment score failed", zap.Int64("comment_id", comment.CommentId), zap.Error(err))
+	}
+	// 写入Redis成功后再发送消息到消息队列，由消费者持久化到MySQL
+	err = message_queue.SendCommentVoteEvent(ctx, message_queue.CommentVoteEvent{
+		UserId:    userId,
+		CommentId: comment.CommentId,
+		Val:       comment.Direction,
+		Timestamp: time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		zap.L().Error("send message to message queue error in logic.VoteComment", zap.Error(err))
+		return err
+	}
 	return nil
 }
 
+// loadCommentVotes 如果Redis中没有评论的投票数据，从MySQL中读取所有投票记录重建
+func loadCommentVotes(commentId int64) error {
+	id := strconv.FormatInt(commentId, 10)
+	loaded, err := redis_repo.CommentVotesLoaded(id)
+	if err != nil || loaded {
+		return err
+	}
+	list := mysql_repo.VoteRepository.Find(sqls.DB(), sqls.NewCnd().Cols("user_id", "val").
+		Where("type = ?", CommentType).Where("target_id = ?", commentId).Where("val <> ?", 0))
+	votes := make(map[string]float64, len(list))
+	for _, v := range list {
+		votes[strconv.FormatInt(v.UserId, 10)] = float64(v.Val)
+	}
+	return redis_repo.RebuildCommentVotes(id, votes)
+}
+
 func DeleteComment(commentId, userId int64) (err error) {
 	// 先确认这个userID是否为该post的作者
 	comment, err := GetCommentById(commentId)
@@ -82,35 +155,16 @@ func DeleteComment(commentId, userId int64) (err error) {
 		zap.L().Error("find comment id error in logic.DeleteComment()", zap.Error(err))
 		return
 	}
-	if comment.UserId != userId {
+	if comment.UserId != userId && !IsModerator(userId) {
 		zap.L().Warn("only author can delete his own post")
 		return ERROR_ILLEGAL_COMMENT_DELETE
 	}
 
-	// 删除对该comment所有的点赞/点踩/收藏/评论/分数
-	// 删除对该comment的所有追评，如果该评论是根评论
-	// 点赞/点踩/分数/评论数在redis中
-	// 子评论在MySQL中
-	var rootCommentId int64 = 0
-	if comment.ParentCommentId != 0 {
-		// 说明不是根节点
-		rootCommentId, err = mysql_repo.CommentRepository.GetRootCommentId(sqls.DB(), comment.ParentCommentId)
-		if err != nil {
-			return err
-		}
-	} else {
-		rootCommentId = commentId
-	}
-
-	// 从redis中获取需要删除的所有评论ID
-	commentIdList, err := redis_repo.GetToDeleteComment(commentId, rootCommentId)
+	// 删除根评论时，其下所有的追评一起删除；删除追评时只删除该评论本身，其下的回复仍然保留
+	// MySQL中只是软删除，记录到回收站中，点赞/点踩记录保留到回收站过期
+	deleteAt := time.Now().Truncate(time.Second)
+	commentIdList, err := mysql_repo.CommentRepository.DeleteCommentInfo(sqls.DB(), comment, deleteAt)
 	if err != nil {
-		zap.L().Error("get all to delete comment ids error in logic.DeleteComment()", zap.Error(err))
-		return err
-	}
-
-	// 通过获取的ID列表删除所有评论
-	if err = mysql_repo.CommentRepository.DeleteCommentInfo(sqls.DB(), commentIdList); err != nil {
 		zap.L().Error("delete comments in mysql error in logic.DeleteComment()", zap.Error(err))
 		return err
 	}
@@ -121,142 +175,206 @@ func DeleteComment(commentId, userId int64) (err error) {
 	}
 
 	// 删除redis中和评论相关的所有记录
-	err = redis_repo.DeleteCommentInfo(commentId, rootCommentId, comment.PostId, commentIdList)
+	err = redis_repo.DeleteCommentInfo(comment, commentIdList)
 	if err != nil {
 		zap.L().Error("fail to delete post related info in redis", zap.Error(err))
 		return err
 	}
+	// 回复数会影响父评论的热度
+	if comment.ParentCommentId != 0 {
+		if err = UpdateCommentScore(comment.ParentCommentId); err != nil {
+			zap.L().Error("update parent comment score failed", zap.Error(err))
+		}
+	} else {
+		// 置顶的评论被删除以后取消置顶，从回收站恢复时不会重新置顶
+		unpinComment(comment.PostId, commentId)
+	}
+	moveToTrash(&models.Trash{
+		Type:       CommentType,
+		TargetId:   commentId,
+		UserId:     comment.UserId,
+		OperatorId: userId,
+		PostId:     comment.PostId,
+		RelatedIds: strings.Join(commentIdList, ","),
+		Title:      excerpt(comment.Content, TrashTitleLen),
+		DeletedAt:  deleteAt,
+	})
+	// 被版主删除的评论扣除作者的声望，从回收站恢复时返还
+	if comment.UserId != userId {
+		changeReputation(comment.UserId, reputation.ContentRemoved, 1)
+	}
+
+	return nil
+}
+
+func commentEditWindow() time.Duration {
+	minutes := DefaultCommentEditWindow
+	if cfg := settings.GlobalSettings.CommentCfg; cfg != nil && cfg.EditWindow > 0 {
+		minutes = cfg.EditWindow
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// EditComment 作者在允许编辑的时间内修改评论，修改前的内容保存为历史版本
+func EditComment(userId int64, param *models.ParamEditComment) (err error) {
+	comment, err := GetCommentById(param.CommentId)
+	if err != nil {
+		zap.L().Error("find comment id error in logic.EditComment()", zap.Error(err))
+		return
+	}
+	if comment.UserId != userId {
+		zap.L().Warn("only author can edit his own comment")
+		return ERROR_ILLEGAL_COMMENT_EDIT
+	}
+	if time.Since(comment.CreateAt) > commentEditWindow() {
+		return ERROR_COMMENT_EDIT_EXPIRED
+	}
+	if comment.Content == param.Content {
+		return nil
+	}
+
+	// 修改后的内容同样需要经过内容规则的检查，编辑不算新的发布，不检查发布频率
+	edited := *comment
+	edited.Content = param.Content
+	u := cache.UserCache.Get(userId)
+	if u == nil {
+		return ERROR_WRONG_USER
+	}
+	if err = validation.CheckCommentContent(u, &edited); err != nil {
+		zap.L().Error("This user hit some strategy, fail to edit comment", zap.Error(err))
+		return err
+	}
 
+	history := &models.CommentHistory{
+		CommentId: comment.CommentId,
+		EditorId:  userId,
+		Content:   comment.Content,
+	}
+	if err = mysql_repo.CommentRepository.EditComment(sqls.DB(), history, param.Content, time.Now()); err != nil {
+		zap.L().Error("edit comment in mysql error in logic.EditComment()", zap.Error(err))
+		return err
+	}
+	cache.CommentCache.Invalidate(comment.CommentId)
+	// 重新解析@，只通知新被@的用户
+	if _, err = SaveMentions(CommentType, comment.CommentId, comment.PostId, userId, param.Content); err != nil {
+		zap.L().Error("save comment mentions failed", zap.Int64("comment_id", comment.CommentId), zap.Error(err))
+	}
 	return nil
 }
 
-func GetCommentListByPostId(query *models.ParamGetCommentByPostId) (res [][]*models.Comment, err error) {
-	// 从bluebell:post:[post-id]中找到所有的根评论
-	// 在根据这些根评论，去bluebell:comment:child_comment_record:[comment-id]中找出所有的子评论
-	// 采用BFS的策略
+// GetCommentHistory 获取评论的历史版本，只有版主可以查看
+func GetCommentHistory(userId, commentId int64) (list []models.CommentHistory, err error) {
+	if !IsModerator(userId) {
+		return nil, ERROR_NOT_MODERATOR
+	}
+	if _, err = GetCommentById(commentId); err != nil {
+		return nil, err
+	}
+	list = mysql_repo.CommentHistoryRepository.Find(sqls.DB(), sqls.NewCnd().Where("comment_id = ?", commentId).Desc("id"))
+	return list, nil
+}
+
+// GetCommentListByPostId 分页获取帖子下的根评论及其追评，同时返回帖子置顶的评论id，没有置顶时为0
+func GetCommentListByPostId(query *models.ParamGetCommentByPostId) (res [][]*models.Comment, pinnedId int64, err error) {
+	// 从bluebell:post:[post-id]中找到所有的根评论，排序分页以后，再通过root_comment_id一次查询出这些根评论下的追评
 	RootComments, err := redis_repo.GetAllRootComment(query.PostId)
-	// 存放不同根评论下的所有子评论，每个数组代表一个跟评论下所有的评论
-	commentsIds := make([][]string, len(RootComments))
-	for idx, root := range RootComments {
-		ids, err := redis_repo.GetSubCommentIdsByRootComment(root)
-		if err != nil {
-			zap.L().Error("logic.GetCommentListByPostId error in get sub comment ids", zap.Error(err))
-			return nil, err
-		}
-		commentsIds[idx] = ids
+	if err != nil {
+		return nil, 0, err
+	}
+	// Redis中的set是无序的，需要按照指定方式排序
+	if query.Sort == "" {
+		query.Sort = models.CommentSortHot
+	}
+	if err = sortCommentIds(RootComments, query.Sort); err != nil {
+		zap.L().Error("sort root comments error in logic.GetCommentListByPostId()", zap.Error(err))
+		return nil, 0, err
+	}
+	// 置顶的评论不论按照哪种方式排序都显示在最前面
+	postId, _ := strconv.ParseInt(query.PostId, 10, 64)
+	if post, err := GetPostById(postId); err == nil {
+		pinnedId = post.PinnedCommentId
+		pinToFront(RootComments, pinnedId)
 	}
-	// 虽然获取了所有根评论下的所有追评，但是在展示的时候没有必要一次性全部查询出来
 	// 通过page 和 size确定要查哪些记录，size确定每页显示几条根评论，page确定从第几页开始选
 	start := (query.Page - 1) * query.Size
-	end := start + query.Size
-	// 查询[start,end]范围内的评论
-
-	for i := start; i < end; i++ {
-		if i >= len(commentsIds) {
-			break
+	end := min(start+query.Size, len(RootComments))
+	if start < 0 || start >= end {
+		return nil, pinnedId, nil
+	}
+	rootIds := make([]int64, 0, end-start)
+	for _, id := range RootComments[start:end] {
+		id_, _ := strconv.ParseInt(id, 10, 64)
+		rootIds = append(rootIds, id_)
+	}
+	// 存放不同根评论下的评论，只展示前几条追评
+	subComments := make(map[int64][]*models.Comment, len(rootIds))
+	list := mysql_repo.CommentRepository.FindSubtree(sqls.DB(), rootIds)
+	for i := range list {
+		root := list[i].RootCommentId
+		if len(subComments[root]) < N_SUB_COMMENTS_TO_SHOW {
+			subComments[root] = append(subComments[root], &list[i])
 		}
-		tmp := []*models.Comment{}
-		// 查询根评论
-		rootCommentId, _ := strconv.ParseInt(RootComments[i], 10, 64)
+	}
+	for _, rootCommentId := range rootIds {
 		rootComment, err1 := GetCommentById(rootCommentId)
 		if err1 != nil {
 			zap.L().Error("find root comment id error in logic.GetCommentListByPostId()", zap.Error(err1))
-			return
+			return nil, 0, err1
 		}
-		//rootComment := mysql_repo.CommentRepository.Get(sqls.DB(), rootCommentId)
-		tmp = append(tmp, rootComment)
-		// 只展示前几条子评论
-		for j := 0; j < min(N_SUB_COMMENTS_TO_SHOW, len(commentsIds[i])); j++ {
-			commentId, _ := strconv.ParseInt(commentsIds[i][j], 10, 64)
-			comment, err1 := GetCommentById(commentId)
-			if err1 != nil {
-				zap.L().Error("find comment id error in logic.GetCommentListByPostId()", zap.Error(err1))
-				return
-			}
-			tmp = append(tmp, comment)
-		}
-		res = append(res, tmp)
+		res = append(res, append([]*models.Comment{rootComment}, subComments[rootCommentId]...))
 	}
-	return res, nil
+	return res, pinnedId, nil
 }
 
-func GetCommentDetail(commentId int64) (res models.ResponseComment, err error) {
-	// 首先根据comment id获取comment 信息，判断这个是不是根评论
-	comment := mysql_repo.CommentRepository.Get(sqls.DB(), commentId)
-	var parentId int64
-	if comment.ParentCommentId == 0 {
-		// 说明是根评论，可直接加载所有的子评论
-		parentId = comment.CommentId
-	} else {
-		// 说明是子评论，需要找到根评论，然后加载所有的子评论
-		parentId, err = mysql_repo.CommentRepository.GetRootCommentId(sqls.DB(), comment.ParentCommentId)
-		if err != nil {
-			zap.L().Error("find root comment id error in logic.GetCommentDetail()", zap.Error(err))
-			return
-		}
-	}
-	// 通过根评论，获取子评论的id
-	subCommentIds, err := redis_repo.GetSubCommentIdsByRootComment(strconv.FormatInt(parentId, 10))
+// GetReplyCount 获取评论的回复数，根评论统计其下所有的追评，追评只统计直接回复
+func GetReplyCount(commentId int64) int64 {
+	comment, err := GetCommentById(commentId)
 	if err != nil {
-		zap.L().Error("get sub comment ids error in logic.GetCommentDetail()", zap.Error(err))
-		return
+		return 0
 	}
+	if comment.ParentCommentId != 0 {
+		return mysql_repo.CommentRepository.CountDirectReplies(sqls.DB(), commentId)
+	}
+	return mysql_repo.CommentRepository.CountReplies(sqls.DB(), []int64{commentId})[commentId]
+}
 
-	// 通过这些评论ID，获取所有的评论信息
-	rootComment := mysql_repo.CommentRepository.Get(sqls.DB(), parentId)
-	username, err := GetUsernameById(rootComment.UserId)
+func GetCommentDetail(commentId int64) (res models.ResponseComment, err error) {
+	// 首先根据comment id获取comment 信息，找到所在的根评论，然后加载根评论下所有的追评
+	comment, err := GetCommentById(commentId)
 	if err != nil {
-		zap.L().Error("get username error in logic.GetCommentDetail()", zap.Error(err))
+		zap.L().Error("find comment error in logic.GetCommentDetail()", zap.Error(err))
 		return
 	}
-
-	voteNum, err := redis_repo.GetCommentVoteNumById(strconv.FormatInt(rootComment.CommentId, 10))
+	rootComment, err := GetCommentById(comment.RootCommentId)
 	if err != nil {
-		zap.L().Error("get vote num by comment id error", zap.Error(err))
+		zap.L().Error("find root comment error in logic.GetCommentDetail()", zap.Error(err))
+		return
+	}
+	if res, err = toResponseComment(rootComment); err != nil {
+		zap.L().Error("build root comment error in logic.GetCommentDetail()", zap.Error(err))
 		return
 	}
 
-	res.Username = username
-	res.Content = rootComment.Content
-	res.VoteNum = voteNum
-	res.UpdateAt = rootComment.UpdateAt
-	res.SubComment = make([]models.ResponseComment, len(subCommentIds))
-	for i := 1; i < len(subCommentIds); i++ {
-		id := subCommentIds[i]
-		id_, _ := strconv.ParseInt(id, 10, 64)
-		comment, err = GetCommentById(id_)
-		if err != nil {
-			zap.L().Error("get comment error in logic.GetCommentDetail()", zap.Error(err))
+	subComments := mysql_repo.CommentRepository.FindSubtree(sqls.DB(), []int64{rootComment.CommentId})
+	res.SubComment = make([]models.ResponseComment, len(subComments))
+	for i := range subComments {
+		comment = &subComments[i]
+		if res.SubComment[i], err = toResponseComment(comment); err != nil {
+			zap.L().Error("build sub comment error in logic.GetCommentDetail()", zap.Error(err))
 			return models.ResponseComment{}, err
 		}
-		//comment = mysql_repo.CommentRepository.Get(sqls.DB(), id_)
-		username, err = GetUsernameById(comment.UserId)
-		if err != nil {
-			zap.L().Error("get username error in logic.GetCommentDetail()", zap.Error(err))
-			return
-		}
-		voteNum, err = redis_repo.GetCommentVoteNumById(id)
-		if err != nil {
-			zap.L().Error("get vote num by comment id error", zap.Error(err))
-			return
-		}
-		res.SubComment[i-1].Username = username
-		res.SubComment[i-1].Content = comment.Content
-		res.SubComment[i-1].VoteNum = voteNum
-		res.SubComment[i-1].UpdateAt = comment.UpdateAt
-		if comment.ParentCommentId != rootComment.CommentId && comment.ParentCommentId != 0 {
-			// 说明是对另一个子评论的追评
+		if comment.ParentCommentId != rootComment.CommentId {
+			// 说明是对另一个追评的回复，被回复的评论可能已经被删除
 			replyComment, err1 := GetCommentById(comment.ParentCommentId)
 			if err1 != nil {
-				zap.L().Error("get comment error in logic.GetCommentDetail()", zap.Error(err1))
-				return models.ResponseComment{}, err1
+				continue
 			}
 			replyUserName, err1 := GetUsernameById(replyComment.UserId)
 			if err1 != nil {
 				zap.L().Error("get username error in logic.GetCommentDetail()", zap.Error(err1))
 				return models.ResponseComment{}, err1
 			}
-			res.SubComment[i-1].ReplyTo = replyUserName
+			res.SubComment[i].ReplyTo = replyUserName
 		}
 	}
 	return res, nil
@@ -0,0 +1,128 @@
+package logic
+
+import (
+	"bluebell/dao/mysql_repo"
+	"bluebell/dao/redis_repo"
+	"bluebell/models"
+	"bluebell/pkg/sqls"
+	"go.uber.org/zap"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	wilsonZ            = 1.96             // 95%置信度
+	commentReplyWeight = 0.5              // 一条回复相当于半个可信的赞
+	commentHotEpoch    = 1704067200       // 2024-01-01，计算发布时间部分的起点
+	commentHotDecay    = 70 * 24 * 3600.0 // 晚发布一周的评论热度高0.1，相当于Wilson下界高0.1
+	N_TOP_COMMENTS     = 3
+)
+
+// wilsonLowerBound 点赞率的Wilson置信区间下界，票数越少越保守
+func wilsonLowerBound(ups, downs float64) float64 {
+	n := ups + downs
+	if n == 0 {
+		return 0
+	}
+	p := ups / n
+	z2 := wilsonZ * wilsonZ
+	return (p + z2/(2*n) - wilsonZ*math.Sqrt((p*(1-p)+z2/(4*n))/n)) / (1 + z2/n)
+}
+
+// CommentHotScore 计算评论热度
+// 热度由Wilson下界和发布时间两部分相加，回复按照commentReplyWeight折算成赞；
+// 发布时间部分随发布时间线性增长，相当于旧评论的热度随时间衰减：几天内主要由投票决定顺序，几周以后新评论会排到旧评论前面，
+// 衰减通过新评论的基数更高实现，已存储的热度不需要随时间重新计算
+func CommentHotScore(ups, downs, replies int64, createAt time.Time) float64 {
+	lower := wilsonLowerBound(float64(ups)+commentReplyWeight*float64(replies), float64(downs))
+	age := float64(createAt.Unix()-commentHotEpoch) / commentHotDecay
+	return lower + max(age, 0)
+}
+
+// UpdateCommentScore 根据Redis中的点赞/点踩/回复数重新计算评论热度，同时写入Redis和MySQL
+func UpdateCommentScore(commentId int64) error {
+	comment, err := GetCommentById(commentId)
+	if err != nil {
+		return err
+	}
+	ups, downs, err := redis_repo.GetCommentVoteStat(strconv.FormatInt(commentId, 10))
+	if err != nil {
+		return err
+	}
+	replies := mysql_repo.CommentRepository.CountDirectReplies(sqls.DB(), commentId)
+	score := CommentHotScore(ups, downs, replies, comment.CreateAt)
+	if err = redis_repo.SetCommentScore(commentId, score); err != nil {
+		zap.L().Error("set comment score in redis failed", zap.Int64("comment_id", commentId), zap.Error(err))
+		return err
+	}
+	if err = mysql_repo.CommentRepository.UpdateScore(sqls.DB(), commentId, int64(score*models.CommentScoreScale)); err != nil {
+		zap.L().Error("update comment score in mysql failed", zap.Int64("comment_id", commentId), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// sortCommentIds 按照指定方式对评论id排序，hot按照热度从高到低，new/old按照发布时间
+func sortCommentIds(ids []string, sortBy string) error {
+	values, err := redis_repo.GetCommentsOrderValue(ids, sortBy != models.CommentSortHot)
+	if err != nil {
+		return err
+	}
+	idx := make([]int, len(ids))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		if sortBy == models.CommentSortOld {
+			return values[idx[a]] < values[idx[b]]
+		}
+		return values[idx[a]] > values[idx[b]]
+	})
+	sorted := make([]string, len(ids))
+	for i, j := range idx {
+		sorted[i] = ids[j]
+	}
+	copy(ids, sorted)
+	return nil
+}
+
+// GetTopComments 获取帖子下热度最高的n条根评论
+func GetTopComments(postId int64, n int) (res []models.ResponseComment, err error) {
+	roots, err := redis_repo.GetAllRootComment(strconv.FormatInt(postId, 10))
+	if err != nil {
+		return nil, err
+	}
+	if err = sortCommentIds(roots, models.CommentSortHot); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(roots) && len(res) < n; i++ {
+		id, _ := strconv.ParseInt(roots[i], 10, 64)
+		comment, err := GetCommentById(id)
+		if err != nil {
+			zap.L().Error("get comment error in logic.GetTopComments()", zap.Int64("comment_id", id), zap.Error(err))
+			continue
+		}
+		item, err := toResponseComment(comment)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, item)
+	}
+	return res, nil
+}
+
+func toResponseComment(comment *models.Comment) (res models.ResponseComment, err error) {
+	if res.Username, err = GetUsernameById(comment.UserId); err != nil {
+		return res, err
+	}
+	if res.VoteNum, err = redis_repo.GetCommentVoteNumById(strconv.FormatInt(comment.CommentId, 10)); err != nil {
+		return res, err
+	}
+	res.Content = comment.Content
+	res.UpdateAt = comment.UpdateAt
+	res.Edited, res.EditedAt = comment.EditedAt != nil, comment.EditedAt
+	res.Mentions = GetMentionSpans(CommentType, comment.CommentId)
+	return res, nil
+}
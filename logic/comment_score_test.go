@@ -0,0 +1,44 @@
+package logic
+
+import (
+	"bluebell/models"
+	"testing"
+	"time"
+)
+
+func TestCommentHotScore(t *testing.T) {
+	old := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	hourLater := old.Add(time.Hour)
+	weekLater := old.AddDate(0, 0, 7)
+	yearLater := old.AddDate(1, 0, 0)
+	tests := []struct {
+		name          string
+		higher, lower float64
+	}{
+		// 发布时间接近时按照Wilson下界排序，票数少的评论更保守
+		{"more votes at the same ratio", CommentHotScore(100, 10, 0, old), CommentHotScore(10, 1, 0, hourLater)},
+		{"better ratio", CommentHotScore(50, 5, 0, old), CommentHotScore(60, 40, 0, hourLater)},
+		{"single up vote beats no votes", CommentHotScore(1, 0, 0, old), CommentHotScore(0, 0, 0, hourLater)},
+		{"replies count as up votes", CommentHotScore(5, 0, 4, old), CommentHotScore(5, 0, 0, hourLater)},
+		// 下界相同时新评论排在前面
+		{"newer wins a tie", CommentHotScore(3, 1, 0, hourLater), CommentHotScore(3, 1, 0, old)},
+		{"newer wins without votes", CommentHotScore(0, 0, 0, hourLater), CommentHotScore(0, 0, 0, old)},
+		// 热度随时间衰减，一周前的热门评论仍然排在没有投票的新评论前面，一年前的热门评论会排到新评论后面
+		{"popular comment of last week", CommentHotScore(100, 10, 0, old), CommentHotScore(0, 0, 0, weekLater)},
+		{"popular comment of last year", CommentHotScore(3, 1, 0, yearLater), CommentHotScore(100, 10, 0, old)},
+	}
+	for _, tt := range tests {
+		if tt.higher <= tt.lower {
+			t.Errorf("%s: %v should rank above %v", tt.name, tt.higher, tt.lower)
+		}
+		// 保存到MySQL时的精度同样能区分先后
+		if int64(tt.higher*models.CommentScoreScale) <= int64(tt.lower*models.CommentScoreScale) {
+			t.Errorf("%s: scaled scores are not ordered", tt.name)
+		}
+	}
+
+	// 衰减的速度：晚发布一周的评论热度高0.1
+	if d := CommentHotScore(0, 0, 0, weekLater) - CommentHotScore(0, 0, 0, old); d < 0.099 || d > 0.101 {
+		t.Errorf("score gained in a week = %v, want 0.1", d)
+	}
+}
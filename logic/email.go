@@ -1,16 +1,17 @@
 package logic
 
 import (
+	"bluebell/models"
 	"bluebell/settings"
 	"bytes"
 	"crypto/tls"
 	"errors"
-	"fmt"
 	"github.com/k3a/html2text"
 	"github.com/vanng822/go-premailer/premailer"
 	"go.uber.org/zap"
 	"gopkg.in/gomail.v2"
 	"html/template"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -21,11 +22,12 @@ type EmailVerificationData struct {
 	Username         string
 	VerificationCode string
 	Subject          string
+	// 通知邮件中每条通知的文字
+	Notifications []string
 }
 
 func GenEmailVerificationURL(info string) string {
-	return fmt.Sprintf("%s:%d/api/v1/verify-email?info=%s",
-		settings.GlobalSettings.AppCfg.Host, settings.GlobalSettings.AppCfg.Port, info)
+	return AbsoluteURL("/api/v1/verify-email?info=" + url.QueryEscape(info))
 }
 
 func GenEmailVerificationData(email string, info string) *EmailVerificationData {
@@ -44,6 +46,14 @@ func GenEmailVerificationCodeData(email string, code string) *EmailVerificationD
 	}
 }
 
+func GenPasswordResetData(username string, url string) *EmailVerificationData {
+	return &EmailVerificationData{
+		URL:      url,
+		Username: username,
+		Subject:  "Reset your Bluebell password",
+	}
+}
+
 func ParseTemplateDir(dir string) (*template.Template, error) {
 	t := template.New("") // 创建一个新的模板上下文
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
@@ -77,6 +87,50 @@ func SendVerificationCodeEmail(email string, code string) error {
 	return SendEmail(email, "email-code", false, GenEmailVerificationCodeData(email, code))
 }
 
+// 重置密码的邮件，包含一次性的重置链接
+func SendPasswordResetEmail(email string, data *EmailVerificationData) error {
+	return SendEmail(email, "password-reset", true, data)
+}
+
+func GenLoginLockedData(username string) *EmailVerificationData {
+	return &EmailVerificationData{
+		URL:      AbsoluteURL("/forgot-password"),
+		Username: username,
+		Subject:  "Your Bluebell account has been temporarily locked",
+	}
+}
+
+func SendLoginLockedEmail(email string, data *EmailVerificationData) error {
+	return SendEmail(email, "login-locked", true, data)
+}
+
+// GenNotificationData 通知邮件的内容，digest为true时是按频率汇总的摘要
+func GenNotificationData(username, language string, notifications []string, digest bool) *EmailVerificationData {
+	subject := "你在 Bluebell 有新的通知"
+	switch {
+	case language == models.LanguageEn && digest:
+		subject = "Your Bluebell notification digest"
+	case language == models.LanguageEn:
+		subject = "You have new notifications on Bluebell"
+	case digest:
+		subject = "Bluebell 通知摘要"
+	}
+	return &EmailVerificationData{
+		URL:           AbsoluteURL("/notifications"),
+		Username:      username,
+		Subject:       subject,
+		Notifications: notifications,
+	}
+}
+
+// 通知邮件，按用户设置的语言选择模板
+func SendNotificationEmail(email, language string, data *EmailVerificationData) error {
+	if language == models.LanguageEn {
+		return SendEmail(email, "notification-en", true, data)
+	}
+	return SendEmail(email, "notification", true, data)
+}
+
 func SendEmail(email, templateFileName string, alternative bool, data *EmailVerificationData) error {
 	email_config := settings.GlobalSettings.EmailCfg
 	m := gomail.NewMessage()
@@ -0,0 +1,292 @@
+package logic
+
+import (
+	"bluebell/dao/redis_repo"
+	"bluebell/settings"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/k3a/html2text"
+	"go.uber.org/zap"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EmbedCacheExpire    = 10 * time.Minute
+	EmbedExcerptLen     = 200
+	OEmbedDefaultWidth  = 550
+	OEmbedDefaultHeight = 400
+)
+
+var (
+	ERROR_INVALID_EMBED_URL = errors.New("invalid post url")
+
+	markdownImageRegexp = regexp.MustCompile(`!\[[^\]]*\]\(\s*([^)\s]+)`)
+	markdownImageTag    = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+	htmlImageRegexp     = regexp.MustCompile(`(?i)<img[^>]+src\s*=\s*["']([^"']+)["']`)
+
+	// 预览页面的模板在第一次使用时解析，之后一直使用解析好的模板
+	embedTemplateOnce sync.Once
+	embedTemplate     *template.Template
+	embedTemplateErr  error
+)
+
+// PostEmbedData 帖子的预览信息，用于渲染Open Graph页面以及oEmbed
+type PostEmbedData struct {
+	PostId        int64     `json:"post_id,string"`
+	Title         string    `json:"title"`
+	Excerpt       string    `json:"excerpt"`
+	AuthorName    string    `json:"author_name"`
+	CommunityName string    `json:"community_name"`
+	ImageURL      string    `json:"image_url"`
+	URL           string    `json:"url"`
+	OEmbedURL     string    `json:"oembed_url"`
+	SiteName      string    `json:"site_name"`
+	PublishedAt   time.Time `json:"published_at"`
+}
+
+// OEmbedResponse oEmbed 1.0 rich类型的响应
+type OEmbedResponse struct {
+	Version       string `json:"version"`
+	Type          string `json:"type"`
+	Title         string `json:"title"`
+	AuthorName    string `json:"author_name"`
+	ProviderName  string `json:"provider_name"`
+	ProviderURL   string `json:"provider_url"`
+	CacheAge      int    `json:"cache_age"`
+	ThumbnailURL  string `json:"thumbnail_url,omitempty"`
+	Html          string `json:"html"`
+	Width         int    `json:"width"`
+	Height        int    `json:"height"`
+	Description   string `json:"description"`
+	CommunityName string `json:"community_name"`
+	URL           string `json:"url"`
+}
+
+func siteName() string {
+	if name := settings.GlobalSettings.AppCfg.Name; name != "" {
+		return name
+	}
+	return "bluebell"
+}
+
+// GetPostEmbedData 获取帖子的预览信息，优先从Redis中读取
+func GetPostEmbedData(postId int64) (*PostEmbedData, error) {
+	data := new(PostEmbedData)
+	cached, err := redis_repo.GetPostEmbed(postId)
+	if err != nil {
+		zap.L().Error("get post embed from redis failed", zap.Int64("post_id", postId), zap.Error(err))
+	} else if cached != "" && json.Unmarshal([]byte(cached), data) == nil {
+		return data, nil
+	}
+
+	post, err := GetPostById(postId)
+	if err != nil {
+		return nil, err
+	}
+	data = &PostEmbedData{
+		PostId:      post.PostId,
+		Title:       post.Title,
+		Excerpt:     plainExcerpt(post.Content, EmbedExcerptLen),
+		ImageURL:    firstImage(post.Content),
+		URL:         GetPostLink(post.PostId),
+		OEmbedURL:   AbsoluteURL("/api/v1/oembed?format=json&url=" + url.QueryEscape(GetPostLink(post.PostId))),
+		SiteName:    siteName(),
+		PublishedAt: post.CreateAt,
+	}
+	if data.AuthorName, err = GetUsernameById(post.AuthorID); err != nil {
+		return nil, err
+	}
+	community, err := GetCommunityById(post.CommunityID)
+	if err != nil {
+		return nil, err
+	}
+	data.CommunityName = community.CommunityName
+
+	if b, err := json.Marshal(data); err == nil {
+		if err = redis_repo.SetPostEmbed(postId, string(b), EmbedCacheExpire); err != nil {
+			zap.L().Error("cache post embed in redis failed", zap.Int64("post_id", postId), zap.Error(err))
+		}
+	}
+	return data, nil
+}
+
+// GetPostCardHTML 获取带Open Graph/Twitter Card信息的帖子预览页面
+func GetPostCardHTML(postId int64) ([]byte, error) {
+	cached, err := redis_repo.GetPostCard(postId)
+	if err != nil {
+		zap.L().Error("get post card from redis failed", zap.Int64("post_id", postId), zap.Error(err))
+	} else if cached != "" {
+		return []byte(cached), nil
+	}
+
+	data, err := GetPostEmbedData(postId)
+	if err != nil {
+		return nil, err
+	}
+	body, err := renderTemplate("post-card", data)
+	if err != nil {
+		return nil, err
+	}
+	body = bytes.TrimSpace(body)
+	if err = redis_repo.SetPostCard(postId, string(body), EmbedCacheExpire); err != nil {
+		zap.L().Error("cache post card in redis failed", zap.Int64("post_id", postId), zap.Error(err))
+	}
+	return body, nil
+}
+
+// oEmbedSize 帖子卡片的宽高，使用配置的大小，没有配置时使用默认值，不超过请求中的maxwidth和maxheight
+func oEmbedSize(maxWidth, maxHeight int) (width, height int) {
+	width, height = OEmbedDefaultWidth, OEmbedDefaultHeight
+	if cfg := settings.GlobalSettings.ShareCfg; cfg != nil {
+		if cfg.EmbedWidth > 0 {
+			width = cfg.EmbedWidth
+		}
+		if cfg.EmbedHeight > 0 {
+			height = cfg.EmbedHeight
+		}
+	}
+	if maxWidth > 0 && maxWidth < width {
+		width = maxWidth
+	}
+	if maxHeight > 0 && maxHeight < height {
+		height = maxHeight
+	}
+	return width, height
+}
+
+// GetPostOEmbed 根据帖子地址返回oEmbed信息，rich类型必须返回宽度和高度，maxWidth和maxHeight为0时表示不限制
+func GetPostOEmbed(rawURL string, maxWidth, maxHeight int) (*OEmbedResponse, error) {
+	postId, err := PostIdFromURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	data, err := GetPostEmbedData(postId)
+	if err != nil {
+		return nil, err
+	}
+	html, err := renderTemplate("post-embed", data)
+	if err != nil {
+		return nil, err
+	}
+	width, height := oEmbedSize(maxWidth, maxHeight)
+	return &OEmbedResponse{
+		Version:       "1.0",
+		Type:          "rich",
+		Title:         data.Title,
+		AuthorName:    data.AuthorName,
+		ProviderName:  data.SiteName,
+		ProviderURL:   BaseURL(),
+		CacheAge:      int(EmbedCacheExpire.Seconds()),
+		ThumbnailURL:  data.ImageURL,
+		Html:          strings.TrimSpace(string(html)),
+		Width:         width,
+		Height:        height,
+		Description:   data.Excerpt,
+		CommunityName: data.CommunityName,
+		URL:           data.URL,
+	}, nil
+}
+
+// PostIdFromURL 从帖子链接中解析帖子id，支持分享落地页、本站的分享短链接以及以帖子id结尾的链接，其他站点的链接返回错误
+func PostIdFromURL(rawURL string) (int64, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, ERROR_INVALID_EMBED_URL
+	}
+	if postId, ok := postIdFromLandingURL(rawURL); ok {
+		return postId, nil
+	}
+	if !sameOrigin(u, BaseURL()) {
+		return 0, ERROR_INVALID_EMBED_URL
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	last := segments[len(segments)-1]
+	if len(segments) >= 2 && segments[len(segments)-2] == "s" {
+		postId, _, err := ParseShareCode(last)
+		if err != nil {
+			return 0, ERROR_INVALID_EMBED_URL
+		}
+		return postId, nil
+	}
+	postId, err := strconv.ParseInt(last, 10, 64)
+	if err != nil {
+		return 0, ERROR_INVALID_EMBED_URL
+	}
+	return postId, nil
+}
+
+// postIdFromLandingURL 按照配置的分享落地页地址匹配链接，{post_id}的位置为帖子id
+func postIdFromLandingURL(rawURL string) (int64, bool) {
+	cfg := settings.GlobalSettings.ShareCfg
+	if cfg == nil || !strings.Contains(cfg.LandingURL, "{post_id}") {
+		return 0, false
+	}
+	pattern := strings.ReplaceAll(regexp.QuoteMeta(cfg.LandingURL), regexp.QuoteMeta("{post_id}"), `(\d+)`)
+	re, err := regexp.Compile("^" + pattern + "$")
+	if err != nil {
+		return 0, false
+	}
+	m := re.FindStringSubmatch(rawURL)
+	if m == nil {
+		return 0, false
+	}
+	postId, err := strconv.ParseInt(m[1], 10, 64)
+	return postId, err == nil
+}
+
+// sameOrigin 链接的协议和域名（包括端口）是否与base相同
+func sameOrigin(u *url.URL, base string) bool {
+	b, err := url.Parse(base)
+	return err == nil && strings.EqualFold(u.Scheme, b.Scheme) && strings.EqualFold(u.Host, b.Host)
+}
+
+func renderTemplate(name string, data interface{}) ([]byte, error) {
+	embedTemplateOnce.Do(func() {
+		embedTemplate, embedTemplateErr = ParseTemplateDir("templates")
+	})
+	if embedTemplateErr != nil {
+		zap.L().Error("could not parse template", zap.Error(embedTemplateErr))
+		return nil, embedTemplateErr
+	}
+	var body bytes.Buffer
+	if err := embedTemplate.ExecuteTemplate(&body, name, data); err != nil {
+		zap.L().Error("could not execute template", zap.String("template", name), zap.Error(err))
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// plainExcerpt 去掉图片和HTML标签，合并空白字符后截取前n个字符
+func plainExcerpt(content string, n int) string {
+	content = markdownImageTag.ReplaceAllString(content, "")
+	text := strings.Join(strings.Fields(html2text.HTML2Text(content)), " ")
+	if runes := []rune(text); len(runes) > n {
+		return string(runes[:n]) + "…"
+	}
+	return text
+}
+
+// firstImage 返回内容中第一张图片的绝对地址，支持Markdown和HTML两种写法
+func firstImage(content string) string {
+	var src string
+	pos := -1
+	for _, re := range []*regexp.Regexp{markdownImageRegexp, htmlImageRegexp} {
+		if m := re.FindStringSubmatchIndex(content); m != nil && (pos < 0 || m[0] < pos) {
+			pos, src = m[0], content[m[2]:m[3]]
+		}
+	}
+	if src == "" || strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		return src
+	}
+	if strings.HasPrefix(src, "//") {
+		return "https:" + src
+	}
+	return AbsoluteURL(src)
+}
@@ -0,0 +1,175 @@
+package logic
+
+import (
+	"bluebell/cache"
+	"bluebell/dao/redis_repo"
+	"bluebell/models"
+	"bluebell/pkg/feeds"
+	"bluebell/settings"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultFeedSize        = 20
+	DefaultFeedExpiredTime = 300 // 秒
+	FeedSummaryLen         = 200
+)
+
+// FeedResult 生成好的订阅源，ETag和LastModified用于HTTP条件请求
+type FeedResult struct {
+	Body         []byte
+	ETag         string
+	LastModified time.Time
+}
+
+func feedSize() int {
+	if cfg := settings.GlobalSettings.FeedCfg; cfg != nil && cfg.Size > 0 {
+		return cfg.Size
+	}
+	return DefaultFeedSize
+}
+
+func feedExpiration() time.Duration {
+	seconds := DefaultFeedExpiredTime
+	if cfg := settings.GlobalSettings.FeedCfg; cfg != nil && cfg.ExpiredTime > 0 {
+		seconds = cfg.ExpiredTime
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// GetCommunityFeed 获取社区最新帖子的Atom订阅源
+func GetCommunityFeed(communityId int64) (*FeedResult, error) {
+	community, err := GetCommunityById(communityId)
+	if err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("community:%d.atom", communityId)
+	return loadFeed(name, true, func() (*feeds.Feed, error) {
+		posts, err := GetPostsWithOrder(&models.ParamPostList{
+			Page:        1,
+			Size:        feedSize(),
+			Order:       models.OrderByTime,
+			CommunityId: strconv.FormatInt(communityId, 10),
+		})
+		if err != nil && !errors.Is(err, ERROR_POST_NOT_EXISTS) {
+			return nil, err
+		}
+		return buildFeed(community.CommunityName, community.Introduction,
+			fmt.Sprintf("/feeds/community/%d.atom", communityId), posts, community.CreateAt), nil
+	})
+}
+
+// GetUserFeed 获取用户最新发布的帖子的Atom订阅源
+func GetUserFeed(userId int64) (*FeedResult, error) {
+	user := cache.UserCache.Get(userId)
+	if user == nil {
+		return nil, ERROR_WRONG_USER
+	}
+	name := fmt.Sprintf("user:%d.atom", userId)
+	return loadFeed(name, true, func() (*feeds.Feed, error) {
+		posts, err := GetPostsWithOrder(&models.ParamPostList{
+			Page:     1,
+			Size:     feedSize(),
+			Order:    models.OrderByTime,
+			AuthorId: strconv.FormatInt(userId, 10),
+		})
+		if err != nil && !errors.Is(err, ERROR_POST_NOT_EXISTS) {
+			return nil, err
+		}
+		return buildFeed(user.Username+"'s posts", "", fmt.Sprintf("/feeds/user/%d.atom", userId), posts, user.CreateAt), nil
+	})
+}
+
+// GetHotFeed 获取热门帖子的RSS订阅源
+func GetHotFeed() (*FeedResult, error) {
+	return loadFeed("hot.rss", false, func() (*feeds.Feed, error) {
+		posts, err := GetPostsWithOrder(&models.ParamPostList{
+			Page:  1,
+			Size:  feedSize(),
+			Order: models.OrderByScore,
+		})
+		if err != nil && !errors.Is(err, ERROR_POST_NOT_EXISTS) {
+			return nil, err
+		}
+		return buildFeed("Hot posts", "The hottest posts on "+settings.GlobalSettings.AppCfg.Name, "/feeds/hot.rss", posts, time.Time{}), nil
+	})
+}
+
+// loadFeed 优先从Redis中读取缓存的订阅源，不存在时重新生成并写入缓存
+func loadFeed(name string, atom bool, build func() (*feeds.Feed, error)) (*FeedResult, error) {
+	body, etag, modified, err := redis_repo.GetFeed(name)
+	if err != nil {
+		zap.L().Error("get feed from redis failed", zap.String("feed", name), zap.Error(err))
+	} else if body != "" {
+		return &FeedResult{Body: []byte(body), ETag: etag, LastModified: modified}, nil
+	}
+
+	feed, err := build()
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	if atom {
+		data, err = feed.ToAtom()
+	} else {
+		data, err = feed.ToRss()
+	}
+	if err != nil {
+		zap.L().Error("render feed failed", zap.String("feed", name), zap.Error(err))
+		return nil, err
+	}
+	sum := sha1.Sum(data)
+	result := &FeedResult{
+		Body:         data,
+		ETag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		LastModified: feed.Updated.Truncate(time.Second),
+	}
+	if err = redis_repo.SetFeed(name, string(data), result.ETag, result.LastModified, feedExpiration()); err != nil {
+		zap.L().Error("cache feed in redis failed", zap.String("feed", name), zap.Error(err))
+	}
+	return result, nil
+}
+
+// buildFeed 生成订阅源，更新时间取帖子中最晚的更新时间，没有帖子时使用since，
+// 保证内容没有变化时重新生成的订阅源ETag和Last-Modified也不变
+func buildFeed(title, description, path string, posts []models.Post, since time.Time) *feeds.Feed {
+	if len(posts) > feedSize() {
+		posts = posts[:feedSize()]
+	}
+	feed := &feeds.Feed{
+		Id:          AbsoluteURL(path),
+		Title:       title,
+		Link:        BaseURL(),
+		SelfLink:    AbsoluteURL(path),
+		Description: description,
+		Updated:     since,
+	}
+	for _, post := range posts {
+		updated := post.UpdateAt
+		if updated.IsZero() {
+			updated = post.CreateAt
+		}
+		if updated.After(feed.Updated) {
+			feed.Updated = updated
+		}
+		item := &feeds.Item{
+			Id:      GetPostLink(post.PostId),
+			Title:   post.Title,
+			Link:    GetPostLink(post.PostId),
+			Content: excerpt(post.Content, FeedSummaryLen),
+			Created: post.CreateAt,
+			Updated: updated,
+		}
+		if author := cache.UserCache.Get(post.AuthorID); author != nil {
+			item.Author = author.Username
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed
+}
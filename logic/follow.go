@@ -0,0 +1,181 @@
+package logic
+
+import (
+	"bluebell/cache"
+	"bluebell/dao/mysql_repo"
+	"bluebell/dao/redis_repo"
+	"bluebell/models"
+	"bluebell/pkg/sqls"
+	"errors"
+	"go.uber.org/zap"
+	"sort"
+)
+
+const (
+	DefaultFollowPageSize = 20
+	MaxFollowPageSize     = 100
+)
+
+// loadFollowIds 获取用户关注(fans为true时为粉丝)的所有用户id，按id倒序排列
+// 优先读取Redis，列表不存在时从MySQL重建，Redis不可用时直接使用MySQL中的数据
+func loadFollowIds(userId int64, fans bool) []int64 {
+	ids, err := ensureFollowSet(userId, fans)
+	if err == nil && ids == nil {
+		ids, err = redis_repo.GetFollowSet(ctx, userId, fans)
+	}
+	if err != nil {
+		zap.L().Error("load follow set from redis failed, fallback to mysql", zap.Int64("user_id", userId), zap.Error(err))
+		ids = findFollowIds(userId, fans)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+	return ids
+}
+
+// ensureFollowSet 保证Redis中存在用户的关注/粉丝列表，发生重建时返回从MySQL查询到的id
+func ensureFollowSet(userId int64, fans bool) ([]int64, error) {
+	loaded, err := redis_repo.FollowSetLoaded(ctx, userId, fans)
+	if err != nil || loaded {
+		return nil, err
+	}
+	ids := findFollowIds(userId, fans)
+	if err = redis_repo.RebuildFollowSet(ctx, userId, fans, ids); err != nil {
+		return nil, err
+	}
+	if ids == nil {
+		ids = []int64{}
+	}
+	return ids, nil
+}
+
+func findFollowIds(userId int64, fans bool) []int64 {
+	if fans {
+		return mysql_repo.UserFollowRepository.FindFollowerIds(sqls.DB(), userId)
+	}
+	return mysql_repo.UserFollowRepository.FindFollowingIds(sqls.DB(), userId)
+}
+
+// followRelations 批量判断当前用户是否关注了ids中的用户，以及这些用户是否关注了当前用户
+func followRelations(viewerId int64, ids []int64) (followed, followsYou []bool) {
+	followed, followsYou = make([]bool, len(ids)), make([]bool, len(ids))
+	if viewerId == 0 || len(ids) == 0 {
+		return
+	}
+	for _, fans := range []bool{false, true} {
+		res := followsYou
+		if !fans {
+			res = followed
+		}
+		if _, err := ensureFollowSet(viewerId, fans); err == nil {
+			members, err := redis_repo.CheckFollowSetMembers(ctx, viewerId, fans, ids)
+			if err == nil {
+				copy(res, members)
+				continue
+			}
+		}
+		set := make(map[int64]struct{})
+		for _, id := range findFollowIds(viewerId, fans) {
+			set[id] = struct{}{}
+		}
+		for i, id := range ids {
+			_, res[i] = set[id]
+		}
+	}
+	return
+}
+
+// buildFollowList 对用户id分页，并补充用户信息和与当前用户的关注关系，已注销的用户不返回
+func buildFollowList(viewerId int64, ids []int64, page, size int) *models.ResponseFollowList {
+	if size <= 0 {
+		size = DefaultFollowPageSize
+	} else if size > MaxFollowPageSize {
+		size = MaxFollowPageSize
+	}
+	if page <= 0 {
+		page = 1
+	}
+	// 先去掉已注销的用户再分页，总数和列表中的用户保持一致
+	users := make([]*models.User, 0, len(ids))
+	for _, id := range ids {
+		if u := cache.UserCache.Get(id); u != nil && u.Status != models.UserStatusDeleted {
+			users = append(users, u)
+		}
+	}
+	res := &models.ResponseFollowList{Total: int64(len(users)), List: []models.ResponseFollowUser{}}
+	start := (page - 1) * size
+	if start >= len(users) {
+		return res
+	}
+	users = users[start:min(start+size, len(users))]
+	ids = make([]int64, len(users))
+	for i, u := range users {
+		ids[i] = u.UserId
+	}
+
+	followed, followsYou := followRelations(viewerId, ids)
+	for i, u := range users {
+		res.List = append(res.List, models.ResponseFollowUser{
+			UserId:     u.UserId,
+			Username:   u.Username,
+			Gender:     u.Gender,
+			Followed:   followed[i],
+			FollowsYou: followsYou[i],
+			Mutual:     followed[i] && followsYou[i],
+		})
+	}
+	return res
+}
+
+func checkFollowListUser(userId int64) error {
+	if u := cache.UserCache.Get(userId); u == nil || u.Status == models.UserStatusDeleted {
+		return ERROR_WRONG_USER
+	}
+	return nil
+}
+
+// GetFollowers 分页获取用户的粉丝列表，viewerId为0表示未登录
+func GetFollowers(viewerId, userId int64, param *models.ParamFollowList) (*models.ResponseFollowList, error) {
+	if err := checkFollowListUser(userId); err != nil {
+		return nil, err
+	}
+	return buildFollowList(viewerId, loadFollowIds(userId, true), param.Page, param.Size), nil
+}
+
+// GetFollowing 分页获取用户的关注列表，viewerId为0表示未登录
+func GetFollowing(viewerId, userId int64, param *models.ParamFollowList) (*models.ResponseFollowList, error) {
+	if err := checkFollowListUser(userId); err != nil {
+		return nil, err
+	}
+	return buildFollowList(viewerId, loadFollowIds(userId, false), param.Page, param.Size), nil
+}
+
+// GetCommonFollows 分页获取两个用户共同关注的用户
+func GetCommonFollows(viewerId, userId, otherUserId int64, param *models.ParamCommonFollows) (*models.ResponseFollowList, error) {
+	if err := checkFollowListUser(userId); err != nil {
+		return nil, err
+	}
+	if err := checkFollowListUser(otherUserId); err != nil {
+		return nil, err
+	}
+	var ids []int64
+	_, err1 := ensureFollowSet(userId, false)
+	_, err2 := ensureFollowSet(otherUserId, false)
+	err := errors.Join(err1, err2)
+	if err == nil {
+		ids, err = redis_repo.GetCommonFollows(ctx, userId, otherUserId)
+	}
+	if err != nil {
+		zap.L().Error("get common follows from redis failed, fallback to mysql", zap.Int64("user_id", userId), zap.Int64("other_user_id", otherUserId), zap.Error(err))
+		set := make(map[int64]struct{})
+		for _, id := range findFollowIds(otherUserId, false) {
+			set[id] = struct{}{}
+		}
+		ids = ids[:0]
+		for _, id := range findFollowIds(userId, false) {
+			if _, ok := set[id]; ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+	return buildFollowList(viewerId, ids, param.Page, param.Size), nil
+}
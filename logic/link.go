@@ -0,0 +1,46 @@
+package logic
+
+import (
+	"bluebell/settings"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// BaseURL 根据配置中的host和port生成站点的绝对地址，例如 http://example.com:8080
+// host中没有协议时默认为http，host中已经带有端口或者端口为协议默认端口时不再拼接端口
+func BaseURL() string {
+	cfg := settings.GlobalSettings.AppCfg
+	host := strings.TrimRight(cfg.Host, "/")
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return host
+	}
+	if u.Port() == "" && cfg.Port != 0 &&
+		!(u.Scheme == "http" && cfg.Port == 80) && !(u.Scheme == "https" && cfg.Port == 443) {
+		u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(cfg.Port))
+	}
+	return strings.TrimRight(u.String(), "/")
+}
+
+// AbsoluteURL 将站内路径转换为绝对地址
+func AbsoluteURL(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return BaseURL() + path
+}
+
+// GetPostLink 获取帖子面向用户、可以公开访问的绝对地址
+// 配置了分享落地页时使用落地页，否则使用不需要登录的帖子预览页面
+func GetPostLink(postId int64) string {
+	id := strconv.FormatInt(postId, 10)
+	if cfg := settings.GlobalSettings.ShareCfg; cfg != nil && cfg.LandingURL != "" {
+		return strings.ReplaceAll(cfg.LandingURL, "{post_id}", id)
+	}
+	return AbsoluteURL("/embed/post/" + id)
+}
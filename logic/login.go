@@ -0,0 +1,212 @@
+package logic
+
+import (
+	"bluebell/dao/mysql_repo"
+	"bluebell/dao/redis_repo"
+	"bluebell/models"
+	"bluebell/pkg/encrypt"
+	"bluebell/pkg/sqls"
+	"bluebell/pkg/validation"
+	"bluebell/settings"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 登录失败按账号和ip分别计数，超过允许的次数后每次失败需要等待的时间翻倍
+// 账号不存在时按登录名计数，和存在的账号表现一致，避免通过锁定行为判断账号是否存在
+
+const (
+	DefaultAccountFreeAttempts = 5
+	DefaultIPFreeAttempts      = 20
+	DefaultLoginBaseDelay      = time.Second
+	DefaultLoginMaxDelay       = 15 * time.Minute
+	DefaultLockoutAttempts     = 10
+	DefaultLockoutDuration     = 15 * time.Minute
+	DefaultLoginFailureWindow  = time.Hour
+	maxLoginNameLen            = 128
+)
+
+var ERROR_LOGIN_LOCKED = errors.New("too many failed login attempts, please try again later")
+
+// LoginLockedError 登录被暂时禁止，RetryAfter为剩余的等待时间
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("%v, retry after %v", ERROR_LOGIN_LOCKED, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LoginLockedError) Unwrap() error {
+	return ERROR_LOGIN_LOCKED
+}
+
+type loginLimits struct {
+	accountFree, ipFree, lockoutAttempts int64
+	baseDelay, maxDelay, lockout, window time.Duration
+}
+
+func getLoginLimits() loginLimits {
+	l := loginLimits{
+		accountFree:     DefaultAccountFreeAttempts,
+		ipFree:          DefaultIPFreeAttempts,
+		lockoutAttempts: DefaultLockoutAttempts,
+		baseDelay:       DefaultLoginBaseDelay,
+		maxDelay:        DefaultLoginMaxDelay,
+		lockout:         DefaultLockoutDuration,
+		window:          DefaultLoginFailureWindow,
+	}
+	cfg := settings.GlobalSettings.LoginCfg
+	if cfg == nil {
+		return l
+	}
+	if cfg.AccountFreeAttempts > 0 {
+		l.accountFree = int64(cfg.AccountFreeAttempts)
+	}
+	if cfg.IPFreeAttempts > 0 {
+		l.ipFree = int64(cfg.IPFreeAttempts)
+	}
+	if cfg.LockoutAttempts > 0 {
+		l.lockoutAttempts = int64(cfg.LockoutAttempts)
+	}
+	if cfg.BaseDelay > 0 {
+		l.baseDelay = time.Duration(cfg.BaseDelay) * time.Second
+	}
+	if cfg.MaxDelay > 0 {
+		l.maxDelay = time.Duration(cfg.MaxDelay) * time.Second
+	}
+	if cfg.LockoutDuration > 0 {
+		l.lockout = time.Duration(cfg.LockoutDuration) * time.Minute
+	}
+	if cfg.FailureWindow > 0 {
+		l.window = time.Duration(cfg.FailureWindow) * time.Minute
+	}
+	return l
+}
+
+// backoff 计算第failures次失败后需要等待的时间
+func (l loginLimits) backoff(failures, free int64) time.Duration {
+	if failures <= free {
+		return 0
+	}
+	d := l.baseDelay
+	for i := free + 1; i < failures && d < l.maxDelay; i++ {
+		d *= 2
+	}
+	return min(d, l.maxDelay)
+}
+
+func accountLoginSubject(userId int64) string {
+	return "account:" + strconv.FormatInt(userId, 10)
+}
+
+// loginSubjects 返回账号和ip的计数对象
+func loginSubjects(u *models.User, loginName, ip string) (account, addr string) {
+	if u != nil {
+		account = accountLoginSubject(u.UserId)
+	} else {
+		if len(loginName) > maxLoginNameLen {
+			loginName = loginName[:maxLoginNameLen]
+		}
+		account = "name:" + strings.ToLower(loginName)
+	}
+	return account, "ip:" + ip
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// checkUserPassword 校验密码，账号不存在时同样计算一次哈希，避免通过响应时间判断账号是否存在
+func checkUserPassword(u *models.User, password string) bool {
+	if u == nil {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = encrypt.Hash("bluebell dummy password")
+		})
+		encrypt.Verify(password, dummyHash)
+		return false
+	}
+	return validation.CheckPassword(password, u.Password)
+}
+
+// SignInWithPasswordFrom 带有暴力破解保护的密码登录，ip为客户端地址
+// 被锁定时返回LoginLockedError，账号不存在和密码错误都返回ERROR_WRONG_PASSWORD
+func SignInWithPasswordFrom(user *models.User, ip string) error {
+	u := findUserByLoginName(user.Username)
+	account, addr := loginSubjects(u, user.Username, ip)
+	if wait, err := redis_repo.GetLoginLock(ctx, account, addr); err != nil {
+		zap.L().Error("get login lock failed", zap.Error(err))
+	} else if wait > 0 {
+		return &LoginLockedError{RetryAfter: wait}
+	}
+
+	if err := signInWithPassword(user, u); err != nil {
+		recordLoginFailure(u, account, addr)
+		return err
+	}
+	if err := redis_repo.ClearLoginFailures(ctx, account); err != nil {
+		zap.L().Error("clear login failures failed", zap.Int64("user_id", u.UserId), zap.Error(err))
+	}
+	return nil
+}
+
+// recordLoginFailure 记录失败次数并设置需要等待的时间，账号第一次达到锁定次数时发送邮件通知
+func recordLoginFailure(u *models.User, account, addr string) {
+	l := getLoginLimits()
+	failures, err := redis_repo.RecordLoginFailure(ctx, account, l.window)
+	if err == nil {
+		wait := l.backoff(failures, l.accountFree)
+		if failures >= l.lockoutAttempts {
+			wait = max(wait, l.lockout)
+		}
+		if wait > 0 {
+			err = redis_repo.SetLoginLock(ctx, account, wait)
+		}
+		if failures == l.lockoutAttempts && u != nil {
+			zap.L().Warn("account locked after too many failed logins", zap.Int64("user_id", u.UserId), zap.Int64("failures", failures))
+			if u.Email != "" {
+				go func() {
+					if err := SendLoginLockedEmail(u.Email, GenLoginLockedData(u.Username)); err != nil {
+						zap.L().Error("send login locked email failed", zap.Int64("user_id", u.UserId), zap.Error(err))
+					}
+				}()
+			}
+		}
+	}
+	if err != nil {
+		zap.L().Error("record account login failure failed", zap.String("subject", account), zap.Error(err))
+	}
+
+	failures, err = redis_repo.RecordLoginFailure(ctx, addr, l.window)
+	if err == nil {
+		if wait := l.backoff(failures, l.ipFree); wait > 0 {
+			err = redis_repo.SetLoginLock(ctx, addr, wait)
+		}
+	}
+	if err != nil {
+		zap.L().Error("record ip login failure failed", zap.String("subject", addr), zap.Error(err))
+	}
+}
+
+// UnlockUser 管理员解除账号的登录锁定
+func UnlockUser(adminId, userId int64) error {
+	if !IsAdmin(adminId) {
+		return ERROR_NOT_ADMIN
+	}
+	u := mysql_repo.UserRepository.Get(sqls.DB(), userId)
+	if u == nil {
+		return ERROR_WRONG_USER
+	}
+	if err := redis_repo.ClearLoginFailures(ctx, accountLoginSubject(userId)); err != nil {
+		zap.L().Error("unlock user error in logic.UnlockUser()", zap.Int64("user_id", userId), zap.Error(err))
+		return err
+	}
+	zap.L().Info("user login unlocked", zap.Int64("admin_id", adminId), zap.Int64("user_id", userId))
+	return nil
+}
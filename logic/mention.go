@@ -0,0 +1,153 @@
+package logic
+
+import (
+	"bluebell/dao/mysql_repo"
+	"bluebell/dao/redis_repo"
+	"bluebell/models"
+	"bluebell/pkg/sqls"
+	"go.uber.org/zap"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+)
+
+const (
+	MaxMentionsPerContent   = 10 // 一条内容中最多@的用户数，超出的部分不再解析
+	DefaultAutocompleteSize = 10
+	MaxAutocompleteSize     = 50
+	NotificationContentLen  = 100
+)
+
+var mentionPattern = regexp.MustCompile(`@([0-9a-zA-Z_-]{1,64})`)
+
+// ParseMentions 解析内容中的@username，并通过用户名找到对应的用户，不存在的用户会被忽略
+func ParseMentions(content string) (spans []models.MentionSpan) {
+	users := make(map[string]*models.User)
+	for _, loc := range mentionPattern.FindAllStringSubmatchIndex(content, -1) {
+		// @前面是字母或数字时，认为是邮箱之类的内容，而不是@用户
+		if loc[0] > 0 && isMentionChar(content[loc[0]-1]) {
+			continue
+		}
+		username := content[loc[2]:loc[3]]
+		u, ok := users[username]
+		if !ok {
+			if len(users) >= MaxMentionsPerContent {
+				continue
+			}
+			u = mysql_repo.UserRepository.GetByUsername(sqls.DB(), username)
+			users[username] = u
+		}
+		if u == nil {
+			continue
+		}
+		start := utf8.RuneCountInString(content[:loc[0]])
+		spans = append(spans, models.MentionSpan{
+			UserId:   u.UserId,
+			Username: u.Username,
+			Start:    start,
+			End:      start + utf8.RuneCountInString(content[loc[0]:loc[1]]),
+		})
+	}
+	return spans
+}
+
+func isMentionChar(b byte) bool {
+	return b == '_' || b == '-' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// SaveMentions 解析帖子/评论中的@并保存，编辑内容时会替换原有的记录，新被@的用户会收到通知
+// 被@的用户设置了不允许作者@自己时，该@不记录也不通知
+func SaveMentions(sourceType int8, sourceId, postId, authorId int64, content string) (spans []models.MentionSpan, err error) {
+	spans = ParseMentions(content)
+	allowed := spans[:0]
+	for _, span := range spans {
+		if CanMention(authorId, span.UserId) {
+			allowed = append(allowed, span)
+		}
+	}
+	spans = allowed
+	notified := make(map[int64]bool)
+	for _, m := range mysql_repo.MentionRepository.FindBySource(sqls.DB(), sourceType, sourceId) {
+		notified[m.UserId] = true
+	}
+	mentions := make([]models.Mention, 0, len(spans))
+	for _, span := range spans {
+		mentions = append(mentions, models.Mention{
+			SourceType: sourceType,
+			SourceId:   sourceId,
+			PostId:     postId,
+			UserId:     span.UserId,
+			Username:   span.Username,
+			AuthorId:   authorId,
+			Start:      span.Start,
+			End:        span.End,
+		})
+	}
+	if len(mentions) == 0 && len(notified) == 0 {
+		return spans, nil
+	}
+	if err = mysql_repo.MentionRepository.Replace(sqls.DB(), sourceType, sourceId, mentions); err != nil {
+		zap.L().Error("save mentions error in logic.SaveMentions()", zap.Int64("source_id", sourceId), zap.Error(err))
+		return nil, err
+	}
+
+	// 自己@自己、之前已经@过的用户不再重复通知
+	notified[authorId] = true
+	for _, span := range spans {
+		if notified[span.UserId] {
+			continue
+		}
+		notified[span.UserId] = true
+		notifyMention(span.UserId, authorId, sourceType, sourceId, postId, content)
+	}
+	return spans, nil
+}
+
+// notifyMention 通知被@的用户，如果作者在该用户的黑名单中则不通知
+func notifyMention(userId, authorId int64, sourceType int8, sourceId, postId int64, content string) {
+	blocked, err := redis_repo.CheckInBlackList(ctx, strconv.FormatInt(authorId, 10), strconv.FormatInt(userId, 10))
+	if err != nil {
+		zap.L().Error("check blacklist error in logic.notifyMention()", zap.Error(err))
+		return
+	}
+	if blocked {
+		return
+	}
+	CreateNotification(&models.Notification{
+		UserId:     userId,
+		ActorId:    authorId,
+		Type:       models.NotificationMention,
+		SourceType: sourceType,
+		SourceId:   sourceId,
+		PostId:     postId,
+		Content:    excerpt(content, NotificationContentLen),
+	})
+}
+
+// GetMentionSpans 获取帖子/评论中@用户的位置，供客户端高亮显示
+func GetMentionSpans(sourceType int8, sourceId int64) []models.MentionSpan {
+	mentions := mysql_repo.MentionRepository.FindBySource(sqls.DB(), sourceType, sourceId)
+	if len(mentions) == 0 {
+		return nil
+	}
+	spans := make([]models.MentionSpan, len(mentions))
+	for i, m := range mentions {
+		spans[i] = models.MentionSpan{UserId: m.UserId, Username: m.Username, Start: m.Start, End: m.End}
+	}
+	return spans
+}
+
+// AutocompleteUsername 按照用户名前缀查找用户
+func AutocompleteUsername(param *models.ParamUserAutocomplete) []models.ResponseUserBrief {
+	size := param.Size
+	if size <= 0 {
+		size = DefaultAutocompleteSize
+	}
+	size = min(size, MaxAutocompleteSize)
+	users := mysql_repo.UserRepository.FindByUsernamePrefix(sqls.DB(), param.Prefix, size)
+	res := make([]models.ResponseUserBrief, len(users))
+	for i, u := range users {
+		res[i] = models.ResponseUserBrief{UserId: u.UserId, Username: u.Username}
+	}
+	return res
+}
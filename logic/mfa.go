@@ -0,0 +1,390 @@
+package logic
+
+import (
+	"bluebell/cache"
+	"bluebell/dao/mysql_repo"
+	"bluebell/dao/redis_repo"
+	"bluebell/models"
+	"bluebell/pkg/sqls"
+	"bluebell/pkg/totp"
+	"bluebell/pkg/validation"
+	"bluebell/settings"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMfaIssuer     = "Bluebell"
+	MfaPendingExpireTime = 5 * time.Minute
+	// 每次登录最多尝试输入验证码的次数，超过后需要重新输入密码
+	MaxMfaAttempts    = 5
+	recoveryCodeCount = 10
+	recoveryCodeLen   = 10
+	// 允许前后一个时间步的时钟偏差
+	totpSkew = 1
+)
+
+var (
+	ERROR_MFA_REQUIRED        = errors.New("two-factor authentication is required for this role")
+	ERROR_MFA_NOT_ENABLED     = errors.New("two-factor authentication is not enabled")
+	ERROR_MFA_ALREADY_ENABLED = errors.New("two-factor authentication is already enabled")
+	ERROR_INVALID_MFA_CODE    = errors.New("invalid two-factor authentication code")
+	ERROR_INVALID_MFA_TOKEN   = errors.New("invalid or expired mfa token")
+	ERROR_NOT_ADMIN           = errors.New("only administrators can perform this operation")
+)
+
+func mfaIssuer() string {
+	if cfg := settings.GlobalSettings.MfaCfg; cfg != nil && cfg.Issuer != "" {
+		return cfg.Issuer
+	}
+	return DefaultMfaIssuer
+}
+
+// mfaRequiredRoles 管理员在运行时设置的策略优先，没有设置过时使用配置文件中的默认值
+func mfaRequiredRoles() []int8 {
+	roles, ok, err := redis_repo.GetMfaRequiredRoles(ctx)
+	if err != nil {
+		zap.L().Error("get mfa required roles failed", zap.Error(err))
+	}
+	if ok {
+		return roles
+	}
+	if cfg := settings.GlobalSettings.MfaCfg; cfg != nil {
+		return cfg.RequiredRoles
+	}
+	return nil
+}
+
+func roleRequiresMfa(role int8) bool {
+	return slices.Contains(mfaRequiredRoles(), role)
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRecoveryCodes 生成一组恢复码，返回给用户的明文以及保存到数据库的哈希
+func newRecoveryCodes() (codes []string, hashed string, err error) {
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range hashes {
+		buf := make([]byte, recoveryCodeLen)
+		if _, err = rand.Read(buf); err != nil {
+			return nil, "", err
+		}
+		code := strings.ToLower(enc.EncodeToString(buf))[:recoveryCodeLen]
+		codes = append(codes, code[:recoveryCodeLen/2]+"-"+code[recoveryCodeLen/2:])
+		hashes[i] = hashRecoveryCode(code)
+	}
+	return codes, strings.Join(hashes, ","), nil
+}
+
+func countRecoveryCodes(hashed string) int {
+	if hashed == "" {
+		return 0
+	}
+	return len(strings.Split(hashed, ","))
+}
+
+// useRecoveryCode 在保存的恢复码哈希中查找code，找到时返回去掉该恢复码以后剩下的哈希
+func useRecoveryCode(hashed, code string) (string, bool) {
+	if hashed == "" {
+		return hashed, false
+	}
+	hashes := strings.Split(hashed, ",")
+	i := slices.Index(hashes, hashRecoveryCode(code))
+	if i < 0 {
+		return hashed, false
+	}
+	return strings.Join(slices.Delete(hashes, i, i+1), ","), true
+}
+
+// verifyMfaCode 校验身份验证器中的验证码或者恢复码，验证码不能重复使用，恢复码使用后作废
+func verifyMfaCode(m *models.UserMfa, code string) (bool, error) {
+	if step, ok := totp.Validate(m.Secret, code, time.Now(), totpSkew); ok {
+		return mysql_repo.UserMfaRepository.UseStep(sqls.DB(), m.UserId, step)
+	}
+	remaining, found := useRecoveryCode(m.RecoveryCodes, code)
+	if !found {
+		return false, nil
+	}
+	ok, err := mysql_repo.UserMfaRepository.ReplaceRecoveryCodes(sqls.DB(), m.UserId, m.RecoveryCodes, remaining)
+	if ok {
+		zap.L().Info("mfa recovery code used", zap.Int64("user_id", m.UserId))
+	}
+	return ok, err
+}
+
+// GetMfaStatus 获取用户两步验证的状态
+func GetMfaStatus(userId int64) (*models.ResponseMfaStatus, error) {
+	u := cache.UserCache.Get(userId)
+	if u == nil {
+		return nil, ERROR_WRONG_USER
+	}
+	res := &models.ResponseMfaStatus{Required: roleRequiresMfa(u.Role)}
+	if m := mysql_repo.UserMfaRepository.GetByUserId(sqls.DB(), userId); m != nil && m.Enabled {
+		res.Enabled, res.RecoveryCodesLeft = true, countRecoveryCodes(m.RecoveryCodes)
+	}
+	return res, nil
+}
+
+// SetupMfa 生成新的身份验证器密钥，需要调用ConfirmMfa确认以后才会生效
+func SetupMfa(userId int64) (*models.ResponseMfaSetup, error) {
+	u := cache.UserCache.Get(userId)
+	if u == nil {
+		return nil, ERROR_WRONG_USER
+	}
+	m := mysql_repo.UserMfaRepository.GetByUserId(sqls.DB(), userId)
+	if m != nil && m.Enabled {
+		return nil, ERROR_MFA_ALREADY_ENABLED
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		err = mysql_repo.UserMfaRepository.Create(sqls.DB(), &models.UserMfa{UserId: userId, Secret: secret})
+	} else {
+		err = mysql_repo.UserMfaRepository.Updates(sqls.DB(), userId, map[string]interface{}{"secret": secret, "last_step": 0})
+	}
+	if err != nil {
+		zap.L().Error("save mfa secret error in logic.SetupMfa()", zap.Error(err))
+		return nil, err
+	}
+	return &models.ResponseMfaSetup{Secret: secret, ProvisioningURI: totp.ProvisioningURI(mfaIssuer(), u.Username, secret)}, nil
+}
+
+// ConfirmMfa 使用身份验证器中的验证码确认绑定，成功后开启两步验证并返回恢复码
+func ConfirmMfa(userId int64, code string) ([]string, error) {
+	m := mysql_repo.UserMfaRepository.GetByUserId(sqls.DB(), userId)
+	if m == nil {
+		return nil, ERROR_MFA_NOT_ENABLED
+	}
+	if m.Enabled {
+		return nil, ERROR_MFA_ALREADY_ENABLED
+	}
+	return enableMfa(userId, m.Secret, code)
+}
+
+func enableMfa(userId int64, secret, code string) ([]string, error) {
+	step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !ok {
+		return nil, ERROR_INVALID_MFA_CODE
+	}
+	codes, hashed, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]interface{}{
+		"secret":         secret,
+		"enabled":        true,
+		"enabled_at":     time.Now(),
+		"recovery_codes": hashed,
+		"last_step":      step,
+	}
+	if mysql_repo.UserMfaRepository.GetByUserId(sqls.DB(), userId) == nil {
+		err = mysql_repo.UserMfaRepository.Create(sqls.DB(), &models.UserMfa{UserId: userId, Secret: secret})
+	}
+	if err == nil {
+		err = mysql_repo.UserMfaRepository.Updates(sqls.DB(), userId, columns)
+	}
+	if err != nil {
+		zap.L().Error("enable mfa failed", zap.Int64("user_id", userId), zap.Error(err))
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableMfa 关闭两步验证，需要同时提供密码和验证码，角色被要求开启两步验证时不能关闭
+func DisableMfa(userId int64, param *models.ParamDisableMfa) error {
+	u := mysql_repo.UserRepository.Get(sqls.DB(), userId)
+	if u == nil {
+		return ERROR_WRONG_USER
+	}
+	if roleRequiresMfa(u.Role) {
+		return ERROR_MFA_REQUIRED
+	}
+	m := mysql_repo.UserMfaRepository.GetByUserId(sqls.DB(), userId)
+	if m == nil || !m.Enabled {
+		return ERROR_MFA_NOT_ENABLED
+	}
+	if !validation.CheckPassword(param.Password, u.Password) {
+		return ERROR_WRONG_PASSWORD
+	}
+	if ok, err := verifyMfaCode(m, param.Code); err != nil || !ok {
+		if err != nil {
+			return err
+		}
+		return ERROR_INVALID_MFA_CODE
+	}
+	return mysql_repo.UserMfaRepository.Delete(sqls.DB(), userId)
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，之前的恢复码全部作废
+func RegenerateRecoveryCodes(userId int64, code string) ([]string, error) {
+	m := mysql_repo.UserMfaRepository.GetByUserId(sqls.DB(), userId)
+	if m == nil || !m.Enabled {
+		return nil, ERROR_MFA_NOT_ENABLED
+	}
+	if ok, err := verifyMfaCode(m, code); err != nil || !ok {
+		if err != nil {
+			return nil, err
+		}
+		return nil, ERROR_INVALID_MFA_CODE
+	}
+	codes, hashed, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err = mysql_repo.UserMfaRepository.Updates(sqls.DB(), userId, map[string]interface{}{"recovery_codes": hashed}); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// needMfa 判断登录是否需要两步验证，enrolled表示用户是否已经绑定了身份验证器
+func needMfa(userId int64) (need, enrolled bool) {
+	u := cache.UserCache.Get(userId)
+	m := mysql_repo.UserMfaRepository.GetByUserId(sqls.DB(), userId)
+	enrolled = m != nil && m.Enabled
+	return enrolled || (u != nil && roleRequiresMfa(u.Role)), enrolled
+}
+
+// beginMfaLogin 密码校验通过以后不直接签发token，而是返回一个短期有效的mfa token
+// 角色要求开启两步验证但是还没有绑定时，客户端需要先用mfa token绑定身份验证器
+func beginMfaLogin(userId int64, enrolled bool, device *models.SessionDevice) (gin.H, error) {
+	token, err := newTokenId()
+	if err != nil {
+		return nil, err
+	}
+	p := &redis_repo.MfaPending{UserId: userId}
+	if device != nil {
+		p.Device = *device
+	}
+	if err = redis_repo.SetMfaPending(ctx, token, p, MfaPendingExpireTime); err != nil {
+		zap.L().Error("save mfa pending login failed", zap.Int64("user_id", userId), zap.Error(err))
+		return nil, err
+	}
+	return gin.H{
+		"mfa_required":        true,
+		"mfa_token":           token,
+		"enrollment_required": !enrolled,
+	}, nil
+}
+
+// takeMfaPending 获取等待两步验证的登录，尝试次数过多时作废
+func takeMfaPending(mfaToken string) (*redis_repo.MfaPending, error) {
+	p, err := redis_repo.TakeMfaAttempt(ctx, mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, ERROR_INVALID_MFA_TOKEN
+	}
+	if p.Attempts > MaxMfaAttempts {
+		if err = redis_repo.DeleteMfaPending(ctx, mfaToken); err != nil {
+			zap.L().Error("delete mfa pending login failed", zap.Error(err))
+		}
+		return nil, ERROR_INVALID_MFA_TOKEN
+	}
+	return p, nil
+}
+
+// StartMfaEnrollment 角色要求两步验证但还没有绑定的用户在登录过程中生成身份验证器密钥
+func StartMfaEnrollment(mfaToken string) (*models.ResponseMfaSetup, error) {
+	p, err := takeMfaPending(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	if _, enrolled := needMfa(p.UserId); enrolled {
+		return nil, ERROR_MFA_ALREADY_ENABLED
+	}
+	u := cache.UserCache.Get(p.UserId)
+	if u == nil {
+		return nil, ERROR_WRONG_USER
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err = redis_repo.SetMfaPendingSecret(ctx, mfaToken, secret); err != nil {
+		return nil, err
+	}
+	return &models.ResponseMfaSetup{Secret: secret, ProvisioningURI: totp.ProvisioningURI(mfaIssuer(), u.Username, secret)}, nil
+}
+
+// CompleteMfaLogin 校验验证码并完成登录，在登录过程中绑定身份验证器时同时返回恢复码
+func CompleteMfaLogin(param *models.ParamMfaLogin) (res gin.H, err error) {
+	p, err := takeMfaPending(param.MfaToken)
+	if err != nil {
+		return nil, err
+	}
+	var codes []string
+	if m := mysql_repo.UserMfaRepository.GetByUserId(sqls.DB(), p.UserId); m != nil && m.Enabled {
+		ok, err := verifyMfaCode(m, param.Code)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ERROR_INVALID_MFA_CODE
+		}
+	} else {
+		secret, err := redis_repo.GetMfaPendingSecret(ctx, param.MfaToken)
+		if err != nil {
+			return nil, err
+		}
+		if secret == "" {
+			return nil, ERROR_MFA_NOT_ENABLED
+		}
+		if codes, err = enableMfa(p.UserId, secret, param.Code); err != nil {
+			return nil, err
+		}
+	}
+	if err = redis_repo.DeleteMfaPending(ctx, param.MfaToken); err != nil {
+		zap.L().Error("delete mfa pending login failed", zap.Error(err))
+	}
+
+	u := cache.UserCache.Get(p.UserId)
+	if u == nil {
+		return nil, ERROR_WRONG_USER
+	}
+	if res, err = issueTokens(&models.User{UserId: u.UserId, Username: u.Username}, &p.Device); err != nil {
+		return nil, err
+	}
+	if codes != nil {
+		res["recovery_codes"] = codes
+	}
+	return res, nil
+}
+
+// GetMfaPolicy 获取必须开启两步验证的角色
+func GetMfaPolicy() []int8 {
+	roles := mfaRequiredRoles()
+	if roles == nil {
+		roles = []int8{}
+	}
+	return roles
+}
+
+// SetMfaPolicy 管理员设置必须开启两步验证的角色，对应角色的用户下次登录时必须完成两步验证
+func SetMfaPolicy(userId int64, roles []int8) error {
+	if !IsAdmin(userId) {
+		return ERROR_NOT_ADMIN
+	}
+	slices.Sort(roles)
+	if err := redis_repo.SetMfaRequiredRoles(ctx, slices.Compact(roles)); err != nil {
+		zap.L().Error("set mfa required roles error in logic.SetMfaPolicy()", zap.Error(err))
+		return err
+	}
+	zap.L().Info("mfa policy updated", zap.Int64("admin_id", userId), zap.Any("required_roles", roles))
+	return nil
+}
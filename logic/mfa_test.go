@@ -0,0 +1,44 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUseRecoveryCode(t *testing.T) {
+	codes, hashed, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || countRecoveryCodes(hashed) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), countRecoveryCodes(hashed), recoveryCodeCount)
+	}
+
+	// 输入时不区分大小写，可以省略中间的连字符
+	first := strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))
+	remaining, ok := useRecoveryCode(hashed, first)
+	if !ok || countRecoveryCodes(remaining) != recoveryCodeCount-1 {
+		t.Fatalf("useRecoveryCode() = %v, %d left, want true, %d left", ok, countRecoveryCodes(remaining), recoveryCodeCount-1)
+	}
+	if _, ok = useRecoveryCode(remaining, codes[0]); ok {
+		t.Fatal("a recovery code was accepted twice")
+	}
+
+	// 每个恢复码都只能使用一次，全部用完以后不再接受任何恢复码
+	for _, code := range codes[1:] {
+		if remaining, ok = useRecoveryCode(remaining, code); !ok {
+			t.Fatalf("recovery code %s was rejected", code)
+		}
+	}
+	if remaining != "" {
+		t.Fatalf("remaining = %q after using every code, want empty", remaining)
+	}
+	for _, code := range codes {
+		if _, ok = useRecoveryCode(remaining, code); ok {
+			t.Fatalf("recovery code %s was accepted after all codes were used", code)
+		}
+	}
+	if _, ok = useRecoveryCode(hashed, "aaaaa-bbbbb"); ok {
+		t.Fatal("an unknown recovery code was accepted")
+	}
+}
@@ -0,0 +1,190 @@
+package logic
+
+import (
+	"bluebell/cache"
+	"bluebell/dao/mysql_repo"
+	"bluebell/models"
+	"bluebell/pkg/snowflake"
+	"bluebell/pkg/sqls"
+	"bluebell/settings"
+	"fmt"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	DefaultDigestInterval = 60 // 检查需要发送通知摘要的间隔，单位为分钟
+	DefaultDigestMaxItems = 50
+	digestBatchSize       = 100
+)
+
+// CreateNotification 保存一条站内通知，失败只记录日志，不影响触发通知的操作
+// 用户开启了该类通知的邮件并且选择立即发送时同时发送邮件，否则由摘要任务汇总发送
+func CreateNotification(n *models.Notification) {
+	n.NotificationId = snowflake.GenID()
+	if err := mysql_repo.NotificationRepository.Create(sqls.DB(), n); err != nil {
+		zap.L().Error("save notification failed", zap.Int64("user_id", n.UserId), zap.Int8("type", n.Type), zap.Error(err))
+		return
+	}
+	p, err := GetUserPreference(n.UserId)
+	if err != nil || !emailEnabled(p, n.Type) || p.DigestFrequency != models.DigestInstant {
+		return
+	}
+	u := cache.UserCache.Get(n.UserId)
+	if !canReceiveEmail(u) {
+		return
+	}
+	notification := *n
+	go func() {
+		data := GenNotificationData(u.Username, p.Language, []string{notificationText(&notification, p.Language)}, false)
+		if err := SendNotificationEmail(u.Email, p.Language, data); err != nil {
+			zap.L().Error("send notification email failed", zap.Int64("user_id", u.UserId), zap.Error(err))
+		}
+	}()
+}
+
+// emailEnabled 用户是否开启了该类通知的邮件
+func emailEnabled(p *models.UserPreference, notificationType int8) bool {
+	switch notificationType {
+	case models.NotificationMention:
+		return p.EmailMention
+	case models.NotificationBadge:
+		return p.EmailBadge
+	}
+	return false
+}
+
+// emailNotificationTypes 用户开启了邮件的通知类型
+func emailNotificationTypes(p *models.UserPreference) []int8 {
+	var types []int8
+	for _, t := range []int8{models.NotificationMention, models.NotificationBadge} {
+		if emailEnabled(p, t) {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// canReceiveEmail 只向已验证的邮箱发送通知邮件
+func canReceiveEmail(u *models.User) bool {
+	return u != nil && u.Status != models.UserStatusDeleted && u.Email != "" && u.Verified
+}
+
+// notificationText 通知在邮件中显示的文字
+func notificationText(n *models.Notification, language string) string {
+	switch n.Type {
+	case models.NotificationMention:
+		actor, err := GetUsernameById(n.ActorId)
+		if err != nil {
+			actor = models.DeletedUsername
+		}
+		if language == models.LanguageEn {
+			return fmt.Sprintf("%s mentioned you: %s", actor, n.Content)
+		}
+		return fmt.Sprintf("%s 提到了你：%s", actor, n.Content)
+	case models.NotificationBadge:
+		if language == models.LanguageEn {
+			return "You earned the badge: " + n.Content
+		}
+		return "你获得了徽章：" + n.Content
+	}
+	return n.Content
+}
+
+// GetNotificationList 分页获取用户的通知，最新的在前
+func GetNotificationList(userId int64, param *models.ParamNotificationList) (list []models.Notification, err error) {
+	cnd := sqls.NewCnd().Where("user_id = ?", userId).Desc("id").Page(param.Page, param.Size)
+	if param.Unread {
+		cnd.Where("read_at IS NULL")
+	}
+	list = mysql_repo.NotificationRepository.Find(sqls.DB(), cnd)
+	return list, nil
+}
+
+// GetUnreadNotificationCount 获取用户未读通知的数量
+func GetUnreadNotificationCount(userId int64) int64 {
+	return mysql_repo.NotificationRepository.Count(sqls.DB(), sqls.NewCnd().Where("user_id = ? AND read_at IS NULL", userId))
+}
+
+// ReadNotifications 将通知标记为已读
+func ReadNotifications(userId int64, param *models.ParamReadNotification) (err error) {
+	if err = mysql_repo.NotificationRepository.MarkRead(sqls.DB(), userId, param.NotificationIds, time.Now()); err != nil {
+		zap.L().Error("mark notifications read error in logic.ReadNotifications()", zap.Error(err))
+	}
+	return
+}
+
+// StartNotificationDigest 定期向选择按天/按周接收通知邮件的用户发送摘要
+func StartNotificationDigest() {
+	minutes := DefaultDigestInterval
+	if cfg := settings.GlobalSettings.DigestCfg; cfg != nil && cfg.Interval > 0 {
+		minutes = cfg.Interval
+	}
+	ticker := time.NewTicker(time.Duration(minutes) * time.Minute)
+	go func() {
+		for range ticker.C {
+			SendNotificationDigests(time.Now())
+		}
+	}()
+}
+
+// SendNotificationDigests 向距离上一次发送摘要超过一个周期的用户发送这段时间内的未读通知
+func SendNotificationDigests(now time.Time) {
+	periods := []struct {
+		frequency string
+		period    time.Duration
+	}{
+		{models.DigestDaily, 24 * time.Hour},
+		{models.DigestWeekly, 7 * 24 * time.Hour},
+	}
+	for _, p := range periods {
+		var lastId int64
+		for {
+			list := mysql_repo.UserPreferenceRepository.FindDigestDue(sqls.DB(), p.frequency, now.Add(-p.period), lastId, digestBatchSize)
+			for i := range list {
+				sendNotificationDigest(&list[i], p.period, now)
+			}
+			if len(list) < digestBatchSize {
+				break
+			}
+			lastId = list[len(list)-1].Id
+		}
+	}
+}
+
+// sendNotificationDigest 发送一个用户的摘要，没有新的未读通知时只记录发送时间
+func sendNotificationDigest(p *models.UserPreference, period time.Duration, now time.Time) {
+	// 连续发送摘要时从上一次发送的时间开始，避免遗漏两次检查之间的通知，最多包含两个周期内的通知
+	since := now.Add(-period)
+	if p.DigestSentAt != nil && p.DigestSentAt.After(now.Add(-2*period)) {
+		since = *p.DigestSentAt
+	}
+	maxItems := DefaultDigestMaxItems
+	if cfg := settings.GlobalSettings.DigestCfg; cfg != nil && cfg.MaxItems > 0 {
+		maxItems = cfg.MaxItems
+	}
+	if u := cache.UserCache.Get(p.UserId); canReceiveEmail(u) {
+		list := mysql_repo.NotificationRepository.Find(sqls.DB(), sqls.NewCnd().
+			Where("user_id = ? AND read_at IS NULL", p.UserId).
+			Where("create_at > ? AND create_at <= ?", since, now).
+			In("type", emailNotificationTypes(p)).Desc("id").Limit(maxItems))
+		if len(list) > 0 {
+			language := p.Language
+			if language == "" {
+				language = DefaultLanguage
+			}
+			texts := make([]string, len(list))
+			for i := range list {
+				texts[i] = notificationText(&list[i], language)
+			}
+			if err := SendNotificationEmail(u.Email, language, GenNotificationData(u.Username, language, texts, true)); err != nil {
+				// 发送失败时不记录发送时间，下次检查时重试
+				zap.L().Error("send notification digest failed", zap.Int64("user_id", p.UserId), zap.Error(err))
+				return
+			}
+		}
+	}
+	if err := mysql_repo.UserPreferenceRepository.UpdateDigestSentAt(sqls.DB(), p.UserId, now); err != nil {
+		zap.L().Error("update digest sent time failed", zap.Int64("user_id", p.UserId), zap.Error(err))
+	}
+}
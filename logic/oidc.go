@@ -0,0 +1,296 @@
+package logic
+
+import (
+	"bluebell/dao/mysql_repo"
+	"bluebell/dao/redis_repo"
+	"bluebell/models"
+	"bluebell/pkg/oidc"
+	"bluebell/pkg/snowflake"
+	"bluebell/pkg/sqls"
+	"bluebell/pkg/validation"
+	"bluebell/settings"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/thanhpk/randstr"
+	"go.uber.org/zap"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OidcStateExpireTime = 10 * time.Minute
+	maxEmailLen         = 64
+)
+
+var (
+	ERROR_UNKNOWN_OIDC_PROVIDER   = errors.New("unknown identity provider")
+	ERROR_INVALID_OIDC_STATE      = errors.New("invalid or expired oauth state")
+	ERROR_OIDC_LOGIN_FAILED       = errors.New("identity provider login failed")
+	ERROR_OIDC_EMAIL_CONFLICT     = errors.New("an account with this email already exists, please sign in with password and link the provider")
+	ERROR_IDENTITY_LINKED         = errors.New("this identity is already linked to another account")
+	ERROR_PROVIDER_ALREADY_LINKED = errors.New("a different identity of this provider is already linked")
+	ERROR_IDENTITY_NOT_FOUND      = errors.New("identity provider is not linked")
+	ERROR_LAST_LOGIN_METHOD       = errors.New("can not unlink the only way to sign in, please set a password first")
+)
+
+var (
+	oidcOnce      sync.Once
+	oidcProviders map[string]*oidc.Provider
+	oidcNames     []string
+)
+
+func initOidcProviders() {
+	oidcProviders = make(map[string]*oidc.Provider)
+	cfg := settings.GlobalSettings.OidcCfg
+	if cfg == nil {
+		return
+	}
+	for _, pc := range cfg.Providers {
+		if pc.Name == "" || pc.Issuer == "" || pc.ClientId == "" {
+			zap.L().Warn("skip incomplete oidc provider config", zap.String("name", pc.Name))
+			continue
+		}
+		oidcProviders[pc.Name] = oidc.NewProvider(pc, nil)
+		oidcNames = append(oidcNames, pc.Name)
+	}
+}
+
+func oidcProvider(name string) (*oidc.Provider, error) {
+	oidcOnce.Do(initOidcProviders)
+	p, ok := oidcProviders[name]
+	if !ok {
+		return nil, ERROR_UNKNOWN_OIDC_PROVIDER
+	}
+	return p, nil
+}
+
+// GetOidcProviders 获取可以用来登录的身份提供方
+func GetOidcProviders() []string {
+	oidcOnce.Do(initOidcProviders)
+	if oidcNames == nil {
+		return []string{}
+	}
+	return oidcNames
+}
+
+// StartOidcAuthorization 生成跳转到身份提供方的地址，state、nonce和PKCE的code verifier保存在Redis中
+// userId不为0时表示已登录的用户绑定第三方账号
+func StartOidcAuthorization(providerName string, userId int64, device *models.SessionDevice) (*models.ResponseOidcAuthorize, error) {
+	p, err := oidcProvider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	s := &redis_repo.OidcState{Provider: providerName, UserId: userId}
+	if device != nil {
+		s.Device = *device
+	}
+	state, err := oidc.RandomString()
+	if err == nil {
+		s.Nonce, err = oidc.RandomString()
+	}
+	if err == nil {
+		s.Verifier, err = oidc.RandomString()
+	}
+	if err != nil {
+		return nil, err
+	}
+	authURL, err := p.AuthCodeURL(ctx, state, s.Nonce, s.Verifier)
+	if err != nil {
+		zap.L().Error("build oidc authorization url failed", zap.String("provider", providerName), zap.Error(err))
+		return nil, err
+	}
+	if err = redis_repo.SetOidcState(ctx, state, s, OidcStateExpireTime); err != nil {
+		return nil, err
+	}
+	return &models.ResponseOidcAuthorize{AuthorizationURL: authURL}, nil
+}
+
+// finishOidcAuthorization 校验state，使用授权码换取并校验id token
+func finishOidcAuthorization(providerName string, userId int64, param *models.ParamOidcCallback) (*oidc.Claims, *redis_repo.OidcState, error) {
+	p, err := oidcProvider(providerName)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := redis_repo.TakeOidcState(ctx, param.State)
+	if err != nil {
+		return nil, nil, err
+	}
+	// state必须由同一个身份提供方、同一个用户发起，防止登录CSRF以及把别人的第三方账号绑定到自己的账号上
+	if s == nil || s.Provider != providerName || s.UserId != userId {
+		return nil, nil, ERROR_INVALID_OIDC_STATE
+	}
+	rawIdToken, err := p.Exchange(ctx, param.Code, s.Verifier)
+	if err != nil {
+		zap.L().Warn("oidc code exchange failed", zap.String("provider", providerName), zap.Error(err))
+		return nil, nil, fmt.Errorf("%w: %v", ERROR_OIDC_LOGIN_FAILED, err)
+	}
+	claims, err := p.Verify(ctx, rawIdToken, s.Nonce)
+	if err != nil {
+		zap.L().Warn("oidc id token verification failed", zap.String("provider", providerName), zap.Error(err))
+		return nil, nil, fmt.Errorf("%w: %v", ERROR_OIDC_LOGIN_FAILED, err)
+	}
+	return claims, s, nil
+}
+
+// OidcSignIn 第三方登录回调，已绑定的账号直接登录；没有绑定时按已验证的邮箱关联已有账号，否则自动注册
+// 登录后续流程和密码登录相同，开启了两步验证的用户同样需要完成两步验证
+func OidcSignIn(providerName string, param *models.ParamOidcCallback) (gin.H, error) {
+	claims, s, err := finishOidcAuthorization(providerName, 0, param)
+	if err != nil {
+		return nil, err
+	}
+	u, err := resolveOidcUser(providerName, claims)
+	if err != nil {
+		return nil, err
+	}
+	return SignInPostProcess(&models.User{UserId: u.UserId, Username: u.Username}, &s.Device)
+}
+
+func resolveOidcUser(providerName string, claims *oidc.Claims) (*models.User, error) {
+	if identity := mysql_repo.UserIdentityRepository.GetBySubject(sqls.DB(), providerName, claims.Subject); identity != nil {
+		u := mysql_repo.UserRepository.Get(sqls.DB(), identity.UserId)
+		if u == nil || u.Status == models.UserStatusDeleted {
+			return nil, ERROR_WRONG_USER
+		}
+		return u, nil
+	}
+
+	email := ""
+	if claims.EmailVerified && len(claims.Email) <= maxEmailLen && validation.IsEmail(claims.Email) == nil {
+		email = claims.Email
+	}
+	if email != "" {
+		if u := mysql_repo.UserRepository.GetByEmail(sqls.DB(), email); u != nil {
+			// 本地账号的邮箱没有验证过时不能自动关联，否则别人可以提前用该邮箱注册账号并保留密码
+			if !u.Verified {
+				return nil, ERROR_OIDC_EMAIL_CONFLICT
+			}
+			if err := linkIdentity(u.UserId, providerName, claims); err != nil {
+				return nil, err
+			}
+			zap.L().Info("oidc identity linked by verified email", zap.Int64("user_id", u.UserId), zap.String("provider", providerName))
+			return u, nil
+		}
+	}
+
+	username, err := oidcUsername(claims)
+	if err != nil {
+		return nil, err
+	}
+	// 第三方注册的账号没有密码，可以通过忘记密码设置
+	u := &models.User{
+		UserId:   snowflake.GenID(),
+		Username: username,
+		Email:    email,
+		Verified: email != "",
+	}
+	identity := &models.UserIdentity{Provider: providerName, Subject: claims.Subject, Email: claims.Email}
+	if err = mysql_repo.UserIdentityRepository.CreateWithUser(sqls.DB(), u, identity); err != nil {
+		zap.L().Error("create user from oidc identity failed", zap.String("provider", providerName), zap.Error(err))
+		return nil, err
+	}
+	return u, nil
+}
+
+var invalidUsernameChars = regexp.MustCompile(`[^0-9a-zA-Z_-]+`)
+
+func sanitizeUsername(s string) string {
+	s = invalidUsernameChars.ReplaceAllString(s, "")
+	s = strings.TrimLeft(s, "0123456789_-")
+	if len(s) > 12 {
+		s = s[:12]
+	}
+	return s
+}
+
+// oidcUsername 根据第三方账号的信息生成一个可用的用户名，被占用时加上随机数字后缀
+func oidcUsername(claims *oidc.Claims) (string, error) {
+	emailName, _, _ := strings.Cut(claims.Email, "@")
+	candidates := []string{sanitizeUsername(claims.PreferredUsername), sanitizeUsername(emailName), sanitizeUsername(claims.Name)}
+	for _, name := range candidates {
+		if validation.IsUsername(name) == nil && !isReservedUsername(name) && mysql_repo.UserRepository.GetByUsername(sqls.DB(), name) == nil {
+			return name, nil
+		}
+	}
+	base := "user"
+	for _, name := range candidates {
+		if name != "" {
+			base = name
+			break
+		}
+	}
+	if len(base) > 7 {
+		base = base[:7]
+	}
+	for i := 0; i < 5; i++ {
+		name := base + randstr.Dec(12-len(base))
+		if mysql_repo.UserRepository.GetByUsername(sqls.DB(), name) == nil {
+			return name, nil
+		}
+	}
+	return "", ERROR_DUPLICATED_USERNAME
+}
+
+func linkIdentity(userId int64, providerName string, claims *oidc.Claims) error {
+	for _, identity := range mysql_repo.UserIdentityRepository.FindByUserId(sqls.DB(), userId) {
+		if identity.Provider == providerName {
+			return ERROR_PROVIDER_ALREADY_LINKED
+		}
+	}
+	return mysql_repo.UserIdentityRepository.Create(sqls.DB(), &models.UserIdentity{UserId: userId, Provider: providerName, Subject: claims.Subject, Email: claims.Email})
+}
+
+// LinkOidcIdentity 已登录的用户完成第三方账号的绑定
+func LinkOidcIdentity(userId int64, providerName string, param *models.ParamOidcCallback) error {
+	claims, _, err := finishOidcAuthorization(providerName, userId, param)
+	if err != nil {
+		return err
+	}
+	if identity := mysql_repo.UserIdentityRepository.GetBySubject(sqls.DB(), providerName, claims.Subject); identity != nil {
+		if identity.UserId != userId {
+			return ERROR_IDENTITY_LINKED
+		}
+		return nil
+	}
+	if err = linkIdentity(userId, providerName, claims); err != nil {
+		return err
+	}
+	zap.L().Info("oidc identity linked", zap.Int64("user_id", userId), zap.String("provider", providerName))
+	return nil
+}
+
+// GetUserIdentities 获取用户绑定的第三方账号
+func GetUserIdentities(userId int64) []models.UserIdentity {
+	list := mysql_repo.UserIdentityRepository.FindByUserId(sqls.DB(), userId)
+	if list == nil {
+		list = []models.UserIdentity{}
+	}
+	return list
+}
+
+// UnlinkOidcIdentity 解绑第三方账号，没有设置密码时至少要保留一个第三方账号用来登录
+func UnlinkOidcIdentity(userId int64, providerName string) error {
+	u := mysql_repo.UserRepository.Get(sqls.DB(), userId)
+	if u == nil {
+		return ERROR_WRONG_USER
+	}
+	identities := mysql_repo.UserIdentityRepository.FindByUserId(sqls.DB(), userId)
+	found := false
+	for _, identity := range identities {
+		found = found || identity.Provider == providerName
+	}
+	if !found {
+		return ERROR_IDENTITY_NOT_FOUND
+	}
+	if u.Password == "" && len(identities) == 1 {
+		return ERROR_LAST_LOGIN_METHOD
+	}
+	if err := mysql_repo.UserIdentityRepository.Delete(sqls.DB(), userId, providerName); err != nil {
+		zap.L().Error("unlink oidc identity failed", zap.Int64("user_id", userId), zap.String("provider", providerName), zap.Error(err))
+		return err
+	}
+	return nil
+}
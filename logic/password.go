@@ -0,0 +1,188 @@
+package logic
+
+import (
+	"bluebell/cache"
+	"bluebell/dao/mysql_repo"
+	"bluebell/dao/redis_repo"
+	"bluebell/models"
+	"bluebell/pkg/base62"
+	"bluebell/pkg/encrypt"
+	"bluebell/pkg/jwtkeys"
+	"bluebell/pkg/sqls"
+	"bluebell/pkg/validation"
+	"bluebell/settings"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+// 重置密码token的格式为 base62(用户id)-base62(过期时间)-随机串-签名
+// 签名时包含用户当前的密码哈希，密码修改后之前发出的链接全部失效
+const (
+	resetTokenSeparator       = "-"
+	resetNonceLen             = 16
+	DefaultResetExpireTime    = 30 // 分钟
+	PasswordResetMailInterval = 2 * time.Minute
+)
+
+var (
+	ERROR_INVALID_RESET_TOKEN = errors.New("invalid or expired password reset token")
+	ERROR_WEAK_PASSWORD       = errors.New("password does not meet the requirements")
+)
+
+// resetSecret 优先使用配置的密钥，没有配置时从token签名密钥派生，不会使用公开的默认密钥
+func resetSecret() ([]byte, error) {
+	if cfg := settings.GlobalSettings.PasswordCfg; cfg != nil && cfg.ResetSecret != "" {
+		return []byte(cfg.ResetSecret), nil
+	}
+	return jwtkeys.DeriveSecret("password-reset")
+}
+
+func resetExpireTime() time.Duration {
+	if cfg := settings.GlobalSettings.PasswordCfg; cfg != nil && cfg.ResetExpireTime > 0 {
+		return time.Duration(cfg.ResetExpireTime) * time.Minute
+	}
+	return DefaultResetExpireTime * time.Minute
+}
+
+func signReset(payload, passwordHash string) (string, error) {
+	secret, err := resetSecret()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	mac.Write([]byte(resetTokenSeparator + passwordHash))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// GenPasswordResetURL 生成重置密码的页面地址
+func GenPasswordResetURL(token string) string {
+	if cfg := settings.GlobalSettings.PasswordCfg; cfg != nil && cfg.ResetURL != "" {
+		return strings.ReplaceAll(cfg.ResetURL, "{token}", token)
+	}
+	return AbsoluteURL("/reset-password?token=" + token)
+}
+
+// ForgotPassword 向邮箱对应的用户发送重置密码邮件
+// 邮箱不存在或者发送过于频繁时同样返回成功，避免泄露邮箱是否已经注册
+func ForgotPassword(email string) (err error) {
+	u := mysql_repo.UserRepository.GetByEmail(sqls.DB(), email)
+	if u == nil {
+		return nil
+	}
+	allowed, err := redis_repo.AllowPasswordResetEmail(ctx, u.Email, PasswordResetMailInterval)
+	if err != nil {
+		zap.L().Error("check password reset email interval error in logic.ForgotPassword()", zap.Error(err))
+		return err
+	}
+	if !allowed {
+		zap.L().Warn("password reset email requested too frequently", zap.Int64("user_id", u.UserId))
+		return nil
+	}
+
+	nonce := make([]byte, resetNonceLen)
+	if _, err = rand.Read(nonce); err != nil {
+		return err
+	}
+	expiration := resetExpireTime()
+	payload := strings.Join([]string{
+		base62.Encode(uint64(u.UserId)),
+		base62.Encode(uint64(time.Now().Add(expiration).Unix())),
+		hex.EncodeToString(nonce),
+	}, resetTokenSeparator)
+	sig, err := signReset(payload, u.Password)
+	if err != nil {
+		zap.L().Error("sign password reset token error in logic.ForgotPassword()", zap.Error(err))
+		return err
+	}
+	token := payload + resetTokenSeparator + sig
+	if err = redis_repo.SetPasswordResetToken(ctx, hex.EncodeToString(nonce), u.UserId, expiration); err != nil {
+		zap.L().Error("save password reset token error in logic.ForgotPassword()", zap.Error(err))
+		return err
+	}
+
+	// 异步发送邮件，避免通过响应时间判断邮箱是否存在
+	go func() {
+		if err := SendPasswordResetEmail(u.Email, GenPasswordResetData(u.Username, GenPasswordResetURL(token))); err != nil {
+			zap.L().Error("send password reset email failed", zap.Int64("user_id", u.UserId), zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// ResetPassword 校验重置密码的token并设置新密码，成功后用户所有的登录状态失效
+func ResetPassword(param *models.ParamResetPassword) (err error) {
+	parts := strings.Split(param.Token, resetTokenSeparator)
+	if len(parts) != 4 {
+		return ERROR_INVALID_RESET_TOKEN
+	}
+	userId, err1 := base62.Decode(parts[0])
+	expireAt, err2 := base62.Decode(parts[1])
+	if err1 != nil || err2 != nil || int64(expireAt) < time.Now().Unix() {
+		return ERROR_INVALID_RESET_TOKEN
+	}
+	u := mysql_repo.UserRepository.Get(sqls.DB(), int64(userId))
+	if u == nil {
+		return ERROR_INVALID_RESET_TOKEN
+	}
+	payload := strings.Join(parts[:3], resetTokenSeparator)
+	expected, err := signReset(payload, u.Password)
+	if err != nil {
+		zap.L().Error("sign password reset token error in logic.ResetPassword()", zap.Error(err))
+		return err
+	}
+	if !hmac.Equal([]byte(parts[3]), []byte(expected)) {
+		return ERROR_INVALID_RESET_TOKEN
+	}
+	if err = validation.IsPassword(param.Password); err != nil {
+		return fmt.Errorf("%w: %v", ERROR_WEAK_PASSWORD, err)
+	}
+	// 签名校验通过以后才消耗随机串，保证链接只能使用一次
+	owner, err := redis_repo.TakePasswordResetToken(ctx, parts[2])
+	if err != nil {
+		zap.L().Error("take password reset token error in logic.ResetPassword()", zap.Error(err))
+		return err
+	}
+	if owner != u.UserId {
+		return ERROR_INVALID_RESET_TOKEN
+	}
+
+	hashed, err := encrypt.Hash(param.Password)
+	if err != nil {
+		zap.L().Error("hash password failed", zap.Error(err))
+		return err
+	}
+	if err = mysql_repo.UserRepository.UpdateColumn(sqls.DB(), u.UserId, "password", hashed); err != nil {
+		zap.L().Error("update password error in logic.ResetPassword()", zap.Error(err))
+		return err
+	}
+	cache.UserCache.Invalidate(u.UserId)
+	if err = RevokeUserTokens(u.UserId); err != nil {
+		zap.L().Error("revoke user tokens error in logic.ResetPassword()", zap.Int64("user_id", u.UserId), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// RevokeUserTokens 吊销用户所有的登录会话，所有设备上的token立即失效
+func RevokeUserTokens(userId int64) error {
+	sessions, err := redis_repo.GetSessions(ctx, userId)
+	if err != nil {
+		return err
+	}
+	sessionIds := make([]string, len(sessions))
+	for i, s := range sessions {
+		sessionIds[i] = s.SessionId
+	}
+	if err = redis_repo.RevokeRefreshTokens(ctx, refreshTokenExpireTime(), sessionIds...); err != nil {
+		return err
+	}
+	return redis_repo.RevokeUserTokens(ctx, userId)
+}
@@ -6,6 +6,7 @@ import (
 	"bluebell/dao/redis_repo"
 	"bluebell/message_queue"
 	"bluebell/models"
+	"bluebell/pkg/reputation"
 	"bluebell/pkg/snowflake"
 	"bluebell/pkg/sqls"
 	"errors"
@@ -35,6 +36,23 @@ func CreatePost(post *models.Post) (err error) {
 		zap.L().Error("create post in redis_repo failed", zap.Error(err))
 		return err
 	}
+	if err = redis_repo.IncrUserStat(post.AuthorID, redis_repo.UserStatPosts, 1); err != nil {
+		zap.L().Error("update user post count failed", zap.Int64("user_id", post.AuthorID), zap.Error(err))
+	}
+	// 解析正文中的@并通知被@的用户，失败不影响发帖
+	if _, err = SaveMentions(PostType, post.PostId, post.PostId, post.AuthorID, post.Content); err != nil {
+		zap.L().Error("save post mentions failed", zap.Int64("post_id", post.PostId), zap.Error(err))
+	}
+	// 发布事件用于检查徽章，失败不影响发帖
+	if err = message_queue.SendContentEvent(ctx, message_queue.ContentEvent{
+		UserId:     post.AuthorID,
+		TargetType: PostType,
+		TargetId:   post.PostId,
+		PostId:     post.PostId,
+		Timestamp:  time.Now().Format(time.RFC3339),
+	}); err != nil {
+		zap.L().Error("send post content event failed", zap.Int64("post_id", post.PostId), zap.Error(err))
+	}
 	return nil
 }
 
@@ -205,8 +223,20 @@ func GetPostsWithOrder(param *models.ParamPostList) (posts []models.Post, err er
 		zap.L().Error("redis_repo get post ids failed", zap.Error(err))
 		return nil, err
 	}
-	// 根据id列表从mysql中获取post信息
-	posts = mysql_repo.PostRepository.Find(sqls.DB(), sqls.NewCnd().In("post_id", ids).Desc("post_id"))
+	if len(ids) == 0 {
+		return nil, ERROR_POST_NOT_EXISTS
+	}
+	// 根据id列表从mysql中获取post信息，按照Redis中的顺序返回
+	list := mysql_repo.PostRepository.Find(sqls.DB(), sqls.NewCnd().In("post_id", ids))
+	byId := make(map[string]models.Post, len(list))
+	for _, post := range list {
+		byId[strconv.FormatInt(post.PostId, 10)] = post
+	}
+	for _, id := range ids {
+		if post, ok := byId[id]; ok {
+			posts = append(posts, post)
+		}
+	}
 	if len(posts) == 0 {
 		err = ERROR_POST_NOT_EXISTS
 	}
@@ -246,15 +276,20 @@ func AddCollectPost(postId, userId int64) (err error) {
 }
 
 func DeletePost(postId, userId int64) (err error) {
-	// 先确认这个userID是否为该post的作者
+	// 先确认这个userID是否为该post的作者，版主也可以删除帖子
 	post := mysql_repo.PostRepository.Get(sqls.DB(), postId)
-	if post.AuthorID != userId {
+	if post == nil {
+		return ERROR_POST_NOT_EXISTS
+	}
+	if post.AuthorID != userId && !IsModerator(userId) {
 		zap.L().Warn("only author can delete his own post")
 		return ERROR_ILLEGAL_POST_DELETE
 	}
 
 	// 先删除MySQL数据，然后删除缓存
-	if err = mysql_repo.PostRepository.DeletePostInfo(sqls.DB(), postId); err != nil {
+	// MySQL中只是软删除，记录到回收站中，在保留期内可以恢复
+	deleteAt := time.Now().Truncate(time.Second)
+	if err = mysql_repo.PostRepository.DeletePostInfo(sqls.DB(), postId, deleteAt); err != nil {
 		zap.L().Error("fail to delete post related info in mysql", zap.Error(err))
 		return err
 	}
@@ -264,11 +299,25 @@ func DeletePost(postId, userId int64) (err error) {
 	// 删除对该帖子所有的点赞/点踩/收藏/评论/分数
 	// 点赞/点踩/分数/评论数在redis中
 	// 收藏/评论在MySQL中
-	err = redis_repo.DeletePostInfo(postId, post.CommunityID)
+	err = redis_repo.DeletePostInfo(postId, post.CommunityID, post.AuthorID)
 	if err != nil {
 		zap.L().Error("fail to delete post related info in redis", zap.Error(err))
 		return err
 	}
+	moveToTrash(&models.Trash{
+		Type:        PostType,
+		TargetId:    postId,
+		UserId:      post.AuthorID,
+		OperatorId:  userId,
+		PostId:      postId,
+		CommunityId: post.CommunityID,
+		Title:       post.Title,
+		DeletedAt:   deleteAt,
+	})
+	// 被版主删除的帖子扣除作者的声望，从回收站恢复时返还
+	if post.AuthorID != userId {
+		changeReputation(post.AuthorID, reputation.ContentRemoved, 1)
+	}
 	return nil
 }
 
@@ -0,0 +1,111 @@
+package logic
+
+import (
+	"bluebell/cache"
+	"bluebell/dao/mysql_repo"
+	"bluebell/models"
+	"bluebell/pkg/sqls"
+	"errors"
+	"go.uber.org/zap"
+	"strconv"
+)
+
+var (
+	ERROR_ILLEGAL_POST_OPERATION = errors.New("only author or moderator can operate this post")
+	ERROR_COMMENT_LOCKED         = errors.New("comments on this post are locked")
+)
+
+// PinComment 作者或版主置顶帖子下的一条根评论，CommentId为0时取消置顶
+func PinComment(userId int64, param *models.ParamPinComment) (err error) {
+	post, err := GetPostById(param.PostId)
+	if err != nil {
+		return err
+	}
+	if post.AuthorID != userId && !IsModerator(userId) {
+		zap.L().Warn("only author or moderator can pin comment", zap.Int64("user_id", userId), zap.Int64("post_id", post.PostId))
+		return ERROR_ILLEGAL_POST_OPERATION
+	}
+	if param.CommentId != 0 {
+		comment, err := GetCommentById(param.CommentId)
+		if err != nil {
+			return err
+		}
+		// 只能置顶该帖子下的根评论
+		if comment.PostId != post.PostId || comment.ParentCommentId != 0 {
+			return ERROR_WRONG_COMMENT
+		}
+	}
+	if err = mysql_repo.PostRepository.UpdateCommentSetting(sqls.DB(), post.PostId, map[string]interface{}{
+		"pinned_comment_id": param.CommentId,
+	}); err != nil {
+		zap.L().Error("pin comment in mysql error in logic.PinComment()", zap.Error(err))
+		return err
+	}
+	cache.PostCache.Invalidate(post.PostId)
+	return nil
+}
+
+// unpinComment 帖子置顶的评论被删除时取消置顶
+func unpinComment(postId, commentId int64) {
+	changed, err := mysql_repo.PostRepository.UnpinComment(sqls.DB(), postId, commentId)
+	if err != nil {
+		zap.L().Error("unpin deleted comment error in logic.unpinComment()", zap.Int64("post_id", postId), zap.Error(err))
+		return
+	}
+	if changed {
+		cache.PostCache.Invalidate(postId)
+	}
+}
+
+// LockComments 作者或版主禁止/允许在帖子下发表新的评论，版主锁定的帖子只有版主可以解锁
+func LockComments(userId int64, param *models.ParamLockComment) (err error) {
+	post, err := GetPostById(param.PostId)
+	if err != nil {
+		return err
+	}
+	moderator := IsModerator(userId)
+	if post.AuthorID != userId && !moderator {
+		zap.L().Warn("only author or moderator can lock comments", zap.Int64("user_id", userId), zap.Int64("post_id", post.PostId))
+		return ERROR_ILLEGAL_POST_OPERATION
+	}
+	if post.CommentLocked && post.CommentLockedBy != post.AuthorID && !moderator {
+		return ERROR_ILLEGAL_POST_OPERATION
+	}
+	columns := map[string]interface{}{"comment_locked": *param.Lock, "comment_locked_by": int64(0)}
+	if *param.Lock {
+		columns["comment_locked_by"] = userId
+	}
+	if err = mysql_repo.PostRepository.UpdateCommentSetting(sqls.DB(), post.PostId, columns); err != nil {
+		zap.L().Error("lock comments in mysql error in logic.LockComments()", zap.Error(err))
+		return err
+	}
+	cache.PostCache.Invalidate(post.PostId)
+	return nil
+}
+
+// checkCommentLocked 帖子禁止评论时，只有版主可以继续评论
+func checkCommentLocked(postId, userId int64) error {
+	post, err := GetPostById(postId)
+	if err != nil {
+		return err
+	}
+	if post.CommentLocked && !IsModerator(userId) {
+		return ERROR_COMMENT_LOCKED
+	}
+	return nil
+}
+
+// pinToFront 将置顶的根评论移动到最前面，不在列表中时不做处理
+func pinToFront(ids []string, pinned int64) {
+	if pinned == 0 {
+		return
+	}
+	pinnedId := strconv.FormatInt(pinned, 10)
+	for i, id := range ids {
+		if id == pinnedId {
+			copy(ids[1:i+1], ids[:i])
+			ids[0] = id
+			return
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package logic
+
+import (
+	"bluebell/cache"
+	"bluebell/dao/mysql_repo"
+	"bluebell/dao/redis_repo"
+	"bluebell/models"
+	"bluebell/pkg/sqls"
+	"errors"
+	"go.uber.org/zap"
+	"strconv"
+)
+
+// 用户的偏好设置，没有保存过或者字段为空时使用默认值
+// 偏好设置和用户信息一起缓存在cache.UserCache中，修改后清除缓存
+
+const (
+	DefaultPostSort        = models.OrderByTime
+	DefaultLanguage        = models.LanguageZh
+	DefaultDigestFrequency = models.DigestInstant
+)
+
+var (
+	ERROR_INVALID_PREFERENCE  = errors.New("invalid preference")
+	ERROR_MESSAGE_NOT_ALLOWED = errors.New("the user does not accept messages from you")
+)
+
+// GetUserPreference 获取用户的偏好设置，没有设置的字段填充默认值
+func GetUserPreference(userId int64) (*models.UserPreference, error) {
+	p := cache.UserCache.GetPreference(userId)
+	if p == nil {
+		return nil, ERROR_WRONG_USER
+	}
+	// 复制一份，避免修改缓存中的数据
+	ret := *p
+	if ret.PostSort == "" {
+		ret.PostSort = DefaultPostSort
+	}
+	if ret.Language == "" {
+		ret.Language = DefaultLanguage
+	}
+	if ret.DigestFrequency == "" {
+		ret.DigestFrequency = DefaultDigestFrequency
+	}
+	return &ret, nil
+}
+
+// UpdateUserPreference 修改用户的偏好设置，只修改param中传了的字段，返回修改后的设置
+func UpdateUserPreference(userId int64, param *models.ParamUserPreference) (*models.UserPreference, error) {
+	if u := cache.UserCache.Get(userId); u == nil || u.Status == models.UserStatusDeleted {
+		return nil, ERROR_WRONG_USER
+	}
+	p, err := GetUserPreference(userId)
+	if err != nil {
+		return nil, err
+	}
+	if param.PostSort != nil {
+		if *param.PostSort != models.OrderByTime && *param.PostSort != models.OrderByScore {
+			return nil, ERROR_INVALID_PREFERENCE
+		}
+		p.PostSort = *param.PostSort
+	}
+	if param.Language != nil {
+		if *param.Language != models.LanguageZh && *param.Language != models.LanguageEn {
+			return nil, ERROR_INVALID_PREFERENCE
+		}
+		p.Language = *param.Language
+	}
+	if param.DigestFrequency != nil {
+		switch *param.DigestFrequency {
+		case models.DigestInstant, models.DigestDaily, models.DigestWeekly:
+			p.DigestFrequency = *param.DigestFrequency
+		default:
+			return nil, ERROR_INVALID_PREFERENCE
+		}
+	}
+	if param.MessagePermission != nil {
+		if !validPermission(*param.MessagePermission) {
+			return nil, ERROR_INVALID_PREFERENCE
+		}
+		p.MessagePermission = *param.MessagePermission
+	}
+	if param.MentionPermission != nil {
+		if !validPermission(*param.MentionPermission) {
+			return nil, ERROR_INVALID_PREFERENCE
+		}
+		p.MentionPermission = *param.MentionPermission
+	}
+	if param.EmailMention != nil {
+		p.EmailMention = *param.EmailMention
+	}
+	if param.EmailBadge != nil {
+		p.EmailBadge = *param.EmailBadge
+	}
+
+	err = mysql_repo.UserPreferenceRepository.Save(sqls.DB(), &models.UserPreference{
+		UserId:            userId,
+		PostSort:          p.PostSort,
+		Language:          p.Language,
+		EmailMention:      p.EmailMention,
+		EmailBadge:        p.EmailBadge,
+		DigestFrequency:   p.DigestFrequency,
+		MessagePermission: p.MessagePermission,
+		MentionPermission: p.MentionPermission,
+	})
+	cache.UserCache.Invalidate(userId)
+	if err != nil {
+		zap.L().Error("save user preference error in logic.UpdateUserPreference()", zap.Int64("user_id", userId), zap.Error(err))
+		return nil, err
+	}
+	return GetUserPreference(userId)
+}
+
+func validPermission(v int8) bool {
+	return v == models.AllowEveryone || v == models.AllowFollowing || v == models.AllowNobody
+}
+
+// allowedBy 判断ownerId的用户是否允许actorId的用户私信/@自己，查询失败时按不允许处理
+func allowedBy(permission int8, ownerId, actorId int64) bool {
+	if ownerId == actorId {
+		return true
+	}
+	switch permission {
+	case models.AllowEveryone:
+		return true
+	case models.AllowFollowing:
+		followed, err := redis_repo.CheckUserFollowedTargetUser(ctx, ownerId, actorId)
+		if err != nil {
+			zap.L().Error("check user followed error in logic.allowedBy()", zap.Int64("user_id", ownerId), zap.Error(err))
+			return false
+		}
+		return followed
+	}
+	return false
+}
+
+// CanMention 判断authorId的用户是否可以@userId的用户
+func CanMention(authorId, userId int64) bool {
+	p := cache.UserCache.GetPreference(userId)
+	return p != nil && allowedBy(p.MentionPermission, userId, authorId)
+}
+
+// CheckMessagePermission 发送私信前检查接收者是否允许发送者私信自己，被接收者拉黑时同样不允许
+func CheckMessagePermission(senderId, recipientId int64) error {
+	u := cache.UserCache.Get(recipientId)
+	if u == nil || u.Status == models.UserStatusDeleted {
+		return ERROR_WRONG_USER
+	}
+	blocked, err := redis_repo.CheckInBlackList(ctx, strconv.FormatInt(senderId, 10), strconv.FormatInt(recipientId, 10))
+	if err != nil {
+		zap.L().Error("check blacklist error in logic.CheckMessagePermission()", zap.Error(err))
+		return err
+	}
+	p := cache.UserCache.GetPreference(recipientId)
+	if blocked || p == nil || !allowedBy(p.MessagePermission, recipientId, senderId) {
+		return ERROR_MESSAGE_NOT_ALLOWED
+	}
+	return nil
+}
+
+// PreferredPostSort 获取用户默认的帖子排序方式，未登录时使用默认的排序方式
+func PreferredPostSort(userId int64) string {
+	if userId == 0 {
+		return DefaultPostSort
+	}
+	p, err := GetUserPreference(userId)
+	if err != nil {
+		return DefaultPostSort
+	}
+	return p.PostSort
+}
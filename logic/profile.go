@@ -0,0 +1,76 @@
+package logic
+
+import (
+	"bluebell/cache"
+	"bluebell/dao/mysql_repo"
+	"bluebell/dao/redis_repo"
+	"bluebell/models"
+	"bluebell/pkg/sqls"
+	"go.uber.org/zap"
+	"time"
+)
+
+// 用户统计数据在Redis中的缓存时间，期间由发帖、评论以及投票的消费者增量更新
+const UserStatsExpireTime = 6 * time.Hour
+
+// GetUserProfile 获取用户的公开主页，viewerId为0表示未登录
+func GetUserProfile(viewerId, userId int64) (*models.ResponseUserProfile, error) {
+	u := cache.UserCache.Get(userId)
+	if u == nil || u.Status == models.UserStatusDeleted {
+		return nil, ERROR_WRONG_USER
+	}
+	stats, err := loadUserStats(userId)
+	if err != nil {
+		zap.L().Error("load user stats error in logic.GetUserProfile()", zap.Int64("user_id", userId), zap.Error(err))
+		return nil, err
+	}
+	fans, follows, err := redis_repo.GetUserFollowCounts(userId)
+	if err != nil {
+		zap.L().Error("get user follow counts error in logic.GetUserProfile()", zap.Int64("user_id", userId), zap.Error(err))
+		return nil, err
+	}
+	profile := &models.ResponseUserProfile{
+		UserId:         u.UserId,
+		Username:       u.Username,
+		Gender:         u.Gender,
+		JoinAt:         u.CreateAt,
+		PostCount:      stats[redis_repo.UserStatPosts],
+		CommentCount:   stats[redis_repo.UserStatComments],
+		LikesReceived:  stats[redis_repo.UserStatLikesReceived],
+		Reputation:     u.Reputation,
+		FollowerCount:  fans,
+		FollowingCount: follows,
+		Badges:         GetUserBadges(userId),
+	}
+	if viewerId != 0 && viewerId != userId {
+		if profile.Followed, err = redis_repo.CheckUserFollowedTargetUser(ctx, viewerId, userId); err != nil {
+			return nil, err
+		}
+	}
+	return profile, nil
+}
+
+// loadUserStats 优先使用Redis中缓存的统计数据，缓存不存在时从MySQL统计并写入缓存
+func loadUserStats(userId int64) (map[string]int64, error) {
+	stats, err := redis_repo.GetUserStats(userId)
+	if err != nil || stats != nil {
+		return stats, err
+	}
+	db := sqls.DB()
+	stats = map[string]int64{
+		redis_repo.UserStatPosts:         mysql_repo.PostRepository.Count(db, sqls.NewCnd().Where("author_id = ?", userId)),
+		redis_repo.UserStatComments:      mysql_repo.CommentRepository.Count(db, sqls.NewCnd().Where("user_id = ?", userId)),
+		redis_repo.UserStatLikesReceived: mysql_repo.VoteRepository.CountLikesReceived(db, userId),
+	}
+	if err = redis_repo.SetUserStats(userId, stats, UserStatsExpireTime); err != nil {
+		zap.L().Error("cache user stats failed", zap.Int64("user_id", userId), zap.Error(err))
+	}
+	return stats, nil
+}
+
+// invalidateUserStats 删除、恢复内容以后，作者的统计数据在下次访问时重新统计
+func invalidateUserStats(userId int64) {
+	if err := redis_repo.DeleteUserStats(userId); err != nil {
+		zap.L().Error("invalidate user stats failed", zap.Int64("user_id", userId), zap.Error(err))
+	}
+}
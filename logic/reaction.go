@@ -0,0 +1,179 @@
+package logic
+
+import (
+	"bluebell/cache"
+	"bluebell/dao/mysql_repo"
+	"bluebell/dao/redis_repo"
+	"bluebell/message_queue"
+	"bluebell/models"
+	"bluebell/pkg/sqls"
+	"bluebell/settings"
+	"errors"
+	"go.uber.org/zap"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	MaxCommunityReactions = 20 // 每个社区最多可以配置的回应数量
+	MaxReactionLen        = 8  // 每个回应最多包含的字符数，组合emoji由多个字符组成
+)
+
+var DefaultReactions = []string{"👍", "❤️", "😂", "😮", "😢", "🎉"}
+
+var (
+	ERROR_INVALID_REACTION = errors.New("reaction is not available in this community")
+	ERROR_NOT_MODERATOR    = errors.New("only moderator can do this operation")
+)
+
+// GetAvailableReactions 获取社区可用的回应，社区没有单独配置时使用默认的回应
+func GetAvailableReactions(communityId int64) []string {
+	if community, err := GetCommunityById(communityId); err == nil && community.Reactions != "" {
+		return strings.Split(community.Reactions, ",")
+	}
+	if cfg := settings.GlobalSettings.ReactionCfg; cfg != nil && len(cfg.Default) > 0 {
+		return cfg.Default
+	}
+	return DefaultReactions
+}
+
+// reactionCommunity 获取帖子/评论所在的社区
+func reactionCommunity(targetType int8, targetId int64) (int64, error) {
+	postId := targetId
+	if targetType == CommentType {
+		comment, err := GetCommentById(targetId)
+		if err != nil {
+			return 0, err
+		}
+		postId = comment.PostId
+	}
+	post, err := GetPostById(postId)
+	if err != nil {
+		return 0, err
+	}
+	return post.CommunityID, nil
+}
+
+// React 添加/取消对帖子/评论的回应，先写入Redis，再通过消息队列持久化到MySQL
+func React(userId int64, param *models.ParamReaction) (err error) {
+	communityId, err := reactionCommunity(param.TargetType, param.TargetId)
+	if err != nil {
+		return err
+	}
+	// 取消回应时不检查，社区修改配置以后仍然可以取消之前添加的回应
+	if param.Action == 1 && !slices.Contains(GetAvailableReactions(communityId), param.Emoji) {
+		return ERROR_INVALID_REACTION
+	}
+	if err = loadReactions(param.TargetType, param.TargetId); err != nil {
+		zap.L().Error("load reactions error in logic.React()", zap.Int64("target_id", param.TargetId), zap.Error(err))
+		return err
+	}
+	var changed bool
+	if param.Action == 1 {
+		changed, err = redis_repo.AddReaction(param.TargetType, param.TargetId, userId, param.Emoji)
+	} else {
+		changed, err = redis_repo.RemoveReaction(param.TargetType, param.TargetId, userId, param.Emoji)
+	}
+	if err != nil {
+		zap.L().Error("modify reaction in redis error in logic.React()", zap.Error(err))
+		return err
+	}
+	// 重复添加/取消同一个回应，不做处理
+	if !changed {
+		return nil
+	}
+	err = message_queue.SendReactionEvent(ctx, message_queue.ReactionEvent{
+		Action:     param.Action,
+		UserId:     userId,
+		TargetType: param.TargetType,
+		TargetId:   param.TargetId,
+		Emoji:      param.Emoji,
+		Timestamp:  time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		zap.L().Error("send message to message queue error in logic.React()", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// GetReactions 获取帖子/评论的回应统计，userId为0时不返回当前用户的回应
+func GetReactions(userId int64, targetType int8, targetId int64) (res *models.ResponseReactions, err error) {
+	communityId, err := reactionCommunity(targetType, targetId)
+	if err != nil {
+		return nil, err
+	}
+	if err = loadReactions(targetType, targetId); err != nil {
+		zap.L().Error("load reactions error in logic.GetReactions()", zap.Int64("target_id", targetId), zap.Error(err))
+		return nil, err
+	}
+	res = &models.ResponseReactions{Available: GetAvailableReactions(communityId), Counts: map[string]int64{}, Mine: []string{}}
+	counts, err := redis_repo.GetReactionCounts(targetType, targetId)
+	if err != nil {
+		return nil, err
+	}
+	// 只返回社区当前可用的回应
+	for _, emoji := range res.Available {
+		if cnt := counts[emoji]; cnt > 0 {
+			res.Counts[emoji] = cnt
+		}
+	}
+	if userId != 0 {
+		mine, err := redis_repo.GetUserReactions(targetType, targetId, userId)
+		if err != nil {
+			return nil, err
+		}
+		for _, emoji := range mine {
+			if slices.Contains(res.Available, emoji) {
+				res.Mine = append(res.Mine, emoji)
+			}
+		}
+	}
+	return res, nil
+}
+
+// loadReactions Redis中没有帖子/评论的回应统计时（例如Redis数据丢失），从MySQL中读取所有回应重建
+func loadReactions(targetType int8, targetId int64) error {
+	loaded, err := redis_repo.ReactionsLoaded(targetType, targetId)
+	if err != nil || loaded {
+		return err
+	}
+	list := mysql_repo.ReactionRepository.FindByTarget(sqls.DB(), targetType, targetId)
+	users := make(map[int64][]string)
+	for _, r := range list {
+		users[r.UserId] = append(users[r.UserId], r.Emoji)
+	}
+	return redis_repo.RebuildReactions(targetType, targetId, users)
+}
+
+// SetCommunityReactions 版主修改社区可用的回应，为空时恢复为默认的回应
+func SetCommunityReactions(userId int64, param *models.ParamCommunityReactions) (err error) {
+	if !IsModerator(userId) {
+		return ERROR_NOT_MODERATOR
+	}
+	if _, err = GetCommunityById(param.CommunityId); err != nil {
+		return err
+	}
+	if len(param.Reactions) > MaxCommunityReactions {
+		return ERROR_INVALID_REACTION
+	}
+	reactions := make([]string, 0, len(param.Reactions))
+	for _, emoji := range param.Reactions {
+		emoji = strings.TrimSpace(emoji)
+		n := utf8.RuneCountInString(emoji)
+		if n == 0 || n > MaxReactionLen || strings.Contains(emoji, ",") {
+			return ERROR_INVALID_REACTION
+		}
+		if !slices.Contains(reactions, emoji) {
+			reactions = append(reactions, emoji)
+		}
+	}
+	if err = mysql_repo.CommunityRepository.UpdateColumn(sqls.DB(), param.CommunityId, "reactions", strings.Join(reactions, ",")); err != nil {
+		zap.L().Error("update community reactions error in logic.SetCommunityReactions()", zap.Error(err))
+		return err
+	}
+	cache.CommunityCache.Invalidate(param.CommunityId)
+	return nil
+}
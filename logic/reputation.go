@@ -0,0 +1,55 @@
+package logic
+
+import (
+	"bluebell/cache"
+	"bluebell/dao/mysql_repo"
+	"bluebell/models"
+	"bluebell/pkg/reputation"
+	"bluebell/pkg/sqls"
+	"errors"
+	"go.uber.org/zap"
+)
+
+var ERROR_INVALID_THRESHOLD = errors.New("reputation threshold can not be negative")
+
+// changeReputation 修改用户的声望，失败只记录日志
+func changeReputation(userId int64, reason string, count int64) {
+	if err := reputation.Change(userId, reason, count); err != nil {
+		zap.L().Error("change user reputation failed", zap.Int64("user_id", userId), zap.String("reason", reason), zap.Error(err))
+	}
+}
+
+// GetCommunityReputation 获取社区生效的声望门槛
+func GetCommunityReputation(communityId int64) (*reputation.Thresholds, error) {
+	if _, err := GetCommunityById(communityId); err != nil {
+		return nil, err
+	}
+	t := reputation.GetThresholds(communityId)
+	return &t, nil
+}
+
+// SetCommunityReputation 版主修改社区的声望门槛，为空的项恢复为全局配置
+func SetCommunityReputation(userId int64, param *models.ParamCommunityReputation) (err error) {
+	if !IsModerator(userId) {
+		return ERROR_NOT_MODERATOR
+	}
+	if _, err = GetCommunityById(param.CommunityId); err != nil {
+		return err
+	}
+	columns := map[string]interface{}{
+		"publish_threshold":     param.PublishThreshold,
+		"vote_weight_threshold": param.VoteWeightThreshold,
+		"link_threshold":        param.LinkThreshold,
+	}
+	for _, v := range columns {
+		if t := v.(*int64); t != nil && *t < 0 {
+			return ERROR_INVALID_THRESHOLD
+		}
+	}
+	if err = mysql_repo.CommunityRepository.Updates(sqls.DB(), param.CommunityId, columns); err != nil {
+		zap.L().Error("update community reputation error in logic.SetCommunityReputation()", zap.Error(err))
+		return err
+	}
+	cache.CommunityCache.Invalidate(param.CommunityId)
+	return nil
+}
@@ -0,0 +1,223 @@
+package logic
+
+import (
+	"bluebell/dao/redis_repo"
+	"bluebell/models"
+	"bluebell/settings"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"go.uber.org/zap"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMaxSessions       = 5
+	SessionPolicyEvictOldest = "evict_oldest"
+	SessionPolicyReject      = "reject"
+	// 最后活动时间的更新间隔，避免每个请求都写Redis
+	sessionTouchInterval = time.Minute
+	sessionIdLen         = 16
+	maxUserAgentLen      = 256
+)
+
+var (
+	ERROR_SESSION_REVOKED   = errors.New("session has been revoked or expired")
+	ERROR_TOO_MANY_SESSIONS = errors.New("too many active sessions")
+	ERROR_SESSION_NOT_FOUND = errors.New("session not found")
+)
+
+func maxSessions() (int, string) {
+	max, policy := DefaultMaxSessions, SessionPolicyEvictOldest
+	if cfg := settings.GlobalSettings.SessionCfg; cfg != nil {
+		if cfg.MaxSessions > 0 {
+			max = cfg.MaxSessions
+		}
+		if cfg.Policy == SessionPolicyReject {
+			policy = SessionPolicyReject
+		}
+	}
+	return max, policy
+}
+
+// deviceName 根据User-Agent生成一个便于识别的设备名称，例如 Chrome on Windows
+func deviceName(ua string) string {
+	lower := strings.ToLower(ua)
+	find := func(candidates [][2]string) string {
+		for _, c := range candidates {
+			if strings.Contains(lower, c[0]) {
+				return c[1]
+			}
+		}
+		return ""
+	}
+	// 顺序有意义，例如Edge和Chrome的User-Agent中都包含chrome
+	browser := find([][2]string{{"edg/", "Edge"}, {"opr/", "Opera"}, {"firefox", "Firefox"}, {"chrome", "Chrome"}, {"safari", "Safari"}, {"curl", "curl"}})
+	platform := find([][2]string{{"android", "Android"}, {"iphone", "iPhone"}, {"ipad", "iPad"}, {"windows", "Windows"}, {"mac os", "macOS"}, {"linux", "Linux"}})
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "" || platform != "":
+		return browser + platform
+	default:
+		return "Unknown device"
+	}
+}
+
+// createSession 登录成功后为当前设备创建会话，超出设备数量上限时按配置踢掉最久未活动的会话或者拒绝登录
+func createSession(userId int64, device *models.SessionDevice) (*models.Session, error) {
+	sessions, err := activeSessions(userId)
+	if err != nil {
+		return nil, err
+	}
+	max, policy := maxSessions()
+	if len(sessions) >= max {
+		if policy == SessionPolicyReject {
+			return nil, ERROR_TOO_MANY_SESSIONS
+		}
+		sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.Before(sessions[j].LastSeenAt) })
+		evicted := make([]string, 0, len(sessions)-max+1)
+		for _, s := range sessions[:len(sessions)-max+1] {
+			evicted = append(evicted, s.SessionId)
+		}
+		if err = revokeSessions(userId, evicted...); err != nil {
+			return nil, err
+		}
+	}
+
+	id := make([]byte, sessionIdLen)
+	if _, err = rand.Read(id); err != nil {
+		return nil, err
+	}
+	if device == nil {
+		device = new(models.SessionDevice)
+	}
+	ua := device.UserAgent
+	if len(ua) > maxUserAgentLen {
+		ua = ua[:maxUserAgentLen]
+	}
+	name := device.Name
+	if name == "" {
+		name = deviceName(ua)
+	}
+	now := time.Now()
+	s := &models.Session{
+		SessionId:  hex.EncodeToString(id),
+		Name:       name,
+		UserAgent:  ua,
+		IP:         device.IP,
+		CreateAt:   now,
+		LastSeenAt: now,
+		ExpireAt:   now.Add(refreshTokenExpireTime()),
+	}
+	if err = redis_repo.SaveSession(ctx, userId, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// activeSessions 获取用户未过期的会话，顺便清理已过期的会话
+func activeSessions(userId int64) ([]models.Session, error) {
+	sessions, err := redis_repo.GetSessions(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	active := sessions[:0]
+	var expired []string
+	for _, s := range sessions {
+		if s.ExpireAt.Before(now) {
+			expired = append(expired, s.SessionId)
+		} else {
+			active = append(active, s)
+		}
+	}
+	if err = redis_repo.DeleteSessions(ctx, userId, expired...); err != nil {
+		zap.L().Warn("delete expired sessions failed", zap.Int64("user_id", userId), zap.Error(err))
+	}
+	return active, nil
+}
+
+// getSession 获取token对应的会话，会话不存在或已过期时返回ERROR_SESSION_REVOKED
+func getSession(claims *MyClaims) (*models.Session, error) {
+	if claims.SessionId == "" {
+		return nil, ERROR_SESSION_REVOKED
+	}
+	s, err := redis_repo.GetSession(ctx, claims.UserId, claims.SessionId)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil || s.ExpireAt.Before(time.Now()) {
+		return nil, ERROR_SESSION_REVOKED
+	}
+	return s, nil
+}
+
+// CheckSession 校验token对应的会话依然有效，并更新会话的最后活动时间和ip
+func CheckSession(claims *MyClaims, ip string) error {
+	s, err := getSession(claims)
+	if err != nil {
+		return err
+	}
+	if time.Since(s.LastSeenAt) >= sessionTouchInterval || s.IP != ip {
+		s.LastSeenAt, s.IP = time.Now(), ip
+		ok, err := redis_repo.UpdateSession(ctx, claims.UserId, s)
+		if err != nil {
+			zap.L().Warn("update session last seen failed", zap.Int64("user_id", claims.UserId), zap.Error(err))
+		} else if !ok {
+			return ERROR_SESSION_REVOKED
+		}
+	}
+	return nil
+}
+
+// GetSessions 获取用户所有已登录的设备，最近活动的在前
+func GetSessions(userId int64, currentSessionId string) ([]models.Session, error) {
+	sessions, err := activeSessions(userId)
+	if err != nil {
+		zap.L().Error("get sessions error in logic.GetSessions()", zap.Int64("user_id", userId), zap.Error(err))
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].SessionId == currentSessionId
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+// RevokeSession 退出某个设备上的登录
+func RevokeSession(userId int64, sessionId string) error {
+	s, err := redis_repo.GetSession(ctx, userId, sessionId)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return ERROR_SESSION_NOT_FOUND
+	}
+	return revokeSessions(userId, sessionId)
+}
+
+// RevokeOtherSessions 退出除当前设备以外所有设备上的登录
+func RevokeOtherSessions(userId int64, currentSessionId string) error {
+	sessions, err := redis_repo.GetSessions(ctx, userId)
+	if err != nil {
+		return err
+	}
+	others := make([]string, 0, len(sessions))
+	for _, s := range sessions {
+		if s.SessionId != currentSessionId {
+			others = append(others, s.SessionId)
+		}
+	}
+	return revokeSessions(userId, others...)
+}
+
+// revokeSessions 删除登录会话，并把会话当前的refresh token记录为已吊销
+func revokeSessions(userId int64, sessionIds ...string) error {
+	if err := redis_repo.RevokeRefreshTokens(ctx, refreshTokenExpireTime(), sessionIds...); err != nil {
+		return err
+	}
+	return redis_repo.DeleteSessions(ctx, userId, sessionIds...)
+}
@@ -0,0 +1,140 @@
+package logic
+
+import (
+	"bluebell/dao/redis_repo"
+	"bluebell/message_queue"
+	"bluebell/pkg/base62"
+	"bluebell/settings"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+// 分享码的格式为 base62(帖子id)[-base62(分享者id)]-签名
+const (
+	shareCodeSeparator = "-"
+	shareSignatureLen  = 6 // 签名截取的字节数
+
+	ShareVisitWindow = 24 * time.Hour // 同一访问者在这段时间内重复访问分享链接只统计一次
+)
+
+var (
+	ERROR_INVALID_SHARE_CODE      = errors.New("invalid share code")
+	ERROR_SHARE_SECRET_NOT_CONFIG = errors.New("share secret is not configured")
+)
+
+// shareSecret 分享链接会长期公开传播，必须使用单独配置的固定密钥，不能跟随token签名密钥轮换
+func shareSecret() ([]byte, error) {
+	if cfg := settings.GlobalSettings.ShareCfg; cfg != nil && cfg.Secret != "" {
+		return []byte(cfg.Secret), nil
+	}
+	return nil, ERROR_SHARE_SECRET_NOT_CONFIG
+}
+
+// CheckShareSecret 启动时检查是否配置了分享链接的签名密钥
+func CheckShareSecret() error {
+	_, err := shareSecret()
+	return err
+}
+
+func signShare(payload string) (string, error) {
+	secret, err := shareSecret()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	sum := mac.Sum(nil)
+	var buf [8]byte
+	copy(buf[8-shareSignatureLen:], sum[:shareSignatureLen])
+	return base62.Encode(binary.BigEndian.Uint64(buf[:])), nil
+}
+
+// GenShareCode 生成带签名的分享码，sharerId为0表示匿名分享
+func GenShareCode(postId, sharerId int64) (string, error) {
+	payload := base62.Encode(uint64(postId))
+	if sharerId > 0 {
+		payload += shareCodeSeparator + base62.Encode(uint64(sharerId))
+	}
+	sig, err := signShare(payload)
+	if err != nil {
+		return "", err
+	}
+	return payload + shareCodeSeparator + sig, nil
+}
+
+// ParseShareCode 校验分享码的签名，并解析出帖子id和分享者id
+func ParseShareCode(code string) (postId, sharerId int64, err error) {
+	idx := strings.LastIndex(code, shareCodeSeparator)
+	if idx <= 0 {
+		return 0, 0, ERROR_INVALID_SHARE_CODE
+	}
+	payload, sig := code[:idx], code[idx+1:]
+	expected, err := signShare(payload)
+	if err != nil {
+		zap.L().Error("sign share code failed", zap.Error(err))
+		return 0, 0, err
+	}
+	if !hmac.Equal([]byte(sig), []byte(expected)) {
+		return 0, 0, ERROR_INVALID_SHARE_CODE
+	}
+	parts := strings.Split(payload, shareCodeSeparator)
+	if len(parts) > 2 {
+		return 0, 0, ERROR_INVALID_SHARE_CODE
+	}
+	ids := make([]int64, 2)
+	for i, part := range parts {
+		n, err := base62.Decode(part)
+		if err != nil || int64(n) <= 0 {
+			return 0, 0, ERROR_INVALID_SHARE_CODE
+		}
+		ids[i] = int64(n)
+	}
+	return ids[0], ids[1], nil
+}
+
+// GetShareLink 生成帖子的分享短链接
+func GetShareLink(postId, sharerId int64) (string, error) {
+	if _, err := GetPostById(postId); err != nil {
+		return "", err
+	}
+	code, err := GenShareCode(postId, sharerId)
+	if err != nil {
+		zap.L().Error("generate share code failed", zap.Int64("post_id", postId), zap.Error(err))
+		return "", err
+	}
+	return AbsoluteURL("/s/" + code), nil
+}
+
+// ResolveShareLink 解析分享码，记录一次分享访问，返回跳转的地址，visitor标识访问者，用于去重
+func ResolveShareLink(code, visitor string) (string, error) {
+	postId, sharerId, err := ParseShareCode(code)
+	if err != nil {
+		return "", err
+	}
+	if _, err = GetPostById(postId); err != nil {
+		return "", err
+	}
+	// 分享统计失败不影响跳转
+	counted, err := redis_repo.AddPostShareNum(postId, sharerId, visitor, ShareVisitWindow)
+	if err != nil {
+		zap.L().Error("add post share num in redis failed", zap.Int64("post_id", postId), zap.Error(err))
+	} else if counted {
+		if err = message_queue.SendPostShareEvent(ctx, message_queue.PostShareEvent{SharerId: sharerId, PostId: postId}); err != nil {
+			zap.L().Error("send post share event failed", zap.Int64("post_id", postId), zap.Error(err))
+		}
+	}
+	return GetPostLink(postId), nil
+}
+
+func GetPostShareNumById(postId int64) int64 {
+	result, err := redis_repo.GetPostShareNumById(postId)
+	if err != nil {
+		zap.L().Error("get post share num failed", zap.Int64("post_id", postId), zap.Error(err))
+	}
+	return int64(result)
+}
@@ -0,0 +1,210 @@
+package logic
+
+import (
+	"bluebell/dao/redis_repo"
+	"bluebell/models"
+	"bluebell/pkg/jwtkeys"
+	"bluebell/settings"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	DefaultAccessTokenExpireTime  = 15     // 分钟
+	DefaultRefreshTokenExpireTime = 24 * 7 // 小时
+	tokenIdLen                    = 16
+	tokenIssuer                   = "bluebell-project"
+	// access token和refresh token使用同一个密钥签名，通过aud区分，不能混用
+	AccessTokenAudience  = "bluebell-access"
+	RefreshTokenAudience = "bluebell-refresh"
+)
+
+type MyClaims struct {
+	UserId   int64  `json:"user_id"`
+	Username string `json:"username"`
+	// 签发token的登录会话，会话被吊销后token随之失效
+	SessionId string `json:"sid"`
+	jwt.StandardClaims
+}
+
+// RefreshClaims refresh token绑定用户和登录会话，Id为每次签发都不同的jti
+// 同一个会话中轮换产生的refresh token属于同一个家族
+type RefreshClaims struct {
+	UserId    int64  `json:"user_id"`
+	SessionId string `json:"sid"`
+	jwt.StandardClaims
+}
+
+var INVALID_TOKEN = errors.New("invalid token")
+var ERROR_REFRESH_TOKEN_REUSED = errors.New("refresh token has already been used")
+
+func accessTokenExpireTime() time.Duration {
+	if cfg := settings.GlobalSettings.TokenCfg; cfg != nil && cfg.AccessExpireTime > 0 {
+		return time.Duration(cfg.AccessExpireTime) * time.Minute
+	}
+	return DefaultAccessTokenExpireTime * time.Minute
+}
+
+func refreshTokenExpireTime() time.Duration {
+	if cfg := settings.GlobalSettings.TokenCfg; cfg != nil && cfg.RefreshExpireTime > 0 {
+		return time.Duration(cfg.RefreshExpireTime) * time.Hour
+	}
+	return DefaultRefreshTokenExpireTime * time.Hour
+}
+
+func newTokenId() (string, error) {
+	id := make([]byte, tokenIdLen)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func GenAccessToken(user *models.User, sessionId string) (string, error) {
+	now := time.Now()
+	c := MyClaims{
+		user.UserId,
+		user.Username,
+		sessionId,
+		jwt.StandardClaims{
+			Audience:  AccessTokenAudience,
+			ExpiresAt: now.Add(accessTokenExpireTime()).Unix(),
+			IssuedAt:  now.Unix(),
+			Issuer:    tokenIssuer,
+		},
+	}
+	return jwtkeys.Sign(c)
+}
+
+// signRefreshToken 签发一个新的refresh token，返回token以及它的jti
+func signRefreshToken(userId int64, sessionId string) (string, string, error) {
+	jti, err := newTokenId()
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now()
+	c := RefreshClaims{
+		userId,
+		sessionId,
+		jwt.StandardClaims{
+			Id:        jti,
+			Audience:  RefreshTokenAudience,
+			ExpiresAt: now.Add(refreshTokenExpireTime()).Unix(),
+			IssuedAt:  now.Unix(),
+			Issuer:    tokenIssuer,
+		},
+	}
+	token, err := jwtkeys.Sign(c)
+	return token, jti, err
+}
+
+// GenRefreshToken 为新的登录会话签发第一个refresh token
+func GenRefreshToken(userId int64, sessionId string) (string, error) {
+	token, jti, err := signRefreshToken(userId, sessionId)
+	if err != nil {
+		return "", err
+	}
+	if err = redis_repo.SetRefreshToken(ctx, sessionId, jti, refreshTokenExpireTime()); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ParseToken 解析并校验access token
+func ParseToken(tokenString string) (*MyClaims, error) {
+	c := new(MyClaims)
+	token, err := jwt.ParseWithClaims(tokenString, c, jwtkeys.Keyfunc)
+	if err != nil {
+		zap.L().Error("parse token failed", zap.Error(err))
+		return nil, err
+	}
+	if !token.Valid {
+		zap.L().Error("invalid token")
+		return nil, INVALID_TOKEN
+	}
+	// 只接受access token，refresh token的有效期更长，不能用来访问接口
+	if c.Audience != AccessTokenAudience || c.Id != "" {
+		zap.L().Warn("token is not an access token", zap.String("aud", c.Audience))
+		return nil, INVALID_TOKEN
+	}
+	return c, nil
+}
+
+// RefreshToken 使用refresh token换取新的access token和refresh token，旧的refresh token立即失效
+// 已经使用过的refresh token再次出现说明可能被盗用，此时吊销整个会话，所有设备上属于该家族的token都不能再使用
+func RefreshToken(refreshToken string) (res gin.H, err error) {
+	claims := new(RefreshClaims)
+	if _, err = jwt.ParseWithClaims(refreshToken, claims, jwtkeys.Keyfunc); err != nil || claims.Audience != RefreshTokenAudience || claims.Id == "" || claims.SessionId == "" {
+		return nil, INVALID_TOKEN
+	}
+
+	revoked, err := redis_repo.IsTokenIdRevoked(ctx, claims.Id)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, revokeTokenFamily(claims)
+	}
+	session, err := getSession(&MyClaims{UserId: claims.UserId, SessionId: claims.SessionId})
+	if err != nil {
+		if errors.Is(err, ERROR_SESSION_REVOKED) {
+			return nil, INVALID_TOKEN
+		}
+		return nil, err
+	}
+
+	newRefreshToken, jti, err := signRefreshToken(claims.UserId, claims.SessionId)
+	if err != nil {
+		zap.L().Error("gen refresh token failed", zap.Error(err))
+		return nil, err
+	}
+	result, err := redis_repo.RotateRefreshToken(ctx, claims.SessionId, claims.Id, jti,
+		refreshTokenExpireTime(), time.Until(time.Unix(claims.ExpiresAt, 0)))
+	if err != nil {
+		zap.L().Error("rotate refresh token failed", zap.Error(err))
+		return nil, err
+	}
+	switch result {
+	case redis_repo.RefreshTokenMissing:
+		return nil, INVALID_TOKEN
+	case redis_repo.RefreshTokenReused:
+		return nil, revokeTokenFamily(claims)
+	}
+	// 刷新以后会话的有效期随新的refresh token延长
+	session.ExpireAt = time.Now().Add(refreshTokenExpireTime())
+	if _, err = redis_repo.UpdateSession(ctx, claims.UserId, session); err != nil {
+		zap.L().Warn("extend session expiration failed", zap.Int64("user_id", claims.UserId), zap.Error(err))
+	}
+
+	username, _ := GetUsernameById(claims.UserId)
+	accessToken, err := GenAccessToken(&models.User{UserId: claims.UserId, Username: username}, claims.SessionId)
+	if err != nil {
+		zap.L().Error("gen access token failed", zap.Error(err))
+		return nil, err
+	}
+	return gin.H{
+		"access_token":  accessToken,
+		"refresh_token": newRefreshToken,
+	}, nil
+}
+
+// revokeTokenFamily 检测到refresh token被重复使用时吊销它所属的会话
+func revokeTokenFamily(claims *RefreshClaims) error {
+	zap.L().Warn("refresh token reuse detected, revoking session",
+		zap.Int64("user_id", claims.UserId), zap.String("session_id", claims.SessionId), zap.String("jti", claims.Id))
+	if err := revokeSessions(claims.UserId, claims.SessionId); err != nil {
+		zap.L().Error("revoke session of reused refresh token failed", zap.Int64("user_id", claims.UserId), zap.Error(err))
+		return err
+	}
+	return ERROR_REFRESH_TOKEN_REUSED
+}
+
+// GetJWKS 获取用于校验token的公钥集合，供其他服务校验bluebell签发的token
+func GetJWKS() jwtkeys.JWKSet {
+	return jwtkeys.PublicKeys()
+}
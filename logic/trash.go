@@ -0,0 +1,231 @@
+package logic
+
+import (
+	"bluebell/cache"
+	"bluebell/dao/mysql_repo"
+	"bluebell/dao/redis_repo"
+	"bluebell/models"
+	"bluebell/pkg/reputation"
+	"bluebell/pkg/snowflake"
+	"bluebell/pkg/sqls"
+	"bluebell/settings"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTrashRetentionDays = 30
+	DefaultTrashPurgeInterval = 60 // 分钟
+	TrashTitleLen             = 50
+)
+
+var (
+	ERROR_TRASH_NOT_EXISTS        = errors.New("trash not exists")
+	ERROR_TRASH_EXPIRED           = errors.New("trash has expired")
+	ERROR_ILLEGAL_TRASH_OPERATION = errors.New("can not operate other's trash")
+	ERROR_TRASH_ORPHANED          = fmt.Errorf("%w: the post of the comment has been purged", ERROR_TRASH_NOT_EXISTS)
+)
+
+func trashRetention() time.Duration {
+	days := DefaultTrashRetentionDays
+	if cfg := settings.GlobalSettings.TrashCfg; cfg != nil && cfg.RetentionDays > 0 {
+		days = cfg.RetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// moveToTrash 帖子/评论软删除以后，写入一条回收站记录
+func moveToTrash(t *models.Trash) {
+	t.TrashId = snowflake.GenID()
+	t.ExpireAt = t.DeletedAt.Add(trashRetention())
+	if err := mysql_repo.TrashRepository.Create(sqls.DB(), t); err != nil {
+		zap.L().Error("save trash record failed", zap.Int64("target_id", t.TargetId), zap.Error(err))
+	}
+	invalidateUserStats(t.UserId)
+}
+
+// excerpt 截取前n个字符，作为回收站中评论的标题
+func excerpt(content string, n int) string {
+	runes := []rune(content)
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+	return content
+}
+
+// GetTrashList 获取回收站列表，普通用户只能看到自己的内容，版主可以查看所有用户的内容
+func GetTrashList(userId int64, param *models.ParamTrashList) (*models.ResponseTrashList, error) {
+	cnd := sqls.NewCnd().Where("expire_at > ?", time.Now()).Desc("deleted_at").Page(param.Page, param.Size)
+	if !(param.All && IsModerator(userId)) {
+		cnd.Where("user_id = ?", userId)
+	}
+	if param.Type != 0 {
+		cnd.Where("type = ?", param.Type)
+	}
+	list, paging := mysql_repo.TrashRepository.FindPageByCnd(sqls.DB(), cnd)
+	if list == nil {
+		list = []models.Trash{}
+	}
+	return &models.ResponseTrashList{Total: paging.Total, List: list}, nil
+}
+
+// RestoreTrash 从回收站中恢复帖子/评论
+func RestoreTrash(userId, trashId int64) (err error) {
+	t := mysql_repo.TrashRepository.Get(sqls.DB(), trashId)
+	if t == nil {
+		return ERROR_TRASH_NOT_EXISTS
+	}
+	// 作者只能恢复自己删除的内容，被版主删除的内容只能由版主恢复
+	if !IsModerator(userId) && (t.UserId != userId || t.OperatorId != userId) {
+		zap.L().Warn("only author or moderator can restore trash", zap.Int64("user_id", userId), zap.Int64("trash_id", trashId))
+		return ERROR_ILLEGAL_TRASH_OPERATION
+	}
+	if t.ExpireAt.Before(time.Now()) {
+		return ERROR_TRASH_EXPIRED
+	}
+
+	switch t.Type {
+	case PostType:
+		err = restorePost(t)
+	case CommentType:
+		err = restoreComment(t)
+	default:
+		err = fmt.Errorf("unknown trash type %d", t.Type)
+	}
+	if errors.Is(err, ERROR_TRASH_ORPHANED) {
+		// 评论所在的帖子已经被彻底删除，回收站记录不再有效
+		if e := mysql_repo.TrashRepository.Delete(sqls.DB(), trashId); e != nil {
+			zap.L().Error("delete orphaned trash failed", zap.Int64("trash_id", trashId), zap.Error(e))
+		}
+		return err
+	}
+	if err != nil {
+		zap.L().Error("restore trash failed", zap.Int64("trash_id", trashId), zap.Error(err))
+		return err
+	}
+	invalidateUserStats(t.UserId)
+	if t.OperatorId != t.UserId {
+		changeReputation(t.UserId, reputation.ContentRemoved, -1)
+	}
+	return mysql_repo.TrashRepository.Delete(sqls.DB(), trashId)
+}
+
+func restorePost(t *models.Trash) (err error) {
+	post := mysql_repo.PostRepository.GetDeleted(sqls.DB(), t.TargetId)
+	if post == nil {
+		return ERROR_POST_NOT_EXISTS
+	}
+	if err = mysql_repo.PostRepository.RestorePostInfo(sqls.DB(), post.PostId, t.DeletedAt); err != nil {
+		zap.L().Error("restore post in mysql failed", zap.Error(err))
+		return err
+	}
+	cache.PostCache.Invalidate(post.PostId)
+	if err = redis_repo.RestorePost(post); err != nil {
+		zap.L().Error("restore post in redis failed", zap.Error(err))
+		return err
+	}
+	// 和帖子一起被删除的评论也被恢复了
+	comments := mysql_repo.CommentRepository.Find(sqls.DB(), sqls.NewCnd().Where("post_id = ?", post.PostId))
+	return restoreCommentsInRedis(post.PostId, comments)
+}
+
+func restoreComment(t *models.Trash) (err error) {
+	if _, err = GetPostById(t.PostId); err != nil {
+		if mysql_repo.PostRepository.GetDeleted(sqls.DB(), t.PostId) == nil {
+			return ERROR_TRASH_ORPHANED
+		}
+		// 帖子已经被删除，需要先恢复帖子
+		return err
+	}
+	ids := strings.Split(t.RelatedIds, ",")
+	deleted := mysql_repo.CommentRepository.FindDeleted(sqls.DB(), ids)
+	if len(deleted) == 0 {
+		return ERROR_WRONG_COMMENT
+	}
+	for _, comment := range deleted {
+		if comment.CommentId == t.TargetId && comment.ParentCommentId != 0 {
+			// 根评论已经被删除，需要先恢复根评论
+			if _, err = GetCommentById(comment.RootCommentId); err != nil {
+				return err
+			}
+		}
+	}
+	if err = mysql_repo.CommentRepository.RestoreCommentInfo(sqls.DB(), ids, t.DeletedAt); err != nil {
+		zap.L().Error("restore comments in mysql failed", zap.Error(err))
+		return err
+	}
+	for _, comment := range deleted {
+		cache.CommentCache.Invalidate(comment.CommentId)
+	}
+	return restoreCommentsInRedis(t.PostId, deleted)
+}
+
+// restoreCommentsInRedis 恢复评论在Redis中的time/score记录，并重新统计帖子下的评论总数
+// 评论树保存在MySQL中，恢复评论以后不需要重建
+func restoreCommentsInRedis(postId int64, restored []models.Comment) error {
+	commentNum := mysql_repo.CommentRepository.Count(sqls.DB(), sqls.NewCnd().Where("post_id = ?", postId))
+	if err := redis_repo.RestoreComments(postId, restored, commentNum); err != nil {
+		zap.L().Error("restore comments in redis failed", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// PurgeExpiredTrash 彻底删除回收站中已经过期的内容，以及相关的点赞/收藏记录
+func PurgeExpiredTrash() {
+	list := mysql_repo.TrashRepository.Find(sqls.DB(), sqls.NewCnd().Where("expire_at <= ?", time.Now()))
+	for i := range list {
+		if err := purgeTrash(&list[i]); err != nil {
+			zap.L().Error("purge trash failed", zap.Int64("trash_id", list[i].TrashId), zap.Error(err))
+		}
+	}
+}
+
+func purgeTrash(t *models.Trash) (err error) {
+	switch t.Type {
+	case PostType:
+		commentIds := mysql_repo.CommentRepository.FindIdsByPostIdUnscoped(sqls.DB(), t.TargetId)
+		if err = mysql_repo.PostRepository.PurgePostInfo(sqls.DB(), t.TargetId); err != nil {
+			return err
+		}
+		if err = redis_repo.PurgePostInfo(t.TargetId); err != nil {
+			return err
+		}
+		ids := make([]string, len(commentIds))
+		for i, id := range commentIds {
+			ids[i] = strconv.FormatInt(id, 10)
+		}
+		if len(ids) > 0 {
+			if err = redis_repo.PurgeCommentInfo(ids); err != nil {
+				return err
+			}
+		}
+	case CommentType:
+		ids := strings.Split(t.RelatedIds, ",")
+		if err = mysql_repo.CommentRepository.PurgeCommentInfo(sqls.DB(), ids); err != nil {
+			return err
+		}
+		if err = redis_repo.PurgeCommentInfo(ids); err != nil {
+			return err
+		}
+	}
+	return mysql_repo.TrashRepository.Delete(sqls.DB(), t.TrashId)
+}
+
+// StartTrashPurge 定期清理回收站中过期的内容
+func StartTrashPurge() {
+	minutes := DefaultTrashPurgeInterval
+	if cfg := settings.GlobalSettings.TrashCfg; cfg != nil && cfg.PurgeInterval > 0 {
+		minutes = cfg.PurgeInterval
+	}
+	ticker := time.NewTicker(time.Duration(minutes) * time.Minute)
+	go func() {
+		for range ticker.C {
+			PurgeExpiredTrash()
+		}
+	}()
+}
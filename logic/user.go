@@ -16,9 +16,9 @@ import (
 	"fmt"
 	"github.com/coocood/freecache"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 	"go.uber.org/zap"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -28,6 +28,7 @@ var ERROR_EMAIL_VERIFIED_BEFORE = errors.New("email verified before")
 var ERROR_DUPLICATED_EMAIL = errors.New("this email has been occupied")
 var ERROR_DUPLICATED_USERNAME = errors.New("this username has been occupied")
 var ERROR_EMPTY_USERNAME = errors.New("username can not be empty")
+var ERROR_RESERVED_USERNAME = errors.New("this username is reserved")
 var ERROR_WRONG_PASSWORD = errors.New("username or password wrong")
 var ERROR_WRONG_USER = errors.New("no such user exists")
 
@@ -36,12 +37,15 @@ const (
 	EMAIL_VERIFIED     = true
 )
 const (
-	AccessTokenExpireDuration  = time.Hour * 200000
-	RefreshTokenExpireDuration = time.Hour * 24 * 7
 	//LoginTokenExpireDuration    = time.Hour * 24 * 30 * 12
 	EMAIL_VERIFICATION_CODE_LEN = 6
 )
 
+// isReservedUsername 注销账号的用户名前缀保留给系统使用，MySQL比较用户名时不区分大小写
+func isReservedUsername(name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), models.DeletedUsernamePrefix)
+}
+
 var followService = newFollowService(1024*1024*1024, 100)
 
 type FollowService struct {
@@ -159,6 +163,10 @@ func SignUp(user *models.ParamUserSignUp) (err error) {
 		zap.L().Error("username can not be empty", zap.Error(ERROR_EMPTY_USERNAME))
 		return ERROR_EMPTY_USERNAME
 	}
+	if isReservedUsername(user.Username) {
+		zap.L().Error("username is reserved", zap.String("username", user.Username))
+		return ERROR_RESERVED_USERNAME
+	}
 	if err = validation.IsPassword(user.Password); err != nil {
 		zap.L().Error("password error", zap.Error(err))
 		return err
@@ -177,11 +185,16 @@ func SignUp(user *models.ParamUserSignUp) (err error) {
 		}
 	}
 
+	hashed, err := encrypt.Hash(user.Password)
+	if err != nil {
+		zap.L().Error("hash password failed", zap.Error(err))
+		return err
+	}
 	// 然后需要构建一个新的user结构体，存入数据库
 	u := &models.User{
 		UserId:   snowflake.GenID(),
 		Username: user.Username,
-		Password: encrypt.Encrypt(user.Password),
+		Password: hashed,
 		Email:    user.Email,
 	}
 	// 存入数据库
@@ -193,28 +206,51 @@ func SignUp(user *models.ParamUserSignUp) (err error) {
 }
 
 func SignInWithPassword(user *models.User) (err error) {
-	// 可能传进来的是email，或者是username
+	return signInWithPassword(user, findUserByLoginName(user.Username))
+}
+
+// findUserByLoginName 登录名可能是email，或者是username，找不到时返回nil
+func findUserByLoginName(name string) *models.User {
 	var u *models.User = nil
 	// 先检查是否为email
-	if err = validation.IsEmail(user.Username); err == nil {
-		u = mysql_repo.UserRepository.GetByEmail(sqls.DB(), user.Username)
+	if validation.IsEmail(name) == nil {
+		u = mysql_repo.UserRepository.GetByEmail(sqls.DB(), name)
 	}
 	// 按照email找不到的话再根据用户名
-	if u == nil {
-		if err = validation.IsUsername(user.Username); err == nil {
-			u = mysql_repo.UserRepository.GetByUsername(sqls.DB(), user.Username)
-		}
+	if u == nil && validation.IsUsername(name) == nil {
+		u = mysql_repo.UserRepository.GetByUsername(sqls.DB(), name)
 	}
+	return u
+}
 
-	if !validation.CheckPassword(user.Password, u.Password) {
-		zap.L().Error("check user failed", zap.Error(err))
+// signInWithPassword 校验登录名对应的用户u的密码，u为nil表示账号不存在
+func signInWithPassword(user, u *models.User) error {
+	if !checkUserPassword(u, user.Password) {
+		zap.L().Warn("check user password failed", zap.String("login", user.Username))
 		return ERROR_WRONG_PASSWORD
 	}
+	// 旧格式或参数已经变化的哈希值，在登录成功后使用明文密码重新计算
+	if encrypt.NeedsRehash(u.Password) {
+		rehashPassword(u.UserId, user.Password)
+	}
 	user.UserId = u.UserId
 	user.Username = u.Username
 	user.Email = u.Email
 	return nil
 }
+
+// rehashPassword 升级用户密码的哈希值，失败只记录日志，下次登录时会再次尝试
+func rehashPassword(userId int64, password string) {
+	hashed, err := encrypt.Hash(password)
+	if err != nil {
+		zap.L().Error("rehash password failed", zap.Int64("user_id", userId), zap.Error(err))
+		return
+	}
+	if err = mysql_repo.UserRepository.UpdateColumn(sqls.DB(), userId, "password", hashed); err != nil {
+		zap.L().Error("update rehashed password failed", zap.Int64("user_id", userId), zap.Error(err))
+	}
+}
+
 func SignInWithEmailVerificationCode(user *models.User) (err error) {
 	// 需要去redis中查询验证码是否存在
 	code, err := redis_repo.CheckValidEmailVerificationCode(ctx, user)
@@ -231,103 +267,27 @@ func SignInWithEmailVerificationCode(user *models.User) (err error) {
 	return nil
 }
 
-type MyClaims struct {
-	UserId   int64  `json:"user_id"`
-	Username string `json:"username"`
-	jwt.StandardClaims
-}
-
-var MySecret = []byte("Hello Bluebell!")
-var INVALID_TOKEN = errors.New("invalid token")
-
-func GenAccessToken(user *models.User) (string, error) {
-	c := MyClaims{
-		user.UserId,
-		user.Username,
-		jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(AccessTokenExpireDuration).Unix(),
-			Issuer:    "bluebell-project",
-		},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, c)
-	return token.SignedString(MySecret)
-}
-
-func GenRefreshToken() (string, error) {
-	c := jwt.StandardClaims{
-		ExpiresAt: time.Now().Add(RefreshTokenExpireDuration).Unix(),
-		Issuer:    "bluebell-project",
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, c)
-	return token.SignedString(MySecret)
-}
-
-func ParseToken(tokenString string) (*MyClaims, error) {
-	c := new(MyClaims)
-	token, err := jwt.ParseWithClaims(tokenString, c, func(token *jwt.Token) (interface{}, error) {
-		return MySecret, nil
-	})
-	if err != nil {
-		zap.L().Error("parse token failed", zap.Error(err))
-		return nil, err
-	}
-	if !token.Valid {
-		zap.L().Error("invalid token")
-		return nil, INVALID_TOKEN
-	}
-	return c, nil
-}
-
-func RefreshToken(accessToken string, refreshToken string) (newAccessToken string, err error) {
-	// 如果refresh-token无效，直接返回错误
-	_, err = jwt.Parse(refreshToken, func(token *jwt.Token) (interface{}, error) {
-		return MySecret, nil
-	})
-	if err != nil {
-		return "", err
-	}
-	// 从旧access token解析claim数据
-	claim := new(MyClaims)
-	_, err = jwt.ParseWithClaims(accessToken, claim, func(token *jwt.Token) (interface{}, error) {
-		return MySecret, nil
-	})
-	// 如果access-token有效，不做处理，此时返回一个空
-	if err != nil {
-		v, _ := err.(*jwt.ValidationError)
-
-		// 当错误类型是过期错误，并且refresh token没有过期，创建一个新的access token
-		if v.Errors == jwt.ValidationErrorExpired {
-			u := models.User{UserId: claim.UserId, Username: claim.Username}
-			if newAccessToken, err = GenAccessToken(&u); err != nil {
-				zap.L().Error("gen access token failed", zap.Error(err))
-				return "", err
-			}
-		}
+func GetUsernameById(userId int64) (username string, err error) {
+	u := cache.UserCache.Get(userId)
+	if u == nil {
+		return "", ERROR_WRONG_USER
 	}
-	// 将有效的access token记录到redis数据库中
-	err = redis_repo.SaveUserId2AccessToken(newAccessToken, claim.UserId)
-	if err != nil {
-		zap.L().Error("save new access token to redis_repo failed", zap.Error(err))
-		return newAccessToken, err
+	if u.Status == models.UserStatusDeleted {
+		return models.DeletedUsername, nil
 	}
-
-	return newAccessToken, err
+	return u.Username, nil
 }
 
-func CheckMoreThanOneUser(userId int64, accessToken string) (bool, error) {
-	err := redis_repo.CheckUserId2AccessToken(userId, accessToken)
-	if err != nil {
-		return true, err
-	}
-	return false, nil
+// IsModerator 判断用户是否为版主或管理员
+func IsModerator(userId int64) bool {
+	u := cache.UserCache.Get(userId)
+	return u != nil && u.Role >= models.RoleModerator
 }
 
-func GetUsernameById(userId int64) (username string, err error) {
+// IsAdmin 判断用户是否为管理员
+func IsAdmin(userId int64) bool {
 	u := cache.UserCache.Get(userId)
-	if u == nil {
-		return "", ERROR_WRONG_USER
-	}
-	return u.Username, nil
+	return u != nil && u.Role >= models.RoleAdmin
 }
 
 func GetEmailById(userId int64) (email string, err error) {
@@ -439,7 +399,7 @@ func VerifyEmail(info string) error {
 //	return err
 //}
 
-func SignInPostProcess(u *models.User) (res gin.H, err error) {
+func SignInPostProcess(u *models.User, device *models.SessionDevice) (res gin.H, err error) {
 	if u.UserId == 0 {
 		user := mysql_repo.UserRepository.GetByEmail(sqls.DB(), u.Email)
 		if user == nil {
@@ -447,27 +407,39 @@ func SignInPostProcess(u *models.User) (res gin.H, err error) {
 			return res, ERROR_WRONG_USER
 		}
 		u.UserId = user.UserId
+		u.Username = user.Username
 	}
 
-	// 生成有效的token并返回给客户端
-	access_token, err := GenAccessToken(u)
+	// 开启了两步验证或者角色要求两步验证时，先返回mfa token，验证码校验通过后再签发token
+	if need, enrolled := needMfa(u.UserId); need {
+		return beginMfaLogin(u.UserId, enrolled, device)
+	}
+	return issueTokens(u, device)
+}
+
+// issueTokens 为当前设备创建登录会话并签发access token和refresh token
+func issueTokens(u *models.User, device *models.SessionDevice) (res gin.H, err error) {
+	// 为当前设备创建登录会话，每个设备独立登录，互不影响
+	session, err := createSession(u.UserId, device)
 	if err != nil {
-		zap.L().Error("user sign in jwt gen access token error in controller.SignInWithPassword()...", zap.Error(err))
+		zap.L().Error("user sign in create session error in logic.issueTokens()...", zap.Error(err))
+		return
 	}
-	refresh_token, err := GenRefreshToken()
+	// 生成有效的token并返回给客户端
+	access_token, err := GenAccessToken(u, session.SessionId)
 	if err != nil {
-		zap.L().Error("user sign in jwt gen refresh token error in controller.SignInWithPassword()...", zap.Error(err))
+		zap.L().Error("user sign in jwt gen access token error in controller.SignInWithPassword()...", zap.Error(err))
 		return
 	}
-	// 将access token存入redis数据库，实现每次只能有一个用户访问特定资源的目的
-	err = redis_repo.SaveUserId2AccessToken(access_token, u.UserId)
+	refresh_token, err := GenRefreshToken(u.UserId, session.SessionId)
 	if err != nil {
-		zap.L().Error("user sign in jwt save access token to redis_repo error in controller.SignInWithPassword()...", zap.Error(err))
+		zap.L().Error("user sign in jwt gen refresh token error in controller.SignInWithPassword()...", zap.Error(err))
 		return
 	}
 	res = gin.H{
 		"access_token":  access_token,
 		"refresh_token": refresh_token,
+		"session_id":    session.SessionId,
 	}
 
 	// 存入用户登录凭据，在一定时间内，下次就不用再用验证码登录
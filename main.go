@@ -18,7 +18,10 @@ import (
 	"bluebell/dao/mysql_repo"
 	"bluebell/dao/redis_repo"
 	"bluebell/logger"
+	"bluebell/logic"
 	"bluebell/message_queue"
+	"bluebell/pkg/encrypt"
+	"bluebell/pkg/jwtkeys"
 	"bluebell/pkg/snowflake"
 	"bluebell/routes"
 	"bluebell/settings"
@@ -57,6 +60,21 @@ func main() {
 		settings.GlobalSettings.AppCfg.MachineID); err != nil {
 		fmt.Printf("init snowflake failed, err:%v\n", err)
 	}
+	// 初始化密码哈希参数
+	if err := encrypt.Init(settings.GlobalSettings.PasswordCfg); err != nil {
+		fmt.Printf("init password hash failed, err:%v\n", err)
+		return
+	}
+	// 加载token签名密钥
+	if err := jwtkeys.Init(settings.GlobalSettings.TokenCfg); err != nil {
+		fmt.Printf("init jwt keys failed, err:%v\n", err)
+		return
+	}
+	// 分享链接的签名密钥需要单独配置
+	if err := logic.CheckShareSecret(); err != nil {
+		fmt.Printf("check share secret failed, err:%v\n", err)
+		return
+	}
 	//4.初始化redis
 	if err := redis_repo.Init(settings.GlobalSettings.RedisCfg); err != nil {
 		fmt.Printf("init settings failed, err:%v\n", err)
@@ -67,9 +85,17 @@ func main() {
 	//5.注册路由
 	r := routes.SetupRouter(settings.GlobalSettings.AppCfg.Mode)
 
+	// 根据事件检查并颁发徽章，消费者启动前注册
+	logic.StartBadgeEngine()
 	//7.启用消息队列
 	message_queue.InitMQ(settings.GlobalSettings.MQCfg)
 	fmt.Println("message queue init successfully")
+	// 定期清理回收站中过期的内容
+	logic.StartTrashPurge()
+	// 定期匿名化冷静期结束的注销账号
+	logic.StartAccountPurge()
+	// 定期发送通知邮件摘要
+	logic.StartNotificationDigest()
 	//7.启动服务（优雅关机
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", settings.GlobalSettings.AppCfg.Port),
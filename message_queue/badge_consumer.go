@@ -0,0 +1,141 @@
+package message_queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// BadgeEvaluator 检查徽章规则，规则和颁发后的通知在logic中实现，由logic在启动徽章引擎时注册
+// 发布事件由BadgeProcessor检查；点赞事件在点赞的消费者更新统计数据以后检查，保证读到的是更新后的获赞总数
+type BadgeEvaluator interface {
+	// RecordActivity 记录用户在t时活跃，并检查连续活跃相关的徽章
+	RecordActivity(userId int64, t time.Time) error
+	// EvaluateStats 检查发帖数、评论数、获赞总数相关的徽章
+	EvaluateStats(userId int64) error
+}
+
+var badgeEvaluator BadgeEvaluator
+
+// SetBadgeEvaluator 注册徽章规则的检查，需要在InitMQ之前调用，没有注册时不检查徽章
+func SetBadgeEvaluator(e BadgeEvaluator) {
+	badgeEvaluator = e
+}
+
+// recordBadgeActivity 徽章检查失败只记录日志，会在用户的下一个事件到来时重新检查
+func recordBadgeActivity(userId int64, timestamp string) {
+	if badgeEvaluator == nil {
+		return
+	}
+	if err := badgeEvaluator.RecordActivity(userId, eventTime(timestamp)); err != nil {
+		zap.L().Error("record activity for badges failed", zap.Int64("user_id", userId), zap.Error(err))
+	}
+}
+
+func evaluateStatBadges(userId int64) {
+	if badgeEvaluator == nil {
+		return
+	}
+	if err := badgeEvaluator.EvaluateStats(userId); err != nil {
+		zap.L().Error("evaluate badges failed", zap.Int64("user_id", userId), zap.Error(err))
+	}
+}
+
+// eventTime 事件中记录的时间，无法解析时使用当前时间
+func eventTime(timestamp string) time.Time {
+	if t, err := time.Parse(time.RFC3339, timestamp); err == nil {
+		return t
+	}
+	return time.Now()
+}
+
+// BadgeProcessor 处理发布帖子/评论的事件，发帖数、评论数在发布时已经更新，这里只需要检查徽章
+type BadgeProcessor struct {
+	kafkaReader *kafka.Reader
+	messages    chan kafka.Message
+	maxRetries  int // 最大重试次数
+}
+
+func NewBadgeProcessor(brokers []string, topic string, maxRetries int) *BadgeProcessor {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     brokers,
+		Topic:       topic,
+		GroupID:     "badge_event_consumer_group",
+		StartOffset: kafka.FirstOffset,
+		MinBytes:    10e3, // 10KB
+		MaxBytes:    10e6, // 10MB
+	})
+
+	return &BadgeProcessor{
+		kafkaReader: reader,
+		messages:    make(chan kafka.Message),
+		maxRetries:  maxRetries,
+	}
+}
+
+func (bp *BadgeProcessor) Start(ctx context.Context) {
+	go bp.consumeMessages(ctx)
+	go bp.process(ctx)
+
+	// Wait for termination signal
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	<-signalChan
+
+	bp.kafkaReader.Close()
+}
+
+func (bp *BadgeProcessor) consumeMessages(ctx context.Context) {
+	for {
+		msg, err := bp.kafkaReader.ReadMessage(ctx)
+		if err != nil {
+			zap.L().Info(fmt.Sprintf("Failed to read message:%v", err))
+			continue
+		}
+		bp.messages <- msg // Send the message to the processing channel
+	}
+}
+
+func (bp *BadgeProcessor) process(ctx context.Context) {
+	for {
+		select {
+		case msg := <-bp.messages:
+			var event ContentEvent
+			if err := json.Unmarshal(msg.Value, &event); err != nil {
+				zap.L().Info(fmt.Sprintf("Failed to unmarshal message:%v", err))
+				commitMessage(bp.kafkaReader, msg)
+				continue
+			}
+			if err := bp.handle(event); err != nil {
+				// 徽章会在用户的下一个事件到来时重新检查，不需要死信队列
+				zap.L().Error(fmt.Sprintf("Failed to process content event: %v\n", err), zap.Error(err))
+			}
+			commitMessage(bp.kafkaReader, msg)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handle 发布帖子/评论算作活跃，同时检查作者的统计徽章
+func (bp *BadgeProcessor) handle(event ContentEvent) (err error) {
+	if badgeEvaluator == nil {
+		return nil
+	}
+	for i := 0; i <= bp.maxRetries; i++ {
+		if err = badgeEvaluator.RecordActivity(event.UserId, eventTime(event.Timestamp)); err == nil {
+			if err = badgeEvaluator.EvaluateStats(event.UserId); err == nil {
+				return nil
+			}
+		}
+		zap.L().Info(fmt.Sprintf("Error processing content event, retrying... (%d/%d): %v\n", i+1, bp.maxRetries, err))
+		time.Sleep(100 * time.Millisecond) // 等待后重试
+	}
+	return err
+}
@@ -0,0 +1,159 @@
+package message_queue
+
+import (
+	"bluebell/dao/mysql_repo"
+	"bluebell/models"
+	"bluebell/pkg/snowflake"
+	"bluebell/pkg/sqls"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+type CommentVoteProcessor struct {
+	kafkaReader     *kafka.Reader
+	messages        chan kafka.Message
+	deadLetterQueue chan CommentVoteEvent // 用于存储失败的事件
+	maxRetries      int                   // 最大重试次数
+}
+
+func NewCommentVoteProcessor(brokers []string, topic string, maxRetries int) *CommentVoteProcessor {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     brokers,
+		Topic:       topic,
+		GroupID:     "comment_vote_event_consumer_group",
+		StartOffset: kafka.FirstOffset,
+		Partition:   0,
+		MinBytes:    10e3, // 10KB
+		MaxBytes:    10e6, // 10MB
+	})
+
+	return &CommentVoteProcessor{
+		kafkaReader:     reader,
+		messages:        make(chan kafka.Message),
+		deadLetterQueue: make(chan CommentVoteEvent, 100), // 设定一个缓冲区
+		maxRetries:      maxRetries,
+	}
+}
+
+func (vp *CommentVoteProcessor) Start(ctx context.Context) {
+	go vp.consumeMessages(ctx)
+	go vp.process(ctx)
+	go vp.handleDeadLetters(ctx) // 处理死信队列
+
+	// Wait for termination signal
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	<-signalChan
+
+	vp.kafkaReader.Close()
+}
+
+func (vp *CommentVoteProcessor) consumeMessages(ctx context.Context) {
+	for {
+		msg, err := vp.kafkaReader.ReadMessage(ctx)
+		if err != nil {
+			zap.L().Info(fmt.Sprintf("Failed to read message:%v", err))
+			continue
+		}
+		vp.messages <- msg // Send the message to the processing channel
+	}
+}
+
+func (vp *CommentVoteProcessor) process(ctx context.Context) {
+	for {
+		select {
+		case msg := <-vp.messages:
+			var event CommentVoteEvent
+			if err := json.Unmarshal(msg.Value, &event); err != nil {
+				zap.L().Info(fmt.Sprintf("Failed to unmarshal message:%v", err))
+				continue
+			}
+			if err := vp.handle(event); err != nil {
+				zap.L().Info(fmt.Sprintf("Failed to process comment vote event: %v, moving to dead letter queue\n", err))
+				vp.deadLetterQueue <- event // 添加到死信队列
+			} else {
+				// 处理成功，提交消息
+				commitMessage(vp.kafkaReader, msg)
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// 评论点赞/点踩/取消事件，将用户对评论的最新投票写入t_vote
+func (vp *CommentVoteProcessor) handle(event CommentVoteEvent) error {
+	var err error
+
+	for i := 0; i <= vp.maxRetries; i++ {
+		if commentDeleted(event.CommentId) {
+			zap.L().Info(fmt.Sprintf("Comment %d is deleted, cannot vote, skipping...\n", event.CommentId))
+			return nil // 评论已删除，直接放弃
+		}
+		zap.L().Info(fmt.Sprintf("User %d voted %d on comment %d at %s\n", event.UserId, event.Val, event.CommentId, event.Timestamp))
+		err = voteCommentDatabaseOperation(event)
+
+		if err == nil {
+			if event.Val == 1 {
+				recordBadgeActivity(event.UserId, event.Timestamp)
+			}
+			return nil // 成功处理
+		}
+		zap.L().Info(fmt.Sprintf("Error processing event, retrying... (%d/%d): %v\n", i+1, vp.maxRetries, err))
+		time.Sleep(100 * time.Millisecond) // 等待后重试
+	}
+	return errors.New(fmt.Sprintf("max retries reached for event: %v", event))
+}
+
+// 处理死信队列中的事件
+func (vp *CommentVoteProcessor) handleDeadLetters(ctx context.Context) {
+	for {
+		select {
+		case event := <-vp.deadLetterQueue:
+			zap.L().Info(fmt.Sprintf("Handling dead letter event: %+v\n", event))
+			// 对于死信事件的策略：再尝试一次，若失败则记录日志
+			if commentDeleted(event.CommentId) {
+				zap.L().Info(fmt.Sprintf("Comment %d is deleted, skipping retry...\n", event.CommentId))
+				continue // 放弃重试
+			}
+			if err := vp.handle(event); err != nil {
+				zap.L().Error(fmt.Sprintf("Final attempt to process comment vote event failed: %v\n", err), zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// 评论投票数据库操作，没有记录时新建，否则更新val
+func voteCommentDatabaseOperation(event CommentVoteEvent) error {
+	oValue := mysql_repo.VoteRepository.FindOne(sqls.DB(), sqls.NewCnd().Where("user_id = ?", event.UserId).Where("type = ?", 2).Where("target_id = ?", event.CommentId))
+	if oValue == nil {
+		if event.Val == 0 {
+			// 说明没有点过赞/踩，没必要执行操作
+			return nil
+		}
+		vote := &models.Vote{VoteId: snowflake.GenID(), UserId: event.UserId, TargetId: event.CommentId, Type: 2, Val: event.Val, Weight: 1}
+		if err := mysql_repo.VoteRepository.Create(sqls.DB(), vote); err != nil {
+			return err
+		}
+		updateVoteReceived(models.Vote{}, *vote)
+		return nil
+	}
+	if err := mysql_repo.VoteRepository.UpdateColumn(sqls.DB(), oValue.VoteId, "val", event.Val); err != nil {
+		return err
+	}
+	old := *oValue
+	oValue.Val = event.Val
+	updateVoteReceived(old, *oValue)
+	return nil
+}
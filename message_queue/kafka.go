@@ -2,6 +2,9 @@ package message_queue
 
 import (
 	"bluebell/dao/mysql_repo"
+	"bluebell/dao/redis_repo"
+	"bluebell/models"
+	"bluebell/pkg/reputation"
 	"bluebell/pkg/sqls"
 	"bluebell/settings"
 	"context"
@@ -25,6 +28,11 @@ type PostClickEvent struct {
 	PostId int64
 }
 
+type PostShareEvent struct {
+	SharerId int64 `json:"sharer_id"`
+	PostId   int64 `json:"post_id"`
+}
+
 type PostCollectionEvent struct {
 	Action    string `json:"action"`
 	UserId    int64  `json:"user_id"`
@@ -32,6 +40,24 @@ type PostCollectionEvent struct {
 	Timestamp string `json:"timestamp"`
 }
 
+type CommentVoteEvent struct {
+	UserId    int64 `json:"user_id"`
+	CommentId int64 `json:"comment_id"`
+	// 取值为1，0，-1，分别表示赞，取消，踩
+	Val       int8   `json:"val"`
+	Timestamp string `json:"timestamp"`
+}
+
+type ReactionEvent struct {
+	// 为1表示添加回应，为-1表示取消回应
+	Action     int8   `json:"action"`
+	UserId     int64  `json:"user_id"`
+	TargetType int8   `json:"target_type"`
+	TargetId   int64  `json:"target_id"`
+	Emoji      string `json:"emoji"`
+	Timestamp  string `json:"timestamp"`
+}
+
 type UserFollowEvent struct {
 	Action       string `json:"action"`
 	UserId       int64  `json:"user_id"`
@@ -39,6 +65,16 @@ type UserFollowEvent struct {
 	Timestamp    string `json:"timestamp"`
 }
 
+// ContentEvent 用户发布了帖子/评论
+type ContentEvent struct {
+	UserId int64 `json:"user_id"`
+	// 为1表示帖子，为2表示评论
+	TargetType int8   `json:"target_type"`
+	TargetId   int64  `json:"target_id"`
+	PostId     int64  `json:"post_id"`
+	Timestamp  string `json:"timestamp"`
+}
+
 // 初始化需要的消费者和生产者，以及对应的topic
 var (
 	LikeTopic              = "post-like-events"
@@ -49,6 +85,14 @@ var (
 	PostClickMaxRetries    = 1
 	UserFollowTopic        = "user-follow-events"
 	UserFollowMaxRetries   = 1
+	PostShareTopic         = "post-share-events"
+	PostShareMaxRetries    = 1
+	CommentVoteTopic       = "comment-vote-events"
+	CommentVoteMaxRetries  = 1
+	ReactionTopic          = "reaction-events"
+	ReactionMaxRetries     = 1
+	ContentTopic           = "content-events"
+	ContentMaxRetries      = 1
 	ctx                    = context.Background()
 )
 
@@ -107,6 +151,85 @@ func SendPostClickEvent(ctx context.Context, message PostClickEvent) (err error)
 	return err
 }
 
+func SendPostShareEvent(ctx context.Context, message PostShareEvent) (err error) {
+	writer := kafka.Writer{
+		Addr:                   kafka.TCP(settings.GlobalSettings.MQCfg.Brokers...),
+		Topic:                  PostShareTopic,
+		Balancer:               &kafka.Hash{},
+		WriteTimeout:           1 * time.Second,
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+	}
+	defer writer.Close()
+	// try to send to mq for 2 times, if error, break
+	send_msg, _ := json.Marshal(message)
+	for i := 0; i < 2; i++ {
+		if err = writer.WriteMessages(
+			ctx, kafka.Message{Key: []byte(strconv.FormatInt(message.PostId, 10)), Value: send_msg}); err != nil {
+			zap.L().Info("write kafka error,try again...", zap.Error(err))
+		} else {
+			zap.L().Info(fmt.Sprintf("send event msg to mq successfully,action = add share num,sharer id = %d,post id = %d",
+				message.SharerId, message.PostId))
+			break
+		}
+	}
+	// TODO 消息发送失败，需要额外处理
+
+	return err
+}
+
+func SendCommentVoteEvent(ctx context.Context, message CommentVoteEvent) (err error) {
+	writer := kafka.Writer{
+		Addr:                   kafka.TCP(settings.GlobalSettings.MQCfg.Brokers...),
+		Topic:                  CommentVoteTopic,
+		Balancer:               &kafka.Hash{},
+		WriteTimeout:           1 * time.Second,
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+	}
+	defer writer.Close()
+	// try to send to mq for 3 times, if error, break
+	send_msg, _ := json.Marshal(message)
+	for i := 0; i < 3; i++ {
+		if err = writer.WriteMessages(
+			ctx, kafka.Message{Key: []byte(strconv.FormatInt(message.UserId, 10)), Value: send_msg}); err != nil {
+			zap.L().Info("write kafka error,try...", zap.Error(err))
+		} else {
+			zap.L().Info(fmt.Sprintf("send comment vote event msg to mq successfully,val = %d,user id = %d,comment id = %d",
+				message.Val, message.UserId, message.CommentId))
+			break
+		}
+	}
+	// TODO 消息发送失败，需要额外处理
+	return err
+}
+
+func SendReactionEvent(ctx context.Context, message ReactionEvent) (err error) {
+	writer := kafka.Writer{
+		Addr:                   kafka.TCP(settings.GlobalSettings.MQCfg.Brokers...),
+		Topic:                  ReactionTopic,
+		Balancer:               &kafka.Hash{},
+		WriteTimeout:           1 * time.Second,
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+	}
+	defer writer.Close()
+	// try to send to mq for 3 times, if error, break
+	send_msg, _ := json.Marshal(message)
+	for i := 0; i < 3; i++ {
+		if err = writer.WriteMessages(
+			ctx, kafka.Message{Key: []byte(strconv.FormatInt(message.UserId, 10)), Value: send_msg}); err != nil {
+			zap.L().Info("write kafka error,try...", zap.Error(err))
+		} else {
+			zap.L().Info(fmt.Sprintf("send reaction event msg to mq successfully,action = %d,user id = %d,target id = %d,emoji = %s",
+				message.Action, message.UserId, message.TargetId, message.Emoji))
+			break
+		}
+	}
+	// TODO 消息发送失败，需要额外处理
+	return err
+}
+
 func SendUserFollowEvent(ctx context.Context, message UserFollowEvent) (err error) {
 	writer := kafka.Writer{
 		Addr:                   kafka.TCP(settings.GlobalSettings.MQCfg.Brokers...),
@@ -134,6 +257,32 @@ func SendUserFollowEvent(ctx context.Context, message UserFollowEvent) (err erro
 	return err
 }
 
+func SendContentEvent(ctx context.Context, message ContentEvent) (err error) {
+	writer := kafka.Writer{
+		Addr:                   kafka.TCP(settings.GlobalSettings.MQCfg.Brokers...),
+		Topic:                  ContentTopic,
+		Balancer:               &kafka.Hash{},
+		WriteTimeout:           1 * time.Second,
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+	}
+	defer writer.Close()
+	// try to send to mq for 3 times, if error, break
+	send_msg, _ := json.Marshal(message)
+	for i := 0; i < 3; i++ {
+		if err = writer.WriteMessages(
+			ctx, kafka.Message{Key: []byte(strconv.FormatInt(message.UserId, 10)), Value: send_msg}); err != nil {
+			zap.L().Info("write kafka error,try...", zap.Error(err))
+		} else {
+			zap.L().Info(fmt.Sprintf("send content event msg to mq successfully,target type = %d,user id = %d,target id = %d",
+				message.TargetType, message.UserId, message.TargetId))
+			break
+		}
+	}
+	// TODO 消息发送失败，需要额外处理
+	return err
+}
+
 func InitMQ(cfg *settings.MessageQueueConfig) {
 	// 需要启动多个监听消息队列的消费者
 	likeProcessor := NewLikeProcessor(cfg.Brokers, LikeTopic, LikeTopicMaxRetries)
@@ -144,6 +293,14 @@ func InitMQ(cfg *settings.MessageQueueConfig) {
 	go postClickProcessor.Start(ctx)
 	userFollowProcessor := NewUserFollowProcessor(cfg.Brokers, UserFollowTopic, UserFollowMaxRetries)
 	go userFollowProcessor.Start(ctx)
+	postShareProcessor := NewPostShareProcessor(cfg.Brokers, PostShareTopic, PostShareMaxRetries)
+	go postShareProcessor.Start(ctx)
+	commentVoteProcessor := NewCommentVoteProcessor(cfg.Brokers, CommentVoteTopic, CommentVoteMaxRetries)
+	go commentVoteProcessor.Start(ctx)
+	reactionProcessor := NewReactionProcessor(cfg.Brokers, ReactionTopic, ReactionMaxRetries)
+	go reactionProcessor.Start(ctx)
+	badgeProcessor := NewBadgeProcessor(cfg.Brokers, ContentTopic, ContentMaxRetries)
+	go badgeProcessor.Start(ctx)
 }
 
 // 帖子是否已被删除
@@ -151,10 +308,104 @@ func postDeleted(postID int64) bool {
 	return mysql_repo.PostRepository.Get(sqls.DB(), postID) == nil
 }
 
+// 评论是否已被删除
+func commentDeleted(commentId int64) bool {
+	return mysql_repo.CommentRepository.Get(sqls.DB(), commentId) == nil
+}
+
 // 用户是否已经注销
 func userDeleted(userId int64) bool {
-	return mysql_repo.UserRepository.Get(sqls.DB(), userId) == nil
+	u := mysql_repo.UserRepository.Get(sqls.DB(), userId)
+	return u == nil || u.Status == models.UserStatusDeleted
+
+}
+
+// voteWeight 投票记录中的权重，没有记录权重的旧数据按1计算
+func voteWeight(v models.Vote) int64 {
+	if v.Weight <= 0 {
+		return 1
+	}
+	return int64(v.Weight)
+}
+
+// postVoteWeight 用户当前对帖子投票的权重，由用户在帖子所属社区的声望决定
+func postVoteWeight(userId, postId int64) int8 {
+	post := mysql_repo.PostRepository.Get(sqls.DB(), postId)
+	if post == nil {
+		return 1
+	}
+	return reputation.VoteWeight(mysql_repo.UserRepository.Get(sqls.DB(), userId), post.CommunityID)
+}
 
+// updateVoteReceived 投票记录持久化以后，根据投票前后的状态更新帖子/评论作者缓存的获赞总数、作者的声望以及帖子的得分
+// 只根据状态的变化计算增量，重复处理同一条消息时状态没有变化，不会重复计算
+// 失败只记录日志，获赞总数的缓存过期后会重新统计
+func updateVoteReceived(old, cur models.Vote) {
+	var likes, dislikes int64
+	switch old.Val {
+	case 1:
+		likes--
+	case -1:
+		dislikes--
+	}
+	switch cur.Val {
+	case 1:
+		likes++
+	case -1:
+		dislikes++
+	}
+	if likes == 0 && dislikes == 0 {
+		return
+	}
+	var authorId, communityId int64
+	if cur.Type == 1 {
+		if post := mysql_repo.PostRepository.Get(sqls.DB(), cur.TargetId); post != nil {
+			authorId, communityId = post.AuthorID, post.CommunityID
+		}
+	} else if comment := mysql_repo.CommentRepository.Get(sqls.DB(), cur.TargetId); comment != nil {
+		authorId = comment.UserId
+	}
+	if authorId == 0 {
+		return
+	}
+	if likes != 0 {
+		if err := redis_repo.IncrUserStat(authorId, redis_repo.UserStatLikesReceived, likes); err != nil {
+			zap.L().Error("update likes received of user failed", zap.Int64("user_id", authorId), zap.Error(err))
+		}
+	}
+	// 获赞总数更新以后再检查徽章
+	if likes > 0 {
+		evaluateStatBadges(authorId)
+	}
+	// 给自己投票不影响声望
+	if authorId != cur.UserId {
+		err := reputation.Change(authorId, reputation.LikeReceived, likes)
+		if err == nil {
+			err = reputation.Change(authorId, reputation.DislikeReceived, dislikes)
+		}
+		if err != nil {
+			zap.L().Error("update reputation of user failed", zap.Int64("user_id", authorId), zap.Error(err))
+		}
+	}
+	if cur.Type == 1 {
+		score := int64(cur.Val)*voteWeight(cur) - int64(old.Val)*voteWeight(old)
+		if err := mysql_repo.PostRepository.IncrScore(sqls.DB(), cur.TargetId, score); err != nil {
+			zap.L().Error("update post score in mysql failed", zap.Int64("post_id", cur.TargetId), zap.Error(err))
+		} else if err = redis_repo.IncrPostScore(cur.TargetId, communityId, float64(score)); err != nil {
+			zap.L().Error("update post score in redis failed", zap.Int64("post_id", cur.TargetId), zap.Error(err))
+		}
+	}
+}
+
+// updateCollected 收藏记录持久化以后更新帖子作者的声望，count为收藏数的变化，收藏自己的帖子不影响声望
+func updateCollected(postId, userId, count int64) {
+	post := mysql_repo.PostRepository.Get(sqls.DB(), postId)
+	if post == nil || post.AuthorID == userId {
+		return
+	}
+	if err := reputation.Change(post.AuthorID, reputation.Collected, count); err != nil {
+		zap.L().Error("update reputation of user failed", zap.Int64("user_id", post.AuthorID), zap.Error(err))
+	}
 }
 
 // 提交消息的 offset
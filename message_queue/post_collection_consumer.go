@@ -148,12 +148,14 @@ func collectPostDatabaseOperation(event PostCollectionEvent) error {
 		if err != nil {
 			return err
 		}
-	} else {
+		updateCollected(event.PostId, event.UserId, 1)
+	} else if oValue.Val != 1 {
 		oValue.Val = 1
 		err := mysql_repo.LikeRepository.UpdateColumn(sqls.DB(), oValue.LikeId, "val", oValue.Val)
 		if err != nil {
 			return err
 		}
+		updateCollected(event.PostId, event.UserId, 1)
 	}
 
 	return nil
@@ -165,13 +167,14 @@ func cancelCollectPostDatabaseOperation(event PostCollectionEvent) error {
 	if oValue == nil {
 		// 说明没有收藏过，没必要执行操作
 		return nil
-	} else {
+	} else if oValue.Val == 1 {
 		// 需要将like记录里的val设置为0
 		oValue.Val = 0
 		err := mysql_repo.LikeRepository.UpdateColumn(sqls.DB(), oValue.LikeId, "val", oValue.Val)
 		if err != nil {
 			return err
 		}
+		updateCollected(event.PostId, event.UserId, -1)
 	}
 	return nil
 }
@@ -143,17 +143,24 @@ func (lp *DisLikeProcessor) handleDeadLetters(ctx context.Context) {
 func dislikePostDatabaseOperation(event PostLikeEvent) error {
 	oValue := mysql_repo.VoteRepository.FindOne(sqls.DB(), sqls.NewCnd().Where("user_id = ?", event.UserId).Where("target_id = ?", event.PostId))
 	if oValue == nil {
-		vote := &models.Vote{VoteId: snowflake.GenID(), UserId: event.UserId, TargetId: event.PostId, Type: 1, Val: -1}
+		vote := &models.Vote{VoteId: snowflake.GenID(), UserId: event.UserId, TargetId: event.PostId, Type: 1, Val: -1, Weight: postVoteWeight(event.UserId, event.PostId)}
 		err := mysql_repo.VoteRepository.Create(sqls.DB(), vote)
 		if err != nil {
 			return err
 		}
+		updateVoteReceived(models.Vote{}, *vote)
 	} else {
+		old := *oValue
+		if oValue.Val != -1 {
+			// 重复处理消息时保留原来的权重
+			oValue.Weight = postVoteWeight(event.UserId, event.PostId)
+		}
 		oValue.Val = -1
-		err := mysql_repo.VoteRepository.UpdateColumn(sqls.DB(), oValue.VoteId, "val", oValue.Val)
+		err := mysql_repo.VoteRepository.UpdateColumns(sqls.DB(), oValue.VoteId, map[string]interface{}{"val": oValue.Val, "weight": oValue.Weight})
 		if err != nil {
 			return err
 		}
+		updateVoteReceived(old, *oValue)
 	}
 
 	return nil
@@ -166,11 +173,13 @@ func cancelDislikePostDatabaseOperation(event PostLikeEvent) error {
 		// 说明没有点过赞/踩，没必要执行操作
 		return nil
 	} else {
+		old := *oValue
 		oValue.Val = 0
 		err := mysql_repo.VoteRepository.UpdateColumn(sqls.DB(), oValue.VoteId, "val", oValue.Val)
 		if err != nil {
 			return err
 		}
+		updateVoteReceived(old, *oValue)
 	}
 	return nil
 }
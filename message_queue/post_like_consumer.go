@@ -100,6 +100,9 @@ func (lp *LikeProcessor) handleLike(event PostLikeEvent) error {
 			zap.L().Info(fmt.Sprintf("User %d liked post %d at %s\n", event.UserId, event.PostId, event.Timestamp))
 			// 处理点赞逻辑
 			err = likePostDatabaseOperation(event) // 执行点赞操作
+			if err == nil {
+				recordBadgeActivity(event.UserId, event.Timestamp)
+			}
 		case "none":
 			zap.L().Info(fmt.Sprintf("User %d cancel liked post %d at %s\n", event.UserId, event.PostId, event.Timestamp))
 			// 处理取消点赞逻辑
@@ -143,17 +146,24 @@ func (lp *LikeProcessor) handleDeadLetters(ctx context.Context) {
 func likePostDatabaseOperation(event PostLikeEvent) error {
 	oValue := mysql_repo.VoteRepository.FindOne(sqls.DB(), sqls.NewCnd().Where("user_id = ?", event.UserId).Where("target_id = ?", event.PostId))
 	if oValue == nil {
-		vote := &models.Vote{VoteId: snowflake.GenID(), UserId: event.UserId, TargetId: event.PostId, Type: 1, Val: 1}
+		vote := &models.Vote{VoteId: snowflake.GenID(), UserId: event.UserId, TargetId: event.PostId, Type: 1, Val: 1, Weight: postVoteWeight(event.UserId, event.PostId)}
 		err := mysql_repo.VoteRepository.Create(sqls.DB(), vote)
 		if err != nil {
 			return err
 		}
+		updateVoteReceived(models.Vote{}, *vote)
 	} else {
+		old := *oValue
+		if oValue.Val != 1 {
+			// 重复处理消息时保留原来的权重
+			oValue.Weight = postVoteWeight(event.UserId, event.PostId)
+		}
 		oValue.Val = 1
-		err := mysql_repo.VoteRepository.UpdateColumn(sqls.DB(), oValue.VoteId, "val", oValue.Val)
+		err := mysql_repo.VoteRepository.UpdateColumns(sqls.DB(), oValue.VoteId, map[string]interface{}{"val": oValue.Val, "weight": oValue.Weight})
 		if err != nil {
 			return err
 		}
+		updateVoteReceived(old, *oValue)
 	}
 
 	return nil
@@ -166,11 +176,13 @@ func cancelLikePostDatabaseOperation(event PostLikeEvent) error {
 		// 说明没有点过赞/踩，没必要执行操作
 		return nil
 	} else {
+		old := *oValue
 		oValue.Val = 0
 		err := mysql_repo.VoteRepository.UpdateColumn(sqls.DB(), oValue.VoteId, "val", oValue.Val)
 		if err != nil {
 			return err
 		}
+		updateVoteReceived(old, *oValue)
 	}
 	return nil
 }
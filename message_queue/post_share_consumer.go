@@ -0,0 +1,130 @@
+package message_queue
+
+import (
+	"bluebell/dao/mysql_repo"
+	"bluebell/pkg/sqls"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+type PostShareProcessor struct {
+	kafkaReader     *kafka.Reader
+	messages        chan kafka.Message
+	deadLetterQueue chan PostShareEvent // 用于存储失败的事件
+	maxRetries      int                 // 最大重试次数
+}
+
+func NewPostShareProcessor(brokers []string, topic string, maxRetries int) *PostShareProcessor {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     brokers,
+		Topic:       topic,
+		GroupID:     "post_share_event_consumer_group",
+		StartOffset: kafka.FirstOffset,
+		Partition:   0,
+		MinBytes:    10e3, // 10KB
+		MaxBytes:    10e6, // 10MB
+	})
+
+	return &PostShareProcessor{
+		kafkaReader:     reader,
+		messages:        make(chan kafka.Message),
+		deadLetterQueue: make(chan PostShareEvent, 100), // 设定一个缓冲区
+		maxRetries:      maxRetries,
+	}
+}
+
+func (sp *PostShareProcessor) Start(ctx context.Context) {
+	go sp.consumeMessages(ctx)
+	go sp.process(ctx)
+	go sp.handleDeadLetters(ctx) // 处理死信队列
+
+	// Wait for termination signal
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	<-signalChan
+
+	sp.kafkaReader.Close()
+}
+
+func (sp *PostShareProcessor) consumeMessages(ctx context.Context) {
+	for {
+		msg, err := sp.kafkaReader.ReadMessage(ctx)
+		if err != nil {
+			zap.L().Info(fmt.Sprintf("Failed to read message:%v", err))
+			continue
+		}
+		sp.messages <- msg // Send the message to the processing channel
+	}
+}
+
+func (sp *PostShareProcessor) process(ctx context.Context) {
+	for {
+		select {
+		case msg := <-sp.messages:
+			var event PostShareEvent
+			if err := json.Unmarshal(msg.Value, &event); err != nil {
+				zap.L().Info(fmt.Sprintf("Failed to unmarshal message:%v", err))
+				continue
+			}
+			if err := sp.handle(event); err != nil {
+				zap.L().Info(fmt.Sprintf("Failed to process share event: %v, moving to dead letter queue\n", err))
+				sp.deadLetterQueue <- event // 添加到死信队列
+			} else {
+				// 处理成功，提交消息
+				commitMessage(sp.kafkaReader, msg)
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// 分享链接访问事件
+func (sp *PostShareProcessor) handle(event PostShareEvent) error {
+	var err error
+
+	for i := 0; i <= sp.maxRetries; i++ {
+		if postDeleted(event.PostId) {
+			zap.L().Info(fmt.Sprintf("Post %d is deleted, cannot share, skipping...\n", event.PostId))
+			return nil // 帖子已删除，直接放弃
+		}
+
+		err = mysql_repo.PostRepository.IncreaseShareNum(sqls.DB(), event.PostId)
+
+		if err == nil {
+			return nil // 成功处理
+		}
+		zap.L().Info(fmt.Sprintf("Error processing event, retrying... (%d/%d): %v\n", i+1, sp.maxRetries, err))
+		time.Sleep(100 * time.Millisecond) // 等待后重试
+	}
+	return errors.New(fmt.Sprintf("max retries reached for event: %v", event))
+}
+
+// 处理死信队列中的事件
+func (sp *PostShareProcessor) handleDeadLetters(ctx context.Context) {
+	for {
+		select {
+		case event := <-sp.deadLetterQueue:
+			zap.L().Info(fmt.Sprintf("Handling dead letter event: %+v\n", event))
+			// 对于死信事件的策略：再尝试一次，若失败则记录日志
+			if postDeleted(event.PostId) {
+				zap.L().Info(fmt.Sprintf("Post %d is deleted, skipping retry...\n", event.PostId))
+				continue // 放弃重试
+			}
+			if err := sp.handle(event); err != nil {
+				zap.L().Error(fmt.Sprintf("Final attempt to process share event failed: %v\n", err), zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
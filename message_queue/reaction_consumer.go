@@ -0,0 +1,146 @@
+package message_queue
+
+import (
+	"bluebell/dao/mysql_repo"
+	"bluebell/models"
+	"bluebell/pkg/sqls"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+type ReactionProcessor struct {
+	kafkaReader     *kafka.Reader
+	messages        chan kafka.Message
+	deadLetterQueue chan ReactionEvent // 用于存储失败的事件
+	maxRetries      int                // 最大重试次数
+}
+
+func NewReactionProcessor(brokers []string, topic string, maxRetries int) *ReactionProcessor {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     brokers,
+		Topic:       topic,
+		GroupID:     "reaction_event_consumer_group",
+		StartOffset: kafka.FirstOffset,
+		Partition:   0,
+		MinBytes:    10e3, // 10KB
+		MaxBytes:    10e6, // 10MB
+	})
+
+	return &ReactionProcessor{
+		kafkaReader:     reader,
+		messages:        make(chan kafka.Message),
+		deadLetterQueue: make(chan ReactionEvent, 100), // 设定一个缓冲区
+		maxRetries:      maxRetries,
+	}
+}
+
+func (rp *ReactionProcessor) Start(ctx context.Context) {
+	go rp.consumeMessages(ctx)
+	go rp.process(ctx)
+	go rp.handleDeadLetters(ctx) // 处理死信队列
+
+	// Wait for termination signal
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	<-signalChan
+
+	rp.kafkaReader.Close()
+}
+
+func (rp *ReactionProcessor) consumeMessages(ctx context.Context) {
+	for {
+		msg, err := rp.kafkaReader.ReadMessage(ctx)
+		if err != nil {
+			zap.L().Info(fmt.Sprintf("Failed to read message:%v", err))
+			continue
+		}
+		rp.messages <- msg // Send the message to the processing channel
+	}
+}
+
+func (rp *ReactionProcessor) process(ctx context.Context) {
+	for {
+		select {
+		case msg := <-rp.messages:
+			var event ReactionEvent
+			if err := json.Unmarshal(msg.Value, &event); err != nil {
+				zap.L().Info(fmt.Sprintf("Failed to unmarshal message:%v", err))
+				continue
+			}
+			if err := rp.handle(event); err != nil {
+				zap.L().Info(fmt.Sprintf("Failed to process reaction event: %v, moving to dead letter queue\n", err))
+				rp.deadLetterQueue <- event // 添加到死信队列
+			} else {
+				// 处理成功，提交消息
+				commitMessage(rp.kafkaReader, msg)
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// 添加/取消emoji回应事件，将回应写入t_reaction
+func (rp *ReactionProcessor) handle(event ReactionEvent) error {
+	var err error
+
+	for i := 0; i <= rp.maxRetries; i++ {
+		if reactionTargetDeleted(event) {
+			zap.L().Info(fmt.Sprintf("Target %d is deleted, cannot react, skipping...\n", event.TargetId))
+			return nil // 帖子/评论已删除，直接放弃
+		}
+		reaction := &models.Reaction{UserId: event.UserId, TargetType: event.TargetType, TargetId: event.TargetId, Emoji: event.Emoji}
+		switch event.Action {
+		case 1:
+			err = mysql_repo.ReactionRepository.Add(sqls.DB(), reaction)
+		case -1:
+			err = mysql_repo.ReactionRepository.Remove(sqls.DB(), reaction)
+		default:
+			return errors.New(fmt.Sprintf("Unknown reaction event,%d\n", event.Action))
+		}
+
+		if err == nil {
+			return nil // 成功处理
+		}
+		zap.L().Info(fmt.Sprintf("Error processing event, retrying... (%d/%d): %v\n", i+1, rp.maxRetries, err))
+		time.Sleep(100 * time.Millisecond) // 等待后重试
+	}
+	return errors.New(fmt.Sprintf("max retries reached for event: %v", event))
+}
+
+// 处理死信队列中的事件
+func (rp *ReactionProcessor) handleDeadLetters(ctx context.Context) {
+	for {
+		select {
+		case event := <-rp.deadLetterQueue:
+			zap.L().Info(fmt.Sprintf("Handling dead letter event: %+v\n", event))
+			// 对于死信事件的策略：再尝试一次，若失败则记录日志
+			if reactionTargetDeleted(event) {
+				zap.L().Info(fmt.Sprintf("Target %d is deleted, skipping retry...\n", event.TargetId))
+				continue // 放弃重试
+			}
+			if err := rp.handle(event); err != nil {
+				zap.L().Error(fmt.Sprintf("Final attempt to process reaction event failed: %v\n", err), zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// 回应的帖子/评论是否已被删除
+func reactionTargetDeleted(event ReactionEvent) bool {
+	if event.TargetType == 2 {
+		return commentDeleted(event.TargetId)
+	}
+	return postDeleted(event.TargetId)
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"bluebell/controllers"
 	"bluebell/logic"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"strings"
@@ -31,15 +32,35 @@ func JWTAuthMiddleware() func(c *gin.Context) {
 			c.Abort()
 			return
 		}
-		// 判断目前token是否有多个用户登录
-		if b, _ := logic.CheckMoreThanOneUser(mc.UserId, parts[1]); b {
-			zap.L().Info("More than one user")
-			controllers.ResponseError(c, controllers.CODE_MORE_THAN_ONE_USER)
+		// 判断token所属的登录会话是否依然有效，已退出登录或者被其他设备踢下线的会话不能继续使用
+		if err = logic.CheckSession(mc, c.ClientIP()); err != nil {
+			zap.L().Info("check session failed", zap.Int64("user_id", mc.UserId), zap.Error(err))
+			if errors.Is(err, logic.ERROR_SESSION_REVOKED) {
+				controllers.ResponseError(c, controllers.CODE_SESSION_REVOKED)
+			} else {
+				controllers.ResponseError(c, controllers.CODE_INTERNAL_ERROR)
+			}
 			c.Abort()
 			return
 		}
 		c.Set(controllers.ContextUserIdKey, mc.UserId)
 		c.Set(controllers.ContextUserNameKey, mc.Username)
+		c.Set(controllers.ContextSessionIdKey, mc.SessionId)
+		c.Next()
+	}
+}
+
+// OptionalJWTAuthMiddleware 可选的登录认证，携带有效token时记录当前用户，否则以匿名用户继续处理请求
+func OptionalJWTAuthMiddleware() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		parts := strings.Split(c.Request.Header.Get("Authorization"), " ")
+		if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
+			if mc, err := logic.ParseToken(parts[1]); err == nil && logic.CheckSession(mc, c.ClientIP()) == nil {
+				c.Set(controllers.ContextUserIdKey, mc.UserId)
+				c.Set(controllers.ContextUserNameKey, mc.Username)
+				c.Set(controllers.ContextSessionIdKey, mc.SessionId)
+			}
+		}
 		c.Next()
 	}
 }
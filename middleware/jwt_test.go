@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"bluebell/controllers"
+	"bluebell/logic"
+	"bluebell/pkg/jwtkeys"
+	"bluebell/settings"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJWTAuthRejectsRefreshToken(t *testing.T) {
+	if err := jwtkeys.Init(&settings.TokenConfig{Keys: []settings.JWTKeyConfig{
+		{Kid: "test", Key: "bluebell-middleware-test-signing-key"},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/protected", JWTAuthMiddleware(), func(c *gin.Context) {
+		t.Error("handler reached with a non-access token")
+		c.Status(http.StatusNoContent)
+	})
+
+	now := time.Now()
+	refresh := jwt.StandardClaims{Id: "jti", Audience: logic.RefreshTokenAudience, IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()}
+	tests := []struct {
+		name   string
+		claims jwt.Claims
+	}{
+		{"refresh token", logic.RefreshClaims{UserId: 1, SessionId: "sid", StandardClaims: refresh}},
+		// 加上aud之前签发的refresh token带有jti
+		{"refresh token without audience", logic.RefreshClaims{UserId: 1, SessionId: "sid",
+			StandardClaims: jwt.StandardClaims{Id: "jti", ExpiresAt: now.Add(time.Hour).Unix()}}},
+		{"refresh audience in access claims", logic.MyClaims{UserId: 1, SessionId: "sid", StandardClaims: refresh}},
+		{"access token without audience", logic.MyClaims{UserId: 1, SessionId: "sid",
+			StandardClaims: jwt.StandardClaims{ExpiresAt: now.Add(time.Hour).Unix()}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwtkeys.Sign(tt.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			var resp controllers.Response
+			if err = json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response %q: %v", w.Body.String(), err)
+			}
+			if resp.Code != controllers.CODE_INVALID_TOKEN {
+				t.Fatalf("code = %v, want %v", resp.Code, controllers.CODE_INVALID_TOKEN)
+			}
+		})
+	}
+}
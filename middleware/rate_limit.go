@@ -1,9 +1,11 @@
 package middleware
 
 import (
+	"bluebell/controllers"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -50,3 +52,60 @@ func NonBlockingRateLimitMiddleware(duration time.Duration) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// routeRequestExpires 记录每个接口和用户/IP在什么时间之前不能再次请求，过期的记录定期清理
+var routeRequestExpires = make(map[string]time.Time)
+var routeMu sync.Mutex
+var routeLastSweep time.Time
+
+const routeSweepInterval = time.Minute
+
+// rateLimitKey 已登录的用户按用户id限流，同一个网络出口下的用户互不影响；未登录时按IP限流
+func rateLimitKey(c *gin.Context) string {
+	if userId := c.GetInt64(controllers.ContextUserIdKey); userId != 0 {
+		return c.FullPath() + "|user:" + strconv.FormatInt(userId, 10)
+	}
+	return c.FullPath() + "|ip:" + c.ClientIP()
+}
+
+// sweepRouteRequests 删除已经过期的记录，需要持有routeMu
+func sweepRouteRequests(now time.Time) {
+	if now.Sub(routeLastSweep) < routeSweepInterval {
+		return
+	}
+	routeLastSweep = now
+	for key, expire := range routeRequestExpires {
+		if !now.Before(expire) {
+			delete(routeRequestExpires, key)
+		}
+	}
+}
+
+// PerRouteRateLimitMiddleware 和NonBlockingRateLimitMiddleware相同，但是按接口和用户/IP分别限流，
+// 同一个IP在不同接口上的请求互不影响，也不会占用NonBlockingRateLimitMiddleware的限额
+func PerRouteRateLimitMiddleware(duration time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := rateLimitKey(c)
+
+		// 检查和更新限流记录在同一次加锁中完成，避免并发的请求同时通过
+		now := time.Now()
+		routeMu.Lock()
+		sweepRouteRequests(now)
+		expire, exists := routeRequestExpires[key]
+		limited := exists && now.Before(expire)
+		if !limited {
+			routeRequestExpires[key] = now.Add(duration * time.Second)
+		}
+		routeMu.Unlock()
+
+		if limited {
+			c.JSON(http.StatusOK, gin.H{
+				"code":  http.StatusTooManyRequests,
+				"error": fmt.Sprintf("Too many requests. Please wait %d seconds before retrying.", duration),
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
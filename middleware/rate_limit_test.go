@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"bluebell/controllers"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPerRouteRateLimitByUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/limited", func(c *gin.Context) {
+		// 模拟JWT中间件设置的用户id，为0时表示没有登录
+		if id, err := strconv.ParseInt(c.GetHeader("X-User-Id"), 10, 64); err == nil {
+			c.Set(controllers.ContextUserIdKey, id)
+		}
+	}, PerRouteRateLimitMiddleware(60), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	request := func(userId string) int {
+		req := httptest.NewRequest(http.MethodPost, "/limited", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		if userId != "" {
+			req.Header.Set("X-User-Id", userId)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 同一个IP下的不同用户分别限流
+	for _, user := range []string{"1", "2", ""} {
+		if code := request(user); code != http.StatusNoContent {
+			t.Fatalf("first request of user %q: status = %d, want %d", user, code, http.StatusNoContent)
+		}
+	}
+	for _, user := range []string{"1", "2", ""} {
+		if code := request(user); code == http.StatusNoContent {
+			t.Fatalf("second request of user %q was not limited", user)
+		}
+	}
+}
+
+func TestSweepRouteRequests(t *testing.T) {
+	now := time.Now()
+	routeMu.Lock()
+	defer routeMu.Unlock()
+	routeRequestExpires["/expired|ip:10.0.0.2"] = now.Add(-time.Second)
+	routeRequestExpires["/active|ip:10.0.0.2"] = now.Add(time.Minute)
+	routeLastSweep = time.Time{}
+
+	sweepRouteRequests(now)
+	for key := range routeRequestExpires {
+		if strings.HasPrefix(key, "/expired") {
+			t.Fatalf("expired record %q was not removed", key)
+		}
+	}
+	if _, ok := routeRequestExpires["/active|ip:10.0.0.2"]; !ok {
+		t.Fatal("active record was removed")
+	}
+}
@@ -3,11 +3,14 @@ CREATE TABLE `t_user` (
     `id` bigint(64) NOT NULL AUTO_INCREMENT,
     `user_id` bigint(64) NOT NULL,
     `username` varchar(64) COLLATE utf8mb4_general_ci NOT NULL,
-    `password` varchar(64) COLLATE utf8mb4_general_ci NOT NULL,
+    `password` varchar(255) COLLATE utf8mb4_general_ci NOT NULL,
     `email` varchar(64) COLLATE utf8mb4_general_ci,
     `gender` tinyint(4) NOT NULL DEFAULT '0',
     `verified` boolean DEFAULT FALSE ,
     `status` tinyint(4) NOT NULL DEFAULT '0',
+    `role` tinyint(4) NOT NULL DEFAULT '0',
+    `delete_request_at` timestamp NULL,
+    `reputation` bigint(64) NOT NULL DEFAULT '0',
     `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
     `update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE
         CURRENT_TIMESTAMP,
@@ -24,6 +27,10 @@ CREATE TABLE `t_community` (
      `community_id` int(64) unsigned NOT NULL,
      `community_name` varchar(128) COLLATE utf8mb4_general_ci NOT NULL,
      `introduction` varchar(256) COLLATE utf8mb4_general_ci NOT NULL,
+     `reactions` varchar(256) COLLATE utf8mb4_general_ci,
+     `publish_threshold` bigint(64) NULL,
+     `vote_weight_threshold` bigint(64) NULL,
+     `link_threshold` bigint(64) NULL,
      `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
      `update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
      `delete_at` TIMESTAMP,
@@ -47,6 +54,9 @@ CREATE TABLE `t_post` (
     `author_id` bigint(64) NOT NULL COMMENT '作者的用户id',
     `community_id` bigint(64) NOT NULL COMMENT '所属社区',
     `status` tinyint(4) NOT NULL DEFAULT '1' COMMENT '帖子状态',
+    `pinned_comment_id` bigint(64) NOT NULL DEFAULT 0 COMMENT '置顶的根评论',
+    `comment_locked` tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否禁止评论',
+    `comment_locked_by` bigint(64) NOT NULL DEFAULT 0 COMMENT '锁定评论的用户',
     `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
     `update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
     `delete_at` TIMESTAMP,
@@ -70,17 +80,33 @@ CREATE TABLE `t_comment`(
     `post_id` bigint(64) NOT NULL,
     `user_id` bigint(64) NOT NULL, -- The user who made the comment
     `parent_comment_id` bigint(64) NULL, -- NULL if it's a comment on the post, or the id of the comment it replies to
+    `root_comment_id` bigint(64) NOT NULL DEFAULT 0, -- id of the root comment, equals comment_id for root comments
     `content` varchar(8192) COLLATE utf8mb4_general_ci NOT NULL,
     `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     `update_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    `edited_at` TIMESTAMP NULL, -- last time the content was edited, NULL if never edited
     `delete_at` TIMESTAMP,
     UNIQUE KEY `idx_comment_id`(`comment_id`),
+    KEY `idx_comment_root_comment_id`(`root_comment_id`),
+    KEY `idx_comment_parent_comment_id`(`parent_comment_id`),
 -- #     FOREIGN KEY (post_id) REFERENCES t_post(post_id),
 -- #     FOREIGN KEY (user_id) REFERENCES t_user(user_id),
 -- #     FOREIGN KEY (parent_comment_id) REFERENCES t_comment(comment_id) ON DELETE CASCADE,
     PRIMARY KEY (`id`)
 )ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
 
+DROP TABLE IF EXISTS `t_comment_history`;
+CREATE TABLE t_comment_history (
+    `id` bigint(64) NOT NULL AUTO_INCREMENT,
+    `comment_id` bigint(64) NOT NULL,
+    `editor_id` bigint(64) NOT NULL, -- The user who edited the comment
+    `content` varchar(8192) COLLATE utf8mb4_general_ci NOT NULL, -- content before the edit
+    `create_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `delete_at` TIMESTAMP,
+    KEY `idx_t_comment_history_comment_id`(`comment_id`),
+    PRIMARY KEY (`id`)
+)ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
 DROP TABLE IF EXISTS `t_like`;
 CREATE TABLE t_like (
     `id` bigint(64) NOT NULL AUTO_INCREMENT,
@@ -106,6 +132,7 @@ CREATE TABLE t_vote (
     `type` tinyint(4) NOT NULL,   -- The type,indicate the user like is a post or comment
     `target_id` bigint(64) NOT NULL, -- Post id or comment id
     `val` tinyint(4) NOT NULL,   -- The type,indicate the user comment is a vote-up or vote-down or not made
+    `weight` tinyint(4) NOT NULL DEFAULT '1', -- Voting weight of the user when the vote was made
     `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     `delete_at` TIMESTAMP,
     UNIQUE KEY `idx_vote_id`(`vote_id`),
@@ -157,3 +184,135 @@ CREATE TABLE t_follow (
     PRIMARY KEY (`id`)
 );
 
+DROP TABLE IF EXISTS `t_trash`;
+CREATE TABLE t_trash (
+    `id` bigint(64) NOT NULL AUTO_INCREMENT,
+    `trash_id` bigint(64) NOT NULL,
+    `type` tinyint(4) NOT NULL, -- 1 post, 2 comment
+    `target_id` bigint(64) NOT NULL,
+    `user_id` bigint(64) NOT NULL, -- author of the deleted content
+    `operator_id` bigint(64) NOT NULL,
+    `post_id` bigint(64) NOT NULL,
+    `community_id` bigint(64) NOT NULL,
+    `related_ids` text,
+    `title` varchar(128) COLLATE utf8mb4_general_ci,
+    `deleted_at` TIMESTAMP NOT NULL,
+    `expire_at` TIMESTAMP NOT NULL,
+    `create_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `delete_at` TIMESTAMP,
+    UNIQUE KEY `idx_trash_id`(`trash_id`),
+    KEY `idx_trash_user_id`(`user_id`),
+    KEY `idx_trash_expire_at`(`expire_at`),
+    PRIMARY KEY (`id`)
+);
+
+DROP TABLE IF EXISTS `t_mention`;
+CREATE TABLE t_mention (
+    `id` bigint(64) NOT NULL AUTO_INCREMENT,
+    `source_type` tinyint(4) NOT NULL, -- 1 post, 2 comment
+    `source_id` bigint(64) NOT NULL,
+    `post_id` bigint(64) NOT NULL,
+    `user_id` bigint(64) NOT NULL, -- mentioned user
+    `username` varchar(64) COLLATE utf8mb4_general_ci NOT NULL,
+    `author_id` bigint(64) NOT NULL,
+    `start` int NOT NULL,
+    `end` int NOT NULL,
+    `create_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `delete_at` TIMESTAMP,
+    KEY `idx_mention_source`(`source_type`, `source_id`),
+    KEY `idx_mention_user_id`(`user_id`),
+    PRIMARY KEY (`id`)
+);
+
+DROP TABLE IF EXISTS `t_notification`;
+CREATE TABLE t_notification (
+    `id` bigint(64) NOT NULL AUTO_INCREMENT,
+    `notification_id` bigint(64) NOT NULL,
+    `user_id` bigint(64) NOT NULL, -- receiver
+    `actor_id` bigint(64) NOT NULL,
+    `type` tinyint(4) NOT NULL, -- 1 mention
+    `source_type` tinyint(4) NOT NULL,
+    `source_id` bigint(64) NOT NULL,
+    `post_id` bigint(64) NOT NULL,
+    `content` varchar(256) COLLATE utf8mb4_general_ci,
+    `read_at` TIMESTAMP NULL,
+    `create_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `delete_at` TIMESTAMP,
+    UNIQUE KEY `idx_notification_id`(`notification_id`),
+    KEY `idx_notification_user`(`user_id`, `read_at`),
+    PRIMARY KEY (`id`)
+);
+
+DROP TABLE IF EXISTS `t_reaction`;
+CREATE TABLE t_reaction (
+    `id` bigint(64) NOT NULL AUTO_INCREMENT,
+    `user_id` bigint(64) NOT NULL,
+    `target_type` tinyint(4) NOT NULL, -- 1 post, 2 comment
+    `target_id` bigint(64) NOT NULL,
+    `emoji` varchar(32) COLLATE utf8mb4_general_ci NOT NULL,
+    `create_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `delete_at` TIMESTAMP,
+    UNIQUE KEY `idx_reaction`(`user_id`, `target_type`, `target_id`, `emoji`),
+    KEY `idx_reaction_target`(`target_type`, `target_id`),
+    PRIMARY KEY (`id`)
+);
+
+DROP TABLE IF EXISTS `t_user_mfa`;
+CREATE TABLE t_user_mfa (
+    `id` bigint(64) NOT NULL AUTO_INCREMENT,
+    `user_id` bigint(64) NOT NULL,
+    `secret` varchar(64) NOT NULL,
+    `enabled` tinyint(1) NOT NULL DEFAULT 0,
+    `enabled_at` TIMESTAMP NULL,
+    `recovery_codes` varchar(1024),
+    `last_step` bigint(64) NOT NULL DEFAULT 0,
+    `create_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `delete_at` TIMESTAMP,
+    UNIQUE KEY `idx_mfa_user`(`user_id`),
+    PRIMARY KEY (`id`)
+);
+
+DROP TABLE IF EXISTS `t_user_identity`;
+CREATE TABLE t_user_identity (
+    `id` bigint(64) NOT NULL AUTO_INCREMENT,
+    `user_id` bigint(64) NOT NULL,
+    `provider` varchar(32) NOT NULL, -- Name of the OpenID Connect provider in settings
+    `subject` varchar(255) NOT NULL, -- The sub claim of the provider's id token
+    `email` varchar(64),
+    `create_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `delete_at` TIMESTAMP,
+    UNIQUE KEY `idx_identity_user`(`user_id`, `provider`),
+    UNIQUE KEY `idx_identity_subject`(`provider`, `subject`),
+    PRIMARY KEY (`id`)
+);
+
+DROP TABLE IF EXISTS `t_user_badge`;
+CREATE TABLE t_user_badge (
+    `id` bigint(64) NOT NULL AUTO_INCREMENT,
+    `user_id` bigint(64) NOT NULL,
+    `badge` varchar(64) NOT NULL, -- Name of the badge rule
+    `period` varchar(16) NOT NULL DEFAULT '', -- Period of a recurring badge such as 2024-W05, empty for one-time badges
+    `create_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `delete_at` TIMESTAMP,
+    UNIQUE KEY `idx_user_badge`(`user_id`, `badge`, `period`),
+    PRIMARY KEY (`id`)
+);
+
+DROP TABLE IF EXISTS `t_user_preference`;
+CREATE TABLE t_user_preference (
+    `id` bigint(64) NOT NULL AUTO_INCREMENT,
+    `user_id` bigint(64) NOT NULL,
+    `post_sort` varchar(16) NOT NULL DEFAULT '', -- Default post list order, time or score
+    `language` varchar(16) NOT NULL DEFAULT '', -- zh or en
+    `email_mention` tinyint(1) NOT NULL DEFAULT 0, -- Send an email when mentioned
+    `email_badge` tinyint(1) NOT NULL DEFAULT 0, -- Send an email when a badge is awarded
+    `digest_frequency` varchar(16) NOT NULL DEFAULT '', -- instant, daily or weekly
+    `message_permission` tinyint(4) NOT NULL DEFAULT 0, -- Who can message me: 0 everyone, 1 users I follow, 2 nobody
+    `mention_permission` tinyint(4) NOT NULL DEFAULT 0, -- Who can mention me, same values as message_permission
+    `digest_sent_at` TIMESTAMP NULL,
+    `create_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `update_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    `delete_at` TIMESTAMP,
+    UNIQUE KEY `idx_preference_user`(`user_id`),
+    PRIMARY KEY (`id`)
+);
@@ -7,7 +7,8 @@ import (
 
 var Models = []interface{}{
 
-	&User{}, &Community{}, &Post{}, &Comment{}, &Like{}, &Conversation{}, &Message{}, &Follow{},
+	&User{}, &Community{}, &Post{}, &Comment{}, &Like{}, &Conversation{}, &Message{}, &Follow{}, &Trash{}, &CommentHistory{},
+	&Mention{}, &Notification{}, &Reaction{}, &UserMfa{}, &UserIdentity{}, &UserBadge{}, &UserPreference{},
 }
 
 type ParamUserSignUp struct {
@@ -24,10 +25,28 @@ type ParamUserSignIn struct {
 	Password    string `json:"password" binding:"required"`
 	CaptchaId   string `json:"captcha-id" binding:"required"`
 	CaptchaCode string `json:"captcha-code" binding:"required"`
+	// 设备名称，为空时根据User-Agent生成
+	DeviceName string `json:"device-name" binding:"omitempty,max=64"`
 }
 type ParamUserSignInViaEmail struct {
 	Email            string `json:"email" bind:"required"`
 	VerificationCode string `json:"code" binding:"required"`
+	// 设备名称，为空时根据User-Agent生成
+	DeviceName string `json:"device-name" binding:"omitempty,max=64"`
+}
+
+type ParamForgotPassword struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ParamResetPassword struct {
+	Token      string `json:"token" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+	RePassword string `json:"re_password" binding:"required,eqfield=Password"`
+}
+
+type ParamDeleteAccount struct {
+	Password string `json:"password" binding:"required"`
 }
 
 type ParamUserEditInfo struct {
@@ -39,6 +58,17 @@ type ParamVotePost struct {
 	PostId    string `json:"post_id" binding:"required"`
 	Direction *int8  `json:"direction" binding:"required,oneof=0 1 2"`
 }
+type ParamPinComment struct {
+	PostId int64 `json:"post-id,string" binding:"required"`
+	// 为0表示取消置顶
+	CommentId int64 `json:"comment-id,string"`
+}
+
+type ParamLockComment struct {
+	PostId int64 `json:"post-id,string" binding:"required"`
+	Lock   *bool `json:"lock" binding:"required"`
+}
+
 type ParamPostCreate struct {
 	Title       string `json:"title" binding:"required"`
 	Content     string `json:"content" binding:"required"`
@@ -50,11 +80,24 @@ const (
 	OrderByScore = "score"
 )
 
+// 评论列表的排序方式
+const (
+	CommentSortHot = "hot"
+	CommentSortNew = "new"
+	CommentSortOld = "old"
+)
+
+// CommentScoreScale Comment.Score 中保存的是评论热度乘以该倍数后取整的结果
+// 热度小于2，需要足够的精度保存用来区分先后的发布时间部分
+const CommentScoreScale = 1e12
+
 type ParamPostList struct {
 	Page        int    `form:"page"`
 	Size        int    `form:"size"`
 	Order       string `form:"order"`
 	CommunityId string `form:"community_id"`
+	// 只在内部使用，按作者筛选帖子，不能和CommunityId同时使用
+	AuthorId string `form:"-"`
 }
 
 type ParamPostList2 struct {
@@ -74,6 +117,11 @@ type ParamCreateComment struct {
 	Content         string `json:"content" binding:"required"`
 }
 
+type ParamEditComment struct {
+	CommentId int64  `json:"comment-id,string" binding:"required"`
+	Content   string `json:"content" binding:"required"`
+}
+
 type ParamVoteComment struct {
 	CommentId int64 `json:"comment-id,string" binding:"required"`
 	Direction int8  `json:"direction" binding:"required,oneof=0 1 -1"`
@@ -83,6 +131,118 @@ type ParamGetCommentByPostId struct {
 	Page   int    `form:"page"`
 	Size   int    `form:"size"`
 	PostId string `form:"post_id"`
+	Sort   string `form:"sort" binding:"omitempty,oneof=hot new old"` // 根评论的排序方式，默认为hot
+}
+
+type ParamTrashList struct {
+	Page int  `form:"page"`
+	Size int  `form:"size"`
+	Type int8 `form:"type" binding:"omitempty,oneof=1 2"`
+	// 版主/管理员可查看所有用户的回收站
+	All bool `form:"all"`
+}
+
+// ParamUserPreference 修改偏好设置，没有传的字段保持不变
+type ParamUserPreference struct {
+	PostSort          *string `json:"post_sort"`          // 帖子列表默认的排序方式，time或score
+	Language          *string `json:"language"`           // 邮件等使用的语言，zh或en
+	EmailMention      *bool   `json:"email_mention"`      // 被@时是否发送邮件
+	EmailBadge        *bool   `json:"email_badge"`        // 获得徽章时是否发送邮件
+	DigestFrequency   *string `json:"digest_frequency"`   // 通知邮件的发送频率，instant、daily或weekly
+	MessagePermission *int8   `json:"message_permission"` // 谁可以私信我，0所有人，1我关注的用户，2任何人都不可以
+	MentionPermission *int8   `json:"mention_permission"` // 谁可以@我，取值同上
+}
+
+type ParamNotificationList struct {
+	Page int `form:"page"`
+	Size int `form:"size"`
+	// 只查看未读的通知
+	Unread bool `form:"unread"`
+}
+
+type ParamReadNotification struct {
+	// 为空表示将所有通知标记为已读
+	NotificationIds []string `json:"notification-ids"`
+}
+
+type ParamUserAutocomplete struct {
+	Prefix string `form:"prefix" binding:"required"`
+	Size   int    `form:"size"`
+}
+
+type ParamFollowList struct {
+	Page int `form:"page"`
+	Size int `form:"size"`
+}
+
+type ParamCommonFollows struct {
+	Page int `form:"page"`
+	Size int `form:"size"`
+	// 与路径中的用户比较的另一个用户，为空时使用当前登录的用户
+	OtherUserId int64 `form:"other_user_id"`
+}
+
+type ParamMfaCode struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type ParamMfaLogin struct {
+	// 登录第一步返回的mfa-token
+	MfaToken string `json:"mfa-token" binding:"required"`
+	// 身份验证器App中的6位验证码，或者一个恢复码
+	Code string `json:"code" binding:"required"`
+}
+
+type ParamMfaEnroll struct {
+	MfaToken string `json:"mfa-token" binding:"required"`
+}
+
+type ParamDisableMfa struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type ParamMfaPolicy struct {
+	// 必须开启两步验证的角色，1为版主，2为管理员，为空表示不强制
+	RequiredRoles []int8 `json:"required-roles" binding:"dive,oneof=1 2"`
+}
+
+type ParamOidcAuthorize struct {
+	// 登录时记录的设备名称，为空时根据User-Agent生成
+	DeviceName string `form:"device-name"`
+}
+
+// ParamOidcCallback 身份提供方跳转回前端页面时携带的参数
+type ParamOidcCallback struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+type ParamReaction struct {
+	// 为1表示帖子，为2表示评论
+	TargetType int8   `json:"target-type" binding:"required,oneof=1 2"`
+	TargetId   int64  `json:"target-id,string" binding:"required"`
+	Emoji      string `json:"emoji" binding:"required"`
+	// 为1表示添加回应，为-1表示取消回应
+	Action int8 `json:"action" binding:"required,oneof=1 -1"`
+}
+
+type ParamGetReactions struct {
+	TargetType int8  `form:"target-type" binding:"required,oneof=1 2"`
+	TargetId   int64 `form:"target-id" binding:"required"`
+}
+
+type ParamCommunityReactions struct {
+	CommunityId int64    `json:"community-id,string" binding:"required"`
+	Reactions   []string `json:"reactions" binding:"required"`
+}
+
+// ParamCommunityReputation 社区的声望门槛，字段为空时恢复为全局配置
+type ParamCommunityReputation struct {
+	CommunityId         int64  `json:"community-id,string" binding:"required"`
+	PublishThreshold    *int64 `json:"publish-threshold"`
+	VoteWeightThreshold *int64 `json:"vote-weight-threshold"`
+	LinkThreshold       *int64 `json:"link-threshold"`
 }
 
 type ParamFollowUser struct {
@@ -100,11 +260,144 @@ type ResponseComment struct {
 	Username   string            `json:"username"`
 	Content    string            `json:"content"`
 	UpdateAt   time.Time         `json:"update-at,omitempty"`
+	Edited     bool              `json:"edited"`
+	Pinned     bool              `json:"pinned,omitempty"`
+	EditedAt   *time.Time        `json:"edited-at,omitempty"`
 	VoteNum    int               `json:"vote-num"`
 	ReplyTo    string            `json:"reply-to,omitempty"`
+	Mentions   []MentionSpan     `json:"mentions,omitempty"`
 	SubComment []ResponseComment `json:"sub-comment,omitempty"`
 }
 
+// MentionSpan 内容中@用户的位置，Start和End为字符(rune)下标，区间左闭右开，包含@符号
+type MentionSpan struct {
+	UserId   int64  `json:"user_id,string"`
+	Username string `json:"username"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+// ResponseAccountDeletion 账号注销的状态
+type ResponseAccountDeletion struct {
+	Requested bool       `json:"requested"`
+	RequestAt *time.Time `json:"request_at,omitempty"`
+	// 冷静期结束的时间，在此之前可以撤销注销申请
+	PurgeAt *time.Time `json:"purge_at,omitempty"`
+}
+
+// ResponseDataExport 个人数据导出的状态
+type ResponseDataExport struct {
+	// pending表示正在生成，ready表示可以下载，failed表示生成失败，none表示没有导出记录
+	Status   string    `json:"status"`
+	CreateAt time.Time `json:"create_at,omitempty"`
+	ExpireAt time.Time `json:"expire_at,omitempty"`
+}
+
+// ResponseReactions 帖子/评论的emoji回应统计
+type ResponseReactions struct {
+	// 所在社区可用的回应
+	Available []string `json:"available"`
+	// 每种回应的数量
+	Counts map[string]int64 `json:"counts"`
+	// 当前用户添加过的回应
+	Mine []string `json:"mine"`
+}
+
+// ResponseUserBrief 用户名自动补全时返回的用户信息
+type ResponseUserBrief struct {
+	UserId   int64  `json:"user_id,string"`
+	Username string `json:"username"`
+}
+
+// ResponseUserProfile 用户的公开主页
+type ResponseUserProfile struct {
+	UserId         int64     `json:"user_id,string"`
+	Username       string    `json:"username"`
+	Gender         int8      `json:"gender"`
+	JoinAt         time.Time `json:"join_at"`
+	PostCount      int64     `json:"post_count"`
+	CommentCount   int64     `json:"comment_count"`
+	LikesReceived  int64     `json:"likes_received"`
+	Reputation     int64     `json:"reputation"`
+	FollowerCount  int64     `json:"follower_count"`
+	FollowingCount int64     `json:"following_count"`
+	// 当前登录的用户是否关注了该用户，未登录时为false
+	Followed bool `json:"followed"`
+	// 获得的徽章，最新获得的在前
+	Badges []ResponseBadge `json:"badges"`
+}
+
+// ResponseBadge 用户获得的徽章
+type ResponseBadge struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// 按周期颁发的徽章所属的周期，例如2024-W05，一次性的徽章为空
+	Period    string    `json:"period,omitempty"`
+	AwardedAt time.Time `json:"awarded_at"`
+}
+
+// ResponseFollowUser 关注/粉丝列表中的用户，关系标记都是相对当前登录的用户，未登录时为false
+type ResponseFollowUser struct {
+	UserId   int64  `json:"user_id,string"`
+	Username string `json:"username"`
+	Gender   int8   `json:"gender"`
+	// 当前登录的用户是否关注了该用户
+	Followed bool `json:"followed"`
+	// 该用户是否关注了当前登录的用户
+	FollowsYou bool `json:"follows_you"`
+	// 是否互相关注
+	Mutual bool `json:"mutual"`
+}
+
+type ResponseTrashList struct {
+	Total int64   `json:"total"`
+	List  []Trash `json:"list"`
+}
+
+type ResponseFollowList struct {
+	Total int64                `json:"total"`
+	List  []ResponseFollowUser `json:"list"`
+}
+
+// ResponseMfaSetup 开始绑定身份验证器时返回的密钥，客户端用provisioning_uri生成二维码
+type ResponseMfaSetup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type ResponseMfaStatus struct {
+	Enabled bool `json:"enabled"`
+	// 用户的角色是否被要求必须开启两步验证
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+type ResponseOidcAuthorize struct {
+	// 前端跳转到该地址完成第三方登录
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// SessionDevice 登录时记录的设备信息
+type SessionDevice struct {
+	Name      string
+	UserAgent string
+	IP        string
+}
+
+// Session 用户在某个设备上的登录会话
+type Session struct {
+	SessionId  string    `json:"session_id"`
+	Name       string    `json:"name"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreateAt   time.Time `json:"create_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpireAt   time.Time `json:"expire_at"`
+	// 是否为发起当前请求的会话
+	Current bool `json:"current"`
+}
+
 type Model struct {
 	Id       int64          `gorm:"size:64;primaryKey;autoIncrement;column:id" json:"id"`
 	CreateAt time.Time      `gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP;column:create_at" json:"create_at"`
@@ -125,6 +418,12 @@ type Post struct {
 	VoteUpNums   int64  `gorm:"size:64;default:0;column:vote_up_nums" json:"vote_up_nums,string"`
 	VoteDownNums int64  `gorm:"size:64;default:0;column:vote_down_nums" json:"vote_down_nums,string"`
 	Score        int64  `gorm:"size:64;default:0;column:score" json:"score,string"`
+	ShareNums    int64  `gorm:"size:64;default:0;column:share_nums" json:"share_nums,string"`
+	// 作者置顶的根评论，为0表示没有置顶
+	PinnedCommentId int64 `gorm:"size:64;default:0;column:pinned_comment_id" json:"pinned_comment_id,string"`
+	// 是否禁止评论，以及执行锁定操作的用户，版主锁定的帖子作者无法解锁
+	CommentLocked   bool  `gorm:"not null;default:false;column:comment_locked" json:"comment_locked"`
+	CommentLockedBy int64 `gorm:"size:64;default:0;column:comment_locked_by" json:"-"`
 
 	UpdateAt time.Time `gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP;;column:update_at" json:"update_at"`
 }
@@ -135,29 +434,64 @@ type PostDetail struct {
 	YesVotes      int64     `json:"yes_votes"`
 	CommentNum    int64     `json:"comment_nums"`
 	ClickNums     int64     `json:"click_nums"`
+	ShareNums     int64     `json:"share_nums"`
 	Content       string    `json:"content"`
 	UpdateAt      time.Time `json:"update_at"`
 	CommunityName string    `json:"community_name,omitempty"`
+	// 置顶的根评论以及是否禁止评论
+	PinnedCommentId int64 `json:"pinned_comment_id,string,omitempty"`
+	CommentLocked   bool  `json:"comment_locked"`
+	// 正文中@到的用户
+	Mentions []MentionSpan `json:"mentions,omitempty"`
+	// emoji回应
+	Reactions *ResponseReactions `json:"reactions,omitempty"`
+	// 热度最高的几条根评论
+	TopComments []ResponseComment `json:"top_comments,omitempty"`
 }
 
 type User struct {
 	Model
 	UserId   int64     `gorm:"size:64;not null;uniqueIndex:idx_user_id;column:user_id" json:"user_id,string"`
 	Username string    `gorm:"size:64;not null;uniqueIndex:idx_username;column:username" json:"username"`
-	Password string    `gorm:"size:64;not null;column:password"`
+	Password string    `gorm:"size:255;not null;column:password"`
 	Gender   int8      `gorm:"size:4;not null;default:0;column:gender" json:"gender"`
 	Status   int8      `gorm:"size:4;not null;default:0;column:status" json:"status"`
 	Email    string    `gorm:"size:64;column:email" json:"email"`
 	Verified bool      `gorm:"default:false;column:verified"`
+	Role     int8      `gorm:"size:4;not null;default:0;column:role" json:"role"` // 用户角色，取值为0，1，2，分别表示普通用户，版主，管理员
 	UpdateAt time.Time `gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP;column:update_at" json:"update_at"`
+
+	// 申请注销账号的时间，冷静期结束后账号会被匿名化，为空表示没有申请注销
+	DeleteRequestAt *time.Time `gorm:"column:delete_request_at" json:"-"`
+	// 声望，由获得的点赞、点踩、收藏以及被版主处理的记录增量计算
+	Reputation int64 `gorm:"not null;default:0;column:reputation" json:"reputation"`
 }
 
+const (
+	RoleNormal    = 0
+	RoleModerator = 1
+	RoleAdmin     = 2
+)
+
+const (
+	UserStatusDeleted     = 2              // 账号已注销，用户名、邮箱、密码已被清除
+	DeletedUsername       = "deleted user" // 已注销用户发布的内容显示的作者名称
+	DeletedUsernamePrefix = "deleted_"     // 注销账号的用户名前缀，注册以及第三方登录时不能使用
+)
+
 type Community struct {
 	Model
-	CommunityId   int64     `gorm:"size:64;not null;uniqueIndex:idx_community_id;column:community_id" json:"community_id,string"`
-	CommunityName string    `gorm:"size:128;not null;uniqueIndex:idx_community_name;column:community_name" json:"community_name"`
-	Introduction  string    `gorm:"size:256;not null;column:introduction" json:"introduction,omitempty"`
-	UpdateAt      time.Time `gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP;column:update_at" json:"update_at"`
+	CommunityId   int64  `gorm:"size:64;not null;uniqueIndex:idx_community_id;column:community_id" json:"community_id,string"`
+	CommunityName string `gorm:"size:128;not null;uniqueIndex:idx_community_name;column:community_name" json:"community_name"`
+	Introduction  string `gorm:"size:256;not null;column:introduction" json:"introduction,omitempty"`
+	// 社区可用的emoji回应，用逗号分隔，为空时使用默认的回应
+	Reactions string    `gorm:"size:256;column:reactions" json:"reactions,omitempty"`
+	UpdateAt  time.Time `gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP;column:update_at" json:"update_at"`
+
+	// 社区单独配置的声望门槛，为空时使用全局配置
+	PublishThreshold    *int64 `gorm:"column:publish_threshold" json:"publish_threshold,omitempty"`
+	VoteWeightThreshold *int64 `gorm:"column:vote_weight_threshold" json:"vote_weight_threshold,omitempty"`
+	LinkThreshold       *int64 `gorm:"column:link_threshold" json:"link_threshold,omitempty"`
 }
 
 type Comment struct {
@@ -169,12 +503,15 @@ type Comment struct {
 	Content         string    `gorm:"size:8192;type:varchar(8192);not null;column:content" json:"content"`
 	UpdateAt        time.Time `gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP;column:update_at" json:"update_at"`
 
+	// 所在根评论的id，根评论为自身的id，用于一次查询出根评论下的所有追评
 	RootCommentId int64 `gorm:"size:64;index;column:root_comment_id" json:"root_comment_id,string"`
 	ClickNums     int64 `gorm:"size:64;default:0;column:click_nums" json:"click_nums,string"`
 	CommentNums   int64 `gorm:"size:64;default:0;column:comment_nums" json:"comment_nums,string"`
 	VoteUpNums    int64 `gorm:"size:64;default:0;column:vote_up_nums" json:"vote_up_nums,string"`
 	VoteDownNums  int64 `gorm:"size:64;default:0;column:vote_down_nums" json:"vote_down_nums,string"`
 	Score         int64 `gorm:"size:64;default:0;column:score" json:"score,string"`
+	// 最后一次编辑的时间，为空表示没有编辑过
+	EditedAt *time.Time `gorm:"type:timestamp;column:edited_at" json:"edited_at,omitempty"`
 	// Relationships
 	//Post          Post      `gorm:"foreignKey:PostId;references:PostId"`
 	//User          User      `gorm:"foreignKey:UserId;references:UserId"`
@@ -205,6 +542,8 @@ type Vote struct {
 	TargetId int64 `gorm:"size:64;null;index;column:target_id" json:"target_id,string"`
 	// 表示评论类型，取值为0，1，-1，分别表示未评论，赞，踩
 	Val int8 `gorm:"size:4;not null;column:val" json:"val"`
+	// 投票时用户的投票权重，计算帖子得分时使用，取消投票时按原来的权重扣除
+	Weight int8 `gorm:"size:4;not null;default:1;column:weight" json:"-"`
 }
 
 // Custom validation logic to enforce CHECK constraint
@@ -249,3 +588,145 @@ type Follow struct {
 	//Follower  User `gorm:"foreignKey:FollowerId;references:UserId"`
 	//Following User `gorm:"foreignKey:FollowingId;references:UserId"`
 }
+
+// Trash 回收站记录，帖子/评论被软删除时写入，在保留期内可以恢复，过期后由定时任务彻底删除
+type Trash struct {
+	Model
+	TrashId int64 `gorm:"size:64;not null;uniqueIndex:idx_trash_id;column:trash_id" json:"trash_id,string"`
+	// 为1表示帖子，为2表示评论
+	Type     int8  `gorm:"size:4;not null;column:type" json:"type"`
+	TargetId int64 `gorm:"size:64;not null;index;column:target_id" json:"target_id,string"`
+	// 被删除内容的作者
+	UserId int64 `gorm:"size:64;not null;index;column:user_id" json:"user_id,string"`
+	// 执行删除操作的用户
+	OperatorId  int64 `gorm:"size:64;not null;column:operator_id" json:"operator_id,string"`
+	PostId      int64 `gorm:"size:64;not null;column:post_id" json:"post_id,string"`
+	CommunityId int64 `gorm:"size:64;not null;column:community_id" json:"community_id,string"`
+	// 和目标一起被删除的评论id，用逗号分隔
+	RelatedIds string    `gorm:"type:text;column:related_ids" json:"-"`
+	Title      string    `gorm:"size:128;column:title" json:"title"`
+	DeletedAt  time.Time `gorm:"type:timestamp;not null;column:deleted_at" json:"deleted_at"`
+	ExpireAt   time.Time `gorm:"type:timestamp;not null;index;column:expire_at" json:"expire_at"`
+}
+
+// CommentHistory 评论被编辑之前的版本
+type CommentHistory struct {
+	Model
+	CommentId int64  `gorm:"size:64;not null;index;column:comment_id" json:"comment_id,string"`
+	EditorId  int64  `gorm:"size:64;not null;column:editor_id" json:"editor_id,string"`
+	Content   string `gorm:"size:8192;type:varchar(8192);not null;column:content" json:"content"`
+}
+
+// Mention 帖子/评论中@用户的记录，编辑内容时会重新生成
+type Mention struct {
+	Model
+	// 为1表示帖子，为2表示评论
+	SourceType int8   `gorm:"size:4;not null;index:idx_mention_source;column:source_type" json:"source_type"`
+	SourceId   int64  `gorm:"size:64;not null;index:idx_mention_source;column:source_id" json:"source_id,string"`
+	PostId     int64  `gorm:"size:64;not null;column:post_id" json:"post_id,string"`
+	UserId     int64  `gorm:"size:64;not null;index;column:user_id" json:"user_id,string"`
+	Username   string `gorm:"size:64;not null;column:username" json:"username"`
+	AuthorId   int64  `gorm:"size:64;not null;column:author_id" json:"author_id,string"`
+	Start      int    `gorm:"not null;column:start" json:"start"`
+	End        int    `gorm:"not null;column:end" json:"end"`
+}
+
+const (
+	NotificationMention = 1 // 被@
+	NotificationBadge   = 2 // 获得徽章
+)
+
+// Notification 站内通知
+type Notification struct {
+	Model
+	NotificationId int64 `gorm:"size:64;not null;uniqueIndex:idx_notification_id;column:notification_id" json:"notification_id,string"`
+	// 接收通知的用户
+	UserId int64 `gorm:"size:64;not null;index:idx_notification_user;column:user_id" json:"user_id,string"`
+	// 触发通知的用户
+	ActorId    int64      `gorm:"size:64;not null;column:actor_id" json:"actor_id,string"`
+	Type       int8       `gorm:"size:4;not null;column:type" json:"type"`
+	SourceType int8       `gorm:"size:4;not null;column:source_type" json:"source_type"`
+	SourceId   int64      `gorm:"size:64;not null;column:source_id" json:"source_id,string"`
+	PostId     int64      `gorm:"size:64;not null;column:post_id" json:"post_id,string"`
+	Content    string     `gorm:"size:256;column:content" json:"content"`
+	ReadAt     *time.Time `gorm:"type:timestamp;index:idx_notification_user;column:read_at" json:"read_at,omitempty"`
+}
+
+// Reaction 用户对帖子/评论的emoji回应，同一用户可以对同一目标添加多种不同的回应
+type Reaction struct {
+	Model
+	UserId int64 `gorm:"size:64;not null;uniqueIndex:idx_reaction;column:user_id" json:"user_id,string"`
+	// 为1表示帖子，为2表示评论
+	TargetType int8   `gorm:"size:4;not null;uniqueIndex:idx_reaction;index:idx_reaction_target;column:target_type" json:"target_type"`
+	TargetId   int64  `gorm:"size:64;not null;uniqueIndex:idx_reaction;index:idx_reaction_target;column:target_id" json:"target_id,string"`
+	Emoji      string `gorm:"size:32;not null;uniqueIndex:idx_reaction;column:emoji" json:"emoji"`
+}
+
+// UserMfa 用户的两步验证（TOTP）设置，确认绑定之前Enabled为false
+type UserMfa struct {
+	Model
+	UserId    int64      `gorm:"size:64;not null;uniqueIndex:idx_mfa_user;column:user_id" json:"user_id,string"`
+	Secret    string     `gorm:"size:64;not null;column:secret" json:"-"`
+	Enabled   bool       `gorm:"not null;default:false;column:enabled" json:"enabled"`
+	EnabledAt *time.Time `gorm:"column:enabled_at" json:"enabled_at,omitempty"`
+	// 恢复码的SHA-256哈希，用逗号分隔，每个恢复码只能使用一次
+	RecoveryCodes string `gorm:"size:1024;column:recovery_codes" json:"-"`
+	// 最近一次验证成功的时间步，同一个验证码不能重复使用
+	LastStep int64 `gorm:"not null;default:0;column:last_step" json:"-"`
+}
+
+// UserIdentity 用户绑定的第三方OpenID Connect账号，每个身份提供方最多绑定一个
+type UserIdentity struct {
+	Model
+	UserId   int64  `gorm:"size:64;not null;uniqueIndex:idx_identity_user;column:user_id" json:"user_id,string"`
+	Provider string `gorm:"size:32;not null;uniqueIndex:idx_identity_user;uniqueIndex:idx_identity_subject;column:provider" json:"provider"`
+	// 用户在身份提供方的唯一标识，即id token中的sub
+	Subject string `gorm:"size:255;not null;uniqueIndex:idx_identity_subject;column:subject" json:"-"`
+	Email   string `gorm:"size:64;column:email" json:"email"`
+}
+
+// UserBadge 用户获得的徽章，同一徽章在同一周期内只颁发一次
+type UserBadge struct {
+	Model
+	UserId int64  `gorm:"size:64;not null;uniqueIndex:idx_user_badge;column:user_id" json:"user_id,string"`
+	Badge  string `gorm:"size:64;not null;uniqueIndex:idx_user_badge;column:badge" json:"badge"`
+	// 按周期颁发的徽章所属的周期，一次性的徽章为空
+	Period string `gorm:"size:16;not null;default:'';uniqueIndex:idx_user_badge;column:period" json:"period"`
+}
+
+// 谁可以私信/@我
+const (
+	AllowEveryone  = 0 // 所有人
+	AllowFollowing = 1 // 只有我关注的用户
+	AllowNobody    = 2 // 任何人都不可以
+)
+
+// 通知邮件的发送频率
+const (
+	DigestInstant = "instant" // 每条通知立即发送
+	DigestDaily   = "daily"   // 每天发送一封摘要
+	DigestWeekly  = "weekly"  // 每周发送一封摘要
+)
+
+// 偏好设置支持的语言
+const (
+	LanguageZh = "zh"
+	LanguageEn = "en"
+)
+
+// UserPreference 用户的偏好设置，没有保存过的用户所有字段都为零值，字段为空时使用默认值
+type UserPreference struct {
+	Model
+	UserId   int64  `gorm:"size:64;not null;uniqueIndex:idx_preference_user;column:user_id" json:"-"`
+	PostSort string `gorm:"size:16;not null;default:'';column:post_sort" json:"post_sort"`
+	Language string `gorm:"size:16;not null;default:'';column:language" json:"language"`
+	// 各类通知是否发送邮件，只会发送到已验证的邮箱
+	EmailMention      bool   `gorm:"not null;default:false;column:email_mention" json:"email_mention"`
+	EmailBadge        bool   `gorm:"not null;default:false;column:email_badge" json:"email_badge"`
+	DigestFrequency   string `gorm:"size:16;not null;default:'';column:digest_frequency" json:"digest_frequency"`
+	MessagePermission int8   `gorm:"size:4;not null;default:0;column:message_permission" json:"message_permission"`
+	MentionPermission int8   `gorm:"size:4;not null;default:0;column:mention_permission" json:"mention_permission"`
+	// 上一次发送通知摘要的时间
+	DigestSentAt *time.Time `gorm:"column:digest_sent_at" json:"-"`
+	UpdateAt     time.Time  `gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP;column:update_at" json:"update_at"`
+}
@@ -0,0 +1,53 @@
+package base62
+
+import (
+	"errors"
+	"math"
+)
+
+const alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var ERROR_INVALID_BASE62 = errors.New("invalid base62 string")
+
+// Encode 将非负整数编码为base62字符串
+func Encode(n uint64) string {
+	if n == 0 {
+		return alphabet[:1]
+	}
+	var buf [11]byte // uint64最多需要11位base62字符
+	i := len(buf)
+	for n > 0 {
+		i--
+		buf[i] = alphabet[n%62]
+		n /= 62
+	}
+	return string(buf[i:])
+}
+
+// Decode 将base62字符串解码为整数
+func Decode(s string) (uint64, error) {
+	if len(s) == 0 {
+		return 0, ERROR_INVALID_BASE62
+	}
+	var n uint64
+	for i := 0; i < len(s); i++ {
+		d := index(s[i])
+		if d < 0 || n > (math.MaxUint64-uint64(d))/62 {
+			return 0, ERROR_INVALID_BASE62
+		}
+		n = n*62 + uint64(d)
+	}
+	return n, nil
+}
+
+func index(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 36
+	}
+	return -1
+}
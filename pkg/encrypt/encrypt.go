@@ -1,16 +1,166 @@
 package encrypt
 
 import (
+	"bluebell/settings"
 	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
 )
 
-// 进行加密操作
-var salt = "www.chan.com"
+// 密码哈希的存储格式，通过前缀区分算法和版本：
+//   argon2id: $argon2id$v=19$m=65536,t=3,p=2$<盐值>$<哈希值>，每个用户使用随机生成的盐值
+//   bcrypt:   $2a$10$<盐值和哈希值>
+//   MD5:      32位十六进制字符串，使用全局盐值的旧格式，只用于校验，登录成功后会升级为新格式
 
-func Encrypt(pwd string) string {
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+var ERROR_INVALID_HASH = errors.New("invalid password hash")
+
+var params = struct {
+	algorithm         string
+	argon2Memory      uint32
+	argon2Iterations  uint32
+	argon2Parallelism uint8
+	bcryptCost        int
+}{
+	algorithm:         AlgorithmArgon2id,
+	argon2Memory:      64 * 1024,
+	argon2Iterations:  3,
+	argon2Parallelism: 2,
+	bcryptCost:        bcrypt.DefaultCost,
+}
+
+// 旧版MD5哈希使用的全局盐值
+var legacySalt = "www.chan.com"
+
+// Init 根据配置设置哈希算法和参数，未配置的参数使用默认值
+func Init(cfg *settings.PasswordConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	switch cfg.Algorithm {
+	case "":
+	case AlgorithmArgon2id, AlgorithmBcrypt:
+		params.algorithm = cfg.Algorithm
+	default:
+		return fmt.Errorf("unsupported password hash algorithm: %s", cfg.Algorithm)
+	}
+	if cfg.Argon2Memory > 0 {
+		params.argon2Memory = cfg.Argon2Memory
+	}
+	if cfg.Argon2Iterations > 0 {
+		params.argon2Iterations = cfg.Argon2Iterations
+	}
+	if cfg.Argon2Parallelism > 0 {
+		params.argon2Parallelism = cfg.Argon2Parallelism
+	}
+	if cfg.BcryptCost > 0 {
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost should be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		params.bcryptCost = cfg.BcryptCost
+	}
+	return nil
+}
+
+// Hash 使用配置的算法计算密码的哈希值
+func Hash(pwd string) (string, error) {
+	if params.algorithm == AlgorithmBcrypt {
+		h, err := bcrypt.GenerateFromPassword([]byte(pwd), params.bcryptCost)
+		return string(h), err
+	}
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(pwd), salt, params.argon2Iterations, params.argon2Memory, params.argon2Parallelism, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		params.argon2Memory, params.argon2Iterations, params.argon2Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify 校验密码和哈希值是否匹配，比较时使用常数时间，避免时序攻击
+func Verify(pwd, hashed string) bool {
+	switch {
+	case strings.HasPrefix(hashed, "$argon2id$"):
+		p, salt, key, err := decodeArgon2id(hashed)
+		if err != nil {
+			return false
+		}
+		other := argon2.IDKey([]byte(pwd), salt, p.iterations, p.memory, p.parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1
+	case strings.HasPrefix(hashed, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(pwd)) == nil
+	default:
+		return subtle.ConstantTimeCompare([]byte(legacyMD5(pwd)), []byte(hashed)) == 1
+	}
+}
+
+// NeedsRehash 哈希值不是当前配置的算法和参数生成时，需要在登录成功后重新计算
+func NeedsRehash(hashed string) bool {
+	switch {
+	case strings.HasPrefix(hashed, "$argon2id$"):
+		if params.algorithm != AlgorithmArgon2id {
+			return true
+		}
+		p, _, _, err := decodeArgon2id(hashed)
+		return err != nil || p.memory != params.argon2Memory || p.iterations != params.argon2Iterations ||
+			p.parallelism != params.argon2Parallelism
+	case strings.HasPrefix(hashed, "$2"):
+		if params.algorithm != AlgorithmBcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(hashed))
+		return err != nil || cost != params.bcryptCost
+	default:
+		return true
+	}
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func decodeArgon2id(hashed string) (p argon2Params, salt, key []byte, err error) {
+	// 切分后为 "", "argon2id", "v=19", "m=65536,t=3,p=2", 盐值, 哈希值
+	parts := strings.Split(hashed, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ERROR_INVALID_HASH
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ERROR_INVALID_HASH
+	}
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return p, nil, nil, ERROR_INVALID_HASH
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, nil, nil, ERROR_INVALID_HASH
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return p, nil, nil, ERROR_INVALID_HASH
+	}
+	return p, salt, key, nil
+}
+
+func legacyMD5(pwd string) string {
 	h := md5.New()
-	h.Write([]byte(salt))
+	h.Write([]byte(legacySalt))
 	h.Write([]byte(pwd))
 	return hex.EncodeToString(h.Sum(nil))
 }
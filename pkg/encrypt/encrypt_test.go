@@ -0,0 +1,194 @@
+package encrypt
+
+import (
+	"bluebell/settings"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+// 旧版格式：md5("www.chan.com" + "123456")
+const legacyHash = "14c8fa3513b4a1fdfc256c53154ce32f"
+
+// useParams 使用cfg对应的哈希参数运行测试，结束后恢复原来的参数
+func useParams(t *testing.T, cfg *settings.PasswordConfig) {
+	t.Helper()
+	saved := params
+	t.Cleanup(func() { params = saved })
+	if err := Init(cfg); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+}
+
+// 测试中使用较小的参数，加快运行速度
+var (
+	argon2Cfg = &settings.PasswordConfig{Algorithm: AlgorithmArgon2id, Argon2Memory: 1024, Argon2Iterations: 1, Argon2Parallelism: 1}
+	bcryptCfg = &settings.PasswordConfig{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost}
+)
+
+func TestVerify(t *testing.T) {
+	useParams(t, argon2Cfg)
+	argon2Hash, err := Hash("123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		hashed string
+		pwd    string
+		want   bool
+	}{
+		{"argon2id", argon2Hash, "123456", true},
+		{"argon2id wrong password", argon2Hash, "1234567", false},
+		{"bcrypt", string(bcryptHash), "123456", true},
+		{"bcrypt wrong password", string(bcryptHash), "654321", false},
+		{"legacy md5", legacyHash, "123456", true},
+		{"legacy md5 wrong password", legacyHash, "12345", false},
+		{"legacy md5 upper case", strings.ToUpper(legacyHash), "123456", false},
+		{"empty hash", "", "", false},
+		{"argon2id missing field", strings.Join(strings.Split(argon2Hash, "$")[:5], "$"), "123456", false},
+		{"argon2id wrong version", strings.Replace(argon2Hash, "v=19", "v=16", 1), "123456", false},
+		{"argon2id bad params", strings.Replace(argon2Hash, "m=1024,t=1,p=1", "m=x,t=1,p=1", 1), "123456", false},
+		{"argon2id bad salt", replacePart(argon2Hash, 4, "!!!"), "123456", false},
+		{"argon2id empty key", replacePart(argon2Hash, 5, ""), "123456", false},
+		{"argon2id truncated key", argon2Hash[:len(argon2Hash)-4], "123456", false},
+		{"bcrypt truncated", string(bcryptHash[:len(bcryptHash)-10]), "123456", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.pwd, tt.hashed); got != tt.want {
+				t.Errorf("Verify(%q, %q) = %v, want %v", tt.pwd, tt.hashed, got, tt.want)
+			}
+		})
+	}
+}
+
+func replacePart(hashed string, i int, part string) string {
+	parts := strings.Split(hashed, "$")
+	parts[i] = part
+	return strings.Join(parts, "$")
+}
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    *settings.PasswordConfig
+		prefix string
+	}{
+		{"argon2id", argon2Cfg, "$argon2id$v=19$m=1024,t=1,p=1$"},
+		{"bcrypt", bcryptCfg, "$2a$04$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useParams(t, tt.cfg)
+			h1, err := Hash("123456")
+			if err != nil {
+				t.Fatal(err)
+			}
+			h2, err := Hash("123456")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(h1, tt.prefix) {
+				t.Errorf("Hash() = %s, want prefix %s", h1, tt.prefix)
+			}
+			// 每次使用随机盐值
+			if h1 == h2 {
+				t.Error("Hash() returned the same hash twice")
+			}
+			if !Verify("123456", h1) || Verify("654321", h1) {
+				t.Errorf("Verify() does not match the hash %s", h1)
+			}
+			if NeedsRehash(h1) {
+				t.Errorf("NeedsRehash(%s) = true for the configured parameters", h1)
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	useParams(t, argon2Cfg)
+	argon2Hash, err := Hash("123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cfg    *settings.PasswordConfig
+		hashed string
+		want   bool
+	}{
+		{"legacy md5", argon2Cfg, legacyHash, true},
+		{"malformed", argon2Cfg, "$argon2id$v=19$broken", true},
+		{"argon2id current", argon2Cfg, argon2Hash, false},
+		{"argon2id memory changed", &settings.PasswordConfig{Argon2Memory: 2048}, argon2Hash, true},
+		{"argon2id iterations changed", &settings.PasswordConfig{Argon2Iterations: 2}, argon2Hash, true},
+		{"argon2id switched to bcrypt", bcryptCfg, argon2Hash, true},
+		{"bcrypt current", bcryptCfg, string(bcryptHash), false},
+		{"bcrypt cost changed", &settings.PasswordConfig{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost + 1}, string(bcryptHash), true},
+		{"bcrypt switched to argon2id", argon2Cfg, string(bcryptHash), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useParams(t, tt.cfg)
+			if got := NeedsRehash(tt.hashed); got != tt.want {
+				t.Errorf("NeedsRehash(%s) = %v, want %v", tt.hashed, got, tt.want)
+			}
+		})
+	}
+}
+
+// 登录时的升级流程：旧格式的哈希校验成功后重新计算，新的哈希使用当前的算法并且不再需要升级
+func TestUpgradeLegacyHash(t *testing.T) {
+	for _, cfg := range []*settings.PasswordConfig{argon2Cfg, bcryptCfg} {
+		t.Run(cfg.Algorithm, func(t *testing.T) {
+			useParams(t, cfg)
+			if !Verify("123456", legacyHash) {
+				t.Fatal("legacy hash does not verify")
+			}
+			if !NeedsRehash(legacyHash) {
+				t.Fatal("legacy hash does not need rehash")
+			}
+			upgraded, err := Hash("123456")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !Verify("123456", upgraded) || NeedsRehash(upgraded) {
+				t.Fatalf("upgraded hash %s is not usable", upgraded)
+			}
+		})
+	}
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *settings.PasswordConfig
+		wantErr bool
+	}{
+		{"nil config", nil, false},
+		{"default algorithm", &settings.PasswordConfig{}, false},
+		{"unknown algorithm", &settings.PasswordConfig{Algorithm: "md5"}, true},
+		{"bcrypt cost too low", &settings.PasswordConfig{BcryptCost: bcrypt.MinCost - 1}, true},
+		{"bcrypt cost too high", &settings.PasswordConfig{BcryptCost: bcrypt.MaxCost + 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := params
+			defer func() { params = saved }()
+			if err := Init(tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package jwtkeys
+
+import (
+	"bluebell/settings"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+)
+
+// 签名密钥通过kid区分，新token使用配置中指定的签名密钥，kid写在token的header中
+// 密钥轮换时先加入新密钥并切换签名密钥，旧密钥保留到它签发的token全部过期后再删除
+// 已经停用的RS256/EdDSA密钥可以只配置公钥，只用于校验
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+var (
+	ERROR_UNKNOWN_KID      = errors.New("unknown jwt key id")
+	ERROR_ALG_MISMATCH     = errors.New("jwt algorithm does not match the key")
+	ERROR_NO_SIGNING_KEY   = errors.New("no jwt signing key available")
+	ERROR_VERIFY_ONLY_KEY  = errors.New("jwt signing key has no private key")
+	ERROR_UNSUPPORTED_ALGO = errors.New("unsupported jwt algorithm")
+)
+
+type key struct {
+	kid       string
+	method    jwt.SigningMethod
+	signKey   interface{} // 只配置了公钥时为nil
+	verifyKey interface{}
+}
+
+// 没有内置的默认密钥，Init成功之前无法签发和校验token
+var (
+	keys    = map[string]*key{}
+	current *key
+)
+
+func hmacKey(kid string, secret []byte) *key {
+	return &key{kid: kid, method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+}
+
+// Init 根据配置加载所有密钥，没有配置任何密钥时返回错误，服务不能启动
+func Init(cfg *settings.TokenConfig) error {
+	if cfg == nil || len(cfg.Keys) == 0 {
+		return fmt.Errorf("%w: token.keys is not configured", ERROR_NO_SIGNING_KEY)
+	}
+	loaded := make(map[string]*key, len(cfg.Keys))
+	for _, kc := range cfg.Keys {
+		if kc.Kid == "" {
+			return errors.New("jwt key id can not be empty")
+		}
+		if _, ok := loaded[kc.Kid]; ok {
+			return fmt.Errorf("duplicate jwt key id: %s", kc.Kid)
+		}
+		k, err := loadKey(kc)
+		if err != nil {
+			return fmt.Errorf("load jwt key %s failed: %w", kc.Kid, err)
+		}
+		loaded[kc.Kid] = k
+	}
+	signing := cfg.SigningKid
+	if signing == "" && len(cfg.Keys) == 1 {
+		signing = cfg.Keys[0].Kid
+	}
+	k, ok := loaded[signing]
+	if !ok {
+		return fmt.Errorf("%w: %q", ERROR_NO_SIGNING_KEY, signing)
+	}
+	if k.signKey == nil {
+		return fmt.Errorf("%w: %q", ERROR_VERIFY_ONLY_KEY, signing)
+	}
+	keys, current = loaded, k
+	return nil
+}
+
+// loadKey 读取密钥内容，优先使用文件
+func loadKey(kc settings.JWTKeyConfig) (*key, error) {
+	data := []byte(kc.Key)
+	if kc.KeyFile != "" {
+		var err error
+		if data, err = os.ReadFile(kc.KeyFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(data) == 0 {
+		return nil, errors.New("key is empty")
+	}
+	k := &key{kid: kc.Kid}
+	var err error
+	switch kc.Algorithm {
+	case AlgorithmHS256, "":
+		return hmacKey(kc.Kid, []byte(strings.TrimSpace(string(data)))), nil
+	case AlgorithmRS256:
+		k.method = jwt.SigningMethodRS256
+		var private *rsa.PrivateKey
+		if private, err = jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+			k.signKey, k.verifyKey = private, &private.PublicKey
+		} else {
+			k.verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(data)
+		}
+	case AlgorithmEdDSA:
+		k.method = jwt.SigningMethodEdDSA
+		var private crypto.PrivateKey
+		if private, err = jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+			k.signKey, k.verifyKey = private, private.(ed25519.PrivateKey).Public()
+		} else {
+			k.verifyKey, err = jwt.ParseEdPublicKeyFromPEM(data)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ERROR_UNSUPPORTED_ALGO, kc.Algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// DeriveSecret 从当前的签名密钥派生用于其他用途的HMAC密钥，不同的purpose得到不同的密钥
+// 轮换签名密钥后派生的密钥也会改变，需要长期有效的签名应该单独配置密钥
+func DeriveSecret(purpose string) ([]byte, error) {
+	k := current
+	if k == nil || k.signKey == nil {
+		return nil, ERROR_NO_SIGNING_KEY
+	}
+	var material []byte
+	switch sk := k.signKey.(type) {
+	case []byte:
+		material = sk
+	default:
+		var err error
+		if material, err = x509.MarshalPKCS8PrivateKey(sk); err != nil {
+			return nil, err
+		}
+	}
+	mac := hmac.New(sha256.New, material)
+	mac.Write([]byte("bluebell:" + purpose))
+	return mac.Sum(nil), nil
+}
+
+// Sign 使用当前的签名密钥签发token，并在header中写入kid
+func Sign(claims jwt.Claims) (string, error) {
+	k := current
+	if k == nil {
+		return "", ERROR_NO_SIGNING_KEY
+	}
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.kid
+	return token.SignedString(k.signKey)
+}
+
+// Keyfunc 根据token header中的kid查找校验密钥，没有kid的旧token使用当前的签名密钥校验
+// 同时要求token的算法和密钥的算法一致，防止用公钥当作HS256密钥伪造token
+func Keyfunc(token *jwt.Token) (interface{}, error) {
+	k := current
+	if kid, ok := token.Header["kid"].(string); ok {
+		if k, ok = keys[kid]; !ok {
+			return nil, ERROR_UNKNOWN_KID
+		}
+	}
+	if k == nil {
+		return nil, ERROR_NO_SIGNING_KEY
+	}
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, ERROR_ALG_MISMATCH
+	}
+	return k.verifyKey, nil
+}
+
+// JWK 公钥的JSON Web Key表示
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA公钥
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519公钥
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeys 返回所有非对称密钥的公钥，HS256密钥永远不会公开
+func PublicKeys() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	enc := base64.RawURLEncoding
+	for _, k := range keys {
+		jwk := JWK{Kid: k.kid, Use: "sig", Alg: k.method.Alg()}
+		switch pub := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = enc.EncodeToString(pub.N.Bytes())
+			jwk.E = enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+			jwk.X = enc.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
@@ -0,0 +1,358 @@
+package oidc
+
+import (
+	"bluebell/settings"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenID Connect授权码模式的客户端，使用PKCE(S256)，并校验state和nonce
+// 身份提供方的地址通过issuer自动发现，id token使用提供方公布的JWKS校验
+
+const (
+	// 校验id token时间时允许的时钟偏差
+	clockSkew = time.Minute
+	// 遇到未知kid时重新获取JWKS的最小间隔，避免被伪造的token反复触发请求
+	jwksRefreshInterval = time.Minute
+	maxResponseSize     = 1 << 20
+)
+
+var defaultScopes = []string{"openid", "email", "profile"}
+
+var (
+	ERROR_DISCOVERY      = errors.New("oidc discovery failed")
+	ERROR_EXCHANGE       = errors.New("oidc code exchange failed")
+	ERROR_INVALID_TOKEN  = errors.New("invalid oidc id token")
+	ERROR_NONCE_MISMATCH = errors.New("oidc nonce mismatch")
+)
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// Claims id token中登录需要用到的用户信息
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+type Provider struct {
+	cfg    settings.OidcProviderConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	meta          *metadata
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// NewProvider 创建身份提供方的客户端，client为nil时使用默认的http客户端
+func NewProvider(cfg settings.OidcProviderConfig, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{cfg: cfg, client: client}
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// RandomString 生成url安全的随机字符串，用于state、nonce和PKCE的code verifier
+func RandomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// CodeChallenge 计算PKCE的S256 code challenge
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
+
+// discover 获取并缓存身份提供方的配置，返回的issuer必须和配置一致
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	issuer := strings.TrimSuffix(p.cfg.Issuer, "/")
+	meta := new(metadata)
+	if err := p.getJSON(ctx, issuer+"/.well-known/openid-configuration", meta); err != nil {
+		return nil, fmt.Errorf("%w: %v", ERROR_DISCOVERY, err)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("%w: issuer %q does not match %q", ERROR_DISCOVERY, meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JwksURI == "" {
+		return nil, fmt.Errorf("%w: incomplete provider metadata", ERROR_DISCOVERY)
+	}
+	p.meta = meta
+	return meta, nil
+}
+
+// AuthCodeURL 生成跳转到身份提供方登录页面的地址
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultScopes
+	} else if !slices.Contains(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.cfg.ClientId)
+	params.Set("redirect_uri", p.cfg.RedirectURL)
+	params.Set("scope", strings.Join(scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", CodeChallenge(verifier))
+	params.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange 使用授权码和code verifier换取id token
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.cfg.ClientId)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientId), url.QueryEscape(p.cfg.ClientSecret))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ERROR_EXCHANGE, err)
+	}
+	defer resp.Body.Close()
+	var res struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&res); err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ERROR_EXCHANGE, resp.Status, err)
+	}
+	if res.Error != "" {
+		return "", fmt.Errorf("%w: %s %s", ERROR_EXCHANGE, res.Error, res.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || res.IdToken == "" {
+		return "", fmt.Errorf("%w: %s: no id_token in response", ERROR_EXCHANGE, resp.Status)
+	}
+	return res.IdToken, nil
+}
+
+// Verify 校验id token的签名、issuer、audience、有效期以及nonce
+func (p *Provider) Verify(ctx context.Context, rawIdToken, nonce string) (*Claims, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims := jwt.MapClaims{}
+	parser := &jwt.Parser{ValidMethods: []string{"RS256", "RS384", "RS512", "ES256", "ES384", "EdDSA"}, SkipClaimsValidation: true}
+	if _, err = parser.ParseWithClaims(rawIdToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.verifyKey(ctx, meta, kid)
+	}); err != nil {
+		return nil, fmt.Errorf("%w: %v", ERROR_INVALID_TOKEN, err)
+	}
+
+	now := time.Now()
+	switch {
+	case !claims.VerifyIssuer(meta.Issuer, true):
+		return nil, fmt.Errorf("%w: unexpected issuer", ERROR_INVALID_TOKEN)
+	case !claims.VerifyAudience(p.cfg.ClientId, true):
+		return nil, fmt.Errorf("%w: unexpected audience", ERROR_INVALID_TOKEN)
+	case !claims.VerifyExpiresAt(now.Add(-clockSkew).Unix(), true):
+		return nil, fmt.Errorf("%w: token is expired", ERROR_INVALID_TOKEN)
+	case !claims.VerifyIssuedAt(now.Add(clockSkew).Unix(), false), !claims.VerifyNotBefore(now.Add(clockSkew).Unix(), false):
+		return nil, fmt.Errorf("%w: token used before issued", ERROR_INVALID_TOKEN)
+	}
+	// 有多个audience时，azp必须是当前客户端
+	if aud, ok := claims["aud"].([]interface{}); ok && len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.cfg.ClientId {
+			return nil, fmt.Errorf("%w: unexpected authorized party", ERROR_INVALID_TOKEN)
+		}
+	}
+	if got, _ := claims["nonce"].(string); nonce == "" || got != nonce {
+		return nil, ERROR_NONCE_MISMATCH
+	}
+
+	str := func(name string) string {
+		s, _ := claims[name].(string)
+		return s
+	}
+	res := &Claims{
+		Subject:           str("sub"),
+		Email:             str("email"),
+		Name:              str("name"),
+		PreferredUsername: str("preferred_username"),
+	}
+	// 部分身份提供方把email_verified作为字符串返回
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		res.EmailVerified = v
+	case string:
+		res.EmailVerified = v == "true"
+	}
+	if res.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ERROR_INVALID_TOKEN)
+	}
+	return res, nil
+}
+
+// verifyKey 根据kid查找校验密钥，找不到时重新获取一次JWKS，以支持身份提供方轮换密钥
+func (p *Provider) verifyKey(ctx context.Context, meta *metadata, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	p.keysFetchedAt = time.Now()
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, meta.JwksURI, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	p.keys = keys
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// lookupKey 没有kid的token只有在提供方只有一个密钥时才能校验
+func (p *Provider) lookupKey(kid string) interface{} {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	dec := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err1 := dec(k.N)
+		e, err2 := dec(k.E)
+		if err := errors.Join(err1, err2); err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err1 := dec(k.X)
+		y, err2 := dec(k.Y)
+		if err := errors.Join(err1, err2); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		x, err := dec(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
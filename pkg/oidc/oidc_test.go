@@ -0,0 +1,149 @@
+package oidc_test
+
+import (
+	"bluebell/pkg/oidc"
+	"bluebell/pkg/oidc/oidctest"
+	"bluebell/settings"
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+const (
+	testClientId     = "bluebell"
+	testClientSecret = "bluebell-secret"
+	testRedirectURL  = "http://localhost:8080/oauth/callback"
+)
+
+func newTestProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	t.Helper()
+	server := oidctest.NewServer(testClientId, testClientSecret)
+	t.Cleanup(server.Close)
+	p := oidc.NewProvider(settings.OidcProviderConfig{
+		Name:         "mock",
+		Issuer:       server.Issuer(),
+		ClientId:     testClientId,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, nil)
+	return server, p
+}
+
+type authorization struct {
+	state, nonce, verifier string
+	authURL                string
+	code, returnedState    string
+}
+
+// authorize 生成授权地址并模拟用户在身份提供方完成登录
+func authorize(t *testing.T, server *oidctest.Server, p *oidc.Provider) *authorization {
+	t.Helper()
+	a := &authorization{}
+	for _, s := range []*string{&a.state, &a.nonce, &a.verifier} {
+		v, err := oidc.RandomString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		*s = v
+	}
+	var err error
+	if a.authURL, err = p.AuthCodeURL(context.Background(), a.state, a.nonce, a.verifier); err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	if a.code, a.returnedState, err = server.Authorize(a.authURL); err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	return a
+}
+
+// S256: BASE64URL(SHA256(verifier))，不带填充，SHA256("abc")取自FIPS 180-2的示例
+func TestCodeChallenge(t *testing.T) {
+	got := oidc.CodeChallenge("abc")
+	if want := "ungWv48Bz-pBQUDeXa4iI7ADYaOWF3qctBD_YfIAFa0"; got != want {
+		t.Fatalf("CodeChallenge() = %s, want %s", got, want)
+	}
+}
+
+func TestLoginFlow(t *testing.T) {
+	server, p := newTestProvider(t)
+	server.SetUser(oidctest.User{Subject: "user-1", Email: "user1@example.com", EmailVerified: true, PreferredUsername: "user1"})
+	a := authorize(t, server, p)
+
+	u, err := url.Parse(a.authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") != oidc.CodeChallenge(a.verifier) {
+		t.Fatalf("authorization url does not carry the S256 challenge of the verifier: %s", a.authURL)
+	}
+	if q.Get("code_verifier") != "" {
+		t.Fatal("code verifier must not be sent to the authorization endpoint")
+	}
+	if q.Get("nonce") != a.nonce || a.returnedState != a.state {
+		t.Fatalf("state/nonce not passed through: state=%q nonce=%q", a.returnedState, q.Get("nonce"))
+	}
+
+	rawIdToken, err := p.Exchange(context.Background(), a.code, a.verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	claims, err := p.Verify(context.Background(), rawIdToken, a.nonce)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "user1@example.com" || !claims.EmailVerified || claims.PreferredUsername != "user1" {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	server, p := newTestProvider(t)
+	a := authorize(t, server, p)
+	other, err := oidc.RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Exchange(context.Background(), a.code, other); !errors.Is(err, oidc.ERROR_EXCHANGE) {
+		t.Fatalf("Exchange with a wrong verifier: err = %v, want %v", err, oidc.ERROR_EXCHANGE)
+	}
+}
+
+func TestExchangeRejectsReusedCode(t *testing.T) {
+	server, p := newTestProvider(t)
+	a := authorize(t, server, p)
+	if _, err := p.Exchange(context.Background(), a.code, a.verifier); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if _, err := p.Exchange(context.Background(), a.code, a.verifier); !errors.Is(err, oidc.ERROR_EXCHANGE) {
+		t.Fatalf("Exchange with a used code: err = %v, want %v", err, oidc.ERROR_EXCHANGE)
+	}
+}
+
+func TestVerifyRejectsNonceMismatch(t *testing.T) {
+	server, p := newTestProvider(t)
+	a := authorize(t, server, p)
+	rawIdToken, err := p.Exchange(context.Background(), a.code, a.verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	for _, nonce := range []string{"", "another-nonce"} {
+		if _, err = p.Verify(context.Background(), rawIdToken, nonce); !errors.Is(err, oidc.ERROR_NONCE_MISMATCH) {
+			t.Fatalf("Verify with nonce %q: err = %v, want %v", nonce, err, oidc.ERROR_NONCE_MISMATCH)
+		}
+	}
+}
+
+func TestVerifyRejectsOtherAudience(t *testing.T) {
+	server, p := newTestProvider(t)
+	a := authorize(t, server, p)
+	rawIdToken, err := p.Exchange(context.Background(), a.code, a.verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	other := oidc.NewProvider(settings.OidcProviderConfig{Name: "mock", Issuer: server.Issuer(), ClientId: "another-client"}, nil)
+	if _, err = other.Verify(context.Background(), rawIdToken, a.nonce); !errors.Is(err, oidc.ERROR_INVALID_TOKEN) {
+		t.Fatalf("Verify for another client: err = %v, want %v", err, oidc.ERROR_INVALID_TOKEN)
+	}
+}
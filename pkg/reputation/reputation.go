@@ -0,0 +1,125 @@
+package reputation
+
+import (
+	"bluebell/cache"
+	"bluebell/dao/mysql_repo"
+	"bluebell/models"
+	"bluebell/pkg/sqls"
+	"bluebell/settings"
+)
+
+// 用户声望：帖子/评论被点赞、帖子被收藏时增加，被点踩、内容被版主删除时减少
+// 声望达到门槛后解锁更宽松的发布频率、更高的投票权重以及发布链接，门槛可以按社区单独配置
+
+// 声望变化的原因
+const (
+	LikeReceived    = "like_received"
+	DislikeReceived = "dislike_received"
+	Collected       = "collected"
+	ContentRemoved  = "content_removed"
+)
+
+const (
+	DefaultLikeReceived        = 10
+	DefaultDislikeReceived     = 2
+	DefaultCollected           = 5
+	DefaultContentRemoved      = 50
+	DefaultPublishThreshold    = 50
+	DefaultVoteWeightThreshold = 500
+	// 已有用户的声望都从0开始，默认不限制发布链接，避免上线后所有用户都无法发布链接
+	DefaultLinkThreshold = 0
+
+	// HighVoteWeight 达到投票权重门槛的用户对帖子投票时的权重
+	HighVoteWeight = 2
+)
+
+// points 每种原因发生一次时声望的变化
+func points(reason string) int64 {
+	cfg := settings.GlobalSettings.ReputationCfg
+	if cfg == nil {
+		cfg = &settings.ReputationConfig{}
+	}
+	pick := func(v *int, def int) int64 {
+		if v != nil && *v >= 0 {
+			return int64(*v)
+		}
+		return int64(def)
+	}
+	switch reason {
+	case LikeReceived:
+		return pick(cfg.LikeReceived, DefaultLikeReceived)
+	case DislikeReceived:
+		return -pick(cfg.DislikeReceived, DefaultDislikeReceived)
+	case Collected:
+		return pick(cfg.Collected, DefaultCollected)
+	case ContentRemoved:
+		return -pick(cfg.ContentRemoved, DefaultContentRemoved)
+	}
+	return 0
+}
+
+// Change 按原因修改用户的声望，count为发生的次数，撤销时为负数
+func Change(userId int64, reason string, count int64) error {
+	delta := points(reason) * count
+	if userId == 0 || delta == 0 {
+		return nil
+	}
+	if err := mysql_repo.UserRepository.IncrReputation(sqls.DB(), userId, delta); err != nil {
+		return err
+	}
+	cache.UserCache.Invalidate(userId)
+	return nil
+}
+
+// Thresholds 解锁各项权限需要的声望
+type Thresholds struct {
+	Publish    int64 `json:"publish"`
+	VoteWeight int64 `json:"vote_weight"`
+	Link       int64 `json:"link"`
+}
+
+// GetThresholds 获取社区的声望门槛，社区没有单独配置的项使用全局配置，communityId为0时返回全局配置
+func GetThresholds(communityId int64) Thresholds {
+	t := Thresholds{Publish: DefaultPublishThreshold, VoteWeight: DefaultVoteWeightThreshold, Link: DefaultLinkThreshold}
+	if cfg := settings.GlobalSettings.ReputationCfg; cfg != nil {
+		if cfg.PublishThreshold != nil {
+			t.Publish = *cfg.PublishThreshold
+		}
+		if cfg.VoteWeightThreshold != nil {
+			t.VoteWeight = *cfg.VoteWeightThreshold
+		}
+		if cfg.LinkThreshold != nil {
+			t.Link = *cfg.LinkThreshold
+		}
+	}
+	if c := cache.CommunityCache.Get(communityId); c != nil {
+		if c.PublishThreshold != nil {
+			t.Publish = *c.PublishThreshold
+		}
+		if c.VoteWeightThreshold != nil {
+			t.VoteWeight = *c.VoteWeightThreshold
+		}
+		if c.LinkThreshold != nil {
+			t.Link = *c.LinkThreshold
+		}
+	}
+	return t
+}
+
+// CanPublishMore 是否使用更宽松的发帖/评论频率限制
+func CanPublishMore(u *models.User, communityId int64) bool {
+	return u.Reputation >= GetThresholds(communityId).Publish
+}
+
+// CanPostLink 是否可以在帖子/评论中发布链接
+func CanPostLink(u *models.User, communityId int64) bool {
+	return u.Reputation >= GetThresholds(communityId).Link
+}
+
+// VoteWeight 用户对社区内的帖子投票时的权重
+func VoteWeight(u *models.User, communityId int64) int8 {
+	if u != nil && u.Reputation >= GetThresholds(communityId).VoteWeight {
+		return HighVoteWeight
+	}
+	return 1
+}
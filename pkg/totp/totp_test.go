@@ -0,0 +1,88 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录B中SHA1的测试向量，密钥为ASCII的"12345678901234567890"
+// 附录中的验证码为8位，这里使用6位，取其后6位
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfc6238Secret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", tt.unix, err)
+		}
+		if got != tt.code {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestValidateWindow(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	tests := []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{"current step", 0, true},
+		{"previous step", -1, true},
+		{"next step", 1, true},
+		{"two steps before", -2, false},
+		{"two steps after", 2, false},
+	}
+	for _, tt := range tests {
+		code, err := Code(rfc6238Secret, step+tt.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := Validate(rfc6238Secret, code, now, 1)
+		if ok != tt.ok {
+			t.Errorf("%s: Validate() ok = %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if ok && got != step+tt.offset {
+			t.Errorf("%s: Validate() step = %d, want %d", tt.name, got, step+tt.offset)
+		}
+	}
+
+	// 不允许时钟偏差时只接受当前时间步
+	code, _ := Code(rfc6238Secret, step-1)
+	if _, ok := Validate(rfc6238Secret, code, now, 0); ok {
+		t.Error("Validate() with zero skew accepted the previous step")
+	}
+}
+
+func TestValidateMalformed(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, _ := Code(rfc6238Secret, Step(now))
+	for _, tt := range []struct{ name, secret, code string }{
+		{"short code", rfc6238Secret, code[:5]},
+		{"long code", rfc6238Secret, code + "0"},
+		{"invalid secret", "not base32!", code},
+		{"other secret", "JBSWY3DPEHPK3PXP", code},
+	} {
+		if _, ok := Validate(tt.secret, tt.code, now, 1); ok {
+			t.Errorf("%s: Validate() accepted %q", tt.name, tt.code)
+		}
+	}
+	if _, ok := Validate(rfc6238Secret, " "+code+" ", now, 1); !ok {
+		t.Error("Validate() rejected a code with surrounding spaces")
+	}
+}
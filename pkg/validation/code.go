@@ -4,4 +4,5 @@ import "errors"
 
 var (
 	ERROR_TOO_MANY_PUBLISH = errors.New("too many publish within a short period")
+	ERROR_LINK_NOT_ALLOWED = errors.New("not enough reputation to post links")
 )
@@ -0,0 +1,54 @@
+package validation
+
+import (
+	"bluebell/cache"
+	"bluebell/models"
+	"bluebell/pkg/reputation"
+	"regexp"
+)
+
+// 声望没有达到社区的门槛时不能在帖子/评论中发布链接
+
+var linkPattern = regexp.MustCompile(`(?i)(https?://|www\.)\S+`)
+
+type LinkStrategy struct {
+}
+
+func (LinkStrategy) Name() string {
+	return "LinkStrategy"
+}
+
+func (LinkStrategy) CheckPost(user *models.User, post *models.Post) error {
+	if post == nil || !(linkPattern.MatchString(post.Title) || linkPattern.MatchString(post.Content)) {
+		return nil
+	}
+	if !reputation.CanPostLink(user, post.CommunityID) {
+		return ERROR_LINK_NOT_ALLOWED
+	}
+	return nil
+}
+
+func (LinkStrategy) CheckComment(user *models.User, comment *models.Comment) error {
+	if comment == nil || !linkPattern.MatchString(comment.Content) {
+		return nil
+	}
+	if !reputation.CanPostLink(user, commentCommunityId(comment)) {
+		return ERROR_LINK_NOT_ALLOWED
+	}
+	return nil
+}
+
+func postCommunityId(post *models.Post) int64 {
+	if post == nil {
+		return 0
+	}
+	return post.CommunityID
+}
+
+// commentCommunityId 评论所属的社区，帖子不存在时返回0，使用全局的门槛
+func commentCommunityId(comment *models.Comment) int64 {
+	if comment == nil {
+		return 0
+	}
+	return postCommunityId(cache.PostCache.Get(comment.PostId))
+}
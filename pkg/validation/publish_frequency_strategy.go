@@ -4,6 +4,7 @@ import (
 	"bluebell/dao/mysql_repo"
 	"bluebell/models"
 	"bluebell/pkg/dates"
+	"bluebell/pkg/reputation"
 	"bluebell/pkg/sqls"
 	"time"
 )
@@ -24,8 +25,12 @@ func (PublishFrequencyStrategy) CheckPost(user *models.User, post *models.Post)
 		maxCountInOneHour    int64 = 2 // 一小时内最高发帖量
 		maxCountInOneDay     int64 = 3 // 一天内最高发帖量
 	)
-	// 注册时间超过24小时，限制宽松一些
-	if user.CreateAt.Unix() < dates.Timestamp(time.Now().Add(-time.Hour*24)) {
+	// 注册时间超过24小时，限制宽松一些；声望达到社区的门槛以后更加宽松
+	if reputation.CanPublishMore(user, postCommunityId(post)) {
+		maxCountInTenMinutes = 6
+		maxCountInOneHour = 15
+		maxCountInOneDay = 30
+	} else if user.CreateAt.Unix() < dates.Timestamp(time.Now().Add(-time.Hour*24)) {
 		maxCountInTenMinutes = 3
 		maxCountInOneHour = 5
 		maxCountInOneDay = 10
@@ -53,8 +58,12 @@ func (PublishFrequencyStrategy) CheckComment(user *models.User, comment *models.
 		maxCountInOneHour    int64 = 60  // 一小时内最高评论量
 		maxCountInOneDay     int64 = 100 // 一天内最高评论量
 	)
-	// 注册时间超过24小时，限制宽松一些
-	if user.CreateAt.Unix() < dates.Timestamp(time.Now().Add(-time.Hour*24)) {
+	// 注册时间超过24小时，限制宽松一些；声望达到社区的门槛以后更加宽松
+	if reputation.CanPublishMore(user, commentCommunityId(comment)) {
+		maxCountInTenMinutes = 40
+		maxCountInOneHour = 240
+		maxCountInOneDay = 600
+	} else if user.CreateAt.Unix() < dates.Timestamp(time.Now().Add(-time.Hour*24)) {
 		maxCountInTenMinutes = 20
 		maxCountInOneHour = 120
 		maxCountInOneDay = 300
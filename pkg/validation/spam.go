@@ -8,8 +8,13 @@ import (
 
 var strategies []Strategy
 
+// contentStrategies 只检查内容的规则，编辑已经发布的内容时使用，不检查发布频率
+var contentStrategies []Strategy
+
 func init() {
+	contentStrategies = append(contentStrategies, &LinkStrategy{})
 	strategies = append(strategies, &PublishFrequencyStrategy{})
+	strategies = append(strategies, contentStrategies...)
 }
 
 func CheckPost(user *models.User, post *models.Post) error {
@@ -37,3 +42,14 @@ func CheckComment(user *models.User, comment *models.Comment) error {
 	}
 	return nil
 }
+
+// CheckCommentContent 编辑评论时只检查修改后的内容
+func CheckCommentContent(user *models.User, comment *models.Comment) error {
+	for _, strategy := range contentStrategies {
+		if err := strategy.CheckComment(user, comment); err != nil {
+			zap.L().Error(fmt.Sprintf("[Comment] hit strategy:%s", strategy.Name()), zap.Error(err))
+			return err
+		}
+	}
+	return nil
+}
@@ -75,7 +75,7 @@ func IsURL(url string) error {
 	return errors.New("URL格式错误")
 }
 
-// CheckPassword 检验用户传进来的password是否和数据库中一致
+// CheckPassword 检验用户传进来的password是否和数据库中保存的哈希值一致，使用常数时间比较
 func CheckPassword(input_password, password string) bool {
-	return encrypt.Encrypt(input_password) == password
+	return encrypt.Verify(input_password, password)
 }
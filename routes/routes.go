@@ -17,6 +17,19 @@ func SetupRouter(mode string) *gin.Engine {
 	}
 	r := gin.New()
 	r.Use(logger.GinLogger(), logger.GinRecovery(true))
+	// 订阅源，供RSS阅读器使用，不需要登录
+	feeds := r.Group("/feeds")
+	{
+		feeds.GET("/community/:id", controllers.GetCommunityFeed)
+		feeds.GET("/user/:id", controllers.GetUserFeed)
+		feeds.GET("/hot.rss", controllers.GetHotFeed)
+	}
+	// 分享短链接，校验签名后跳转到帖子页面
+	r.GET("/s/:code", controllers.ResolveShareLink)
+	// 帖子预览页面，带有Open Graph/Twitter Card元信息
+	r.GET("/embed/post/:id", controllers.GetPostCard)
+	// token校验公钥，供其他服务校验bluebell签发的token
+	r.GET("/.well-known/jwks.json", controllers.GetJWKS)
 	v1 := r.Group("/api/v1")
 	captchas := v1.Group("/captcha")
 	// rate_limit1 := ratelimit.New(1, ratelimit.Per(time.Minute))
@@ -26,23 +39,39 @@ func SetupRouter(mode string) *gin.Engine {
 		v1.POST("/signup", controllers.SignUp)
 		v1.POST("/login", controllers.SignIn)
 		v1.POST("/login-via-email", controllers.SignInViaEmail)
+		v1.POST("/login/mfa", controllers.SignInWithMfa)
+		v1.POST("/login/mfa/enroll", controllers.StartMfaEnrollment)
+		v1.GET("/oauth/providers", controllers.GetOidcProviders)
+		v1.GET("/oauth/:provider/authorize", controllers.OidcAuthorize)
+		v1.POST("/oauth/:provider/callback", controllers.OidcCallback)
 		v1.GET("/refresh-access-token", controllers.RefreshAccessToken)
 		v1.GET("/community", controllers.GetAllCommunities)
 		v1.GET("/community/:id", controllers.GetCommunityById)
+		v1.GET("/community/:id/reputation", controllers.GetCommunityReputation)
+		v1.GET("/badges", controllers.GetBadgeRules)
 		v1.GET("/verify-email", controllers.VerifyEmail)
 		v1.GET("/get-email-verification-code", middleware.NonBlockingRateLimitMiddleware(60), controllers.GetVerificationCode)
+		v1.POST("/forgot-password", middleware.PerRouteRateLimitMiddleware(60), controllers.ForgotPassword)
+		v1.POST("/reset-password", middleware.PerRouteRateLimitMiddleware(5), controllers.ResetPassword)
 		captchas.GET("/request", controllers.GetCaptchaInfo)
 		captchas.GET("/show", controllers.GetShow)
 		captchas.GET("/verify", middleware.NonBlockingRateLimitMiddleware(60), controllers.GetVerify)
 
-		v1.GET("/post/link", controllers.GetPostLink)
-		v1.GET("/posts1", controllers.GetPostList1)
+		v1.GET("/post/link", middleware.OptionalJWTAuthMiddleware(), controllers.GetPostLink)
+		v1.GET("/post/preview/:id", controllers.GetPostPreview)
+		v1.GET("/oembed", controllers.GetPostOEmbed)
+		v1.GET("/posts1", middleware.OptionalJWTAuthMiddleware(), controllers.GetPostList1)
 		v1.GET("/posts2", controllers.GetPostList2)
 
 		v1.GET("/comment/by-post-id", controllers.GetCommentByPostId)
 		v1.GET("/comment/total-count", controllers.GetTotalCommentsCount)
 		v1.GET("/comment/sub-comments-count", controllers.GetSubCommentsCount)
 		v1.GET("/comment/comment-detail", controllers.GetCommentsDetail)
+		v1.GET("/reaction", middleware.OptionalJWTAuthMiddleware(), controllers.GetReactions)
+		v1.GET("/user/:id", middleware.OptionalJWTAuthMiddleware(), controllers.GetUserProfile)
+		v1.GET("/user/:id/followers", middleware.OptionalJWTAuthMiddleware(), controllers.GetFollowers)
+		v1.GET("/user/:id/following", middleware.OptionalJWTAuthMiddleware(), controllers.GetFollowing)
+		v1.GET("/user/:id/common-follows", middleware.OptionalJWTAuthMiddleware(), controllers.GetCommonFollows)
 
 	}
 	v1.Use(middleware.JWTAuthMiddleware())
@@ -55,9 +84,45 @@ func SetupRouter(mode string) *gin.Engine {
 		v1.POST("/send-email", controllers.SendEmail)
 		v1.POST("/post/collect", controllers.CollectPost)
 		v1.DELETE("/post", controllers.DeletePost)
+		v1.POST("/post/pin-comment", controllers.PinComment)
+		v1.POST("/post/lock-comments", controllers.LockComments)
 		v1.POST("/comment", controllers.CreateComment)
 		v1.POST("/comment/vote", controllers.VoteForComment)
 		v1.DELETE("/comment", controllers.DeleteComment)
+		v1.PUT("/comment", controllers.EditComment)
+		v1.GET("/comment/history", controllers.GetCommentHistory)
+		v1.GET("/trash", controllers.GetTrashList)
+		v1.POST("/trash/restore", controllers.RestoreTrash)
+		v1.GET("/user/autocomplete", controllers.AutocompleteUsername)
+		v1.GET("/notification", controllers.GetNotificationList)
+		v1.GET("/notification/unread-count", controllers.GetUnreadNotificationCount)
+		v1.POST("/notification/read", controllers.ReadNotifications)
+		v1.POST("/reaction", controllers.React)
+		v1.PUT("/community/reactions", controllers.SetCommunityReactions)
+		v1.PUT("/community/reputation", controllers.SetCommunityReputation)
+		v1.GET("/user/deletion", controllers.GetAccountDeletion)
+		v1.POST("/user/deletion", middleware.PerRouteRateLimitMiddleware(5), controllers.RequestAccountDeletion)
+		v1.DELETE("/user/deletion", controllers.CancelAccountDeletion)
+		v1.GET("/user/export", controllers.GetDataExport)
+		v1.POST("/user/export", middleware.PerRouteRateLimitMiddleware(60), controllers.RequestDataExport)
+		v1.GET("/user/export/download", controllers.DownloadDataExport)
+		v1.GET("/user/preference", controllers.GetUserPreference)
+		v1.PATCH("/user/preference", controllers.UpdateUserPreference)
+		v1.GET("/user/sessions", controllers.GetSessions)
+		v1.DELETE("/user/sessions", controllers.RevokeOtherSessions)
+		v1.DELETE("/user/sessions/:id", controllers.RevokeSession)
+		v1.GET("/user/mfa", controllers.GetMfaStatus)
+		v1.DELETE("/user/mfa", controllers.DisableMfa)
+		v1.POST("/user/mfa/setup", controllers.SetupMfa)
+		v1.POST("/user/mfa/confirm", controllers.ConfirmMfa)
+		v1.POST("/user/mfa/recovery-codes", controllers.RegenerateRecoveryCodes)
+		v1.GET("/admin/mfa-policy", controllers.GetMfaPolicy)
+		v1.PUT("/admin/mfa-policy", controllers.SetMfaPolicy)
+		v1.POST("/admin/users/:id/unlock", controllers.UnlockUser)
+		v1.GET("/user/identities", controllers.GetUserIdentities)
+		v1.POST("/user/identities/:provider", controllers.LinkIdentity)
+		v1.POST("/user/identities/:provider/callback", controllers.LinkIdentityCallback)
+		v1.DELETE("/user/identities/:provider", controllers.UnlinkIdentity)
 
 		// 测试jwt-token，使得只有登录了的用户才能访问ping接口
 		r.GET("/ping", middleware.JWTAuthMiddleware(), func(c *gin.Context) {
@@ -7,13 +7,28 @@ import (
 )
 
 type AppSettings struct {
-	AppCfg       *AppConfig          `mapstructure:"app"`
-	LogCfg       *LogConfig          `mapstructure:"log"`
-	MysqlCfg     *MysqlConfig        `mapstructure:"mysql"`
-	RedisCfg     *RedisConfig        `mapstructure:"redis"`
-	EmailCfg     *EmailConfig        `mapstructure:"email"`
-	MQCfg        *MessageQueueConfig `mapstructure:"message_queue"`
-	FreeCacheCfg *FreeCacheConfig    `mapstructure:"free_cache"`
+	AppCfg        *AppConfig          `mapstructure:"app"`
+	LogCfg        *LogConfig          `mapstructure:"log"`
+	MysqlCfg      *MysqlConfig        `mapstructure:"mysql"`
+	RedisCfg      *RedisConfig        `mapstructure:"redis"`
+	EmailCfg      *EmailConfig        `mapstructure:"email"`
+	MQCfg         *MessageQueueConfig `mapstructure:"message_queue"`
+	FreeCacheCfg  *FreeCacheConfig    `mapstructure:"free_cache"`
+	TrashCfg      *TrashConfig        `mapstructure:"trash"`
+	FeedCfg       *FeedConfig         `mapstructure:"feed"`
+	ShareCfg      *ShareConfig        `mapstructure:"share"`
+	CommentCfg    *CommentConfig      `mapstructure:"comment"`
+	ReactionCfg   *ReactionConfig     `mapstructure:"reaction"`
+	PasswordCfg   *PasswordConfig     `mapstructure:"password"`
+	AccountCfg    *AccountConfig      `mapstructure:"account"`
+	SessionCfg    *SessionConfig      `mapstructure:"session"`
+	TokenCfg      *TokenConfig        `mapstructure:"token"`
+	MfaCfg        *MfaConfig          `mapstructure:"mfa"`
+	OidcCfg       *OidcConfig         `mapstructure:"oidc"`
+	LoginCfg      *LoginConfig        `mapstructure:"login"`
+	ReputationCfg *ReputationConfig   `mapstructure:"reputation"`
+	BadgeCfg      *BadgeConfig        `mapstructure:"badge"`
+	DigestCfg     *DigestConfig       `mapstructure:"digest"`
 }
 type AppConfig struct {
 	Name      string `mapstructure:"name"`
@@ -64,6 +79,125 @@ type FreeCacheConfig struct {
 	ExpiredTime int `mapstructure:"expire_time"`
 }
 
+type TrashConfig struct {
+	RetentionDays int `mapstructure:"retention_days"` // 回收站内容的保留天数
+	PurgeInterval int `mapstructure:"purge_interval"` // 清理过期内容的间隔，单位为分钟
+}
+
+type FeedConfig struct {
+	Size        int `mapstructure:"size"`        // 每个订阅源包含的帖子数量
+	ExpiredTime int `mapstructure:"expire_time"` // 订阅源在Redis中的缓存时间，单位为秒
+}
+
+type ShareConfig struct {
+	Secret      string `mapstructure:"secret"`       // 分享链接签名使用的密钥，必须配置，修改后已经发出的分享链接全部失效
+	LandingURL  string `mapstructure:"landing_url"`  // 分享链接跳转的页面，{post_id}会被替换为帖子id，为空时跳转到帖子预览页面
+	EmbedWidth  int    `mapstructure:"embed_width"`  // oEmbed中帖子卡片的宽度，单位为像素
+	EmbedHeight int    `mapstructure:"embed_height"` // oEmbed中帖子卡片的高度，单位为像素
+}
+
+type CommentConfig struct {
+	EditWindow int `mapstructure:"edit_window"` // 评论发布后允许编辑的时间，单位为分钟
+}
+
+type ReactionConfig struct {
+	Default []string `mapstructure:"default"` // 社区没有单独配置时可用的emoji回应
+}
+
+type PasswordConfig struct {
+	Algorithm         string `mapstructure:"algorithm"`          // 新密码使用的哈希算法，argon2id或bcrypt，默认为argon2id
+	Argon2Memory      uint32 `mapstructure:"argon2_memory"`      // argon2id使用的内存，单位为KiB
+	Argon2Iterations  uint32 `mapstructure:"argon2_iterations"`  // argon2id的迭代次数
+	Argon2Parallelism uint8  `mapstructure:"argon2_parallelism"` // argon2id的并行度
+	BcryptCost        int    `mapstructure:"bcrypt_cost"`        // bcrypt的cost
+	ResetSecret       string `mapstructure:"reset_secret"`       // 重置密码链接签名使用的密钥，为空时从token签名密钥派生
+	ResetExpireTime   int    `mapstructure:"reset_expire_time"`  // 重置密码链接的有效期，单位为分钟
+	ResetURL          string `mapstructure:"reset_url"`          // 重置密码的页面，{token}会被替换为重置密码的token
+}
+
+type AccountConfig struct {
+	DeletionGraceDays int    `mapstructure:"deletion_grace_days"` // 申请注销后的冷静期，单位为天
+	PurgeInterval     int    `mapstructure:"purge_interval"`      // 检查冷静期已结束的账号以及过期导出文件的间隔，单位为分钟
+	ExportDir         string `mapstructure:"export_dir"`          // 个人数据导出文件的保存目录
+	ExportExpireTime  int    `mapstructure:"export_expire_time"`  // 导出文件的保留时间，单位为小时
+}
+
+type SessionConfig struct {
+	MaxSessions int    `mapstructure:"max_sessions"` // 每个用户同时登录的设备数量上限
+	Policy      string `mapstructure:"policy"`       // 达到上限时的处理方式，evict_oldest踢掉最久未活动的设备，reject拒绝新的登录
+}
+
+type TokenConfig struct {
+	AccessExpireTime  int            `mapstructure:"access_expire_time"`  // access token的有效期，单位为分钟
+	RefreshExpireTime int            `mapstructure:"refresh_expire_time"` // refresh token的有效期，单位为小时，每次刷新时重新计算
+	SigningKid        string         `mapstructure:"signing_kid"`         // 签发新token使用的密钥，只有一个密钥时可以不填
+	Keys              []JWTKeyConfig `mapstructure:"keys"`                // 所有可以用来校验token的密钥，至少需要一个可以签名的密钥，否则服务不能启动
+}
+
+type JWTKeyConfig struct {
+	Kid       string `mapstructure:"kid"`       // 密钥id，写在token的header中
+	Algorithm string `mapstructure:"algorithm"` // HS256、RS256或EdDSA，默认为HS256
+	Key       string `mapstructure:"key"`       // HS256的密钥，或者PEM格式的私钥/公钥
+	KeyFile   string `mapstructure:"key_file"`  // 从文件读取密钥，优先于key
+}
+
+type MfaConfig struct {
+	Issuer        string `mapstructure:"issuer"`         // 身份验证器App中显示的服务名称
+	RequiredRoles []int8 `mapstructure:"required_roles"` // 默认必须开启两步验证的角色，管理员可以在运行时修改
+}
+
+type OidcConfig struct {
+	Providers []OidcProviderConfig `mapstructure:"providers"` // 支持登录的OpenID Connect身份提供方
+}
+
+type OidcProviderConfig struct {
+	Name         string   `mapstructure:"name"`          // 身份提供方的名称，用在接口路径中，例如google
+	Issuer       string   `mapstructure:"issuer"`        // 身份提供方的issuer，通过issuer/.well-known/openid-configuration获取其他地址
+	ClientId     string   `mapstructure:"client_id"`     // 在身份提供方注册的客户端id
+	ClientSecret string   `mapstructure:"client_secret"` // 客户端密钥
+	RedirectURL  string   `mapstructure:"redirect_url"`  // 登录完成后跳转回的前端页面，前端再把code和state提交给回调接口
+	Scopes       []string `mapstructure:"scopes"`        // 申请的scope，默认为openid email profile
+}
+
+type LoginConfig struct {
+	AccountFreeAttempts int `mapstructure:"account_free_attempts"` // 同一账号允许连续失败的次数，超过后每次失败等待的时间翻倍
+	IPFreeAttempts      int `mapstructure:"ip_free_attempts"`      // 同一ip允许连续失败的次数，超过后每次失败等待的时间翻倍
+	BaseDelay           int `mapstructure:"base_delay"`            // 第一次需要等待的时间，单位为秒
+	MaxDelay            int `mapstructure:"max_delay"`             // 等待时间的上限，单位为秒
+	LockoutAttempts     int `mapstructure:"lockout_attempts"`      // 同一账号连续失败达到该次数时锁定账号并发送邮件通知
+	LockoutDuration     int `mapstructure:"lockout_duration"`      // 账号锁定的时间，单位为分钟
+	FailureWindow       int `mapstructure:"failure_window"`        // 失败次数的统计窗口，最后一次失败后超过该时间清零，单位为分钟
+}
+
+// ReputationConfig 没有配置的项使用默认值，配置为0时表示关闭该项
+type ReputationConfig struct {
+	LikeReceived        *int   `mapstructure:"like_received"`         // 帖子/评论被点赞一次获得的声望
+	DislikeReceived     *int   `mapstructure:"dislike_received"`      // 帖子/评论被点踩一次扣除的声望
+	Collected           *int   `mapstructure:"collected"`             // 帖子被收藏一次获得的声望
+	ContentRemoved      *int   `mapstructure:"content_removed"`       // 帖子/评论被版主删除一次扣除的声望
+	PublishThreshold    *int64 `mapstructure:"publish_threshold"`     // 达到该声望后放宽发帖/评论的频率限制，社区可以单独配置
+	VoteWeightThreshold *int64 `mapstructure:"vote_weight_threshold"` // 达到该声望后对帖子投票的权重提高，社区可以单独配置
+	LinkThreshold       *int64 `mapstructure:"link_threshold"`        // 达到该声望后才能在帖子/评论中发布链接，社区可以单独配置
+}
+
+type BadgeConfig struct {
+	Rules        []BadgeRuleConfig `mapstructure:"rules"`         // 徽章规则，配置后替换默认的规则
+	RankInterval int               `mapstructure:"rank_interval"` // 检查上一周排行榜徽章的间隔，单位为分钟
+}
+
+type BadgeRuleConfig struct {
+	Name        string `mapstructure:"name"`        // 徽章的唯一名称，修改后已颁发的徽章不会再显示
+	Title       string `mapstructure:"title"`       // 展示的标题
+	Description string `mapstructure:"description"` // 展示的说明
+	Metric      string `mapstructure:"metric"`      // 统计项，posts、comments、likes_received、streak_days或weekly_top_commenter
+	Threshold   int64  `mapstructure:"threshold"`   // 统计值达到该值时颁发，weekly_top_commenter为上一周评论数最多且不少于该值的用户
+}
+
+type DigestConfig struct {
+	Interval int `mapstructure:"interval"`  // 检查需要发送通知摘要的间隔，单位为分钟
+	MaxItems int `mapstructure:"max_items"` // 每封摘要最多包含的通知数量
+}
+
 var GlobalSettings = new(AppSettings)
 
 func Init() (err error) {
@@ -0,0 +1,172 @@
+package test
+
+import (
+	"bluebell/dao/mysql_repo"
+	"bluebell/dao/redis_repo"
+	"bluebell/logger"
+	"bluebell/logic"
+	"bluebell/models"
+	"bluebell/pkg/jwtkeys"
+	"bluebell/pkg/oidc/oidctest"
+	"bluebell/pkg/snowflake"
+	"bluebell/pkg/sqls"
+	"bluebell/settings"
+	"errors"
+	"github.com/thanhpk/randstr"
+	"sync"
+	"testing"
+)
+
+// 第三方登录的测试使用本地的模拟身份提供方，MySQL和Redis使用config.yaml中的配置，连接不上时跳过
+
+const oidcTestProvider = "mock"
+
+var (
+	oidcSetupOnce sync.Once
+	oidcSetupErr  error
+	oidcServer    *oidctest.Server
+)
+
+func setupOidc(t *testing.T) *oidctest.Server {
+	t.Helper()
+	oidcSetupOnce.Do(func() {
+		if oidcSetupErr = settings.Init(); oidcSetupErr != nil {
+			return
+		}
+		if oidcSetupErr = logger.Init(settings.GlobalSettings.LogCfg, settings.GlobalSettings.AppCfg.Mode); oidcSetupErr != nil {
+			return
+		}
+		if oidcSetupErr = mysql_repo.InitDB(settings.GlobalSettings.MysqlCfg); oidcSetupErr != nil {
+			return
+		}
+		if oidcSetupErr = snowflake.Init(settings.GlobalSettings.AppCfg.StartTime, settings.GlobalSettings.AppCfg.MachineID); oidcSetupErr != nil {
+			return
+		}
+		if oidcSetupErr = jwtkeys.Init(settings.GlobalSettings.TokenCfg); oidcSetupErr != nil {
+			return
+		}
+		if oidcSetupErr = redis_repo.Init(settings.GlobalSettings.RedisCfg); oidcSetupErr != nil {
+			return
+		}
+		// 身份提供方在第一次使用时初始化，整个测试过程中使用同一个模拟服务
+		oidcServer = oidctest.NewServer("bluebell", "bluebell-secret")
+		settings.GlobalSettings.OidcCfg = &settings.OidcConfig{Providers: []settings.OidcProviderConfig{{
+			Name:         oidcTestProvider,
+			Issuer:       oidcServer.Issuer(),
+			ClientId:     "bluebell",
+			ClientSecret: "bluebell-secret",
+			RedirectURL:  "http://localhost:8080/oauth/callback",
+		}}}
+	})
+	if oidcSetupErr != nil {
+		t.Skipf("test environment is not available: %v", oidcSetupErr)
+	}
+	return oidcServer
+}
+
+// oidcCallback 发起授权并以user的身份在模拟身份提供方完成登录，返回前端回调时携带的参数
+func oidcCallback(t *testing.T, server *oidctest.Server, userId int64, user oidctest.User) *models.ParamOidcCallback {
+	t.Helper()
+	server.SetUser(user)
+	res, err := logic.StartOidcAuthorization(oidcTestProvider, userId, nil)
+	if err != nil {
+		t.Fatalf("StartOidcAuthorization: %v", err)
+	}
+	code, state, err := server.Authorize(res.AuthorizationURL)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	return &models.ParamOidcCallback{Code: code, State: state}
+}
+
+func createTestUser(t *testing.T, email string, verified bool) *models.User {
+	t.Helper()
+	u := &models.User{
+		UserId:   snowflake.GenID(),
+		Username: "t" + randstr.Hex(10),
+		Email:    email,
+		Verified: verified,
+	}
+	if err := mysql_repo.UserRepository.Create(sqls.DB(), u); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return u
+}
+
+func newOidcUser() oidctest.User {
+	return oidctest.User{Subject: randstr.Hex(16), Email: randstr.Hex(8) + "@example.com", EmailVerified: true}
+}
+
+func TestOidcStateMismatch(t *testing.T) {
+	server := setupOidc(t)
+
+	param := oidcCallback(t, server, 0, newOidcUser())
+	forged := &models.ParamOidcCallback{Code: param.Code, State: randstr.Hex(16)}
+	if _, err := logic.OidcSignIn(oidcTestProvider, forged); !errors.Is(err, logic.ERROR_INVALID_OIDC_STATE) {
+		t.Fatalf("sign in with an unknown state: err = %v, want %v", err, logic.ERROR_INVALID_OIDC_STATE)
+	}
+
+	// 未登录时发起的授权不能用来给已登录的用户绑定，反过来也一样
+	u := createTestUser(t, "", false)
+	if err := logic.LinkOidcIdentity(u.UserId, oidcTestProvider, param); !errors.Is(err, logic.ERROR_INVALID_OIDC_STATE) {
+		t.Fatalf("link with a sign in state: err = %v, want %v", err, logic.ERROR_INVALID_OIDC_STATE)
+	}
+	param = oidcCallback(t, server, u.UserId, newOidcUser())
+	if _, err := logic.OidcSignIn(oidcTestProvider, param); !errors.Is(err, logic.ERROR_INVALID_OIDC_STATE) {
+		t.Fatalf("sign in with a link state: err = %v, want %v", err, logic.ERROR_INVALID_OIDC_STATE)
+	}
+
+	// state只能使用一次
+	param = oidcCallback(t, server, 0, newOidcUser())
+	if _, err := logic.OidcSignIn(oidcTestProvider, param); err != nil {
+		t.Fatalf("OidcSignIn: %v", err)
+	}
+	if _, err := logic.OidcSignIn(oidcTestProvider, param); !errors.Is(err, logic.ERROR_INVALID_OIDC_STATE) {
+		t.Fatalf("sign in with a used state: err = %v, want %v", err, logic.ERROR_INVALID_OIDC_STATE)
+	}
+}
+
+func TestOidcSignInLinksVerifiedEmail(t *testing.T) {
+	server := setupOidc(t)
+
+	oidcUser := newOidcUser()
+	u := createTestUser(t, oidcUser.Email, true)
+	if _, err := logic.OidcSignIn(oidcTestProvider, oidcCallback(t, server, 0, oidcUser)); err != nil {
+		t.Fatalf("OidcSignIn: %v", err)
+	}
+	identity := mysql_repo.UserIdentityRepository.GetBySubject(sqls.DB(), oidcTestProvider, oidcUser.Subject)
+	if identity == nil || identity.UserId != u.UserId {
+		t.Fatalf("identity = %+v, want linked to user %d", identity, u.UserId)
+	}
+
+	// 本地账号的邮箱没有验证过时不能自动关联
+	oidcUser = newOidcUser()
+	createTestUser(t, oidcUser.Email, false)
+	if _, err := logic.OidcSignIn(oidcTestProvider, oidcCallback(t, server, 0, oidcUser)); !errors.Is(err, logic.ERROR_OIDC_EMAIL_CONFLICT) {
+		t.Fatalf("sign in with an unverified local email: err = %v, want %v", err, logic.ERROR_OIDC_EMAIL_CONFLICT)
+	}
+}
+
+func TestOidcLinkIdentity(t *testing.T) {
+	server := setupOidc(t)
+
+	oidcUser := newOidcUser()
+	u := createTestUser(t, "", false)
+	if err := logic.LinkOidcIdentity(u.UserId, oidcTestProvider, oidcCallback(t, server, u.UserId, oidcUser)); err != nil {
+		t.Fatalf("LinkOidcIdentity: %v", err)
+	}
+	identity := mysql_repo.UserIdentityRepository.GetBySubject(sqls.DB(), oidcTestProvider, oidcUser.Subject)
+	if identity == nil || identity.UserId != u.UserId {
+		t.Fatalf("identity = %+v, want linked to user %d", identity, u.UserId)
+	}
+
+	// 绑定以后使用第三方账号登录的是同一个账号
+	if _, err := logic.OidcSignIn(oidcTestProvider, oidcCallback(t, server, 0, oidcUser)); err != nil {
+		t.Fatalf("OidcSignIn: %v", err)
+	}
+
+	other := createTestUser(t, "", false)
+	if err := logic.LinkOidcIdentity(other.UserId, oidcTestProvider, oidcCallback(t, server, other.UserId, oidcUser)); !errors.Is(err, logic.ERROR_IDENTITY_LINKED) {
+		t.Fatalf("link an identity of another user: err = %v, want %v", err, logic.ERROR_IDENTITY_LINKED)
+	}
+}